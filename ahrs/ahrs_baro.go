@@ -0,0 +1,262 @@
+/*
+BaroFilter runs alongside an AHRSProvider to estimate pressure altitude and vertical speed.
+It is a small Kalman filter over altitude, vertical speed and vertical accelerometer bias.
+The vertical acceleration comes from the AHRSProvider's G load and attitude and drives the prediction.
+The barometric pressure, and the GPS vertical speed W3 when it's valid, then correct it.
+The accelerometer keeps the vertical speed responsive and the baro keeps the altitude from drifting.
+Its outputs are in the units the GDL90 AHRS messages want, so they can be handed straight to
+gdl90.WithPressureAltitude and gdl90.WithVerticalSpeed.
+*/
+package ahrs
+
+import (
+	"log"
+	"math"
+
+	"github.com/westphae/goflying"
+	"github.com/westphae/goflying/altimeter"
+)
+
+const (
+	ftPerKt = 1.687810 // Feet per second in one knot
+
+	baroAltitudeNoiseDefault  = 10.0  // Baro altitude noise, ft
+	baroGPSVSNoiseDefault     = 2.0   // GPS vertical speed noise, kt
+	baroAccelNoiseDefault     = 0.05  // Vertical acceleration noise, G
+	baroAccelBiasDriftDefault = 0.001 // Vertical acceleration bias drift, G/√s
+
+	baroInitialVSNoise   = 10.0 // Initial vertical speed uncertainty without GPS, ft/s
+	baroInitialBiasNoise = 0.05 // Initial vertical acceleration bias uncertainty, G
+)
+
+// BaroFilter holds the vertical state: pressure altitude, vertical speed and vertical accelerometer bias.
+type BaroFilter struct {
+	Z, V, C float64       // Pressure altitude, ft; vertical speed, ft/s; vertical acceleration bias, ft/s²
+	a       float64       // Vertical acceleration from the AHRSProvider, ft/s²
+	p       [3][3]float64 // Covariance of Z, V, C
+	T       float64       // Time of last prediction
+	tP, tW  float64       // Times of last baro and GPS updates
+
+	altitudeNoise  float64 // Baro altitude noise, ft
+	gpsVSNoise     float64 // GPS vertical speed noise, kt
+	accelNoise     float64 // Vertical acceleration noise, G
+	accelBiasDrift float64 // Vertical acceleration bias drift, G/√s
+
+	needsInitialization bool
+	logMap              map[string]interface{}
+}
+
+// NewBaroFilter returns a new BaroFilter, which initializes itself on the first valid baro reading.
+func NewBaroFilter() (f *BaroFilter) {
+	f = new(BaroFilter)
+	f.needsInitialization = true
+	f.altitudeNoise = baroAltitudeNoiseDefault
+	f.gpsVSNoise = baroGPSVSNoiseDefault
+	f.accelNoise = baroAccelNoiseDefault
+	f.accelBiasDrift = baroAccelBiasDriftDefault
+	f.logMap = make(map[string]interface{})
+	return
+}
+
+// init puts the filter into a known state from the baro reading in m.
+func (f *BaroFilter) init(m *Measurement) {
+	f.needsInitialization = false
+	f.T, f.tP, f.tW = m.T, m.TP, m.TW
+
+	f.Z, f.V, f.C, f.a = pressureAltitude(m.P), 0, 0, 0
+	f.p = [3][3]float64{}
+	f.p[0][0] = f.altitudeNoise * f.altitudeNoise
+	f.p[1][1] = baroInitialVSNoise * baroInitialVSNoise
+	if m.WValid {
+		f.V = m.W3 * ftPerKt
+		f.p[1][1] = f.gpsVSNoise * ftPerKt * f.gpsVSNoise * ftPerKt
+	}
+	f.p[2][2] = baroInitialBiasNoise * G * ftPerKt * baroInitialBiasNoise * G * ftPerKt
+
+	f.updateLogMap(m, f.logMap)
+}
+
+// Compute predicts the vertical state forward to m.T using the vertical acceleration from p,
+// then updates it with any new baro and GPS readings in m.
+// p may be nil, in which case the filter runs on the baro and GPS alone.
+func (f *BaroFilter) Compute(m *Measurement, p AHRSProvider) {
+	if f.needsInitialization {
+		if m.PValid {
+			f.init(m)
+		}
+		return
+	}
+
+	dt := m.T - f.T
+	if dt > maxDT || (!m.PValid && m.T-f.tP > maxDT) {
+		log.Printf("BaroFilter Info: Reinitializing at %f\n", m.T)
+		f.needsInitialization = true
+		f.Compute(m, p)
+		return
+	}
+	if dt < minDT {
+		return
+	}
+
+	f.predict(dt, f.verticalAcceleration(p))
+	if m.PValid && m.TP-f.tP > minDT {
+		f.update([3]float64{1, 0, 0}, pressureAltitude(m.P)-f.Z, f.altitudeNoise*f.altitudeNoise)
+		f.tP = m.TP
+	}
+	if m.WValid && m.TW-f.tW > minDT {
+		r := f.gpsVSNoise * ftPerKt
+		f.update([3]float64{0, 1, 0}, m.W3*ftPerKt-f.V, r*r)
+		f.tW = m.TW
+	}
+
+	f.updateLogMap(m, f.logMap)
+}
+
+// verticalAcceleration returns the earth-frame vertical acceleration, ft/s², implied by p's G load and attitude.
+// The G load is along the aircraft's axis 3, so this neglects the small contribution of the
+// longitudinal and lateral accelerations when pitched or banked.
+func (f *BaroFilter) verticalAcceleration(p AHRSProvider) float64 {
+	if p == nil || !p.Valid() {
+		return 0
+	}
+	roll, pitch, _ := p.RollPitchHeading()
+	a := (p.GLoad()*math.Cos(roll)*math.Cos(pitch) - 1) * G * ftPerKt
+	if math.IsNaN(a) || math.IsInf(a, 0) {
+		return 0
+	}
+	return a
+}
+
+// predict propagates the state and its covariance over dt with the vertical acceleration a, ft/s².
+func (f *BaroFilter) predict(dt, a float64) {
+	f.a = a
+	f.Z += f.V*dt + (a-f.C)*dt*dt/2
+	f.V += (a - f.C) * dt
+	f.T += dt
+
+	phi := [3][3]float64{
+		{1, dt, -dt * dt / 2},
+		{0, 1, -dt},
+		{0, 0, 1},
+	}
+	var fp, p [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				fp[i][j] += phi[i][k] * f.p[k][j]
+			}
+		}
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				p[i][j] += fp[i][k] * phi[j][k]
+			}
+		}
+	}
+
+	qa := f.accelNoise * G * ftPerKt
+	qa *= qa
+	qc := f.accelBiasDrift * G * ftPerKt
+	p[0][0] += qa * dt * dt * dt * dt / 4
+	p[0][1] += qa * dt * dt * dt / 2
+	p[1][0] += qa * dt * dt * dt / 2
+	p[1][1] += qa * dt * dt
+	p[2][2] += qc * qc * dt
+	f.p = p
+}
+
+// update corrects the state with a scalar measurement having residual y, variance r and Jacobian h.
+func (f *BaroFilter) update(h [3]float64, y, r float64) {
+	var ph [3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			ph[i] += f.p[i][j] * h[j]
+		}
+	}
+	ss := r
+	for i := 0; i < 3; i++ {
+		ss += h[i] * ph[i]
+	}
+
+	var k [3]float64
+	for i := 0; i < 3; i++ {
+		k[i] = ph[i] / ss
+	}
+	f.Z += k[0] * y
+	f.V += k[1] * y
+	f.C += k[2] * y
+
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			f.p[i][j] -= k[i] * ph[j]
+		}
+	}
+}
+
+// Valid returns whether the filter has been initialized from a baro reading.
+func (f *BaroFilter) Valid() bool {
+	return !f.needsInitialization
+}
+
+// PressureAltitude returns the smoothed pressure altitude in feet, or NaN if it isn't available.
+func (f *BaroFilter) PressureAltitude() float64 {
+	if !f.Valid() {
+		return math.NaN()
+	}
+	return f.Z
+}
+
+// VerticalSpeed returns the smoothed vertical speed in feet per minute, or NaN if it isn't available.
+func (f *BaroFilter) VerticalSpeed() float64 {
+	if !f.Valid() {
+		return math.NaN()
+	}
+	return f.V * 60
+}
+
+// Reset restarts the filter from scratch.
+func (f *BaroFilter) Reset() {
+	f.needsInitialization = true
+}
+
+// SetConfig lets the user alter some of the configuration settings.
+func (f *BaroFilter) SetConfig(configMap map[string]float64) {
+	if v, ok := configMap["altitudeNoise"]; ok && v > 0 {
+		f.altitudeNoise = v
+	}
+	if v, ok := configMap["gpsVSNoise"]; ok && v > 0 {
+		f.gpsVSNoise = v
+	}
+	if v, ok := configMap["accelNoise"]; ok && v > 0 {
+		f.accelNoise = v
+	}
+	if v, ok := configMap["accelBiasDrift"]; ok && v > 0 {
+		f.accelBiasDrift = v
+	}
+}
+
+// GetLogMap returns a map providing current vertical state and measurement values for analysis.
+func (f *BaroFilter) GetLogMap() (p map[string]interface{}) {
+	return f.logMap
+}
+
+func (f *BaroFilter) updateLogMap(m *Measurement, p map[string]interface{}) {
+	p["TPa"] = f.T
+	p["Z"] = f.Z
+	p["VS"] = f.V * 60
+	p["AZ"] = f.a
+	p["CZ"] = f.C
+	p["dZ"] = math.Sqrt(f.p[0][0])
+	p["dVS"] = math.Sqrt(f.p[1][1]) * 60
+	p["P"] = m.P
+	p["PValid"] = 0.0
+	if m.PValid {
+		p["PValid"] = 1.0
+	}
+}
+
+// pressureAltitude returns the pressure altitude, ft, for the static pressure p, hPa.
+func pressureAltitude(p float64) float64 {
+	return float64(altimeter.PressureAltitude(goflying.HPa(p)))
+}
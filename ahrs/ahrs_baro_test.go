@@ -0,0 +1,135 @@
+package ahrs
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// gLoadProvider is an AHRSProvider reporting a fixed attitude and whatever G load the test sets.
+type gLoadProvider struct {
+	State
+}
+
+func (s *gLoadProvider) Compute(m *Measurement) {}
+
+// pressureAt returns the static pressure, hPa, at pressure altitude z, ft.
+func pressureAt(z float64) float64 {
+	return 1013.25 * math.Pow(1-z/145442.16, 1/0.190263)
+}
+
+func TestPressureAltitude(t *testing.T) {
+	for _, z := range []float64{-1000, 0, 5000, 18000, 35000} {
+		if got := pressureAltitude(pressureAt(z)); math.Abs(got-z) > 1e-6 {
+			t.Errorf("pressureAltitude(pressureAt(%f)) = %f", z, got)
+		}
+	}
+	if got := pressureAltitude(1013.25); got != 0 {
+		t.Errorf("pressureAltitude(1013.25) = %f, want 0", got)
+	}
+}
+
+func TestBaroFilterClimb(t *testing.T) {
+	tests := []struct {
+		name      string
+		accel     bool    // Use the vertical acceleration from the AHRSProvider
+		gps       bool    // Use the GPS vertical speed
+		bias      float64 // Vertical accelerometer bias, G
+		vsLagTol  float64 // Vertical speed tolerance just after the pull-up, ft/min
+		vsTol     float64 // Steady climb vertical speed tolerance, ft/min
+		altTol    float64 // Steady climb altitude tolerance, ft
+		wantValid bool
+	}{
+		{"baro only", false, false, 0, 800, 100, 10, true},
+		{"baro and GPS", false, true, 0, 800, 60, 10, true},
+		{"baro and accel", true, false, 0.02, 150, 60, 10, true},
+		{"baro, accel and GPS", true, true, 0.02, 150, 40, 10, true},
+	}
+
+	const (
+		dt     = 0.02
+		z0     = 2500.0 // Initial altitude, ft
+		pullUp = 8.0    // Vertical acceleration during the pull-up, ft/s²
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(1))
+			f := NewBaroFilter()
+			if !math.IsNaN(f.PressureAltitude()) || !math.IsNaN(f.VerticalSpeed()) {
+				t.Fatalf("uninitialized filter should return NaN")
+			}
+
+			p := &gLoadProvider{}
+			p.E0 = 1 // Level
+			var provider AHRSProvider
+			if tt.accel {
+				provider = p
+			}
+
+			z, v := z0, 0.0
+			for i := 0; i <= 3000; i++ {
+				tm := float64(i) * dt
+				a := 0.0
+				if tm > 10 && tm <= 12 { // Pull up into a climb
+					a = pullUp
+				}
+				z += v*dt + a*dt*dt/2
+				v += a * dt
+				p.gLoad = 1 + a/(G*ftPerKt) + tt.bias
+
+				m := NewMeasurement()
+				m.T = tm
+				if i%5 == 0 {
+					m.PValid, m.TP = true, tm
+					m.P = pressureAt(z + 10*rnd.NormFloat64())
+				}
+				if tt.gps && i%50 == 0 {
+					m.WValid, m.TW = true, tm
+					m.W3 = v/ftPerKt + 1*rnd.NormFloat64()
+				}
+				f.Compute(m, provider)
+
+				if i == 625 { // 0.5 s after the pull-up
+					if vs := f.VerticalSpeed(); math.Abs(vs-v*60) > tt.vsLagTol {
+						t.Errorf("vertical speed after pull-up = %f, want %f", vs, v*60)
+					}
+				}
+			}
+
+			if f.Valid() != tt.wantValid {
+				t.Fatalf("Valid() = %t, want %t", f.Valid(), tt.wantValid)
+			}
+			if alt := f.PressureAltitude(); math.Abs(alt-z) > tt.altTol {
+				t.Errorf("pressure altitude = %f, want %f", alt, z)
+			}
+			if vs := f.VerticalSpeed(); math.Abs(vs-v*60) > tt.vsTol {
+				t.Errorf("vertical speed = %f, want %f", vs, v*60)
+			}
+			if tt.accel {
+				if c := f.C / (G * ftPerKt); math.Abs(c-tt.bias) > 0.005 {
+					t.Errorf("vertical acceleration bias = %f G, want %f G", c, tt.bias)
+				}
+			}
+		})
+	}
+}
+
+func TestBaroFilterStale(t *testing.T) {
+	f := NewBaroFilter()
+	m := NewMeasurement()
+	m.T, m.TP, m.PValid, m.P = 0, 0, true, pressureAt(1000)
+	f.Compute(m, nil)
+	if !f.Valid() {
+		t.Fatalf("Valid() = false after a baro reading")
+	}
+
+	m = NewMeasurement()
+	for _, tm := range []float64{1, 5, maxDT + 1} {
+		m.T = tm
+		f.Compute(m, nil)
+	}
+	if f.Valid() {
+		t.Errorf("Valid() = true after %f s without baro", maxDT+1)
+	}
+}
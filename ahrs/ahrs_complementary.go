@@ -0,0 +1,186 @@
+/*
+The complementary-filter AHRS algorithms, Madgwick and Mahony, are lightweight alternatives to the Kalman
+filters for low-CPU devices.  They integrate the gyro rates into the attitude quaternion E and continuously
+steer it toward the gravity direction measured by the accelerometer and, when Measurement.MValid is set,
+toward magnetic north as measured by the magnetometer.  Without the magnetometer they are IMU-only and
+the heading is just the integrated gyro rate, so it is reported as Invalid.
+
+They use no GPS or airspeed data, so they give a baseline to compare the GPS-aided algorithms against.
+The accelerometer reads -1 G along axis 3 in level flight, as for KalmanState and the simulator.
+*/
+package ahrs
+
+import (
+	"math"
+
+	"github.com/skelterjohn/go.matrix"
+)
+
+// complementaryState holds what the Madgwick and Mahony algorithms have in common.
+type complementaryState struct {
+	State
+	magValid bool // Whether the last update used the magnetometer, so heading is referenced to magnetic north
+}
+
+func newComplementaryState() (s complementaryState) {
+	s.needsInitialization = true
+	s.aNorm = 1
+	s.E0 = 1 // Initial guess is East
+	s.F0 = 1 // Initial guess is that it's oriented pointing forward and level
+	s.normalize()
+	s.M = matrix.Zeros(32, 32)
+	s.N = matrix.Zeros(32, 32)
+	s.logMap = make(map[string]interface{})
+	s.gLoad = 1
+	return
+}
+
+// init sets roll and pitch from the accelerometer and heading from the magnetometer, if available.
+func (s *complementaryState) init(m *Measurement) {
+	s.State.init(m)
+
+	_, a, mag, aOK, mOK := s.sensorVectors(m)
+	if aOK {
+		s.roll, s.pitch = rollPitchFromAccel(a[0], a[1], a[2])
+	}
+	s.heading = Pi / 2 // East, as for the identity quaternion
+	s.magValid = mOK
+	if mOK {
+		s.heading = levelMagHeading(s.roll, s.pitch, mag[0], mag[1], mag[2])
+		s.headingMag = s.heading
+	}
+	s.roll, s.pitch, s.heading = Regularize(s.roll, s.pitch, s.heading)
+	s.E0, s.E1, s.E2, s.E3 = ToQuaternion(s.roll, s.pitch, s.heading)
+	s.normalize()
+
+	s.H1, s.H2, s.H3 = 0, 0, 0
+	s.slipSkid, s.turnRate, s.gLoad = 0, 0, 1
+}
+
+// sensorVectors returns the gyro rates b, Rad/s, and the unit accelerometer and magnetometer vectors a and mag,
+// all in the aircraft frame.  aOK and mOK report whether a and mag are usable.
+func (s *complementaryState) sensorVectors(m *Measurement) (b, a, mag [3]float64, aOK, mOK bool) {
+	if m.SValid {
+		b[0], b[1], b[2] = s.rotateByF(m.B1-s.D1, m.B2-s.D2, m.B3-s.D3, false)
+		for i := range b {
+			b[i] *= Deg
+		}
+
+		a[0], a[1], a[2] = s.rotateByF(m.A1-s.C1, m.A2-s.C2, m.A3-s.C3, false)
+		if u, err := MakeUnitVector(a); err == nil {
+			a, aOK = *u, true
+		}
+	}
+
+	if m.MValid {
+		mag[0], mag[1], mag[2] = s.rotateByF(s.K1*m.M1+s.L1, s.K2*m.M2+s.L2, s.K3*m.M3+s.L3, false)
+		if u, err := MakeUnitVector(mag); err == nil {
+			mag, mOK = *u, true
+		}
+	}
+	return
+}
+
+// magReference returns magnetic north in the earth frame, as measured by the unit magnetometer vector mag,
+// with its horizontal component rotated onto the north axis.
+func (s *complementaryState) magReference(mag [3]float64) (n1, n2, n3 float64) {
+	h1, h2, h3 := s.rotateByE(mag[0], mag[1], mag[2], false)
+	return 0, math.Hypot(h1, h2), h3
+}
+
+// calcDerived updates the attitude, magnetic heading, slip/skid, rate of turn
+// and G load reported to the user from the current state, measurement and gyro rates b, Rad/s.
+func (s *complementaryState) calcDerived(m *Measurement, b [3]float64) {
+	s.roll, s.pitch, s.heading = FromQuaternion(s.E0, s.E1, s.E2, s.E3)
+	if s.magValid {
+		s.headingMag = s.heading
+	}
+
+	s.H1, s.H2, s.H3 = s.rotateByE(b[0]/Deg, b[1]/Deg, b[2]/Deg, false)
+	// H is in the earth frame, so -H3 is the rate of turn to the right
+	s.turnRate += slowSmoothConst * (-s.H3*Deg - s.turnRate)
+
+	if m.SValid {
+		_, a2, a3 := s.rotateByF(m.A1-s.C1, m.A2-s.C2, m.A3-s.C3, false)
+		s.slipSkid += slowSmoothConst * (math.Atan2(a2, -a3) - s.slipSkid)
+		s.gLoad += slowSmoothConst * (-a3/s.aNorm - s.gLoad)
+	}
+}
+
+// RollPitchHeading returns the current attitude values as estimated by the complementary filter.
+// Heading is magnetic, and Invalid when the magnetometer isn't being used.
+func (s *complementaryState) RollPitchHeading() (roll float64, pitch float64, heading float64) {
+	roll, pitch, heading = s.State.RollPitchHeading()
+	if !s.magValid {
+		heading = Invalid
+	}
+	return
+}
+
+// HeadingMagnetic returns true, since the heading is steered toward magnetic north.
+func (s *complementaryState) HeadingMagnetic() bool {
+	return true
+}
+
+// MagHeading returns the magnetic heading in degrees, or Invalid when the magnetometer isn't being used.
+func (s *complementaryState) MagHeading() (hdg float64) {
+	if !s.magValid {
+		return Invalid
+	}
+	return s.State.MagHeading()
+}
+
+func (s *complementaryState) updateLogMap(m *Measurement, p map[string]interface{}) {
+	s.State.updateLogMap(m, p)
+	p["magValid"] = 0.0
+	if s.magValid {
+		p["magValid"] = 1.0
+	}
+}
+
+// rollPitchFromAccel returns the roll and pitch, Rad, for which gravity would give the aircraft-frame
+// accelerometer reading a1, a2, a3.
+func rollPitchFromAccel(a1, a2, a3 float64) (roll, pitch float64) {
+	roll = math.Atan2(-a2, -a3)
+	pitch = math.Asin(math.Max(-1, math.Min(1, -a1/math.Sqrt(a1*a1+a2*a2+a3*a3))))
+	return
+}
+
+// levelMagHeading returns the magnetic heading, Rad, for the aircraft-frame magnetometer reading m1, m2, m3
+// at the given roll and pitch, Rad.
+func levelMagHeading(roll, pitch, m1, m2, m3 float64) (heading float64) {
+	// Rotate the reading into a level frame with the nose pointing north
+	r := QuaternionToRotationMatrix(ToQuaternion(roll, pitch, 0))
+	me1 := r[0][0]*m1 + r[0][1]*m2 + r[0][2]*m3
+	me2 := r[1][0]*m1 + r[1][1]*m2 + r[1][2]*m3
+	_, _, heading = Regularize(0, 0, -math.Atan2(me1, me2))
+	return
+}
+
+var ComplementaryJSONConfig = `{
+  "State": [
+    ["Roll", "RollActual", 0],
+    ["Pitch", "PitchActual", 0],
+    ["Heading", "HeadingActual", null],
+    ["headingMag", null, null],
+    ["turnRate", "turnRateActual", 0],
+    ["gLoad", "gLoadActual", 1],
+    ["slipSkid", "slipSkidActual", 0],
+    ["T", null, null],
+    ["E0", "E0Actual", null],
+    ["E1", "E1Actual", null],
+    ["E2", "E2Actual", null],
+    ["E3", "E3Actual", null]
+  ],
+  "Measurement": [
+    ["A1", null, 0],
+    ["A2", null, 0],
+    ["A3", null, 0],
+    ["B1", null, 0],
+    ["B2", null, 0],
+    ["B3", null, 0],
+    ["M1", null, 0],
+    ["M2", null, 0],
+    ["M3", null, 0]
+  ]
+}`
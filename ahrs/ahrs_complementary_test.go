@@ -0,0 +1,137 @@
+package ahrs
+
+import (
+	"math"
+	"testing"
+)
+
+// complementaryMeasurement returns a measurement for an aircraft with attitude quaternion e0..e3 rotating at
+// aircraft-frame rates b (°/s) with gyro bias d, in an earth magnetic field pointing north and down.
+func complementaryMeasurement(t float64, e0, e1, e2, e3 float64, b, d [3]float64, mValid bool) *Measurement {
+	n := [3]float64{0, 20, -40}
+	r := QuaternionToRotationMatrix(e0, e1, e2, e3)
+	m := eskfMeasurement(t, e0, e1, e2, e3, b, d, [3]float64{}, false)
+	m.MValid = mValid
+	m.M1 = r[0][0]*n[0] + r[1][0]*n[1] + r[2][0]*n[2]
+	m.M2 = r[0][1]*n[0] + r[1][1]*n[1] + r[2][1]*n[2]
+	m.M3 = r[0][2]*n[0] + r[1][2]*n[1] + r[2][2]*n[2]
+	return m
+}
+
+func TestComplementarySteadyAttitude(t *testing.T) {
+	tests := []struct {
+		algo   string
+		mValid bool
+	}{
+		{"madgwick", true},
+		{"madgwick", false},
+		{"mahony", true},
+		{"mahony", false},
+	}
+
+	for _, tt := range tests {
+		name := tt.algo + " IMU"
+		if tt.mValid {
+			name = tt.algo + " MARG"
+		}
+		t.Run(name, func(t *testing.T) {
+			s, err := NewAHRS(tt.algo, nil)
+			if err != nil {
+				t.Fatalf("NewAHRS() error = %v", err)
+			}
+			// Start from a wrong attitude estimate, then converge on the true one
+			e0, e1, e2, e3 := ToQuaternion(0, 0, 0)
+			s.Compute(complementaryMeasurement(0, e0, e1, e2, e3, [3]float64{}, [3]float64{}, tt.mValid))
+			e0, e1, e2, e3 = ToQuaternion(25*Deg, -10*Deg, 140*Deg)
+			for i := 1; i < 12000; i++ {
+				s.Compute(complementaryMeasurement(float64(i)*0.02, e0, e1, e2, e3, [3]float64{}, [3]float64{}, tt.mValid))
+			}
+
+			roll, pitch, heading := s.RollPitchHeading()
+			if math.Abs(roll/Deg-25) > 0.5 || math.Abs(pitch/Deg+10) > 0.5 {
+				t.Errorf("roll, pitch = %f, %f, want 25, -10", roll/Deg, pitch/Deg)
+			}
+			if tt.mValid {
+				if math.Abs(AngleDiff(heading, 140*Deg)/Deg) > 0.5 {
+					t.Errorf("heading = %f, want 140", heading/Deg)
+				}
+				if hdg := s.MagHeading(); math.Abs(AngleDiff(hdg*Deg, 140*Deg)/Deg) > 0.5 {
+					t.Errorf("MagHeading() = %f, want 140", hdg)
+				}
+			} else if heading != Invalid {
+				t.Errorf("heading without magnetometer = %f, want Invalid", heading)
+			}
+		})
+	}
+}
+
+func TestComplementaryRoll(t *testing.T) {
+	for _, algo := range []string{"madgwick", "mahony"} {
+		t.Run(algo, func(t *testing.T) {
+			s, _ := NewAHRS(algo, nil)
+			e0, e1, e2, e3 := ToQuaternion(0, 5*Deg, 30*Deg)
+			b := [3]float64{90, 0, 0} // Roll at 90°/s for one full revolution
+			dt := 0.01
+
+			s.Compute(complementaryMeasurement(0, e0, e1, e2, e3, b, [3]float64{}, true))
+			var maxErr float64
+			for i := 1; i <= 400; i++ {
+				q0, q1, q2, q3 := QuaternionFromRotationVector(b[0]*dt*Deg, b[1]*dt*Deg, b[2]*dt*Deg)
+				e0, e1, e2, e3 = QuaternionMultiply(e0, e1, e2, e3, q0, q1, q2, q3)
+				s.Compute(complementaryMeasurement(float64(i)*dt, e0, e1, e2, e3, b, [3]float64{}, true))
+
+				roll, pitch, _ := s.RollPitchHeading()
+				wantRoll, wantPitch, _ := FromQuaternion(e0, e1, e2, e3)
+				maxErr = math.Max(maxErr, math.Abs(AngleDiff(roll, wantRoll)))
+				maxErr = math.Max(maxErr, math.Abs(AngleDiff(pitch, wantPitch)))
+			}
+			if maxErr > 1*Deg {
+				t.Errorf("max roll/pitch error through a roll = %f°, want < 1°", maxErr/Deg)
+			}
+		})
+	}
+}
+
+func TestMahonyGyroBias(t *testing.T) {
+	s := NewMahonyAHRS()
+	e0, e1, e2, e3 := ToQuaternion(10*Deg, 5*Deg, 300*Deg)
+	d := [3]float64{0.5, -0.3, 0.2}
+	for i := 0; i < 10000; i++ {
+		s.Compute(complementaryMeasurement(float64(i)*0.02, e0, e1, e2, e3, [3]float64{}, d, true))
+	}
+
+	_, dd, _, _ := s.GetCalibrations()
+	for i := 0; i < 3; i++ {
+		if math.Abs(dd[i]-d[i]) > 0.01 {
+			t.Errorf("gyro bias %d = %f, want %f", i+1, dd[i], d[i])
+		}
+	}
+}
+
+func TestMadgwickGradient(t *testing.T) {
+	s := NewMadgwickAHRS()
+	s.E0, s.E1, s.E2, s.E3 = ToQuaternion(20*Deg, -10*Deg, 70*Deg)
+	s.normalize()
+	v := [3]float64{0.3, 0.5, -0.8}
+	u := [3]float64{0.1, -0.6, -0.79}
+
+	cost := func(q [4]float64) float64 {
+		z := *s
+		z.E0, z.E1, z.E2, z.E3 = q[0], q[1], q[2], q[3]
+		z.calcRotationMatrices()
+		f1, f2, f3 := z.rotateByE(v[0], v[1], v[2], true)
+		f1, f2, f3 = f1-u[0], f2-u[1], f3-u[2]
+		return (f1*f1 + f2*f2 + f3*f3) / 2
+	}
+
+	var got [4]float64
+	got[0], got[1], got[2], got[3] = s.gradientStep(v[0], v[1], v[2], u)
+	q := [4]float64{s.E0, s.E1, s.E2, s.E3}
+	for i := 0; i < 4; i++ {
+		dq := q
+		dq[i] += 1e-7
+		if want := (cost(dq) - cost(q)) / 1e-7; math.Abs(got[i]-want) > 1e-4 {
+			t.Errorf("gradient %d = %f, want %f", i, got[i], want)
+		}
+	}
+}
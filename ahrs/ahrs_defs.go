@@ -54,6 +54,13 @@ type AHRSProvider interface {
 	GetLogMap() map[string]interface{}
 }
 
+// MagneticHeadingProvider is implemented by AHRSProviders whose RollPitchHeading heading can be referenced
+// to magnetic rather than true north.
+type MagneticHeadingProvider interface {
+	// HeadingMagnetic returns whether the heading is magnetic.
+	HeadingMagnetic() bool
+}
+
 // Measurement holds the measurements used for updating the Kalman filter:
 // true airspeed, groundspeed, accelerations, gyro rates, magnetometer, time;
 // along with variance accumulators and uncertainty matrix.
@@ -61,13 +68,16 @@ type AHRSProvider interface {
 // until appropriate sensors are working.
 type Measurement struct { // Order here also defines order in the matrices below
 	UValid, WValid, SValid, MValid bool // Do we have valid airspeed, GPS, accel/gyro, and magnetometer readings?
+	PValid                         bool // Do we have a valid barometric pressure reading?
 	// U, W, A, B, M
 	U1, U2, U3 float64 // Vector of measured airspeed, kt, aircraft (accelerated) frame
 	W1, W2, W3 float64 // Vector of GPS speed in N/S, E/W and U/D directions, kt, latlong axes, earth (inertial) frame
 	A1, A2, A3 float64 // Vector holding accelerometer readings, G, aircraft (accelerated) frame
 	B1, B2, B3 float64 // Vector of gyro rates in roll, pitch, heading axes, °/s, aircraft (accelerated) frame
 	M1, M2, M3 float64 // Vector of magnetometer readings, µT, aircraft (accelerated) frame
+	P          float64 // Static (barometric) pressure, hPa; not part of the matrices below
 	TW, TU, T  float64 // Timestamp of GPS, airspeed and sensor readings
+	TP         float64 // Timestamp of barometric pressure reading
 	//TODO westphae: track separate measurement timestamps for Gyro/Accel, Magnetometer, GPS, Baro
 
 	Accums [15]func(float64) (float64, float64, float64) // Accumulators to track means & variances of all variables
@@ -0,0 +1,526 @@
+/*
+The error-state (multiplicative) extended Kalman filter keeps the attitude as a unit quaternion E and
+estimates only a small 3-component rotation error δθ in the aircraft frame, along with the gyro bias D and
+the accelerometer bias C.  The quaternion is propagated exactly by the measured gyro rates and each estimated
+error is folded back into E as a rotation, so E never needs to be re-normalized by the filter and the
+linearization stays good through large rotations, where the additive Kalman variants struggle.
+
+E is a quaternion translating from aircraft frame to earth frame (i.e. E_{ea}).
+D is the estimate of the gyro sensor bias, °/s
+C is the estimate of the accelerometer sensor bias, G
+
+Error state
+x = [δθ, δD, δC], with the true attitude E*exp(δθ/2)
+
+Equations of Motion
+E -> E*exp((B-D)*dt/2)
+D -> D
+C -> C
+
+Measurement Predictions
+A = E^-1 * (-up - dW/dt/G) + C  (the same sign convention as KalmanState and the simulator)
+track = heading, when the GPS groundspeed is above minGS
+*/
+package ahrs
+
+import (
+	"log"
+	"math"
+
+	"github.com/skelterjohn/go.matrix"
+)
+
+const (
+	eskfGyroNoiseDefault       = 0.3    // Gyro rate noise, °/s per √Hz
+	eskfGyroBiasDriftDefault   = 0.01   // Random walk of the gyro bias, °/s per √s
+	eskfAccelNoiseDefault      = 0.05   // Accelerometer measurement noise, G
+	eskfAccelBiasDriftDefault  = 0.0005 // Random walk of the accelerometer bias, G per √s
+	eskfHeadingNoiseDefault    = 5.0    // Noise of the GPS track as a measurement of heading, °
+	eskfMaxHeadingUncertainty  = 30.0   // Above this heading uncertainty, °, the heading is reported invalid
+	eskfInitialAttitudeError   = 10.0   // Initial roll and pitch uncertainty, °
+	eskfInitialGyroBiasError   = 1.0    // Initial gyro bias uncertainty, °/s
+	eskfInitialAccelBiasError  = 0.05   // Initial accelerometer bias uncertainty, G
+	eskfInitialHeadingError    = 180.0  // Initial heading uncertainty when not known from the GPS, °
+	eskfInitialGPSHeadingError = 10.0   // Initial heading uncertainty when taken from the GPS track, °
+	eskfErrorStates            = 9      // Size of the error state δθ, δD, δC
+)
+
+func init() {
+	Register(Algorithm{
+		Name:        "eskf",
+		Description: "Error-state (multiplicative) extended Kalman filter with gyro and accelerometer biases",
+		New:         func() AHRSProvider { return NewESKFAHRS() },
+		Config: []ConfigParam{
+			{"gyroNoise", "Gyro rate noise, °/s per √Hz", eskfGyroNoiseDefault, 1e-3, 10},
+			{"gyroBiasDrift", "Random walk of the gyro bias, °/s per √s", eskfGyroBiasDriftDefault, 1e-5, 1},
+			{"accelNoise", "Accelerometer measurement noise, G", eskfAccelNoiseDefault, 1e-3, 1},
+			{"accelBiasDrift", "Random walk of the accelerometer bias, G per √s", eskfAccelBiasDriftDefault, 1e-6, 0.1},
+			{"headingNoise", "Noise of the GPS track as a measurement of heading, °", eskfHeadingNoiseDefault, 0.1, 90},
+		},
+		JSONConfig: ESKFJSONConfig,
+	})
+}
+
+// ESKFState is an error-state (multiplicative) extended Kalman filter for the attitude, gyro bias and
+// accelerometer bias.
+type ESKFState struct {
+	State
+	p                  *matrix.DenseMatrix // Covariance of the error state δθ, δD, δC
+	tW                 float64             // Time of last GPS reading
+	w1, w2, w3, gs     float64             // Last GPS velocity and groundspeed, kt
+	wValid             bool                // Whether w1, w2, w3 hold a GPS reading
+	ae1, ae2, ae3      float64             // Expected accelerometer reading, earth frame, G
+	dHeading           float64             // Heading uncertainty, Rad
+	headingValid       bool                // Whether the heading uncertainty is small enough to report
+	y1, y2, y3, yTrack float64             // Last innovations of accelerometer, G, and track, Rad
+	gyroNoise          float64             // Gyro rate noise, °/s per √Hz
+	gyroBiasDrift      float64             // Random walk of the gyro bias, °/s per √s
+	accelNoise         float64             // Accelerometer measurement noise, G
+	accelBiasDrift     float64             // Random walk of the accelerometer bias, G per √s
+	headingNoise       float64             // Noise of the GPS track as a measurement of heading, °
+}
+
+// NewESKFAHRS returns a new error-state Kalman AHRS object which initializes itself
+// from the first measurement passed to Compute.
+func NewESKFAHRS() (s *ESKFState) {
+	s = new(ESKFState)
+	s.gyroNoise = eskfGyroNoiseDefault
+	s.gyroBiasDrift = eskfGyroBiasDriftDefault
+	s.accelNoise = eskfAccelNoiseDefault
+	s.accelBiasDrift = eskfAccelBiasDriftDefault
+	s.headingNoise = eskfHeadingNoiseDefault
+	s.needsInitialization = true
+	s.aNorm = 1
+	s.E0 = 1 // Initial guess is East
+	s.F0 = 1 // Initial guess is that it's oriented pointing forward and level
+	s.normalize()
+	s.M = matrix.Zeros(32, 32)
+	s.N = matrix.Zeros(32, 32)
+	s.p = matrix.Zeros(eskfErrorStates, eskfErrorStates)
+	s.logMap = make(map[string]interface{})
+	s.updateLogMap(NewMeasurement(), s.logMap)
+
+	s.gLoad = 1
+	return
+}
+
+// init sets roll and pitch from the accelerometer and heading from the GPS track, if available.
+func (s *ESKFState) init(m *Measurement) {
+	s.State.init(m)
+
+	a1, a2, a3 := s.rotateByF(m.A1-s.C1, m.A2-s.C2, m.A3-s.C3, false)
+	if aa := math.Sqrt(a1*a1 + a2*a2 + a3*a3); aa > Small {
+		s.roll = math.Atan2(-a2, -a3)
+		s.pitch = math.Asin(math.Max(-1, math.Min(1, -a1/aa)))
+	}
+
+	s.wValid = m.WValid
+	s.tW = m.TW
+	s.w1, s.w2, s.w3, s.gs = m.W1, m.W2, m.W3, math.Hypot(m.W1, m.W2)
+	s.ae1, s.ae2, s.ae3 = 0, 0, -1
+
+	dHeading := eskfInitialHeadingError * Deg
+	s.heading = Pi / 2 // East, as for the identity quaternion
+	if m.WValid && s.gs > minGS {
+		s.heading = math.Atan2(m.W1, m.W2)
+		dHeading = eskfInitialGPSHeadingError * Deg
+	}
+	s.roll, s.pitch, s.heading = Regularize(s.roll, s.pitch, s.heading)
+	s.E0, s.E1, s.E2, s.E3 = ToQuaternion(s.roll, s.pitch, s.heading)
+	s.normalize()
+
+	da, dd, dc := eskfInitialAttitudeError*Deg, eskfInitialGyroBiasError, eskfInitialAccelBiasError
+	s.p = matrix.Diagonal([]float64{
+		da * da, da * da, da * da,
+		dd * dd, dd * dd, dd * dd,
+		dc * dc, dc * dc, dc * dc,
+	})
+	s.resetHeadingCovariance(dHeading * dHeading)
+
+	s.H1, s.H2, s.H3 = 0, 0, 0
+	s.slipSkid, s.turnRate, s.gLoad = 0, 0, 1
+	s.y1, s.y2, s.y3, s.yTrack = 0, 0, 0, 0
+	s.calcUncertainty()
+
+	s.updateLogMap(m, s.logMap)
+}
+
+// Compute propagates the attitude with the gyro and then corrects it with the accelerometer and GPS.
+func (s *ESKFState) Compute(m *Measurement) {
+	if s.needsInitialization {
+		s.init(m)
+		return
+	}
+
+	dt := m.T - s.T
+	if dt > maxDT {
+		log.Printf("AHRS Info: Reinitializing at %f\n", m.T)
+		s.init(m)
+		return
+	}
+	if dt < minDT {
+		return
+	}
+
+	s.predict(m, dt)
+	if m.WValid && m.TW-s.tW > minDT {
+		s.updateGPS(m)
+	} else if !m.WValid {
+		s.wValid = false
+		s.ae1, s.ae2, s.ae3 = 0, 0, -1
+	}
+	if m.SValid {
+		s.updateAccel(m)
+	}
+	s.calcUncertainty()
+	s.calcDerived(m)
+
+	s.updateLogMap(m, s.logMap)
+}
+
+// predict rotates E by the measured gyro rates over dt and propagates the error covariance.
+func (s *ESKFState) predict(m *Measurement, dt float64) {
+	var b1, b2, b3 float64
+	if m.SValid {
+		b1, b2, b3 = s.rotateByF(m.B1-s.D1, m.B2-s.D2, m.B3-s.D3, false)
+	}
+
+	q0, q1, q2, q3 := QuaternionFromRotationVector(b1*dt*Deg, b2*dt*Deg, b3*dt*Deg)
+	s.E0, s.E1, s.E2, s.E3 = QuaternionMultiply(s.E0, s.E1, s.E2, s.E3, q0, q1, q2, q3)
+	s.normalize()
+	s.H1, s.H2, s.H3 = s.rotateByE(b1, b2, b3, false)
+	s.T = m.T
+
+	// The attitude error rotates backwards by the step, and picks up the error in the gyro bias
+	q0, q1, q2, q3 = QuaternionFromRotationVector(-b1*dt*Deg, -b2*dt*Deg, -b3*dt*Deg)
+	r := QuaternionToRotationMatrix(q0, q1, q2, q3)
+	f := matrix.Eye(eskfErrorStates)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			f.Set(i, j, r[i][j])
+			f.Set(i, 3+j, -s.fSensor(i, j)*dt*Deg)
+		}
+	}
+
+	g, d, c := s.gyroNoise*Deg, s.gyroBiasDrift, s.accelBiasDrift
+	q := matrix.Diagonal([]float64{
+		g * g * dt, g * g * dt, g * g * dt,
+		d * d * dt, d * d * dt, d * d * dt,
+		c * c * dt, c * c * dt, c * c * dt,
+	})
+
+	s.p = matrix.Sum(matrix.Product(f, s.p, f.Transpose()), q)
+}
+
+// updateGPS estimates the earth-frame acceleration from the change in GPS velocity and,
+// when moving, corrects the heading with the GPS track.
+func (s *ESKFState) updateGPS(m *Measurement) {
+	dtw := m.TW - s.tW
+	if s.wValid && dtw < maxDT {
+		s.ae1 = -(m.W1 - s.w1) / dtw / G
+		s.ae2 = -(m.W2 - s.w2) / dtw / G
+		s.ae3 = -1 - (m.W3-s.w3)/dtw/G
+	} else {
+		s.ae1, s.ae2, s.ae3 = 0, 0, -1
+	}
+	s.wValid = true
+	s.tW = m.TW
+	s.w1, s.w2, s.w3, s.gs = m.W1, m.W2, m.W3, math.Hypot(m.W1, m.W2)
+
+	if s.gs <= minGS {
+		return
+	}
+
+	track := math.Atan2(m.W1, m.W2)
+	if !s.headingValid {
+		// Heading is unknown, so jump straight to the track rather than linearizing a large error
+		roll, pitch, _ := FromQuaternion(s.E0, s.E1, s.E2, s.E3)
+		s.E0, s.E1, s.E2, s.E3 = ToQuaternion(roll, pitch, track)
+		s.normalize()
+		dh := eskfInitialGPSHeadingError * Deg
+		s.resetHeadingCovariance(dh * dh)
+	}
+
+	// Nose direction in earth frame, and its change for a rotation error δθ2, δθ3
+	n1, n2 := s.e11, s.e21
+	hh := n1*n1 + n2*n2
+	if hh < 0.01 {
+		return // Nose near vertical: track doesn't tell us the heading
+	}
+	h := matrix.Zeros(1, eskfErrorStates)
+	h.Set(0, 1, -(n2*s.e13-n1*s.e23)/hh)
+	h.Set(0, 2, (n2*s.e12-n1*s.e22)/hh)
+
+	s.yTrack = AngleDiff(track, math.Atan2(n1, n2))
+	y := matrix.MakeDenseMatrix([]float64{s.yTrack}, 1, 1)
+	rr := s.headingNoise * Deg
+	s.update(y, h, matrix.MakeDenseMatrix([]float64{rr * rr}, 1, 1))
+}
+
+// updateAccel corrects roll, pitch and the accelerometer bias with the accelerometer.
+func (s *ESKFState) updateAccel(m *Measurement) {
+	// Expected accelerometer reading in aircraft frame, then sensor frame
+	a1, a2, a3 := s.rotateByE(s.ae1, s.ae2, s.ae3, true)
+	z1, z2, z3 := s.rotateByF(a1, a2, a3, true)
+
+	s.y1 = m.A1 - z1 - s.C1
+	s.y2 = m.A2 - z2 - s.C2
+	s.y3 = m.A3 - z3 - s.C3
+	y := matrix.MakeDenseMatrix([]float64{s.y1, s.y2, s.y3}, 3, 1)
+
+	// Rotation error δθ changes the aircraft-frame reading by a×δθ
+	ax := [3][3]float64{
+		{0, -a3, a2},
+		{a3, 0, -a1},
+		{-a2, a1, 0},
+	}
+	h := matrix.Zeros(3, eskfErrorStates)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			var v float64
+			for k := 0; k < 3; k++ {
+				v += s.fSensor(k, i) * ax[k][j]
+			}
+			h.Set(i, j, v)
+		}
+		h.Set(i, 6+i, 1)
+	}
+
+	// Trust the accelerometer less when it isn't reading what we expect, e.g. in an uncompensated turn
+	mm := math.Sqrt((m.A1-s.C1)*(m.A1-s.C1) + (m.A2-s.C2)*(m.A2-s.C2) + (m.A3-s.C3)*(m.A3-s.C3))
+	da := mm - math.Sqrt(s.ae1*s.ae1+s.ae2*s.ae2+s.ae3*s.ae3)
+	v := s.accelNoise*s.accelNoise + da*da
+	s.update(y, h, matrix.Diagonal([]float64{v, v, v}))
+}
+
+// fSensor returns element i, j of the rotation matrix used by rotateByF.
+func (s *ESKFState) fSensor(i, j int) float64 {
+	return [3][3]float64{
+		{s.f11, s.f12, s.f13},
+		{s.f21, s.f22, s.f23},
+		{s.f31, s.f32, s.f33},
+	}[i][j]
+}
+
+// update performs the Kalman update for innovation y with measurement Jacobian h and noise r,
+// then folds the estimated error back into the state.
+func (s *ESKFState) update(y, h, r *matrix.DenseMatrix) {
+	ph := matrix.Product(s.p, h.Transpose())
+	ss, err := matrix.Sum(matrix.Product(h, ph), r).Inverse()
+	if err != nil {
+		log.Println("AHRS: Can't invert error-state Kalman gain matrix")
+		return
+	}
+	kk := matrix.Product(ph, ss)
+	dx := matrix.Product(kk, y)
+
+	// Joseph form keeps p symmetric and positive
+	ikh := matrix.Difference(matrix.Eye(eskfErrorStates), matrix.Product(kk, h))
+	s.p = matrix.Sum(matrix.Product(ikh, s.p, ikh.Transpose()), matrix.Product(kk, r, kk.Transpose()))
+
+	q0, q1, q2, q3 := QuaternionFromRotationVector(dx.Get(0, 0), dx.Get(1, 0), dx.Get(2, 0))
+	s.E0, s.E1, s.E2, s.E3 = QuaternionMultiply(s.E0, s.E1, s.E2, s.E3, q0, q1, q2, q3)
+	s.D1 += dx.Get(3, 0)
+	s.D2 += dx.Get(4, 0)
+	s.D3 += dx.Get(5, 0)
+	s.C1 += dx.Get(6, 0)
+	s.C2 += dx.Get(7, 0)
+	s.C3 += dx.Get(8, 0)
+	s.normalize()
+}
+
+// resetHeadingCovariance sets the heading uncertainty to v, uncorrelated with the rest of the state.
+func (s *ESKFState) resetHeadingCovariance(v float64) {
+	// The earth up direction in aircraft frame is the heading axis of δθ
+	u := [3]float64{s.e31, s.e32, s.e33}
+	pr := matrix.Eye(eskfErrorStates)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			pr.Set(i, j, pr.Get(i, j)-u[i]*u[j])
+		}
+	}
+	s.p = matrix.Product(pr, s.p, pr.Transpose())
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			s.p.Set(i, j, s.p.Get(i, j)+v*u[i]*u[j])
+		}
+	}
+}
+
+// calcUncertainty fills the State covariance M from the error covariance and updates
+// the heading uncertainty.
+func (s *ESKFState) calcUncertainty() {
+	// δE = E*(0, δθ)/2
+	var jac [4][3]float64
+	for j := 0; j < 3; j++ {
+		var v [3]float64
+		v[j] = 0.5
+		jac[0][j], jac[1][j], jac[2][j], jac[3][j] = QuaternionMultiply(s.E0, s.E1, s.E2, s.E3, 0, v[0], v[1], v[2])
+	}
+	s.M = matrix.Zeros(32, 32)
+	for i := 0; i < 4; i++ {
+		for k := 0; k < 4; k++ {
+			var v float64
+			for j := 0; j < 3; j++ {
+				for l := 0; l < 3; l++ {
+					v += jac[i][j] * s.p.Get(j, l) * jac[k][l]
+				}
+			}
+			s.M.Set(6+i, 6+k, v)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			s.M.Set(26+i, 26+j, s.p.Get(3+i, 3+j))
+			s.M.Set(19+i, 19+j, s.p.Get(6+i, 6+j))
+		}
+	}
+
+	// Heading uncertainty is the uncertainty in rotation about the earth up axis
+	u := [3]float64{s.e31, s.e32, s.e33}
+	var v float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			v += u[i] * s.p.Get(i, j) * u[j]
+		}
+	}
+	s.dHeading = math.Sqrt(math.Max(v, 0))
+	s.headingValid = s.dHeading < eskfMaxHeadingUncertainty*Deg
+}
+
+// calcDerived updates the attitude, magnetic heading, slip/skid, rate of turn
+// and G load reported to the user from the current state and measurement.
+func (s *ESKFState) calcDerived(m *Measurement) {
+	s.roll, s.pitch, s.heading = FromQuaternion(s.E0, s.E1, s.E2, s.E3)
+
+	if m.SValid {
+		// The accelerometer reads -1 G along axis 3 in level flight
+		_, a2, a3 := s.rotateByF(m.A1-s.C1, m.A2-s.C2, m.A3-s.C3, false)
+		s.slipSkid += slowSmoothConst * (math.Atan2(a2, -a3) - s.slipSkid)
+		s.gLoad += slowSmoothConst * (-a3/s.aNorm - s.gLoad)
+	}
+
+	// H is in the earth frame, so -H3 is the rate of turn to the right
+	s.turnRate += slowSmoothConst * (-s.H3*Deg - s.turnRate)
+
+	if m.MValid {
+		// Level the magnetometer reading using roll and pitch only, so heading errors don't feed into it
+		m1, m2, m3 := s.rotateByF(s.K1*m.M1+s.L1, s.K2*m.M2+s.L2, s.K3*m.M3+s.L3, false)
+		s.headingMag += slowSmoothConst * AngleDiff(levelMagHeading(s.roll, s.pitch, m1, m2, m3), s.headingMag)
+		_, _, s.headingMag = Regularize(0, 0, s.headingMag)
+	}
+}
+
+// RollPitchHeading returns the current attitude values as estimated by the error-state Kalman filter.
+// Heading is Invalid until it has been observed from the GPS track.
+func (s *ESKFState) RollPitchHeading() (roll float64, pitch float64, heading float64) {
+	roll, pitch, heading = s.State.RollPitchHeading()
+	if !s.headingValid {
+		heading = Invalid
+	}
+	return
+}
+
+// SetConfig lets the user alter the noise parameters of the error-state Kalman filter.
+func (s *ESKFState) SetConfig(configMap map[string]float64) {
+	if v, ok := configMap["gyroNoise"]; ok && v > 0 {
+		s.gyroNoise = v
+	}
+	if v, ok := configMap["gyroBiasDrift"]; ok && v > 0 {
+		s.gyroBiasDrift = v
+	}
+	if v, ok := configMap["accelNoise"]; ok && v > 0 {
+		s.accelNoise = v
+	}
+	if v, ok := configMap["accelBiasDrift"]; ok && v > 0 {
+		s.accelBiasDrift = v
+	}
+	if v, ok := configMap["headingNoise"]; ok && v > 0 {
+		s.headingNoise = v
+	}
+}
+
+// Valid returns whether the filter has a usable roll and pitch.
+func (s *ESKFState) Valid() (ok bool) {
+	if math.IsNaN(s.E0) || math.IsNaN(s.E1) || math.IsNaN(s.E2) || math.IsNaN(s.E3) {
+		log.Println("AHRS error-state Kalman filter diverged")
+		return false
+	}
+	for i := 0; i < 2; i++ {
+		if v := s.p.Get(i, i); math.IsNaN(v) || v > eskfInitialAttitudeError*eskfInitialAttitudeError*Deg*Deg {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *ESKFState) updateLogMap(m *Measurement, p map[string]interface{}) {
+	s.State.updateLogMap(m, p)
+
+	var eskfLogMap = map[string]func(s *ESKFState, m *Measurement) float64{
+		"RollUncertainty":    func(s *ESKFState, m *Measurement) float64 { return math.Sqrt(math.Max(s.p.Get(0, 0), 0)) / Deg },
+		"PitchUncertainty":   func(s *ESKFState, m *Measurement) float64 { return math.Sqrt(math.Max(s.p.Get(1, 1), 0)) / Deg },
+		"HeadingUncertainty": func(s *ESKFState, m *Measurement) float64 { return s.dHeading / Deg },
+		"D1Uncertainty":      func(s *ESKFState, m *Measurement) float64 { return math.Sqrt(math.Max(s.p.Get(3, 3), 0)) },
+		"D2Uncertainty":      func(s *ESKFState, m *Measurement) float64 { return math.Sqrt(math.Max(s.p.Get(4, 4), 0)) },
+		"D3Uncertainty":      func(s *ESKFState, m *Measurement) float64 { return math.Sqrt(math.Max(s.p.Get(5, 5), 0)) },
+		"C1Uncertainty":      func(s *ESKFState, m *Measurement) float64 { return math.Sqrt(math.Max(s.p.Get(6, 6), 0)) },
+		"C2Uncertainty":      func(s *ESKFState, m *Measurement) float64 { return math.Sqrt(math.Max(s.p.Get(7, 7), 0)) },
+		"C3Uncertainty":      func(s *ESKFState, m *Measurement) float64 { return math.Sqrt(math.Max(s.p.Get(8, 8), 0)) },
+		"YA1":                func(s *ESKFState, m *Measurement) float64 { return s.y1 },
+		"YA2":                func(s *ESKFState, m *Measurement) float64 { return s.y2 },
+		"YA3":                func(s *ESKFState, m *Measurement) float64 { return s.y3 },
+		"YTrack":             func(s *ESKFState, m *Measurement) float64 { return s.yTrack / Deg },
+		"GroundSpeed":        func(s *ESKFState, m *Measurement) float64 { return s.gs },
+		"headingValid": func(s *ESKFState, m *Measurement) float64 {
+			if s.headingValid {
+				return 1
+			}
+			return 0
+		},
+	}
+
+	for k := range eskfLogMap {
+		p[k] = eskfLogMap[k](s, m)
+	}
+}
+
+var ESKFJSONConfig = `{
+  "State": [
+    ["Roll", "RollActual", 0],
+    ["Pitch", "PitchActual", 0],
+    ["Heading", "HeadingActual", null],
+    ["RollUncertainty", null, 0],
+    ["PitchUncertainty", null, 0],
+    ["HeadingUncertainty", null, 0],
+    ["turnRate", "turnRateActual", 0],
+    ["gLoad", "gLoadActual", 1],
+    ["slipSkid", "slipSkidActual", 0],
+    ["GroundSpeed", null, 0],
+    ["T", null, null],
+    ["E0", "E0Actual", null],
+    ["E1", "E1Actual", null],
+    ["E2", "E2Actual", null],
+    ["E3", "E3Actual", null],
+    ["C1", "C1Actual", 0],
+    ["C2", "C2Actual", 0],
+    ["C3", "C3Actual", 0],
+    ["D1", "D1Actual", 0],
+    ["D2", "D2Actual", 0],
+    ["D3", "D3Actual", 0]
+  ],
+  "Measurement": [
+    ["W1", null, 0],
+    ["W2", null, 0],
+    ["W3", null, 0],
+    ["A1", "YA1", 0],
+    ["A2", "YA2", 0],
+    ["A3", "YA3", 0],
+    ["B1", null, 0],
+    ["B2", null, 0],
+    ["B3", null, 0],
+    ["M1", null, 0],
+    ["M2", null, 0],
+    ["M3", null, 0]
+  ]
+}`
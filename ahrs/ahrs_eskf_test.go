@@ -0,0 +1,111 @@
+package ahrs
+
+import (
+	"math"
+	"testing"
+)
+
+// eskfMeasurement returns a measurement for an aircraft with attitude quaternion e0..e3 rotating at
+// aircraft-frame rates b (°/s), with gyro bias d, using the accelerometer convention of the simulator.
+func eskfMeasurement(t float64, e0, e1, e2, e3 float64, b, d, w [3]float64, wValid bool) *Measurement {
+	r := QuaternionToRotationMatrix(e0, e1, e2, e3)
+	m := NewMeasurement()
+	m.SValid = true
+	m.A1, m.A2, m.A3 = -r[2][0], -r[2][1], -r[2][2]
+	m.B1, m.B2, m.B3 = b[0]+d[0], b[1]+d[1], b[2]+d[2]
+	m.WValid = wValid
+	m.W1, m.W2, m.W3 = w[0], w[1], w[2]
+	m.T, m.TW = t, t
+	return m
+}
+
+func TestESKFSteadyAttitude(t *testing.T) {
+	tests := []struct {
+		name               string
+		roll, pitch, track float64 // °
+		w1, w2             float64 // kt
+		gpsStart           int     // First step with valid GPS
+	}{
+		{"level north", 0, 0, 0, 0, 100, 0},
+		{"tilted, late GPS", 30, 10, 200, -34.2, -94.0, 100},
+	}
+
+	d := [3]float64{0.5, -0.3, 0.2}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewESKFAHRS()
+			e0, e1, e2, e3 := ToQuaternion(tt.roll*Deg, tt.pitch*Deg, tt.track*Deg)
+			w := [3]float64{tt.w1, tt.w2, 0}
+
+			for i := 0; i < 6000; i++ {
+				s.Compute(eskfMeasurement(float64(i)*0.05, e0, e1, e2, e3, [3]float64{}, d, w, i >= tt.gpsStart))
+			}
+
+			if !s.Valid() {
+				t.Fatalf("Valid() = false")
+			}
+			roll, pitch, heading := s.RollPitchHeading()
+			if math.Abs(roll/Deg-tt.roll) > 0.5 || math.Abs(pitch/Deg-tt.pitch) > 0.5 {
+				t.Errorf("roll, pitch = %f, %f, want %f, %f", roll/Deg, pitch/Deg, tt.roll, tt.pitch)
+			}
+			if math.Abs(AngleDiff(heading, tt.track*Deg)/Deg) > 1 {
+				t.Errorf("heading = %f, want %f", heading/Deg, tt.track)
+			}
+			_, dd, _, _ := s.GetCalibrations()
+			for i := 0; i < 3; i++ {
+				if math.Abs(dd[i]-d[i]) > 0.05 {
+					t.Errorf("gyro bias %d = %f, want %f", i+1, dd[i], d[i])
+				}
+			}
+		})
+	}
+}
+
+func TestESKFLargeRotation(t *testing.T) {
+	s := NewESKFAHRS()
+	e0, e1, e2, e3 := ToQuaternion(0, 0, Pi/2)
+	b := [3]float64{90, 0, 0} // Roll at 90°/s for one full revolution
+	dt := 0.01
+
+	s.Compute(eskfMeasurement(0, e0, e1, e2, e3, b, [3]float64{}, [3]float64{}, false))
+	var maxErr float64
+	for i := 1; i <= 400; i++ {
+		q0, q1, q2, q3 := QuaternionFromRotationVector(b[0]*dt*Deg, b[1]*dt*Deg, b[2]*dt*Deg)
+		e0, e1, e2, e3 = QuaternionMultiply(e0, e1, e2, e3, q0, q1, q2, q3)
+		s.Compute(eskfMeasurement(float64(i)*dt, e0, e1, e2, e3, b, [3]float64{}, [3]float64{}, false))
+
+		roll, pitch, _ := s.RollPitchHeading()
+		wantRoll, wantPitch, _ := FromQuaternion(e0, e1, e2, e3)
+		maxErr = math.Max(maxErr, math.Abs(AngleDiff(roll, wantRoll)))
+		maxErr = math.Max(maxErr, math.Abs(AngleDiff(pitch, wantPitch)))
+	}
+	if maxErr > 1*Deg {
+		t.Errorf("max roll/pitch error through a roll = %f°, want < 1°", maxErr/Deg)
+	}
+	if _, _, heading := s.RollPitchHeading(); heading != Invalid {
+		t.Errorf("heading without GPS = %f, want Invalid", heading)
+	}
+}
+
+func TestESKFTrackJacobian(t *testing.T) {
+	s := NewESKFAHRS()
+	s.E0, s.E1, s.E2, s.E3 = ToQuaternion(20*Deg, -10*Deg, 70*Deg)
+	s.normalize()
+
+	track := func(s *ESKFState) float64 { return math.Atan2(s.e11, s.e21) }
+	n1, n2 := s.e11, s.e21
+	hh := n1*n1 + n2*n2
+	want := [3]float64{0, -(n2*s.e13 - n1*s.e23) / hh, (n2*s.e12 - n1*s.e22) / hh}
+
+	for i := 0; i < 3; i++ {
+		var v [3]float64
+		v[i] = 1e-6
+		z := *s
+		q0, q1, q2, q3 := QuaternionFromRotationVector(v[0], v[1], v[2])
+		z.E0, z.E1, z.E2, z.E3 = QuaternionMultiply(s.E0, s.E1, s.E2, s.E3, q0, q1, q2, q3)
+		z.normalize()
+		if got := AngleDiff(track(&z), track(s)) / 1e-6; math.Abs(got-want[i]) > 1e-4 {
+			t.Errorf("d(track)/dθ%d = %f, want %f", i+1, got, want[i])
+		}
+	}
+}
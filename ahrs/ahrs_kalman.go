@@ -8,8 +8,56 @@ import (
 	"math"
 )
 
+const (
+	kalmanAttitudeNoiseDefault    = 0.02   // Process noise of the attitude quaternion per √s
+	kalmanGyroNoiseDefault        = 1.0    // Process noise of the gyro rates, °/s per √s
+	kalmanProcessNoiseDefault     = 1.0    // Scale applied to all other process noise
+	kalmanBiasTimeConstantDefault = 3600.0 // Time constant for drift of biases V, C, F, D, L, s
+)
+
+func init() {
+	Register(Algorithm{
+		Name:        "kalman",
+		Description: "Full 32-state extended Kalman filter",
+		New:         func() AHRSProvider { return NewKalmanAHRS() },
+		Config: []ConfigParam{
+			{"attitudeNoise", "Process noise of the attitude quaternion per √s", kalmanAttitudeNoiseDefault, 1e-5, 1},
+			{"gyroNoise", "Process noise of the gyro rates, °/s per √s", kalmanGyroNoiseDefault, 1e-3, 100},
+			{"processNoise", "Scale applied to the process noise of all other states", kalmanProcessNoiseDefault, 1e-2, 100},
+			{"biasTimeConstant", "Time constant for drift of the bias states, s", kalmanBiasTimeConstantDefault, 1, 86400},
+		},
+		JSONConfig: KalmanJSONConfig,
+	})
+}
+
 type KalmanState struct {
 	State
+	attitudeNoise    float64 // Process noise of E per √s
+	gyroNoise        float64 // Process noise of H per √s
+	processNoise     float64 // Scale of the process noise of U, Z, N
+	biasTimeConstant float64 // Time constant for drift of V, C, F, D, L
+}
+
+// NewKalmanAHRS returns a new Kalman AHRS object which initializes itself
+// from the first measurement passed to Compute.
+func NewKalmanAHRS() (s *KalmanState) {
+	s = new(KalmanState)
+	s.attitudeNoise = kalmanAttitudeNoiseDefault
+	s.gyroNoise = kalmanGyroNoiseDefault
+	s.processNoise = kalmanProcessNoiseDefault
+	s.biasTimeConstant = kalmanBiasTimeConstantDefault
+	s.needsInitialization = true
+	s.aNorm = 1
+	s.E0 = 1 // Initial guess is East
+	s.F0 = 1 // Initial guess is that it's oriented pointing forward and level
+	s.normalize()
+	s.M = matrix.Zeros(32, 32)
+	s.N = matrix.Zeros(32, 32)
+	s.logMap = make(map[string]interface{})
+	s.updateLogMap(NewMeasurement(), s.logMap)
+
+	s.gLoad = 1
+	return
 }
 
 func (s *KalmanState) CalcRollPitchHeadingUncertainty() (droll float64, dpitch float64, dheading float64) {
@@ -19,7 +67,9 @@ func (s *KalmanState) CalcRollPitchHeadingUncertainty() (droll float64, dpitch f
 	return
 }
 
-// GetState returns the Kalman state of the system
+// GetState returns the Kalman state of the system.
+// Its covariance matrix M holds the uncertainties of all the state variables,
+// and RollPitchHeadingUncertainty gives the uncertainty of the attitude.
 func (s *KalmanState) GetState() *State {
 	return &s.State
 }
@@ -31,12 +81,23 @@ func (s *KalmanState) GetStateMap() (dat *map[string]float64) {
 
 // Initialize the state at the start of the Kalman filter, based on current measurements
 func InitializeKalman(m *Measurement) (s *KalmanState) {
-	s = new(KalmanState)
+	s = NewKalmanAHRS()
 	s.init(m)
 	return
 }
 
 func (s *KalmanState) init(m *Measurement) {
+	s.State.init(m)
+
+	s.U1, s.U2, s.U3 = 0, 0, 0
+	s.Z1, s.Z2, s.Z3 = 0, 0, 0
+	s.E0, s.E1, s.E2, s.E3 = 0, 0, 0, 0
+	s.H1, s.H2, s.H3 = 0, 0, 0
+	s.N1, s.N2, s.N3 = 0, 0, 0
+	s.V1, s.V2, s.V3 = 0, 0, 0
+	s.F0, s.F1, s.F2, s.F3 = 0, 0, 0, 0
+	s.slipSkid, s.turnRate, s.gLoad = 0, 0, 1
+
 	// Diagonal matrix of initial state uncertainties, will be squared into covariance below
 	// Specifics here aren't too important--it will change very quickly
 	s.M = matrix.Diagonal([]float64{
@@ -53,22 +114,7 @@ func (s *KalmanState) init(m *Measurement) {
 	})
 	s.M = matrix.Product(s.M, s.M)
 
-	// Diagonal matrix of state process uncertainties per s, will be squared into covariance below
-	// Tuning these is more important
-	tt := math.Sqrt(60.0*60.0) // One-hour time constant for drift of biases V, C, F, D, L
-	s.N = matrix.Diagonal([]float64{
-		1, 0.1, 0.1,                                // U*3
-		0.2, 0.1, 0.2,                              // Z*3
-		0.02, 0.02, 0.02, 0.02,                     // E*4
-		1, 1, 1,                                    // H*3
-		100, 100, 100,                              // N*3
-		5/tt, 5/tt, 5/tt,                           // V*3
-		0.01/tt, 0.01/tt, 0.01/tt,                  // C*3
-		0.0001/tt, 0.0001/tt, 0.0001/tt, 0.0001/tt, // F*4
-		0.1/tt, 0.1/tt, 0.1/tt,                     // D*3
-		0.1/tt, 0.1/tt, 0.1/tt,                     // L*3
-	})
-	s.N = matrix.Product(s.N, s.N)
+	s.calcProcessNoise()
 
 	//TODO westphae: for now just treat the case !m.UValid; if we have U, we can do a lot more!
 
@@ -112,15 +158,112 @@ func (s *KalmanState) init(m *Measurement) {
 		s.M.Set(31, 31, Big)
 	}
 
+	s.updateLogMap(m, s.logMap)
+
 	return
 }
 
+// calcProcessNoise sets the process noise covariance N from the configuration.
+func (s *KalmanState) calcProcessNoise() {
+	// Diagonal matrix of state process uncertainties per s, will be squared into covariance below
+	// Tuning these is more important
+	tt := math.Sqrt(s.biasTimeConstant) // Time constant for drift of biases V, C, F, D, L
+	p, e, h := s.processNoise, s.attitudeNoise, s.gyroNoise
+	s.N = matrix.Diagonal([]float64{
+		1 * p, 0.1 * p, 0.1 * p, // U*3
+		0.2 * p, 0.1 * p, 0.2 * p, // Z*3
+		e, e, e, e, // E*4
+		h, h, h, // H*3
+		100 * p, 100 * p, 100 * p, // N*3
+		5 / tt, 5 / tt, 5 / tt, // V*3
+		0.01 / tt, 0.01 / tt, 0.01 / tt, // C*3
+		0.0001 / tt, 0.0001 / tt, 0.0001 / tt, 0.0001 / tt, // F*4
+		0.1 / tt, 0.1 / tt, 0.1 / tt, // D*3
+		0.1 / tt, 0.1 / tt, 0.1 / tt, // L*3
+	})
+	s.N = matrix.Product(s.N, s.N)
+}
+
 // Compute runs first the prediction and then the update phases of the Kalman filter
 func (s *KalmanState) Compute(m *Measurement) {
+	if s.needsInitialization {
+		s.init(m)
+		return
+	}
+
+	dt := m.T - s.T
+	if dt > maxDT {
+		log.Printf("AHRS Info: Reinitializing at %f\n", m.T)
+		s.init(m)
+		return
+	}
+	if dt < minDT {
+		return
+	}
+
 	s.Predict(m.T)
 	s.Update(m)
+	s.calcDerived(m)
+
+	s.updateLogMap(m, s.logMap)
+}
+
+// calcDerived updates the attitude, magnetic heading, slip/skid, rate of turn
+// and G load reported to the user from the current state and measurement.
+func (s *KalmanState) calcDerived(m *Measurement) {
+	s.roll, s.pitch, s.heading = FromQuaternion(s.E0, s.E1, s.E2, s.E3)
+
+	// The filter's accelerometer reads -1 G along axis 3 in level flight
+	_, a2, a3 := s.rotateByF(m.A1-s.C1, m.A2-s.C2, m.A3-s.C3, false)
+	s.slipSkid += slowSmoothConst * (math.Atan2(a2, -a3) - s.slipSkid)
+	s.gLoad += slowSmoothConst * (-a3/s.aNorm - s.gLoad)
+
+	// H is in the earth frame, so -H3 is the rate of turn to the right
+	s.turnRate += slowSmoothConst * (-s.H3*Deg - s.turnRate)
+
+	if m.MValid {
+		m1, m2, _ := s.rotateByF(m.M1-s.L1, m.M2-s.L2, m.M3-s.L3, false)
+		_, _, s.headingMag = Regularize(0, 0, math.Atan2(m1, m2))
+	}
+}
+
+// SetConfig lets the user alter the process noise of the Kalman filter.
+func (s *KalmanState) SetConfig(configMap map[string]float64) {
+	if v, ok := configMap["attitudeNoise"]; ok && v > 0 {
+		s.attitudeNoise = v
+	}
+	if v, ok := configMap["gyroNoise"]; ok && v > 0 {
+		s.gyroNoise = v
+	}
+	if v, ok := configMap["processNoise"]; ok && v > 0 {
+		s.processNoise = v
+	}
+	if v, ok := configMap["biasTimeConstant"]; ok && v > 0 {
+		s.biasTimeConstant = v
+	}
+
+	if !s.needsInitialization {
+		s.calcProcessNoise()
+	}
 }
 
+func (s *KalmanState) updateLogMap(m *Measurement, p map[string]interface{}) {
+	s.State.updateLogMap(m, p)
+
+	// Standard deviations of the attitude and gyro bias estimates
+	droll, dpitch, dheading := s.RollPitchHeadingUncertainty()
+	p["RollUncertainty"] = droll / Deg
+	p["PitchUncertainty"] = dpitch / Deg
+	p["HeadingUncertainty"] = dheading / Deg
+	for i, k := range []string{"U1", "U2", "U3", "V1", "V2", "V3", "D1", "D2", "D3"} {
+		p[k+"Uncertainty"] = math.Sqrt(s.M.Get(uncertaintyIndex[i], uncertaintyIndex[i]))
+	}
+}
+
+// uncertaintyIndex holds the indices in M of the states logged with their
+// uncertainty by updateLogMap, in the same order.
+var uncertaintyIndex = []int{0, 1, 2, 16, 17, 18, 26, 27, 28}
+
 // Valid applies some heuristics to detect whether the computed state is valid or not
 func (s *KalmanState) Valid() (ok bool) {
 	ok = true
@@ -816,4 +959,44 @@ func (s *KalmanState) calcJacobianMeasurement() (jac *matrix.DenseMatrix) {
 	return
 }
 
-var KalmanJSONConfig = ""
+var KalmanJSONConfig = `{
+  "State": [
+    ["Roll", "RollUncertainty", "RollActual", 0],
+    ["Pitch", "PitchUncertainty", "PitchActual", 0],
+    ["Heading", "HeadingUncertainty", "HeadingActual", null],
+    ["turnRate", null, "turnRateActual", 0],
+    ["gLoad", null, "gLoadActual", 1],
+    ["slipSkid", null, "slipSkidActual", 0],
+    ["T", null, null, null],
+    ["E0", null, "E0Actual", null],
+    ["E1", null, "E1Actual", null],
+    ["E2", null, "E2Actual", null],
+    ["E3", null, "E3Actual", null],
+    ["Z1", null, "Z1Actual", 0],
+    ["Z2", null, "Z2Actual", 0],
+    ["Z3", null, "Z3Actual", 0],
+    ["C1", null, "C1Actual", 0],
+    ["C2", null, "C2Actual", 0],
+    ["C3", null, "C3Actual", 0],
+    ["H1", null, "H1Actual", 0],
+    ["H2", null, "H2Actual", 0],
+    ["H3", null, "H3Actual", 0],
+    ["D1", "D1Uncertainty", "D1Actual", 0],
+    ["D2", "D2Uncertainty", "D2Actual", 0],
+    ["D3", "D3Uncertainty", "D3Actual", 0]
+  ],
+  "Measurement": [
+    ["W1", null, 0],
+    ["W2", null, 0],
+    ["W3", null, 0],
+    ["A1", null, 0],
+    ["A2", null, 0],
+    ["A3", null, 0],
+    ["B1", null, 0],
+    ["B2", null, 0],
+    ["B3", null, 0],
+    ["M1", null, 0],
+    ["M2", null, 0],
+    ["M3", null, 0]
+  ]
+}`
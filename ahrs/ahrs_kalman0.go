@@ -49,6 +49,15 @@ type Kalman0State struct {
 	kk    *matrix.DenseMatrix
 }
 
+func init() {
+	Register(Algorithm{
+		Name:        "kalman0",
+		Description: "Kalman filter development stage 0: gyro and accelerometer in one dimension",
+		New:         func() AHRSProvider { return NewKalman0AHRS() },
+		JSONConfig:  Kalman0JSONConfig,
+	})
+}
+
 // Initialize the state at the start of the Kalman filter, based on current measurements
 func NewKalman0AHRS() (s *Kalman0State) {
 	s = new(Kalman0State)
@@ -236,8 +245,9 @@ func (s *Kalman0State) calcJacobianMeasurement() {
 	return
 }
 
-// SetCalibrations sets the AHRS accelerometer calibrations to c and gyro calibrations to d.
-func (s *Kalman0State) SetCalibrations(c, d *[3]float64) {
+// SetCalibrations sets the AHRS accelerometer calibrations to c, gyro calibrations to d,
+// mag scaling to k and mag offset to l.
+func (s *Kalman0State) SetCalibrations(c, d, k, l *[3]float64) {
 	return
 }
 
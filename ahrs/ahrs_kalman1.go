@@ -44,6 +44,15 @@ type Kalman1State struct {
 	kk    *matrix.DenseMatrix
 }
 
+func init() {
+	Register(Algorithm{
+		Name:        "kalman1",
+		Description: "Kalman filter development stage 1: gyro and accelerometer in three dimensions",
+		New:         func() AHRSProvider { return NewKalman1AHRS() },
+		JSONConfig:  Kalman1JSONConfig,
+	})
+}
+
 // Initialize the state at the start of the Kalman filter, based on current measurements
 func NewKalman1AHRS() (s *Kalman1State) {
 	s = new(Kalman1State)
@@ -292,8 +301,9 @@ func (s *Kalman1State) calcJacobianMeasurement() {
 	return
 }
 
-// SetCalibrations sets the AHRS accelerometer calibrations to c and gyro calibrations to d.
-func (s *Kalman1State) SetCalibrations(c, d *[3]float64) {
+// SetCalibrations sets the AHRS accelerometer calibrations to c, gyro calibrations to d,
+// mag scaling to k and mag offset to l.
+func (s *Kalman1State) SetCalibrations(c, d, k, l *[3]float64) {
 	return
 }
 
@@ -0,0 +1,53 @@
+package ahrs
+
+import (
+	"math"
+	"testing"
+)
+
+// levelFlight returns a measurement for straight and level flight north at
+// 100kt, using the accelerometer convention of KalmanState.PredictMeasurement.
+func levelFlight(t float64) *Measurement {
+	m := NewMeasurement()
+	m.WValid, m.SValid = true, true
+	m.W1, m.W2, m.W3 = 0, 100, 0
+	m.A1, m.A2, m.A3 = 0, 0, -1
+	m.T, m.TW = t, t
+	return m
+}
+
+func TestKalmanProvider(t *testing.T) {
+	s, err := NewAHRS("kalman", map[string]float64{"gyroNoise": 2})
+	if err != nil {
+		t.Fatalf("NewAHRS() error = %v", err)
+	}
+
+	for i := 0; i < 200; i++ {
+		s.Compute(levelFlight(float64(i) * 0.05))
+	}
+
+	roll, pitch, _ := s.RollPitchHeading()
+	if math.Abs(roll/Deg) > 1 || math.Abs(pitch/Deg) > 1 {
+		t.Errorf("RollPitchHeading() = %f, %f, want level", roll/Deg, pitch/Deg)
+	}
+	if g := s.GLoad(); math.Abs(g-1) > 0.05 {
+		t.Errorf("GLoad() = %f, want 1", g)
+	}
+
+	st := s.GetState()
+	if r, c := st.M.GetSize(); r != 32 || c != 32 {
+		t.Fatalf("GetState().M is %dx%d, want 32x32", r, c)
+	}
+	if droll, _, _ := st.RollPitchHeadingUncertainty(); math.IsNaN(droll) || droll <= 0 {
+		t.Errorf("roll uncertainty = %f, want positive", droll)
+	}
+	if _, ok := s.GetLogMap()["RollUncertainty"]; !ok {
+		t.Errorf("GetLogMap() has no RollUncertainty")
+	}
+
+	s.Reset()
+	s.Compute(levelFlight(100))
+	if st := s.GetState(); st.T != 100 {
+		t.Errorf("after Reset, T = %f, want 100", st.T)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Madgwick's gradient-descent AHRS algorithm (S. Madgwick, "An efficient orientation filter for inertial and
+inertial/magnetic sensor arrays", 2010).
+
+E is a quaternion translating from aircraft frame to earth frame (i.e. E_{ea}).
+At each step the gyro rate of change of E is corrected by a step of size beta down the gradient of
+the error between the measured and predicted gravity (and magnetic north) directions:
+
+f = E*·v·E - s, for each earth-frame reference v and unit aircraft-frame sensor vector s
+∇ = -2 v·E·f, summed over the references
+E -> E + (0.5*E·B - beta*∇/|∇|)*dt
+*/
+package ahrs
+
+import (
+	"log"
+	"math"
+)
+
+const (
+	madgwickBetaDefault = 0.1 // Gradient-descent step, Rad/s
+)
+
+func init() {
+	Register(Algorithm{
+		Name:        "madgwick",
+		Description: "Madgwick gradient-descent complementary filter, IMU with optional magnetometer",
+		New:         func() AHRSProvider { return NewMadgwickAHRS() },
+		Config: []ConfigParam{
+			{"beta", "Gradient-descent step toward the accelerometer and magnetometer, Rad/s", madgwickBetaDefault, 0, 10},
+		},
+		JSONConfig: ComplementaryJSONConfig,
+	})
+}
+
+// MadgwickState is the Madgwick gradient-descent AHRS algorithm.
+type MadgwickState struct {
+	complementaryState
+	gradient float64 // Magnitude of the last error gradient
+	beta     float64 // Gradient-descent step, Rad/s
+}
+
+// NewMadgwickAHRS returns a new Madgwick AHRS object which initializes itself
+// from the first measurement passed to Compute.
+func NewMadgwickAHRS() (s *MadgwickState) {
+	s = &MadgwickState{complementaryState: newComplementaryState(), beta: madgwickBetaDefault}
+	s.updateLogMap(NewMeasurement(), s.logMap)
+	return
+}
+
+func (s *MadgwickState) init(m *Measurement) {
+	s.complementaryState.init(m)
+	s.gradient = 0
+	s.updateLogMap(m, s.logMap)
+}
+
+// Compute performs the Madgwick AHRS computations.
+func (s *MadgwickState) Compute(m *Measurement) {
+	if s.needsInitialization {
+		s.init(m)
+		return
+	}
+
+	dt := m.T - s.T
+	if dt > maxDT {
+		log.Printf("AHRS Info: Reinitializing at %f\n", m.T)
+		s.init(m)
+		return
+	}
+	if dt < minDT {
+		return
+	}
+
+	b, a, mag, aOK, mOK := s.sensorVectors(m)
+
+	// Rate of change of E from the gyro
+	d0, d1, d2, d3 := QuaternionMultiply(s.E0, s.E1, s.E2, s.E3, 0, b[0]/2, b[1]/2, b[2]/2)
+
+	var g0, g1, g2, g3 float64
+	if aOK {
+		// Gravity points down in the earth frame
+		g0, g1, g2, g3 = s.gradientStep(0, 0, -1, a)
+	}
+	if mOK {
+		n1, n2, n3 := s.magReference(mag)
+		h0, h1, h2, h3 := s.gradientStep(n1, n2, n3, mag)
+		g0, g1, g2, g3 = g0+h0, g1+h1, g2+h2, g3+h3
+	}
+	s.gradient = math.Sqrt(g0*g0 + g1*g1 + g2*g2 + g3*g3)
+	if s.gradient > Small {
+		d0 -= s.beta * g0 / s.gradient
+		d1 -= s.beta * g1 / s.gradient
+		d2 -= s.beta * g2 / s.gradient
+		d3 -= s.beta * g3 / s.gradient
+	}
+
+	s.E0, s.E1, s.E2, s.E3 = QuaternionNormalize(s.E0+d0*dt, s.E1+d1*dt, s.E2+d2*dt, s.E3+d3*dt)
+	s.normalize()
+	s.T = m.T
+	s.magValid = mOK
+
+	s.calcDerived(m, b)
+	s.updateLogMap(m, s.logMap)
+}
+
+// gradientStep returns the gradient with respect to E of the squared error between the earth-frame
+// reference v1, v2, v3 rotated into the aircraft frame and the measured unit vector u.
+func (s *MadgwickState) gradientStep(v1, v2, v3 float64, u [3]float64) (g0, g1, g2, g3 float64) {
+	f1, f2, f3 := s.rotateByE(v1, v2, v3, true)
+	f1, f2, f3 = f1-u[0], f2-u[1], f3-u[2]
+
+	g0, g1, g2, g3 = QuaternionMultiply(0, v1, v2, v3, s.E0, s.E1, s.E2, s.E3)
+	g0, g1, g2, g3 = QuaternionMultiply(g0, g1, g2, g3, 0, f1, f2, f3)
+	return -2 * g0, -2 * g1, -2 * g2, -2 * g3
+}
+
+// SetConfig lets the user alter the gain of the Madgwick algorithm.
+func (s *MadgwickState) SetConfig(configMap map[string]float64) {
+	if v, ok := configMap["beta"]; ok && v >= 0 {
+		s.beta = v
+	}
+}
+
+func (s *MadgwickState) updateLogMap(m *Measurement, p map[string]interface{}) {
+	s.complementaryState.updateLogMap(m, p)
+	p["Gradient"] = s.gradient
+}
@@ -0,0 +1,148 @@
+/*
+Mahony's nonlinear complementary filter (R. Mahony, T. Hamel and J.-M. Pflimlin, "Nonlinear complementary
+filters on the special orthogonal group", 2008), in its explicit form with gyro bias estimation.
+
+E is a quaternion translating from aircraft frame to earth frame (i.e. E_{ea}).
+The error between the measured and predicted gravity (and magnetic north) directions drives a PI
+correction to the gyro rates:
+
+e = Σ s × (E*·v·E), for each earth-frame reference v and unit aircraft-frame sensor vector s
+I -> I + e*dt
+E -> E·exp(0.5*(B + kp*e + ki*I)*dt)
+*/
+package ahrs
+
+import (
+	"log"
+	"math"
+)
+
+const (
+	mahonyKpDefault = 1.0  // Proportional gain, Rad/s
+	mahonyKiDefault = 0.05 // Integral gain, Rad/s²
+)
+
+func init() {
+	Register(Algorithm{
+		Name:        "mahony",
+		Description: "Mahony PI complementary filter, IMU with optional magnetometer",
+		New:         func() AHRSProvider { return NewMahonyAHRS() },
+		Config: []ConfigParam{
+			{"kp", "Proportional gain toward the accelerometer and magnetometer, Rad/s", mahonyKpDefault, 0, 20},
+			{"ki", "Integral gain for the gyro bias, Rad/s²", mahonyKiDefault, 0, 5},
+		},
+		JSONConfig: ComplementaryJSONConfig,
+	})
+}
+
+// MahonyState is the Mahony PI complementary-filter AHRS algorithm.
+type MahonyState struct {
+	complementaryState
+	e1, e2, e3 float64 // Last error between measured and predicted directions, aircraft frame
+	i1, i2, i3 float64 // Integral of the error, aircraft frame
+	kp         float64 // Proportional gain, Rad/s
+	ki         float64 // Integral gain, Rad/s²
+}
+
+// NewMahonyAHRS returns a new Mahony AHRS object which initializes itself
+// from the first measurement passed to Compute.
+func NewMahonyAHRS() (s *MahonyState) {
+	s = &MahonyState{complementaryState: newComplementaryState(), kp: mahonyKpDefault, ki: mahonyKiDefault}
+	s.updateLogMap(NewMeasurement(), s.logMap)
+	return
+}
+
+func (s *MahonyState) init(m *Measurement) {
+	s.complementaryState.init(m)
+	s.e1, s.e2, s.e3 = 0, 0, 0
+	s.i1, s.i2, s.i3 = 0, 0, 0
+	s.updateLogMap(m, s.logMap)
+}
+
+// Compute performs the Mahony AHRS computations.
+func (s *MahonyState) Compute(m *Measurement) {
+	if s.needsInitialization {
+		s.init(m)
+		return
+	}
+
+	dt := m.T - s.T
+	if dt > maxDT {
+		log.Printf("AHRS Info: Reinitializing at %f\n", m.T)
+		s.init(m)
+		return
+	}
+	if dt < minDT {
+		return
+	}
+
+	b, a, mag, aOK, mOK := s.sensorVectors(m)
+
+	s.e1, s.e2, s.e3 = 0, 0, 0
+	if aOK {
+		// Gravity points down in the earth frame
+		s.addError(0, 0, -1, a)
+	}
+	if mOK {
+		n1, n2, n3 := s.magReference(mag)
+		s.addError(n1, n2, n3, mag)
+	}
+
+	if aOK || mOK {
+		s.i1 += s.e1 * dt
+		s.i2 += s.e2 * dt
+		s.i3 += s.e3 * dt
+	}
+
+	w1 := b[0] + s.kp*s.e1 + s.ki*s.i1
+	w2 := b[1] + s.kp*s.e2 + s.ki*s.i2
+	w3 := b[2] + s.kp*s.e3 + s.ki*s.i3
+	q0, q1, q2, q3 := QuaternionFromRotationVector(w1*dt, w2*dt, w3*dt)
+	s.E0, s.E1, s.E2, s.E3 = QuaternionMultiply(s.E0, s.E1, s.E2, s.E3, q0, q1, q2, q3)
+	s.normalize()
+	s.T = m.T
+	s.magValid = mOK
+
+	s.calcDerived(m, b)
+	s.updateLogMap(m, s.logMap)
+}
+
+// addError adds to the error the rotation, Rad, from the earth-frame reference v1, v2, v3 rotated into
+// the aircraft frame toward the measured unit vector u.
+func (s *MahonyState) addError(v1, v2, v3 float64, u [3]float64) {
+	p1, p2, p3 := s.rotateByE(v1, v2, v3, true)
+	s.e1 += u[1]*p3 - u[2]*p2
+	s.e2 += u[2]*p1 - u[0]*p3
+	s.e3 += u[0]*p2 - u[1]*p1
+}
+
+// GetCalibrations returns the AHRS accelerometer calibrations c, gyro calibrations d,
+// mag scaling k and mag offset l.  The gyro calibrations include the bias estimated by the integral term.
+func (s *MahonyState) GetCalibrations() (c, d, k, l *[3]float64) {
+	c, d, k, l = s.State.GetCalibrations()
+	// The integral term is added to the aircraft-frame gyro rates, so it is minus the bias
+	d1, d2, d3 := s.rotateByF(-s.ki*s.i1/Deg, -s.ki*s.i2/Deg, -s.ki*s.i3/Deg, true)
+	d[0], d[1], d[2] = d[0]+d1, d[1]+d2, d[2]+d3
+	return
+}
+
+// SetConfig lets the user alter the gains of the Mahony algorithm.
+func (s *MahonyState) SetConfig(configMap map[string]float64) {
+	if v, ok := configMap["kp"]; ok && v >= 0 {
+		s.kp = v
+	}
+	if v, ok := configMap["ki"]; ok && v >= 0 {
+		s.ki = v
+	}
+}
+
+func (s *MahonyState) updateLogMap(m *Measurement, p map[string]interface{}) {
+	s.complementaryState.updateLogMap(m, p)
+	p["Error1"] = s.e1 / Deg
+	p["Error2"] = s.e2 / Deg
+	p["Error3"] = s.e3 / Deg
+	p["Integral1"] = s.ki * s.i1 / Deg
+	p["Integral2"] = s.ki * s.i2 / Deg
+	p["Integral3"] = s.ki * s.i3 / Deg
+	p["ErrorNorm"] = math.Sqrt(s.e1*s.e1+s.e2*s.e2+s.e3*s.e3) / Deg
+}
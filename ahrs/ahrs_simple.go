@@ -6,6 +6,13 @@ by providing a more instantaneous response than the GPS can provide.
 This is really a poor-man's sensor fusion algorithm.  The proper way to do this is with a Kalman Filter,
 but this approach is simpler and easier to debug, and should be good enough for most flight conditions.
 
+When true airspeed U is available, the aircraft's own acceleration is known in the aircraft frame from the
+change in airspeed and the gyro rates (the centripetal acceleration), so it is removed from the accelerometer
+reading directly rather than estimated from the change in GPS velocity, which lags.  The wind V is estimated
+by finding the wind for which the GPS velocity less the wind has the magnitude of the airspeed, which
+becomes observable as the aircraft turns; the aircraft's nose is then mapped onto its velocity through
+the air rather than its ground track.
+
 It is a step on the way to the full Kalman Filter implementation, a bit more obvious what's going on so
 the math and stratux integration can be more easily developed and debugged.
 
@@ -26,18 +33,31 @@ const (
 	minDT                      = 1e-6 // Below this time interval, don't recalculate
 	maxDT                      = 10.0 // Above this time interval, re-initialize--too stale
 	minGS                      = 5.0  // Below this GS, don't use any GPS data
+	minAirspeed                = 20.0 // Below this airspeed, kt, don't use any airspeed data
+	airspeedTimeConst          = 1.0  // Time constant, s, of the smoothing of airspeed and its rate of change
 	fastSmoothConstDefault     = 0.7  // Sensible default for fast smoothing of AHRS values
 	slowSmoothConstDefault     = 0.1  // Sensible default for slow smoothing of AHRS values
 	verySlowSmoothConstDefault = 0.02 // Five-second smoothing mainly for groundspeed, to decide static mode
 	gpsWeightDefault           = 0.04 // Sensible default for weight of GPS-derived values in solution
 )
 
-var (
-	fastSmoothConst     = fastSmoothConstDefault     // Decay constant for smoothing values reported to the user
-	slowSmoothConst     = slowSmoothConstDefault     // Decay constant for smoothing values reported to the user
-	verySlowSmoothConst = verySlowSmoothConstDefault // Decay constant for smoothing values reported to the user
-	gpsWeight           = gpsWeightDefault           // Weight given to GPS quaternion over gyro quaternion
-)
+// slowSmoothConst is the decay constant the other algorithms smooth the values they report to the user with.
+const slowSmoothConst = slowSmoothConstDefault
+
+func init() {
+	Register(Algorithm{
+		Name:        "simple",
+		Description: "GPS-derived attitude blended with integrated gyro rates",
+		New:         func() AHRSProvider { return NewSimpleAHRS() },
+		Config: []ConfigParam{
+			{"fastSmoothConst", "Decay constant for fast smoothing of reported values", fastSmoothConstDefault, 0.001, 1},
+			{"slowSmoothConst", "Decay constant for slow smoothing of reported values", slowSmoothConstDefault, 0.001, 1},
+			{"verySlowSmoothConst", "Decay constant for smoothing groundspeed to detect static mode", verySlowSmoothConstDefault, 0.001, 1},
+			{"gpsWeight", "Weight given to the GPS attitude over the gyro attitude", gpsWeightDefault, 0, 1},
+		},
+		JSONConfig: SimpleJSONConfig,
+	})
+}
 
 type SimpleState struct {
 	State
@@ -47,15 +67,28 @@ type SimpleState struct {
 	rollGPS, pitchGPS, headingGPS float64 // GPS/accel-based attitude, Rad
 	rollGyr, pitchGyr, headingGyr float64 // Gyro-based attitude, Rad
 	w1, w2, w3, gs                float64 // Groundspeed & ROC, Kts
+	tU                            float64 // Time of last airspeed reading
+	u1, u2, u3                    float64 // Smoothed airspeed, Kts
+	du1, du2, du3                 float64 // Smoothed rate of change of airspeed, Kts/s
+	airspeedValid                 bool    // Whether airspeed is being used
+	sideslip                      float64 // Angle of the air velocity to the left of the nose, Rad
 	smoothW1, smoothW2, smoothGS  float64 // Smoothed groundspeed used to determine if stationary
 	staticMode                    bool    // For low groundspeed or invalid GPS
 	headingValid                  bool    // Whether to slew quickly to correct heading
+	fastSmoothConst               float64 // Decay constant for smoothing values reported to the user
+	slowSmoothConst               float64 // Decay constant for smoothing values reported to the user
+	verySlowSmoothConst           float64 // Decay constant for smoothing values reported to the user
+	gpsWeight                     float64 // Weight given to GPS quaternion over gyro quaternion
 }
 
 //NewSimpleAHRS returns a new Simple AHRS object.
 // It is initialized with a beginning sensor orientation quaternion f0.
 func NewSimpleAHRS() (s *SimpleState) {
 	s = new(SimpleState)
+	s.fastSmoothConst = fastSmoothConstDefault
+	s.slowSmoothConst = slowSmoothConstDefault
+	s.verySlowSmoothConst = verySlowSmoothConstDefault
+	s.gpsWeight = gpsWeightDefault
 	s.needsInitialization = true
 	s.aNorm = 1
 	s.F0 = 1 // Initial guess is that it's oriented pointing forward and level
@@ -73,8 +106,8 @@ func (s *SimpleState) init(m *Measurement) {
 	s.tW = m.TW
 	if m.WValid {
 		s.gs = math.Hypot(m.W1, m.W2)
-		s.smoothW1 = s.smoothW1 + verySlowSmoothConst*(m.W1-s.smoothW1)
-		s.smoothW2 = s.smoothW2 + verySlowSmoothConst*(m.W2-s.smoothW2)
+		s.smoothW1 = s.smoothW1 + s.verySlowSmoothConst*(m.W1-s.smoothW1)
+		s.smoothW2 = s.smoothW2 + s.verySlowSmoothConst*(m.W2-s.smoothW2)
 		s.smoothGS = math.Hypot(s.smoothW1, s.smoothW2)
 		s.w1 = m.W1
 		s.w2 = m.W2
@@ -89,6 +122,16 @@ func (s *SimpleState) init(m *Measurement) {
 		s.w3 = 0
 	}
 
+	s.tU = m.TU
+	s.airspeedValid = m.UValid && m.U1 > minAirspeed
+	s.u1, s.u2, s.u3 = m.U1, m.U2, m.U3
+	s.du1, s.du2, s.du3 = 0, 0, 0
+	s.U1, s.U2, s.U3 = 0, 0, 0
+	if s.airspeedValid {
+		s.U1, s.U2, s.U3 = m.U1, m.U2, m.U3
+	}
+	s.sideslip = 0
+
 	if s.smoothGS > minGS {
 		s.heading = math.Atan2(m.W1, m.W2)
 		for s.heading < 0 {
@@ -128,17 +171,17 @@ func (s *SimpleState) Compute(m *Measurement) {
 	m1, m2, _ := s.rotateByF(s.K1*m.M1+s.L1, s.K2*m.M2+s.L2, s.K3*m.M3+s.L3, false)
 
 	// Update estimates of current gyro  and accel rates
-	s.Z1 += fastSmoothConst * (a1/s.aNorm - s.Z1)
-	s.Z2 += fastSmoothConst * (a2/s.aNorm - s.Z2)
-	s.Z3 += fastSmoothConst * (a3/s.aNorm - s.Z3)
-	s.H1 += fastSmoothConst * (b1 - s.H1)
-	s.H2 += fastSmoothConst * (b2 - s.H2)
-	s.H3 += fastSmoothConst * (b3 - s.H3)
+	s.Z1 += s.fastSmoothConst * (a1/s.aNorm - s.Z1)
+	s.Z2 += s.fastSmoothConst * (a2/s.aNorm - s.Z2)
+	s.Z3 += s.fastSmoothConst * (a3/s.aNorm - s.Z3)
+	s.H1 += s.fastSmoothConst * (b1 - s.H1)
+	s.H2 += s.fastSmoothConst * (b2 - s.H2)
+	s.H3 += s.fastSmoothConst * (b3 - s.H3)
 
 	if m.WValid && dtw > minDT {
 		s.gs = math.Hypot(m.W1, m.W2)
-		s.smoothW1 = s.smoothW1 + verySlowSmoothConst*(m.W1-s.smoothW1)
-		s.smoothW2 = s.smoothW2 + verySlowSmoothConst*(m.W2-s.smoothW2)
+		s.smoothW1 = s.smoothW1 + s.verySlowSmoothConst*(m.W1-s.smoothW1)
+		s.smoothW2 = s.smoothW2 + s.verySlowSmoothConst*(m.W2-s.smoothW2)
 		s.smoothGS = math.Hypot(s.smoothW1, s.smoothW2)
 	}
 
@@ -162,7 +205,23 @@ func (s *SimpleState) Compute(m *Measurement) {
 		ae[2] -= (m.W3 - s.w3) / dtw / G
 	}
 
-	ha, err := MakeUnitVector([3]float64{s.Z1, s.Z2, s.Z3})
+	// With airspeed, remove the aircraft's own acceleration, including the centripetal acceleration in
+	// a turn, from the measured acceleration so that it maps onto gravity alone.
+	z1, z2, z3 := s.Z1, s.Z2, s.Z3
+	s.airspeedValid = m.UValid && m.U1 > minAirspeed
+	if s.airspeedValid {
+		c1, c2, c3 := s.airspeedAcceleration(m)
+		z1 += c1 / G
+		z2 += c2 / G
+		z3 += c3 / G
+		ae = [3]float64{0, 0, -1}
+		if !s.staticMode {
+			s.updateWind(m, dtw)
+			ve = [3]float64{m.W1 - s.V1, m.W2 - s.V2, m.W3 - s.V3} // Air velocity in earth frame
+		}
+	}
+
+	ha, err := MakeUnitVector([3]float64{z1, z2, z3})
 	if err != nil {
 		log.Println("AHRS Error: IMU-measured acceleration was zero")
 		return
@@ -184,10 +243,10 @@ func (s *SimpleState) Compute(m *Measurement) {
 	e0, e1, e2, e3 := RotationMatrixToQuaternion(*rotmat)
 	e0, e1, e2, e3 = QuaternionSign(e0, e1, e2, e3, s.eGPS0, s.eGPS1, s.eGPS2, s.eGPS3)
 	s.eGPS0, s.eGPS1, s.eGPS2, s.eGPS3 = QuaternionNormalize(
-		s.eGPS0+fastSmoothConst*(e0-s.eGPS0),
-		s.eGPS1+fastSmoothConst*(e1-s.eGPS1),
-		s.eGPS2+fastSmoothConst*(e2-s.eGPS2),
-		s.eGPS3+fastSmoothConst*(e3-s.eGPS3),
+		s.eGPS0+s.fastSmoothConst*(e0-s.eGPS0),
+		s.eGPS1+s.fastSmoothConst*(e1-s.eGPS1),
+		s.eGPS2+s.fastSmoothConst*(e2-s.eGPS2),
+		s.eGPS3+s.fastSmoothConst*(e3-s.eGPS3),
 	)
 
 	// By rotating the orientation quaternion at the last time step, s.E, by the measured gyro rates,
@@ -202,10 +261,10 @@ func (s *SimpleState) Compute(m *Measurement) {
 	de2 := s.eGPS2 - s.eGyr2
 	de3 := s.eGPS3 - s.eGyr3
 	s.E0, s.E1, s.E2, s.E3 = QuaternionNormalize(
-		s.eGyr0+gpsWeight*de0*(0.5+de0*de0),
-		s.eGyr1+gpsWeight*de1*(0.5+de1*de1),
-		s.eGyr2+gpsWeight*de2*(0.5+de2*de2),
-		s.eGyr3+gpsWeight*de3*(0.5+de3*de3),
+		s.eGyr0+s.gpsWeight*de0*(0.5+de0*de0),
+		s.eGyr1+s.gpsWeight*de1*(0.5+de1*de1),
+		s.eGyr2+s.gpsWeight*de2*(0.5+de2*de2),
+		s.eGyr3+s.gpsWeight*de3*(0.5+de3*de3),
 	)
 
 	s.roll, s.pitch, s.heading = FromQuaternion(s.E0, s.E1, s.E2, s.E3)
@@ -214,7 +273,7 @@ func (s *SimpleState) Compute(m *Measurement) {
 
 	// Update Magnetic Heading
 	dhM := AngleDiff(math.Atan2(m1, m2), s.headingMag)
-	s.headingMag += slowSmoothConst * dhM
+	s.headingMag += s.slowSmoothConst * dhM
 	for s.headingMag < 0 {
 		s.headingMag += 2 * Pi
 	}
@@ -223,15 +282,22 @@ func (s *SimpleState) Compute(m *Measurement) {
 	}
 
 	// Update Slip/Skid
-	s.slipSkid += slowSmoothConst * (math.Atan2(a2, -a3) - s.slipSkid)
+	s.slipSkid += s.slowSmoothConst * (math.Atan2(a2, -a3) - s.slipSkid)
 
 	// Update Rate of Turn
 	if s.gs > 0 && dtw > 0 {
-		s.turnRate += slowSmoothConst * ((m.W2*(m.W1-s.w1)-m.W1*(m.W2-s.w2))/(s.gs*s.gs)/dtw - s.turnRate)
+		s.turnRate += s.slowSmoothConst * ((m.W2*(m.W1-s.w1)-m.W1*(m.W2-s.w2))/(s.gs*s.gs)/dtw - s.turnRate)
 	}
 
 	// Update GLoad
-	s.gLoad += slowSmoothConst * (-a3/s.aNorm - s.gLoad)
+	s.gLoad += s.slowSmoothConst * (-a3/s.aNorm - s.gLoad)
+
+	// Update sideslip from the air velocity in aircraft frame
+	if s.airspeedValid && !s.staticMode {
+		s.calcRotationMatrices()
+		v1, v2, _ := s.rotateByE(m.W1-s.V1, m.W2-s.V2, m.W3-s.V3, true)
+		s.sideslip += s.slowSmoothConst * (math.Atan2(v2, v1) - s.sideslip)
+	}
 
 	s.updateLogMap(m, s.logMap)
 
@@ -240,6 +306,56 @@ func (s *SimpleState) Compute(m *Measurement) {
 	s.w1 = m.W1
 	s.w2 = m.W2
 	s.w3 = m.W3
+	if m.UValid {
+		s.tU = m.TU
+	}
+}
+
+// airspeedAcceleration returns the acceleration of the aircraft in the aircraft frame, kt/s,
+// from the change in airspeed and the centripetal acceleration due to the gyro rates.
+// Differencing successive airspeed readings would amplify the pitot noise many times over, so the
+// smoothed airspeed is differentiated and the result smoothed again, both over airspeedTimeConst
+// rather than per sample so that the noise doesn't grow with the sample rate.
+func (s *SimpleState) airspeedAcceleration(m *Measurement) (c1, c2, c3 float64) {
+	s.U1 += s.fastSmoothConst * (m.U1 - s.U1)
+	s.U2 += s.fastSmoothConst * (m.U2 - s.U2)
+	s.U3 += s.fastSmoothConst * (m.U3 - s.U3)
+
+	if dtu := m.TU - s.tU; dtu > minDT && dtu < maxDT {
+		k := dtu / (airspeedTimeConst + dtu)
+		du1, du2, du3 := k*(m.U1-s.u1)/dtu, k*(m.U2-s.u2)/dtu, k*(m.U3-s.u3)/dtu
+		s.u1, s.u2, s.u3 = s.u1+du1*dtu, s.u2+du2*dtu, s.u3+du3*dtu
+		s.du1 += k * (du1 - s.du1)
+		s.du2 += k * (du2 - s.du2)
+		s.du3 += k * (du3 - s.du3)
+	}
+	c1, c2, c3 = s.du1, s.du2, s.du3
+
+	// H is the gyro rate in aircraft frame, so H×U is the centripetal acceleration
+	c1 += (s.H2*s.U3 - s.H3*s.U2) * Deg
+	c2 += (s.H3*s.U1 - s.H1*s.U3) * Deg
+	c3 += (s.H1*s.U2 - s.H2*s.U1) * Deg
+	return
+}
+
+// updateWind moves the horizontal wind estimate V toward the wind for which the GPS velocity less
+// the wind has the magnitude of the airspeed.  The vertical wind is taken to be zero.
+func (s *SimpleState) updateWind(m *Measurement, dtw float64) {
+	if dtw < minDT {
+		return
+	}
+
+	r1, r2 := m.W1-s.V1, m.W2-s.V2
+	rr := math.Hypot(r1, r2)
+	if rr < minGS {
+		return
+	}
+	uu := s.U1*s.U1 + s.U2*s.U2 + s.U3*s.U3
+	tas := math.Sqrt(math.Max(uu-m.W3*m.W3, 0)) // Horizontal airspeed
+	dv := s.verySlowSmoothConst * (rr - tas)
+	s.V1 += dv * r1 / rr
+	s.V2 += dv * r2 / rr
+	s.V3 = 0
 }
 
 // RollPitchHeading returns the current attitude values as estimated by the Kalman algorithm.
@@ -262,24 +378,24 @@ func (s *SimpleState) RateOfTurn() (turnRate float64) {
 // SetConfig lets the user alter some of the configuration settings.
 func (s *SimpleState) SetConfig(configMap map[string]float64) {
 	if v, ok := configMap["fastSmoothConst"]; ok {
-		fastSmoothConst = v
+		s.fastSmoothConst = v
 	}
 	if v, ok := configMap["slowSmoothConst"]; ok {
-		slowSmoothConst = v
+		s.slowSmoothConst = v
 	}
 	if v, ok := configMap["verySlowSmoothConst"]; ok {
-		verySlowSmoothConst = v
+		s.verySlowSmoothConst = v
 	}
 	if v, ok := configMap["gpsWeight"]; ok {
-		gpsWeight = v
+		s.gpsWeight = v
 	}
-	if fastSmoothConst == 0 || slowSmoothConst == 0 || verySlowSmoothConst == 0 {
+	if s.fastSmoothConst == 0 || s.slowSmoothConst == 0 || s.verySlowSmoothConst == 0 {
 		// This doesn't make sense, means user hasn't set correctly.
 		// Set sensible defaults.
-		fastSmoothConst = fastSmoothConstDefault
-		slowSmoothConst = slowSmoothConstDefault
-		verySlowSmoothConst = verySlowSmoothConstDefault
-		gpsWeight = gpsWeightDefault
+		s.fastSmoothConst = fastSmoothConstDefault
+		s.slowSmoothConst = slowSmoothConstDefault
+		s.verySlowSmoothConst = verySlowSmoothConstDefault
+		s.gpsWeight = gpsWeightDefault
 	}
 }
 
@@ -297,6 +413,12 @@ func (s *SimpleState) updateLogMap(m *Measurement, p map[string]interface{}) {
 		"SmoothW2":          func(s *SimpleState, m *Measurement) float64 { return s.smoothW2 },
 		"SmoothGroundSpeed": func(s *SimpleState, m *Measurement) float64 { return s.smoothGS },
 		"TWa":               func(s *SimpleState, m *Measurement) float64 { return s.tW },
+		"TUa":               func(s *SimpleState, m *Measurement) float64 { return s.tU },
+		"U1":                func(s *SimpleState, m *Measurement) float64 { return s.U1 },
+		"V1":                func(s *SimpleState, m *Measurement) float64 { return s.V1 },
+		"V2":                func(s *SimpleState, m *Measurement) float64 { return s.V2 },
+		"V3":                func(s *SimpleState, m *Measurement) float64 { return s.V3 },
+		"Sideslip":          func(s *SimpleState, m *Measurement) float64 { return s.sideslip / Deg },
 		"W1a":               func(s *SimpleState, m *Measurement) float64 { return s.w1 },
 		"W2a":               func(s *SimpleState, m *Measurement) float64 { return s.w2 },
 		"W3a":               func(s *SimpleState, m *Measurement) float64 { return s.w3 },
@@ -314,6 +436,12 @@ func (s *SimpleState) updateLogMap(m *Measurement, p map[string]interface{}) {
 			}
 			return 0
 		},
+		"airspeedValid": func(s *SimpleState, m *Measurement) float64 {
+			if s.airspeedValid {
+				return 1
+			}
+			return 0
+		},
 		"headingValid": func(s *SimpleState, m *Measurement) float64 {
 			if s.headingValid {
 				return 1
@@ -336,6 +464,10 @@ var SimpleJSONConfig = `{
     ["gLoad", null, null, "gLoadActual", 1],
     ["slipSkid", null, null, "slipSkidActual", 0],
     ["GroundSpeed", null, null, null, 0],
+    ["U1", null, null, "U1Actual", 0],
+    ["V1", null, null, "V1Actual", 0],
+    ["V2", null, null, "V2Actual", 0],
+    ["Sideslip", null, null, null, 0],
     ["T", null, null, null, null],
     ["E0", "EGPS0", "EGyr0", "E0Actual", null],
     ["E1", "EGPS1", "EGyr1", "E1Actual", null],
@@ -355,6 +487,7 @@ var SimpleJSONConfig = `{
     ["D3", null, null, "D3Actual", 0]
   ],
   "Measurement": [
+    ["U1", null, 0],
     ["W1", "W1a", 0],
     ["W2", "W2a", 0],
     ["W3", "W3a", 0],
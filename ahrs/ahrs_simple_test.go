@@ -0,0 +1,84 @@
+package ahrs
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestSimpleAirspeedTurn flies a standard-rate coordinated turn to the right in a wind from the west and
+// checks that SimpleState, with airspeed, finds the bank angle, the wind and the heading (not the track),
+// and that a noisy airspeed sampled quickly doesn't show up as a large along-track acceleration.
+func TestSimpleAirspeedTurn(t *testing.T) {
+	tests := []struct {
+		name     string
+		dt       float64 // s
+		asiNoise float64 // kt
+	}{
+		{"Noiseless", 0.1, 0},
+		{"NoisyAirspeed", 0.02, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simpleAirspeedTurn(t, tt.dt, tt.asiNoise)
+		})
+	}
+}
+
+func simpleAirspeedTurn(t *testing.T, dt, asiNoise float64) {
+	const (
+		tas   = 100.0   // kt
+		omega = 3 * Deg // Rate of turn, Rad/s
+	)
+	wind := [3]float64{10, 0, 0} // Blowing toward the east, kt
+	roll := math.Atan(omega * tas / G)
+	rnd := rand.New(rand.NewSource(1))
+
+	s := NewSimpleAHRS()
+	var heading, maxRollErr, maxDU float64
+	n := int(300 / dt)
+	for i := 0; i < n; i++ {
+		tt := float64(i) * dt
+		heading = math.Mod(omega*tt, 2*Pi)
+		e0, e1, e2, e3 := ToQuaternion(roll, 0, heading)
+		r := QuaternionToRotationMatrix(e0, e1, e2, e3)
+
+		// Accelerometer reads gravity plus the centripetal acceleration, toward the right wing
+		ae := [3]float64{tas * omega * math.Cos(heading) / G, -tas * omega * math.Sin(heading) / G, 1}
+		m := NewMeasurement()
+		m.UValid, m.WValid, m.SValid = true, true, true
+		m.U1 = tas + rnd.NormFloat64()*asiNoise
+		m.W1 = tas*math.Sin(heading) + wind[0]
+		m.W2 = tas*math.Cos(heading) + wind[1]
+		m.A1 = r[0][0]*ae[0] + r[1][0]*ae[1] + r[2][0]*ae[2]
+		m.A2 = r[0][1]*ae[0] + r[1][1]*ae[1] + r[2][1]*ae[2]
+		m.A3 = r[0][2]*ae[0] + r[1][2]*ae[1] + r[2][2]*ae[2]
+		m.B1, m.B2, m.B3 = -r[2][0]*omega/Deg, -r[2][1]*omega/Deg, -r[2][2]*omega/Deg
+		m.T, m.TU, m.TW = tt, tt, tt
+		s.Compute(m)
+
+		if gotRoll, _, _ := s.RollPitchHeading(); i > n/2 {
+			maxRollErr = math.Max(maxRollErr, math.Abs(gotRoll-roll))
+			maxDU = math.Max(maxDU, math.Abs(s.du1))
+		}
+	}
+
+	if maxDU/G > 0.02 { // The airspeed is constant
+		t.Errorf("airspeed acceleration is up to %f G", maxDU/G)
+	}
+	if maxRollErr/Deg > 2 {
+		t.Errorf("roll is up to %f off %f", maxRollErr/Deg, roll/Deg)
+	}
+	_, _, gotHeading := s.RollPitchHeading()
+	if math.Abs(AngleDiff(gotHeading, heading))/Deg > 2 {
+		t.Errorf("heading = %f, want %f", gotHeading/Deg, heading/Deg)
+	}
+	if dt < 0.1 { // The wind estimate is smoothed per GPS sample, which come at most every 0.1 s
+		return
+	}
+	st := s.GetState()
+	if math.Hypot(st.V1-wind[0], st.V2-wind[1]) > 1 {
+		t.Errorf("wind = %f, %f, want %f, %f", st.V1, st.V2, wind[0], wind[1])
+	}
+}
@@ -168,7 +168,7 @@ func (s *State) init(m *Measurement) {
 	// Initialize Magnetic Heading, Slip/Skid, Rate of Turn, and GLoad.
 	_, _, s.headingMag = Regularize(0, 0, math.Atan2(m1, m2))
 	s.slipSkid = math.Atan2(a2, -a3)
-	s.turnRate = b3 * Deg
+	s.turnRate = -b3 * Deg // E is level, so -b3 is the rate of turn to the right
 	s.gLoad = -a3 / s.aNorm
 
 	s.updateLogMap(m, s.logMap)
@@ -10,7 +10,7 @@ import (
 )
 
 func createRandomState() (s *KalmanState) {
-	s = &KalmanState{State{
+	s = &KalmanState{State: State{
 		U1: rand.Float64()*100 + 15,
 		U2: rand.Float64()*10 - 5,
 		U3: rand.Float64()*10 - 5,
@@ -103,6 +103,26 @@ func QuaternionRotate(q0, q1, q2, q3, h1, h2, h3 float64) (r0, r1, r2, r3 float6
 	return QuaternionNormalize(r0, r1, r2, r3)
 }
 
+// QuaternionMultiply returns the quaternion product q*r.
+func QuaternionMultiply(q0, q1, q2, q3, r0, r1, r2, r3 float64) (p0, p1, p2, p3 float64) {
+	p0 = q0*r0 - q1*r1 - q2*r2 - q3*r3
+	p1 = q0*r1 + q1*r0 + q2*r3 - q3*r2
+	p2 = q0*r2 - q1*r3 + q2*r0 + q3*r1
+	p3 = q0*r3 + q1*r2 - q2*r1 + q3*r0
+	return
+}
+
+// QuaternionFromRotationVector returns the unit quaternion rotating by the angle |v| (radians)
+// about the axis v.  Unlike QuaternionRotate, it is exact for large rotations.
+func QuaternionFromRotationVector(v1, v2, v3 float64) (q0, q1, q2, q3 float64) {
+	vv := math.Sqrt(v1*v1 + v2*v2 + v3*v3)
+	if vv < Small {
+		return QuaternionNormalize(1, 0.5*v1, 0.5*v2, 0.5*v3)
+	}
+	sv := math.Sin(vv/2) / vv
+	return math.Cos(vv / 2), sv * v1, sv * v2, sv * v3
+}
+
 // RotationMatrixToQuaternion computes the quaternion q corresponding to a rotation matrix r.
 func RotationMatrixToQuaternion(r [3][3]float64) (q0, q1, q2, q3 float64) {
 	q0 = math.Sqrt(1+r[0][0]+r[1][1]+r[2][2]) / 2
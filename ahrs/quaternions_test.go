@@ -374,3 +374,33 @@ func TestSmallCompositions(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestQuaternionMultiply(t *testing.T) {
+	q := quaternion.Quaternion{W: 0.5, X: -0.1, Y: 0.7, Z: 0.2}
+	r := quaternion.Quaternion{W: -0.3, X: 0.4, Y: 0.1, Z: 0.9}
+	want := quaternion.Prod(q, r)
+	p0, p1, p2, p3 := QuaternionMultiply(q.W, q.X, q.Y, q.Z, r.W, r.X, r.Y, r.Z)
+	if notSmall(p0-want.W) || notSmall(p1-want.X) || notSmall(p2-want.Y) || notSmall(p3-want.Z) {
+		t.Errorf("QuaternionMultiply() = %f %f %f %f, want %v", p0, p1, p2, p3, want)
+	}
+}
+
+func TestQuaternionFromRotationVector(t *testing.T) {
+	// A large rotation in one step should match many small steps of QuaternionRotate
+	h1, h2, h3 := 0.6, -1.1, 0.9
+	n := 10000
+	var q0, q1, q2, q3 float64 = 1, 0, 0, 0
+	for i := 0; i < n; i++ {
+		q0, q1, q2, q3 = QuaternionRotate(q0, q1, q2, q3, h1/float64(n), h2/float64(n), h3/float64(n))
+	}
+
+	r0, r1, r2, r3 := QuaternionFromRotationVector(h1, h2, h3)
+	if notSmall(r0-q0) || notSmall(r1-q1) || notSmall(r2-q2) || notSmall(r3-q3) {
+		t.Errorf("QuaternionFromRotationVector() = %f %f %f %f, want %f %f %f %f", r0, r1, r2, r3, q0, q1, q2, q3)
+	}
+
+	r0, r1, r2, r3 = QuaternionFromRotationVector(0, 0, 0)
+	if r0 != 1 || r1 != 0 || r2 != 0 || r3 != 0 {
+		t.Errorf("QuaternionFromRotationVector(0) = %f %f %f %f, want identity", r0, r1, r2, r3)
+	}
+}
@@ -0,0 +1,122 @@
+package ahrs
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// ConfigParam describes one of the keys accepted by an algorithm's SetConfig.
+type ConfigParam struct {
+	Name        string
+	Description string
+	Default     float64
+	Min, Max    float64 // Inclusive range of valid values
+}
+
+// Algorithm describes an AHRSProvider which can be built by name.
+type Algorithm struct {
+	Name        string
+	Description string
+	New         func() AHRSProvider // Returns a new provider with its default configuration
+	Config      []ConfigParam       // Keys accepted by SetConfig
+	JSONConfig  string              // Chart layout for the analysis web page, if any
+}
+
+var (
+	algorithmsMu sync.RWMutex
+	algorithms   = make(map[string]Algorithm)
+)
+
+// Register makes an algorithm available by name. It panics if the name is
+// empty, already registered, or if New is nil.
+func Register(a Algorithm) {
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+
+	if a.Name == "" || a.New == nil {
+		panic("ahrs: Register needs a name and constructor")
+	}
+	if _, dup := algorithms[a.Name]; dup {
+		panic("ahrs: Register called twice for algorithm " + a.Name)
+	}
+	algorithms[a.Name] = a
+}
+
+// Algorithms returns all registered algorithms, sorted by name.
+func Algorithms() []Algorithm {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+
+	list := make([]Algorithm, 0, len(algorithms))
+	for _, a := range algorithms {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// LookupAlgorithm returns the algorithm registered under name.
+func LookupAlgorithm(name string) (Algorithm, bool) {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+
+	a, ok := algorithms[name]
+	return a, ok
+}
+
+// NewAHRS builds the algorithm registered under name, validates config and
+// applies it on top of the algorithm's defaults. The config belongs to the new
+// provider alone.
+func NewAHRS(name string, config map[string]float64) (AHRSProvider, error) {
+	a, ok := LookupAlgorithm(name)
+	if !ok {
+		return nil, fmt.Errorf("ahrs: unknown algorithm %q", name)
+	}
+
+	if err := a.ValidateConfig(config); err != nil {
+		return nil, err
+	}
+
+	s := a.New()
+	if len(config) > 0 {
+		s.SetConfig(config)
+	}
+
+	return s, nil
+}
+
+// DefaultConfig returns the default value of every config key.
+func (a Algorithm) DefaultConfig() map[string]float64 {
+	cfg := make(map[string]float64, len(a.Config))
+	for _, p := range a.Config {
+		cfg[p.Name] = p.Default
+	}
+	return cfg
+}
+
+// ValidateConfig checks that every key in config is known to the algorithm and
+// that its value is in range.
+func (a Algorithm) ValidateConfig(config map[string]float64) error {
+	for k, v := range config {
+		p, ok := a.param(k)
+		if !ok {
+			return fmt.Errorf("ahrs: unknown config key %q for algorithm %s", k, a.Name)
+		}
+		if math.IsNaN(v) || v < p.Min || v > p.Max {
+			return fmt.Errorf("ahrs: config %s=%g for algorithm %s out of range [%g, %g]", k, v, a.Name, p.Min, p.Max)
+		}
+	}
+	return nil
+}
+
+func (a Algorithm) param(name string) (ConfigParam, bool) {
+	for _, p := range a.Config {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return ConfigParam{}, false
+}
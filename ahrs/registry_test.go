@@ -0,0 +1,201 @@
+package ahrs
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestAlgorithmsRegistered(t *testing.T) {
+	for _, name := range []string{"simple", "kalman", "kalman0", "kalman1", "eskf", "madgwick", "mahony"} {
+		if _, ok := LookupAlgorithm(name); !ok {
+			t.Errorf("algorithm %s not registered", name)
+		}
+	}
+
+	algos := Algorithms()
+	for i := 1; i < len(algos); i++ {
+		if algos[i-1].Name >= algos[i].Name {
+			t.Errorf("Algorithms() not sorted: %s before %s", algos[i-1].Name, algos[i].Name)
+		}
+	}
+}
+
+func TestNewAHRS(t *testing.T) {
+	tests := []struct {
+		name    string
+		algo    string
+		config  map[string]float64
+		wantErr bool
+	}{
+		{"defaults", "simple", nil, false},
+		{"valid config", "simple", map[string]float64{"gpsWeight": 0.1}, false},
+		{"unknown algorithm", "nope", nil, true},
+		{"unknown key", "simple", map[string]float64{"nope": 1}, true},
+		{"out of range", "simple", map[string]float64{"gpsWeight": 2}, true},
+		{"NaN", "simple", map[string]float64{"gpsWeight": math.NaN()}, true},
+		{"no config keys", "kalman1", map[string]float64{"gpsWeight": 0.1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewAHRS(tt.algo, tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAHRS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && s == nil {
+				t.Errorf("NewAHRS() returned nil provider")
+			}
+		})
+	}
+}
+
+// configOf reads back the config of each provider that has one, keyed as in its Config.
+var configOf = map[string]func(interface{}) map[string]float64{
+	"simple": func(p interface{}) map[string]float64 {
+		s := p.(*SimpleState)
+		return map[string]float64{"fastSmoothConst": s.fastSmoothConst, "slowSmoothConst": s.slowSmoothConst,
+			"verySlowSmoothConst": s.verySlowSmoothConst, "gpsWeight": s.gpsWeight}
+	},
+	"kalman": func(p interface{}) map[string]float64 {
+		s := p.(*KalmanState)
+		return map[string]float64{"attitudeNoise": s.attitudeNoise, "gyroNoise": s.gyroNoise,
+			"processNoise": s.processNoise, "biasTimeConstant": s.biasTimeConstant}
+	},
+	"eskf": func(p interface{}) map[string]float64 {
+		s := p.(*ESKFState)
+		return map[string]float64{"gyroNoise": s.gyroNoise, "gyroBiasDrift": s.gyroBiasDrift,
+			"accelNoise": s.accelNoise, "accelBiasDrift": s.accelBiasDrift, "headingNoise": s.headingNoise}
+	},
+	"madgwick": func(p interface{}) map[string]float64 {
+		return map[string]float64{"beta": p.(*MadgwickState).beta}
+	},
+	"mahony": func(p interface{}) map[string]float64 {
+		s := p.(*MahonyState)
+		return map[string]float64{"kp": s.kp, "ki": s.ki}
+	},
+	"baro": func(p interface{}) map[string]float64 {
+		f := p.(*BaroFilter)
+		return map[string]float64{"altitudeNoise": f.altitudeNoise, "gpsVSNoise": f.gpsVSNoise,
+			"accelNoise": f.accelNoise, "accelBiasDrift": f.accelBiasDrift}
+	},
+}
+
+// TestConfigPerInstance checks that every registered provider, and the BaroFilter, keeps the config it was
+// built with while others of its kind are built and configured differently.
+func TestConfigPerInstance(t *testing.T) {
+	type configurable struct {
+		name   string
+		params []ConfigParam
+		build  func(config map[string]float64) (interface{}, error)
+	}
+	var tests []configurable
+	for _, a := range Algorithms() {
+		name := a.Name
+		tests = append(tests, configurable{name, a.Config, func(config map[string]float64) (interface{}, error) {
+			return NewAHRS(name, config)
+		}})
+	}
+	tests = append(tests, configurable{"baro", []ConfigParam{
+		{"altitudeNoise", "", baroAltitudeNoiseDefault, 1, 100},
+		{"gpsVSNoise", "", baroGPSVSNoiseDefault, 0.1, 10},
+		{"accelNoise", "", baroAccelNoiseDefault, 0.001, 1},
+		{"accelBiasDrift", "", baroAccelBiasDriftDefault, 1e-5, 0.1},
+	}, func(config map[string]float64) (interface{}, error) {
+		f := NewBaroFilter()
+		f.SetConfig(config)
+		return f, nil
+	}})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.params) == 0 {
+				t.Skipf("%s has no config", tt.name)
+			}
+			get, ok := configOf[tt.name]
+			if !ok {
+				t.Fatalf("configOf can't read the config of %s", tt.name)
+			}
+
+			// Move every key halfway toward one end of its range, and the other provider's toward the other end
+			defaults, tuned, other := make(map[string]float64), make(map[string]float64), make(map[string]float64)
+			for _, p := range tt.params {
+				defaults[p.Name], tuned[p.Name], other[p.Name] = p.Default, (p.Default+p.Max)/2, (p.Default+p.Min)/2
+			}
+			s, err := tt.build(tuned)
+			if err != nil {
+				t.Fatalf("building with %v: %v", tuned, err)
+			}
+			o, err := tt.build(other)
+			if err != nil {
+				t.Fatalf("building with %v: %v", other, err)
+			}
+			d, err := tt.build(nil)
+			if err != nil {
+				t.Fatalf("building with the defaults: %v", err)
+			}
+
+			for _, c := range []struct {
+				p    interface{}
+				want map[string]float64
+			}{{s, tuned}, {o, other}, {d, defaults}} {
+				if got := get(c.p); !reflect.DeepEqual(got, c.want) {
+					t.Errorf("config = %v, want %v", got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register() didn't panic on a duplicate name")
+		}
+	}()
+	Register(Algorithm{Name: "simple", New: func() AHRSProvider { return NewSimpleAHRS() }})
+}
+
+// TestRateOfTurnRight flies every registered provider through a standard-rate coordinated turn to the right,
+// with the accelerometer convention of the simulator, and checks that each reports a positive rate of turn.
+func TestRateOfTurnRight(t *testing.T) {
+	const (
+		tas   = 100.0   // kt
+		omega = 3 * Deg // Rad/s
+		dt    = 0.05    // s
+	)
+	roll := math.Atan(omega * tas / G)
+	// The development stages of the Kalman filter don't estimate a rate of turn
+	noTurnRate := map[string]bool{"kalman0": true, "kalman1": true}
+
+	for _, a := range Algorithms() {
+		t.Run(a.Name, func(t *testing.T) {
+			if noTurnRate[a.Name] {
+				t.Skipf("%s doesn't estimate a rate of turn", a.Name)
+			}
+			s := a.New()
+			for i := 0; i < 600; i++ {
+				tt := float64(i) * dt
+				heading := math.Mod(omega*tt, 2*Pi)
+				e0, e1, e2, e3 := ToQuaternion(roll, 0, heading)
+				r := QuaternionToRotationMatrix(e0, e1, e2, e3)
+
+				// The accelerometer reads gravity plus the centripetal acceleration, toward the right wing
+				ae := [3]float64{-tas * omega * math.Cos(heading) / G, tas * omega * math.Sin(heading) / G, -1}
+				m := NewMeasurement()
+				m.UValid, m.WValid, m.SValid = true, true, true
+				m.U1 = tas
+				m.W1, m.W2 = tas*math.Sin(heading), tas*math.Cos(heading)
+				m.A1 = r[0][0]*ae[0] + r[1][0]*ae[1] + r[2][0]*ae[2]
+				m.A2 = r[0][1]*ae[0] + r[1][1]*ae[1] + r[2][1]*ae[2]
+				m.A3 = r[0][2]*ae[0] + r[1][2]*ae[1] + r[2][2]*ae[2]
+				m.B1, m.B2, m.B3 = -r[2][0]*omega/Deg, -r[2][1]*omega/Deg, -r[2][2]*omega/Deg
+				m.T, m.TU, m.TW = tt, tt, tt
+				s.Compute(m)
+			}
+
+			if rot := s.RateOfTurn(); !(rot > 0) {
+				t.Errorf("RateOfTurn() = %f in a right turn at %f°/s, want positive", rot, omega/Deg)
+			}
+		})
+	}
+}
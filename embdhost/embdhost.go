@@ -0,0 +1,25 @@
+/*
+Package embdhost registers embd's host drivers, for programs that open their buses with embd rather than
+i2cdev.  The sensor drivers take a sensors.I2CBus and no longer pull the host drivers in themselves, so
+without this package embd.NewI2CBus finds no host to open the bus on.
+*/
+package embdhost
+
+import (
+	"fmt"
+
+	"github.com/kidoman/embd"
+	_ "github.com/kidoman/embd/host/all" // Registers the host drivers with embd
+	_ "github.com/kidoman/embd/host/rpi" // Registers the Raspberry Pi host driver with embd
+)
+
+// NewI2CBus returns I2C bus n, /dev/i2c-n, opened with embd's host driver.
+// embd panics on a host it doesn't support, which NewI2CBus returns as an error instead.
+func NewI2CBus(n byte) (bus embd.I2CBus, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("embdhost: %v", r)
+		}
+	}()
+	return embd.NewI2CBus(n), nil
+}
@@ -0,0 +1,275 @@
+package gdl90
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// iLevil CompanyID, PackageID and Version
+const (
+	CID      = "LE"  // iLevil CompanyID
+	PIDAHRS  = 0x01  // AHRS PackageID
+	PIDAHRS1 = 0x01  // AHRS PackageID Version 1
+	INTERR   = 32767 // Error value for int16 types
+	UINTERR  = 65535 // Error value for uint16 types
+
+	AHRSMsgSize = 24 // Size of the AHRS message without FCS and framing
+)
+
+var ahrsErrorStr = "AHRS Message Error: %s"
+
+// AHRSMsg contains the data from an iLevil AHRS version 1 message
+type AHRSMsg struct {
+	companyID        string
+	packageID        byte
+	packageIDVersion byte
+	roll             int16
+	pitch            int16
+	yaw              int16
+	inclination      int16
+	turnCoord        int16
+	gLoad            int16
+	kias             int16
+	pAlt             uint16
+	vertSpeed        int16
+}
+
+// NewAHRSMsg returns an AHRSMsg with all its values marked as invalid.
+func NewAHRSMsg() *AHRSMsg {
+	return &AHRSMsg{
+		companyID:        CID,
+		packageID:        PIDAHRS,
+		packageIDVersion: PIDAHRS1,
+		roll:             INTERR,
+		pitch:            INTERR,
+		yaw:              INTERR,
+		inclination:      INTERR,
+		turnCoord:        INTERR,
+		gLoad:            INTERR,
+		kias:             INTERR,
+		pAlt:             UINTERR,
+		vertSpeed:        INTERR,
+	}
+}
+
+func (dat *AHRSMsg) MessageID() byte {
+	return MsgIDAHRS
+}
+
+func (dat *AHRSMsg) MarshalBinary() ([]byte, error) {
+	msg := make([]byte, AHRSMsgSize)
+
+	copy(msg[0:2], CID)
+	msg[2] = PIDAHRS
+	msg[3] = PIDAHRS1
+
+	putInt(msg[4:6], dat.roll)
+	putInt(msg[6:8], dat.pitch)
+	putInt(msg[8:10], dat.yaw)
+	putInt(msg[10:12], dat.inclination)
+	putInt(msg[12:14], dat.turnCoord)
+	putInt(msg[14:16], dat.gLoad)
+	putInt(msg[16:18], dat.kias)
+	putUint(msg[18:20], dat.pAlt)
+	putInt(msg[20:22], dat.vertSpeed)
+	putInt(msg[22:24], INTERR) // Reserved
+
+	return msg, nil
+}
+
+func (dat *AHRSMsg) UnmarshalBinary(msg []byte) (err error) {
+	if len(msg) != AHRSMsgSize {
+		err = fmt.Errorf(ahrsErrorStr, fmt.Sprintf("Message length was %d, should be %d", len(msg), AHRSMsgSize))
+		return
+	}
+	if s := string(msg[0:2]); s != CID {
+		err = fmt.Errorf(ahrsErrorStr, fmt.Sprintf("Incorrect CompanyID: %s", string(msg[0:2])))
+		return
+	} else {
+		dat.companyID = s
+	}
+	if s := msg[2]; s != PIDAHRS {
+		err = fmt.Errorf(ahrsErrorStr, fmt.Sprintf("Expecting ProductID 0x01, received %b", msg[2]))
+		return
+	} else {
+		dat.packageID = s
+	}
+	if s := msg[3]; s != PIDAHRS1 {
+		err = fmt.Errorf(ahrsErrorStr, fmt.Sprintf("Expecting ProductID Version 0x01, received %b", msg[3]))
+		return
+	} else {
+		dat.packageIDVersion = s
+	}
+
+	dat.roll = bytes2int(msg[4:6])
+	dat.pitch = bytes2int(msg[6:8])
+	dat.yaw = bytes2int(msg[8:10])
+	dat.inclination = bytes2int(msg[10:12])
+	dat.turnCoord = bytes2int(msg[12:14])
+	dat.gLoad = bytes2int(msg[14:16])
+	dat.kias = bytes2int(msg[16:18])
+	dat.pAlt = bytes2uint(msg[18:20])
+	dat.vertSpeed = bytes2int(msg[20:22])
+
+	return
+}
+
+func (dat *AHRSMsg) Roll() (roll float64, err error) {
+	if dat.roll == INTERR {
+		err = errors.New("Bad Roll value")
+	} else {
+		roll = float64(dat.roll) / 10
+	}
+	return
+}
+
+func (dat *AHRSMsg) Pitch() (pitch float64, err error) {
+	if dat.pitch == INTERR {
+		err = errors.New("Bad Pitch value")
+	} else {
+		pitch = float64(dat.pitch) / 10
+	}
+	return
+}
+
+func (dat *AHRSMsg) Yaw() (yaw float64, err error) {
+	if dat.yaw == INTERR {
+		err = errors.New("Bad Yaw value")
+	} else {
+		yaw = float64(dat.yaw) / 10
+	}
+	return
+}
+
+func (dat *AHRSMsg) Inclination() (inclination float64, err error) {
+	if dat.inclination == INTERR {
+		err = errors.New("Bad Inclination value")
+	} else {
+		inclination = float64(dat.inclination) / 10
+	}
+	return
+}
+
+func (dat *AHRSMsg) TurnCoord() (turnCoord float64, err error) {
+	if dat.turnCoord == INTERR {
+		err = errors.New("Bad TurnCoord value")
+	} else {
+		turnCoord = float64(dat.turnCoord) / 10
+	}
+	return
+}
+
+func (dat *AHRSMsg) GLoad() (gLoad float64, err error) {
+	if dat.gLoad == INTERR {
+		err = errors.New("Bad GLoad value")
+	} else {
+		gLoad = float64(dat.gLoad) / 10
+	}
+	return
+}
+
+func (dat *AHRSMsg) KIAS() (kias float64, err error) {
+	if dat.kias == INTERR {
+		err = errors.New("Bad KIAS value")
+	} else {
+		kias = float64(dat.kias) / 10
+	}
+	return
+}
+
+func (dat *AHRSMsg) PAlt() (pAlt float64, err error) {
+	if dat.pAlt == UINTERR {
+		err = errors.New("Bad PAlt value")
+	} else {
+		pAlt = float64(dat.pAlt) - 5000
+	}
+	return
+}
+
+func (dat *AHRSMsg) VertSpeed() (vertSpeed float64, err error) {
+	if dat.vertSpeed == INTERR {
+		err = errors.New("Bad VertSpeed value")
+	} else {
+		vertSpeed = float64(dat.vertSpeed)
+	}
+	return
+}
+
+// SetRoll sets the roll in degrees, or marks it invalid if roll is NaN.
+func (dat *AHRSMsg) SetRoll(roll float64) {
+	dat.roll = scaleInt(roll, 10)
+}
+
+// SetPitch sets the pitch in degrees, or marks it invalid if pitch is NaN.
+func (dat *AHRSMsg) SetPitch(pitch float64) {
+	dat.pitch = scaleInt(pitch, 10)
+}
+
+// SetYaw sets the heading in degrees, or marks it invalid if yaw is NaN.
+func (dat *AHRSMsg) SetYaw(yaw float64) {
+	dat.yaw = scaleInt(yaw, 10)
+}
+
+// SetInclination sets the slip/skid in degrees, or marks it invalid if
+// inclination is NaN.
+func (dat *AHRSMsg) SetInclination(inclination float64) {
+	dat.inclination = scaleInt(inclination, 10)
+}
+
+// SetTurnCoord sets the rate of turn in degrees per second, or marks it
+// invalid if turnCoord is NaN.
+func (dat *AHRSMsg) SetTurnCoord(turnCoord float64) {
+	dat.turnCoord = scaleInt(turnCoord, 10)
+}
+
+// SetGLoad sets the G load in G, or marks it invalid if gLoad is NaN.
+func (dat *AHRSMsg) SetGLoad(gLoad float64) {
+	dat.gLoad = scaleInt(gLoad, 10)
+}
+
+// SetKIAS sets the indicated airspeed in knots, or marks it invalid if kias is
+// NaN.
+func (dat *AHRSMsg) SetKIAS(kias float64) {
+	dat.kias = scaleInt(kias, 10)
+}
+
+// SetPAlt sets the pressure altitude in feet, or marks it invalid if pAlt is
+// NaN or out of range.
+func (dat *AHRSMsg) SetPAlt(pAlt float64) {
+	if math.IsNaN(pAlt) || pAlt < -5000 || pAlt+5000 >= UINTERR {
+		dat.pAlt = UINTERR
+		return
+	}
+	dat.pAlt = uint16(math.Round(pAlt + 5000))
+}
+
+// SetVertSpeed sets the vertical speed in feet per minute, or marks it invalid
+// if vertSpeed is NaN.
+func (dat *AHRSMsg) SetVertSpeed(vertSpeed float64) {
+	dat.vertSpeed = scaleInt(vertSpeed, 1)
+}
+
+func (dat *AHRSMsg) String() string {
+	return fmt.Sprintf("AHRS roll %s, pitch %s, yaw %s, inclination %s, turn coordinator %s, G load %s, KIAS %s, pressure altitude %s, vertical speed %s",
+		formatValue(dat.Roll()), formatValue(dat.Pitch()), formatValue(dat.Yaw()),
+		formatValue(dat.Inclination()), formatValue(dat.TurnCoord()), formatValue(dat.GLoad()),
+		formatValue(dat.KIAS()), formatValue(dat.PAlt()), formatValue(dat.VertSpeed()))
+}
+
+// scaleInt converts v into a signed 16-bit value with the given scale, using
+// INTERR for values which are NaN or don't fit.
+func scaleInt(v, scale float64) int16 {
+	v = math.Round(v * scale)
+	if math.IsNaN(v) || v >= INTERR || v <= -INTERR {
+		return INTERR
+	}
+	return int16(v)
+}
+
+func formatValue(v float64, err error) string {
+	if err != nil {
+		return "invalid"
+	}
+	return fmt.Sprintf("%.1f", v)
+}
@@ -0,0 +1,221 @@
+package gdl90
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"time"
+
+	"github.com/westphae/goflying/ahrs"
+)
+
+// DefaultBroadcastRate is the rate at which AHRS messages are sent unless
+// WithBroadcastRate is used. Stratux sends its AHRS messages at 5Hz.
+const DefaultBroadcastRate = 200 * time.Millisecond
+
+// Logger receives the errors of the broadcasting goroutine started by
+// AHRSBroadcaster.Start.
+var Logger = log.Default()
+
+// AHRSBroadcaster sends the attitude estimated by an ahrs.AHRSProvider as
+// iLevil and ForeFlight AHRS messages to one or more UDP destinations.
+type AHRSBroadcaster struct {
+	provider  ahrs.AHRSProvider
+	conns     []net.Conn
+	rate      time.Duration
+	pAlt      func() float64
+	vertSpeed func() float64
+}
+
+// NewAHRSBroadcaster returns an AHRSBroadcaster reading from provider and
+// sending to each of the "host:port" UDP destinations. One or more
+// BroadcasterSettingFunc functions can be specified to change the defaults.
+func NewAHRSBroadcaster(provider ahrs.AHRSProvider, destinations []string, settings ...BroadcasterSettingFunc) (*AHRSBroadcaster, error) {
+	b := &AHRSBroadcaster{
+		provider: provider,
+		rate:     DefaultBroadcastRate,
+	}
+
+	for _, f := range settings {
+		if err := f(b); err != nil {
+			return nil, fmt.Errorf("gdl90: %w", err)
+		}
+	}
+
+	for _, dest := range destinations {
+		conn, err := net.Dial("udp", dest)
+		if err != nil {
+			b.Close()
+			return nil, fmt.Errorf("gdl90: %w", err)
+		}
+		b.conns = append(b.conns, conn)
+	}
+
+	return b, nil
+}
+
+// Start starts the broadcasting goroutine and returns a stop function.
+// The provider is read from the broadcasting goroutine, so callers updating it
+// concurrently should instead call Send from their own loop.
+func (b *AHRSBroadcaster) Start(ctx context.Context) func() {
+	broadcastCtx, cancel := context.WithCancel(ctx)
+
+	go b.broadcast(broadcastCtx)
+
+	return cancel
+}
+
+func (b *AHRSBroadcaster) broadcast(ctx context.Context) {
+	ticker := time.NewTicker(b.rate)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Send(); err != nil {
+				Logger.Printf("gdl90: error sending AHRS messages: %v\n", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Send encodes the current state of the provider and sends it once to every
+// destination.
+func (b *AHRSBroadcaster) Send() error {
+	frames, err := b.Frames()
+	if err != nil {
+		return err
+	}
+
+	for _, conn := range b.conns {
+		for _, frame := range frames {
+			if _, err := conn.Write(frame); err != nil {
+				return fmt.Errorf("gdl90: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Frames returns the framed iLevil and ForeFlight AHRS messages for the
+// current state of the provider.
+func (b *AHRSBroadcaster) Frames() ([][]byte, error) {
+	ilevil, foreflight := b.Messages()
+
+	frames := make([][]byte, 0, 2)
+	for _, msg := range []Message{ilevil, foreflight} {
+		frame, err := Encode(msg)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+
+	return frames, nil
+}
+
+// Messages returns the iLevil and ForeFlight AHRS messages for the current
+// state of the provider. Values the provider reports as ahrs.Invalid, and all
+// values if the provider's state isn't valid, are sent as invalid. The heading
+// is flagged as magnetic if the provider is an ahrs.MagneticHeadingProvider
+// reporting so, and as true otherwise.
+func (b *AHRSBroadcaster) Messages() (*AHRSMsg, *ForeFlightAHRS) {
+	ilevil := NewAHRSMsg()
+	foreflight := &ForeFlightAHRS{}
+
+	if b.pAlt != nil {
+		ilevil.SetPAlt(b.pAlt())
+	}
+	if b.vertSpeed != nil {
+		ilevil.SetVertSpeed(b.vertSpeed())
+	}
+
+	if !b.provider.Valid() {
+		return ilevil, foreflight
+	}
+
+	// The provider's attitude is in radians, the rest in degrees
+	roll, pitch, heading := b.provider.RollPitchHeading()
+	roll, pitch, heading = fromRadians(roll), fromRadians(pitch), fromRadians(heading)
+
+	ilevil.SetRoll(roll)
+	ilevil.SetPitch(pitch)
+	ilevil.SetYaw(heading)
+	ilevil.SetInclination(validOrNaN(b.provider.SlipSkid()))
+	ilevil.SetTurnCoord(validOrNaN(b.provider.RateOfTurn()))
+	ilevil.SetGLoad(validOrNaN(b.provider.GLoad()))
+
+	foreflight.Roll, foreflight.RollValid = roll, !math.IsNaN(roll)
+	foreflight.Pitch, foreflight.PitchValid = pitch, !math.IsNaN(pitch)
+	foreflight.Heading, foreflight.HeadingValid = heading, !math.IsNaN(heading)
+	if p, ok := b.provider.(ahrs.MagneticHeadingProvider); ok {
+		foreflight.HeadingMagnetic = p.HeadingMagnetic()
+	}
+
+	return ilevil, foreflight
+}
+
+// Close closes the connections to all destinations.
+func (b *AHRSBroadcaster) Close() error {
+	var err error
+	for _, conn := range b.conns {
+		if e := conn.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	b.conns = nil
+
+	return err
+}
+
+func fromRadians(v float64) float64 {
+	if v == ahrs.Invalid {
+		return math.NaN()
+	}
+	return v / ahrs.Deg
+}
+
+func validOrNaN(v float64) float64 {
+	if v == ahrs.Invalid {
+		return math.NaN()
+	}
+	return v
+}
+
+// BroadcasterSettingFunc represents a function that modifies one of the
+// settings of an AHRSBroadcaster.
+type BroadcasterSettingFunc func(b *AHRSBroadcaster) error
+
+// WithBroadcastRate sets the interval between AHRS messages.
+func WithBroadcastRate(rate time.Duration) BroadcasterSettingFunc {
+	return func(b *AHRSBroadcaster) error {
+		if rate <= 0 {
+			return fmt.Errorf("invalid broadcast rate %s", rate)
+		}
+		b.rate = rate
+		return nil
+	}
+}
+
+// WithPressureAltitude sets a function returning the pressure altitude in feet
+// to include in the iLevil AHRS message, or NaN if it isn't available.
+func WithPressureAltitude(pAlt func() float64) BroadcasterSettingFunc {
+	return func(b *AHRSBroadcaster) error {
+		b.pAlt = pAlt
+		return nil
+	}
+}
+
+// WithVerticalSpeed sets a function returning the vertical speed in feet per
+// minute to include in the iLevil AHRS message, or NaN if it isn't available.
+func WithVerticalSpeed(vertSpeed func() float64) BroadcasterSettingFunc {
+	return func(b *AHRSBroadcaster) error {
+		b.vertSpeed = vertSpeed
+		return nil
+	}
+}
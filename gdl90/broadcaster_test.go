@@ -0,0 +1,142 @@
+package gdl90
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/westphae/goflying/ahrs"
+)
+
+// testProvider returns fixed values for the parts of ahrs.AHRSProvider the
+// broadcaster uses.
+type testProvider struct {
+	ahrs.AHRSProvider
+	roll, pitch, heading, slipSkid, turnRate, gLoad float64
+	valid                                           bool
+}
+
+func (p *testProvider) RollPitchHeading() (float64, float64, float64) {
+	return p.roll, p.pitch, p.heading
+}
+func (p *testProvider) SlipSkid() float64   { return p.slipSkid }
+func (p *testProvider) RateOfTurn() float64 { return p.turnRate }
+func (p *testProvider) GLoad() float64      { return p.gLoad }
+func (p *testProvider) Valid() bool         { return p.valid }
+
+func TestAHRSBroadcaster(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	defer conn.Close()
+
+	provider := &testProvider{
+		roll: -10 * ahrs.Deg, pitch: 5 * ahrs.Deg, heading: ahrs.Invalid,
+		slipSkid: 1.5, turnRate: ahrs.Invalid, gLoad: 1.2, valid: true,
+	}
+	b, err := NewAHRSBroadcaster(provider, []string{conn.LocalAddr().String()},
+		WithPressureAltitude(func() float64 { return 2500 }),
+		WithVerticalSpeed(func() float64 { return math.NaN() }),
+	)
+	if err != nil {
+		t.Fatalf("NewAHRSBroadcaster() error = %v", err)
+	}
+	defer b.Close()
+
+	if err := b.Send(); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	var msgs []Message
+	buf := make([]byte, 1024)
+	for i := 0; i < 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("ReadFrom() error = %v", err)
+		}
+		msg, err := Decode(buf[:n])
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	ilevil, ok := msgs[0].(*AHRSMsg)
+	if !ok {
+		t.Fatalf("first message is %T, want *AHRSMsg", msgs[0])
+	}
+	if roll, err := ilevil.Roll(); err != nil || roll != -10 {
+		t.Errorf("Roll() = %v, %v, want -10", roll, err)
+	}
+	if _, err := ilevil.Yaw(); err == nil {
+		t.Errorf("Yaw() is valid, want invalid")
+	}
+	if _, err := ilevil.TurnCoord(); err == nil {
+		t.Errorf("TurnCoord() is valid, want invalid")
+	}
+	if pAlt, err := ilevil.PAlt(); err != nil || pAlt != 2500 {
+		t.Errorf("PAlt() = %v, %v, want 2500", pAlt, err)
+	}
+	if _, err := ilevil.VertSpeed(); err == nil {
+		t.Errorf("VertSpeed() is valid, want invalid")
+	}
+
+	foreflight, ok := msgs[1].(*ForeFlightAHRS)
+	if !ok {
+		t.Fatalf("second message is %T, want *ForeFlightAHRS", msgs[1])
+	}
+	want := ForeFlightAHRS{Roll: -10, RollValid: true, Pitch: 5, PitchValid: true}
+	if *foreflight != want {
+		t.Errorf("ForeFlightAHRS = %+v, want %+v", *foreflight, want)
+	}
+}
+
+func TestAHRSBroadcasterInvalidProvider(t *testing.T) {
+	b, err := NewAHRSBroadcaster(&testProvider{roll: 0.1, valid: false}, nil)
+	if err != nil {
+		t.Fatalf("NewAHRSBroadcaster() error = %v", err)
+	}
+
+	ilevil, foreflight := b.Messages()
+	if _, err := ilevil.Roll(); err == nil {
+		t.Errorf("Roll() is valid, want invalid")
+	}
+	if foreflight.RollValid {
+		t.Errorf("ForeFlight roll is valid, want invalid")
+	}
+}
+
+// magneticProvider is a testProvider whose heading is magnetic.
+type magneticProvider struct {
+	testProvider
+}
+
+func (p *magneticProvider) HeadingMagnetic() bool { return true }
+
+func TestAHRSBroadcasterHeadingReference(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ahrs.AHRSProvider
+		magnetic bool
+	}{
+		{"True", &testProvider{heading: 90 * ahrs.Deg, valid: true}, false},
+		{"Magnetic", &magneticProvider{testProvider{heading: 90 * ahrs.Deg, valid: true}}, true},
+		{"Madgwick", ahrs.NewMadgwickAHRS(), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewAHRSBroadcaster(tt.provider, nil)
+			if err != nil {
+				t.Fatalf("NewAHRSBroadcaster() error = %v", err)
+			}
+
+			if _, foreflight := b.Messages(); foreflight.HeadingMagnetic != tt.magnetic {
+				t.Errorf("HeadingMagnetic = %v, want %v", foreflight.HeadingMagnetic, tt.magnetic)
+			}
+		})
+	}
+}
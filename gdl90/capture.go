@@ -0,0 +1,192 @@
+package gdl90
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// A capture file starts with captureMagic followed by a version byte, then
+// holds one record per datagram: the reception time in Unix nanoseconds as a
+// big endian int64, the datagram length as a big endian uint32 and the
+// datagram itself.
+const (
+	captureMagic      = "GDL90CAP"
+	captureVersion    = 1
+	captureRecordSize = 12
+	maxPacketSize     = 65535
+)
+
+var ErrCaptureFormat = errors.New("gdl90: unrecognized capture file format")
+
+// Packet is a single UDP datagram, as received at Time.
+type Packet struct {
+	Time time.Time
+	Data []byte
+}
+
+// PacketReader is implemented by the capture file readers. ReadPacket returns
+// io.EOF at the end of the capture.
+type PacketReader interface {
+	ReadPacket() (Packet, error)
+}
+
+// CaptureWriter records datagrams to a capture file.
+type CaptureWriter struct {
+	w *bufio.Writer
+}
+
+// NewCaptureWriter writes the capture file header to w and returns a
+// CaptureWriter ready to record packets.
+func NewCaptureWriter(w io.Writer) (*CaptureWriter, error) {
+	cw := &CaptureWriter{w: bufio.NewWriter(w)}
+
+	if _, err := cw.w.WriteString(captureMagic); err != nil {
+		return nil, fmt.Errorf("gdl90: %w", err)
+	}
+	if err := cw.w.WriteByte(captureVersion); err != nil {
+		return nil, fmt.Errorf("gdl90: %w", err)
+	}
+
+	return cw, cw.Flush()
+}
+
+// WritePacket records p. Packets are buffered until Flush is called.
+func (cw *CaptureWriter) WritePacket(p Packet) error {
+	var hdr [captureRecordSize]byte
+	binary.BigEndian.PutUint64(hdr[0:8], uint64(p.Time.UnixNano()))
+	binary.BigEndian.PutUint32(hdr[8:12], uint32(len(p.Data)))
+
+	if _, err := cw.w.Write(hdr[:]); err != nil {
+		return fmt.Errorf("gdl90: %w", err)
+	}
+	if _, err := cw.w.Write(p.Data); err != nil {
+		return fmt.Errorf("gdl90: %w", err)
+	}
+
+	return nil
+}
+
+// Flush writes any buffered packets to the underlying writer.
+func (cw *CaptureWriter) Flush() error {
+	if err := cw.w.Flush(); err != nil {
+		return fmt.Errorf("gdl90: %w", err)
+	}
+	return nil
+}
+
+// CaptureReader reads datagrams from a capture file written by CaptureWriter.
+type CaptureReader struct {
+	r io.Reader
+}
+
+// NewCaptureReader checks the capture file header in r and returns a
+// CaptureReader positioned at the first packet.
+func NewCaptureReader(r io.Reader) (*CaptureReader, error) {
+	hdr := make([]byte, len(captureMagic)+1)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("gdl90: reading capture header: %w", err)
+	}
+	if string(hdr[:len(captureMagic)]) != captureMagic {
+		return nil, ErrCaptureFormat
+	}
+	if v := hdr[len(captureMagic)]; v != captureVersion {
+		return nil, fmt.Errorf("gdl90: unsupported capture file version %d", v)
+	}
+
+	return &CaptureReader{r: r}, nil
+}
+
+func (cr *CaptureReader) ReadPacket() (Packet, error) {
+	var hdr [captureRecordSize]byte
+	if _, err := io.ReadFull(cr.r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return Packet{}, fmt.Errorf("gdl90: truncated capture record: %w", err)
+		}
+		return Packet{}, err
+	}
+
+	n := binary.BigEndian.Uint32(hdr[8:12])
+	if n > maxPacketSize {
+		return Packet{}, fmt.Errorf("gdl90: capture record length %d too large", n)
+	}
+
+	p := Packet{
+		Time: time.Unix(0, int64(binary.BigEndian.Uint64(hdr[0:8]))),
+		Data: make([]byte, n),
+	}
+	if _, err := io.ReadFull(cr.r, p.Data); err != nil {
+		return Packet{}, fmt.Errorf("gdl90: truncated capture record: %w", err)
+	}
+
+	return p, nil
+}
+
+// OpenCapture returns a PacketReader for r, which may hold either a capture
+// file written by CaptureWriter or a pcap file.
+func OpenCapture(r io.Reader) (PacketReader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(len(captureMagic))
+	if err != nil {
+		return nil, fmt.Errorf("gdl90: reading capture header: %w", err)
+	}
+
+	if bytes.Equal(magic, []byte(captureMagic)) {
+		return NewCaptureReader(br)
+	}
+
+	return NewPcapReader(br)
+}
+
+// Replay reads every packet from src and passes it to fn, sleeping between
+// packets so they are replayed at their original pace divided by speed.
+// A speed of zero or less replays as fast as possible. Replay stops at the end
+// of src, when ctx is done or when fn returns an error.
+func Replay(ctx context.Context, src PacketReader, speed float64, fn func(Packet) error) error {
+	var (
+		first     time.Time
+		start     time.Time
+		haveFirst bool
+	)
+
+	for {
+		p, err := src.ReadPacket()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !haveFirst {
+			first, start, haveFirst = p.Time, time.Now(), true
+		}
+
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(p.Time.Sub(first)) / speed))
+			if wait := time.Until(due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				}
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+}
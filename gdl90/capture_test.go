@@ -0,0 +1,193 @@
+package gdl90
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	packets := []Packet{
+		{Time: time.Unix(1600000000, 123456789), Data: []byte{0x7E, 0x00, 0x7E}},
+		{Time: time.Unix(1600000000, 223456789), Data: []byte{}},
+		{Time: time.Unix(1600000001, 0), Data: []byte{0x7E, 0x14, 0x01, 0x7E}},
+	}
+
+	var buf bytes.Buffer
+	cw, err := NewCaptureWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewCaptureWriter() error = %v", err)
+	}
+	for _, p := range packets {
+		if err := cw.WritePacket(p); err != nil {
+			t.Fatalf("WritePacket() error = %v", err)
+		}
+	}
+	if err := cw.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	src, err := OpenCapture(&buf)
+	if err != nil {
+		t.Fatalf("OpenCapture() error = %v", err)
+	}
+	if _, ok := src.(*CaptureReader); !ok {
+		t.Fatalf("OpenCapture() returned %T, want *CaptureReader", src)
+	}
+
+	got := readAll(t, src)
+	if !reflect.DeepEqual(got, packets) {
+		t.Errorf("ReadPacket() = %v, want %v", got, packets)
+	}
+}
+
+func TestPcapReader(t *testing.T) {
+	payload := []byte{0x7E, 0x00, 0x81, 0x41, 0xDB, 0xD0, 0x08, 0x02, 0xB3, 0x8B, 0x7E}
+
+	tests := []struct {
+		name  string
+		order binary.ByteOrder
+		magic uint32
+		frac  uint32
+		want  time.Time
+	}{
+		{"little endian microseconds", binary.LittleEndian, pcapMagicMicro, 250000, time.Unix(1600000000, 250000000)},
+		{"big endian nanoseconds", binary.BigEndian, pcapMagicNano, 250000, time.Unix(1600000000, 250000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writePcapHeader(&buf, tt.order, tt.magic, linkTypeEthernet)
+			writePcapRecord(&buf, tt.order, 1600000000, tt.frac, ethernetUDP(4000, payload))
+			writePcapRecord(&buf, tt.order, 1600000000, tt.frac, ethernetUDP(5000, []byte{0x01}))
+			writePcapRecord(&buf, tt.order, 1600000000, tt.frac, []byte{0x00, 0x01, 0x02}) // Not UDP
+			writePcapRecord(&buf, tt.order, 1600000001, tt.frac, ethernetUDP(4000, payload))
+
+			src, err := OpenCapture(&buf)
+			if err != nil {
+				t.Fatalf("OpenCapture() error = %v", err)
+			}
+			pr, ok := src.(*PcapReader)
+			if !ok {
+				t.Fatalf("OpenCapture() returned %T, want *PcapReader", src)
+			}
+			pr.Port = 4000
+
+			got := readAll(t, src)
+			if len(got) != 2 {
+				t.Fatalf("read %d packets, want 2", len(got))
+			}
+			if !got[0].Time.Equal(tt.want) {
+				t.Errorf("Time = %v, want %v", got[0].Time, tt.want)
+			}
+			if !bytes.Equal(got[0].Data, payload) {
+				t.Errorf("Data = % X, want % X", got[0].Data, payload)
+			}
+		})
+	}
+}
+
+func TestOpenCaptureUnknown(t *testing.T) {
+	if _, err := OpenCapture(bytes.NewReader(make([]byte, 64))); err != ErrCaptureFormat {
+		t.Errorf("OpenCapture() error = %v, want %v", err, ErrCaptureFormat)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	packets := []Packet{
+		{Time: start, Data: []byte{1}},
+		{Time: start.Add(100 * time.Millisecond), Data: []byte{2}},
+		{Time: start.Add(200 * time.Millisecond), Data: []byte{3}},
+	}
+
+	var got []Packet
+	t0 := time.Now()
+	err := Replay(context.Background(), &sliceReader{packets: packets}, 4, func(p Packet) error {
+		got = append(got, p)
+		return nil
+	})
+	elapsed := time.Since(t0)
+
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, packets) {
+		t.Errorf("Replay() packets = %v, want %v", got, packets)
+	}
+	if elapsed < 50*time.Millisecond {
+		t.Errorf("Replay() took %s, want at least 50ms at 4x speed", elapsed)
+	}
+}
+
+type sliceReader struct {
+	packets []Packet
+}
+
+func (r *sliceReader) ReadPacket() (Packet, error) {
+	if len(r.packets) == 0 {
+		return Packet{}, io.EOF
+	}
+	p := r.packets[0]
+	r.packets = r.packets[1:]
+	return p, nil
+}
+
+func readAll(t *testing.T, src PacketReader) []Packet {
+	var packets []Packet
+	for {
+		p, err := src.ReadPacket()
+		if err == io.EOF {
+			return packets
+		}
+		if err != nil {
+			t.Fatalf("ReadPacket() error = %v", err)
+		}
+		packets = append(packets, p)
+	}
+}
+
+func writePcapHeader(buf *bytes.Buffer, order binary.ByteOrder, magic, linkType uint32) {
+	hdr := make([]byte, pcapHeaderSize)
+	order.PutUint32(hdr[0:4], magic)
+	order.PutUint16(hdr[4:6], 2)
+	order.PutUint16(hdr[6:8], 4)
+	order.PutUint32(hdr[16:20], 65535)
+	order.PutUint32(hdr[20:24], linkType)
+	buf.Write(hdr)
+}
+
+func writePcapRecord(buf *bytes.Buffer, order binary.ByteOrder, sec, frac uint32, data []byte) {
+	hdr := make([]byte, pcapRecordHeaderSize)
+	order.PutUint32(hdr[0:4], sec)
+	order.PutUint32(hdr[4:8], frac)
+	order.PutUint32(hdr[8:12], uint32(len(data)))
+	order.PutUint32(hdr[12:16], uint32(len(data)))
+	buf.Write(hdr)
+	buf.Write(data)
+}
+
+// ethernetUDP returns an Ethernet frame holding an IPv4 UDP datagram.
+func ethernetUDP(port uint16, payload []byte) []byte {
+	eth := make([]byte, 14)
+	binary.BigEndian.PutUint16(eth[12:14], etherTypeIPv4)
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+8+len(payload)))
+	ip[8] = 64
+	ip[9] = ipProtocolUDP
+	copy(ip[12:16], []byte{192, 168, 10, 1})
+	copy(ip[16:20], []byte{192, 168, 10, 24})
+
+	udp := make([]byte, 8)
+	binary.BigEndian.PutUint16(udp[0:2], 43211)
+	binary.BigEndian.PutUint16(udp[2:4], port)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(8+len(payload)))
+
+	return append(append(append(eth, ip...), udp...), payload...)
+}
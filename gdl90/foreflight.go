@@ -0,0 +1,134 @@
+package gdl90
+
+import "fmt"
+
+const (
+	ForeFlightAHRSSize = 12
+
+	foreFlightHeadingMagnetic = 0x8000
+	foreFlightHeadingMask     = 0x7FFF
+)
+
+// ForeFlightAHRS contains the data from a ForeFlight AHRS message, as also
+// sent by Stratux.
+type ForeFlightAHRS struct {
+	Roll            float64 // Degrees, positive right wing down
+	RollValid       bool    // Whether Roll is available
+	Pitch           float64 // Degrees, positive nose up
+	PitchValid      bool    // Whether Pitch is available
+	Heading         float64 // Degrees
+	HeadingMagnetic bool    // Whether Heading is magnetic rather than true
+	HeadingValid    bool    // Whether Heading is available
+	IAS             int     // Indicated airspeed, kt
+	IASValid        bool    // Whether IAS is available
+	TAS             int     // True airspeed, kt
+	TASValid        bool    // Whether TAS is available
+}
+
+func (msg *ForeFlightAHRS) MessageID() byte {
+	return MsgIDForeFlight
+}
+
+func (msg *ForeFlightAHRS) MarshalBinary() ([]byte, error) {
+	data := make([]byte, ForeFlightAHRSSize)
+
+	data[0] = MsgIDForeFlight
+	data[1] = ForeFlightSubIDAHRS
+
+	roll, pitch := int16(INTERR), int16(INTERR)
+	if msg.RollValid {
+		roll = scaleInt(msg.Roll, 10)
+	}
+	if msg.PitchValid {
+		pitch = scaleInt(msg.Pitch, 10)
+	}
+	putInt(data[2:4], roll)
+	putInt(data[4:6], pitch)
+
+	hdg := uint16(UINTERR)
+	if msg.HeadingValid {
+		hdg = uint16(scaleInt(msg.Heading, 10)) & foreFlightHeadingMask
+		if msg.HeadingMagnetic {
+			hdg |= foreFlightHeadingMagnetic
+		}
+	}
+	putUint(data[6:8], hdg)
+
+	ias, tas := uint16(UINTERR), uint16(UINTERR)
+	if msg.IASValid {
+		ias = uint16(clamp(float64(msg.IAS), 0, UINTERR-1))
+	}
+	if msg.TASValid {
+		tas = uint16(clamp(float64(msg.TAS), 0, UINTERR-1))
+	}
+	putUint(data[8:10], ias)
+	putUint(data[10:12], tas)
+
+	return data, nil
+}
+
+func (msg *ForeFlightAHRS) UnmarshalBinary(data []byte) error {
+	if err := checkMessage(data, MsgIDForeFlight, ForeFlightAHRSSize); err != nil {
+		return err
+	}
+	if data[1] != ForeFlightSubIDAHRS {
+		return fmt.Errorf("gdl90: expecting ForeFlight sub-ID 0x%02X, received 0x%02X", ForeFlightSubIDAHRS, data[1])
+	}
+
+	roll, pitch := bytes2int(data[2:4]), bytes2int(data[4:6])
+	msg.RollValid, msg.Roll = roll != INTERR, 0
+	if msg.RollValid {
+		msg.Roll = float64(roll) / 10
+	}
+	msg.PitchValid, msg.Pitch = pitch != INTERR, 0
+	if msg.PitchValid {
+		msg.Pitch = float64(pitch) / 10
+	}
+
+	hdg := bytes2uint(data[6:8])
+	msg.HeadingValid, msg.Heading, msg.HeadingMagnetic = hdg != UINTERR, 0, false
+	if msg.HeadingValid {
+		msg.HeadingMagnetic = hdg&foreFlightHeadingMagnetic != 0
+		// Heading is a signed 15-bit value below the magnetic flag
+		h := int16(hdg<<1) >> 1
+		msg.Heading = float64(h) / 10
+	}
+
+	ias, tas := bytes2uint(data[8:10]), bytes2uint(data[10:12])
+	msg.IASValid, msg.IAS = ias != UINTERR, 0
+	if msg.IASValid {
+		msg.IAS = int(ias)
+	}
+	msg.TASValid, msg.TAS = tas != UINTERR, 0
+	if msg.TASValid {
+		msg.TAS = int(tas)
+	}
+
+	return nil
+}
+
+func (msg *ForeFlightAHRS) String() string {
+	roll, pitch, hdg, ias, tas := "invalid", "invalid", "invalid", "invalid", "invalid"
+	if msg.RollValid {
+		roll = fmt.Sprintf("%.1f", msg.Roll)
+	}
+	if msg.PitchValid {
+		pitch = fmt.Sprintf("%.1f", msg.Pitch)
+	}
+	if msg.HeadingValid {
+		hdg = fmt.Sprintf("%.1f", msg.Heading)
+		if msg.HeadingMagnetic {
+			hdg += "M"
+		} else {
+			hdg += "T"
+		}
+	}
+	if msg.IASValid {
+		ias = fmt.Sprintf("%dkt", msg.IAS)
+	}
+	if msg.TASValid {
+		tas = fmt.Sprintf("%dkt", msg.TAS)
+	}
+
+	return fmt.Sprintf("ForeFlight AHRS roll %s, pitch %s, heading %s, IAS %s, TAS %s", roll, pitch, hdg, ias, tas)
+}
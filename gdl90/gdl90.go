@@ -0,0 +1,354 @@
+/*
+Package gdl90 encodes and decodes GDL90 messages, as sent by Stratux and other
+ADS-B receivers to EFB applications.
+
+Reference 1: GDL 90 Data Interface Specification, 560-1058-00 Rev A
+Reference 2: https://www.foreflight.com/connect/spec/
+Reference 3: iLevil AHRS message, as implemented by Stratux
+*/
+
+package gdl90
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+const (
+	FlagByte    = 0x7E // Marks the beginning and end of each frame
+	ControlByte = 0x7D // Escapes a FlagByte or ControlByte within a frame
+	EscapeXOR   = 0x20 // Escaped bytes are XORed with this value
+
+	FCSSize = 2 // Size of the frame check sequence at the end of each message
+
+	// Message IDs
+	MsgIDHeartbeat                = 0x00
+	MsgIDUplinkData               = 0x07
+	MsgIDOwnshipReport            = 0x0A
+	MsgIDOwnshipGeometricAltitude = 0x0B
+	MsgIDTrafficReport            = 0x14
+	MsgIDAHRS                     = 0x4C // iLevil AHRS, "L" of the "LE" CompanyID
+	MsgIDForeFlight               = 0x65
+	ForeFlightSubIDAHRS           = 0x01
+)
+
+var (
+	ErrEmptyFrame  = errors.New("gdl90: empty frame")
+	ErrFrameFlags  = errors.New("gdl90: missing flag byte at frame boundary")
+	ErrEscape      = errors.New("gdl90: control byte at end of frame")
+	ErrShortFrame  = errors.New("gdl90: frame too short")
+	ErrMsgTooShort = errors.New("gdl90: message too short")
+)
+
+// Message is implemented by every GDL90 message type. MarshalBinary returns
+// the message bytes starting with the message ID, without the frame check
+// sequence and without framing.
+type Message interface {
+	MessageID() byte
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary(data []byte) error
+}
+
+// Encode marshals msg, appends the frame check sequence and frames the result
+// so it is ready to be sent.
+func Encode(msg Message) ([]byte, error) {
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return Frame(appendFCS(data)), nil
+}
+
+// Decode unframes a single frame, checks its frame check sequence and returns
+// the decoded message. Unknown message IDs are returned as *UnknownMsg.
+func Decode(frame []byte) (Message, error) {
+	data, err := Unframe(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < FCSSize+1 {
+		return nil, ErrShortFrame
+	}
+
+	if err := crcCheck(data); err != nil {
+		return nil, err
+	}
+
+	return DecodeMessage(data[:len(data)-FCSSize])
+}
+
+// DecodeMessage decodes an unframed message without frame check sequence.
+func DecodeMessage(data []byte) (Message, error) {
+	if len(data) < 1 {
+		return nil, ErrMsgTooShort
+	}
+
+	var msg Message
+
+	switch data[0] {
+	case MsgIDHeartbeat:
+		msg = new(Heartbeat)
+	case MsgIDUplinkData:
+		msg = new(UplinkData)
+	case MsgIDOwnshipReport:
+		msg = new(OwnshipReport)
+	case MsgIDOwnshipGeometricAltitude:
+		msg = new(OwnshipGeometricAltitude)
+	case MsgIDTrafficReport:
+		msg = new(TrafficReport)
+	case MsgIDAHRS:
+		msg = new(AHRSMsg)
+	case MsgIDForeFlight:
+		if len(data) > 1 && data[1] == ForeFlightSubIDAHRS {
+			msg = new(ForeFlightAHRS)
+		} else {
+			msg = new(UnknownMsg)
+		}
+	default:
+		msg = new(UnknownMsg)
+	}
+
+	if err := msg.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// Frame escapes any flag or control bytes in data and wraps the result with
+// flag bytes.
+func Frame(data []byte) []byte {
+	frame := make([]byte, 0, len(data)+len(data)/8+2)
+	frame = append(frame, FlagByte)
+
+	for _, b := range data {
+		if b == FlagByte || b == ControlByte {
+			frame = append(frame, ControlByte, b^EscapeXOR)
+		} else {
+			frame = append(frame, b)
+		}
+	}
+
+	return append(frame, FlagByte)
+}
+
+// Unframe strips the flag bytes from frame and restores any escaped bytes.
+func Unframe(frame []byte) ([]byte, error) {
+	if len(frame) == 0 {
+		return nil, ErrEmptyFrame
+	}
+
+	if len(frame) < 2 || frame[0] != FlagByte || frame[len(frame)-1] != FlagByte {
+		return nil, ErrFrameFlags
+	}
+
+	data := make([]byte, 0, len(frame)-2)
+	escaped := false
+
+	for _, b := range frame[1 : len(frame)-1] {
+		switch {
+		case escaped:
+			data = append(data, b^EscapeXOR)
+			escaped = false
+		case b == ControlByte:
+			escaped = true
+		case b == FlagByte:
+			return nil, ErrFrameFlags
+		default:
+			data = append(data, b)
+		}
+	}
+
+	if escaped {
+		return nil, ErrEscape
+	}
+
+	return data, nil
+}
+
+// ScanFrames is a bufio.SplitFunc that splits a byte stream, such as a UDP
+// datagram holding several messages, into individual frames including their
+// flag bytes. Any bytes before the first flag byte are discarded.
+func ScanFrames(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	start := bytes.IndexByte(data, FlagByte)
+	if start < 0 {
+		return len(data), nil, nil
+	}
+
+	// Skip over repeated flag bytes, which mark empty frames
+	for start+1 < len(data) && data[start+1] == FlagByte {
+		start++
+	}
+
+	if end := bytes.IndexByte(data[start+1:], FlagByte); end >= 0 {
+		end += start + 2
+		return end, data[start:end], nil
+	}
+
+	if atEOF {
+		return len(data), nil, nil
+	}
+
+	return start, nil, nil
+}
+
+// appendFCS returns data followed by its frame check sequence, LSB first.
+func appendFCS(data []byte) []byte {
+	crc := crcCompute(data)
+	return append(data, byte(crc), byte(crc>>8))
+}
+
+// crc16Table is the lookup table for the CRC-16-CCITT used by GDL90, as
+// given in the GDL90 specification, section 2.2.3.
+var crc16Table = func() (table [256]uint16) {
+	for i := range table {
+		crc := uint16(i) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return
+}()
+
+// crcCompute returns the GDL90 frame check sequence of data.
+func crcCompute(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc16Table[crc>>8] ^ crc<<8 ^ uint16(b)
+	}
+	return crc
+}
+
+// crcCheck verifies the frame check sequence at the end of msg.
+func crcCheck(msg []byte) error {
+	n := len(msg) - FCSSize
+	got := uint16(msg[n]) | uint16(msg[n+1])<<8
+	if want := crcCompute(msg[:n]); got != want {
+		return &ChecksumError{ID: msg[0], Got: got, Want: want}
+	}
+	return nil
+}
+
+// ChecksumError is returned when the frame check sequence of a frame doesn't
+// match its contents.
+type ChecksumError struct {
+	ID   byte   // Message ID of the frame
+	Got  uint16 // FCS received with the frame
+	Want uint16 // FCS computed from the frame contents
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("gdl90: CRC incorrect for message 0x%02X: received 0x%04X, computed 0x%04X", e.ID, e.Got, e.Want)
+}
+
+// Decoder decodes frames like Decode, keeping count of the frames it couldn't
+// decode.
+type Decoder struct {
+	Frames         int // Number of frames seen
+	Malformed      int // Number of frames which couldn't be decoded, including checksum errors
+	ChecksumErrors int // Number of frames with an incorrect frame check sequence
+}
+
+// Decode decodes a single frame, counting it as malformed if it fails.
+func (d *Decoder) Decode(frame []byte) (Message, error) {
+	d.Frames++
+
+	msg, err := Decode(frame)
+	if err != nil {
+		d.Malformed++
+		var crcErr *ChecksumError
+		if errors.As(err, &crcErr) {
+			d.ChecksumErrors++
+		}
+	}
+
+	return msg, err
+}
+
+func (d *Decoder) String() string {
+	return fmt.Sprintf("%d frames, %d malformed, %d checksum errors", d.Frames, d.Malformed, d.ChecksumErrors)
+}
+
+// UnknownMsg holds any message which isn't otherwise decoded by this package.
+type UnknownMsg struct {
+	Data []byte
+}
+
+func (msg *UnknownMsg) MessageID() byte {
+	if len(msg.Data) == 0 {
+		return 0
+	}
+
+	return msg.Data[0]
+}
+
+func (msg *UnknownMsg) MarshalBinary() ([]byte, error) {
+	if len(msg.Data) == 0 {
+		return nil, ErrMsgTooShort
+	}
+
+	return append([]byte(nil), msg.Data...), nil
+}
+
+func (msg *UnknownMsg) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return ErrMsgTooShort
+	}
+
+	msg.Data = append([]byte(nil), data...)
+
+	return nil
+}
+
+func (msg *UnknownMsg) String() string {
+	return fmt.Sprintf("unknown message ID 0x%02X, %d bytes", msg.MessageID(), len(msg.Data))
+}
+
+// checkMessage verifies that data holds a message of the expected ID and size.
+func checkMessage(data []byte, id byte, size int) error {
+	if len(data) != size {
+		return fmt.Errorf("gdl90: message 0x%02X length was %d, should be %d", id, len(data), size)
+	}
+
+	if data[0] != id {
+		return fmt.Errorf("gdl90: expecting message ID 0x%02X, received 0x%02X", id, data[0])
+	}
+
+	return nil
+}
+
+func bytes2int(b []byte) int16 {
+	return (int16(b[1]) << 0) | (int16(b[0]) << 8)
+}
+
+func bytes2uint(b []byte) uint16 {
+	return (uint16(b[1]) << 0) | (uint16(b[0]) << 8)
+}
+
+func putInt(b []byte, v int16) {
+	putUint(b, uint16(v))
+}
+
+func putUint(b []byte, v uint16) {
+	b[0] = byte(v >> 8)
+	b[1] = byte(v)
+}
+
+// bytes2int24 decodes a signed 24-bit MSB-first value.
+func bytes2int24(b []byte) int32 {
+	return (int32(b[0])<<24 | int32(b[1])<<16 | int32(b[2])<<8) >> 8
+}
+
+func putInt24(b []byte, v int32) {
+	b[0] = byte(v >> 16)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v)
+}
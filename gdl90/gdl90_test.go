@@ -0,0 +1,225 @@
+package gdl90
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		frame []byte
+	}{
+		{"plain", []byte{0x00, 0x01, 0x02}, []byte{0x7E, 0x00, 0x01, 0x02, 0x7E}},
+		{"flag byte", []byte{0x00, 0x7E, 0x02}, []byte{0x7E, 0x00, 0x7D, 0x5E, 0x02, 0x7E}},
+		{"control byte", []byte{0x7D, 0x01}, []byte{0x7E, 0x7D, 0x5D, 0x01, 0x7E}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Frame(tt.data); !bytes.Equal(got, tt.frame) {
+				t.Errorf("Frame() = % X, want % X", got, tt.frame)
+			}
+			got, err := Unframe(tt.frame)
+			if err != nil {
+				t.Fatalf("Unframe() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("Unframe() = % X, want % X", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestUnframeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+		err   error
+	}{
+		{"empty", []byte{}, ErrEmptyFrame},
+		{"missing start flag", []byte{0x00, 0x01, 0x7E}, ErrFrameFlags},
+		{"missing end flag", []byte{0x7E, 0x00, 0x01}, ErrFrameFlags},
+		{"trailing control byte", []byte{0x7E, 0x00, 0x7D, 0x7E}, ErrEscape},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Unframe(tt.frame); err != tt.err {
+				t.Errorf("Unframe() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestScanFrames(t *testing.T) {
+	stream := []byte{0xFF, 0x7E, 0x00, 0x01, 0x7E, 0x7E, 0x02, 0x7D, 0x5E, 0x7E, 0x7E, 0x03}
+	want := [][]byte{
+		{0x7E, 0x00, 0x01, 0x7E},
+		{0x7E, 0x02, 0x7D, 0x5E, 0x7E},
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(stream))
+	scanner.Split(ScanFrames)
+	var got [][]byte
+	for scanner.Scan() {
+		got = append(got, append([]byte(nil), scanner.Bytes()...))
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanFrames() = % X, want % X", got, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ahrs := NewAHRSMsg()
+	ahrs.SetRoll(-12.3)
+	ahrs.SetPitch(4.5)
+	ahrs.SetYaw(271.2)
+	ahrs.SetGLoad(1.1)
+	ahrs.SetPAlt(3500)
+	ahrs.SetVertSpeed(-500)
+
+	uplink := &UplinkData{TimeOfReception: 12345, TimeOfReceptionValid: true}
+	uplink.Payload[0], uplink.Payload[UplinkPayloadSize-1] = 0x7E, 0x7D
+
+	traffic := TrafficReport{
+		AlertStatus: 1, AddressType: 0, Address: 0xABCDEF,
+		Latitude: 22.5, Longitude: -112.5, // Exactly representable
+		Altitude: 5000, AltitudeValid: true,
+		Misc: MiscAirborne | MiscTrueTrack, NIC: 10, NACp: 9,
+		HVelocity: 123, HVelocityValid: true,
+		VVelocity: -640, VVelocityValid: true,
+		Track: 45, EmitterCat: 1, CallSign: "N825V", Priority: 0,
+	}
+
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{"heartbeat", &Heartbeat{Status1: HeartbeatGPSPosValid | HeartbeatUATInitialized, Status2: HeartbeatUTCOK, Timestamp: 80000, UplinkCount: 3, BasicLongCount: 513}},
+		{"uplink", uplink},
+		{"ownship", &OwnshipReport{traffic}},
+		{"ownship geometric altitude", &OwnshipGeometricAltitude{Altitude: 3100, VFOM: 10, VFOMValid: true}},
+		{"traffic", &traffic},
+		{"traffic invalid", &TrafficReport{CallSign: "ABCDEFGH"}},
+		{"ahrs", ahrs},
+		{"ahrs invalid", NewAHRSMsg()},
+		{"foreflight ahrs", &ForeFlightAHRS{Roll: -12.3, RollValid: true, Pitch: 4.5, PitchValid: true, Heading: 271.2, HeadingMagnetic: true, HeadingValid: true, IAS: 110, IASValid: true}},
+		{"unknown", &UnknownMsg{Data: []byte{0x65, 0x00, 0x01, 0x02}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := Encode(tt.msg)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			got, err := Decode(frame)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.msg) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.msg)
+			}
+		})
+	}
+}
+
+func TestTrafficReportDecode(t *testing.T) {
+	// Example traffic report from the GDL90 specification, section 3.5.4
+	data := []byte{0x14, 0x00, 0xAB, 0x45, 0x49, 0x1F, 0xEF, 0x15, 0xA8, 0x89, 0x78, 0x0F, 0x09, 0xA9,
+		0x07, 0xB0, 0x01, 0x20, 0x01, 0x4E, 0x38, 0x32, 0x35, 0x56, 0x20, 0x20, 0x20, 0x00}
+
+	msg, err := DecodeMessage(data)
+	if err != nil {
+		t.Fatalf("DecodeMessage() error = %v", err)
+	}
+	tr, ok := msg.(*TrafficReport)
+	if !ok {
+		t.Fatalf("DecodeMessage() returned %T, want *TrafficReport", msg)
+	}
+
+	if tr.Address != 0xAB4549 {
+		t.Errorf("Address = %06X, want AB4549", tr.Address)
+	}
+	if tr.Latitude < 44.9070 || tr.Latitude > 44.9071 {
+		t.Errorf("Latitude = %f, want 44.90708", tr.Latitude)
+	}
+	if tr.Longitude < -122.9949 || tr.Longitude > -122.9948 {
+		t.Errorf("Longitude = %f, want -122.99488", tr.Longitude)
+	}
+	if !tr.AltitudeValid || tr.Altitude != 5000 {
+		t.Errorf("Altitude = %d (valid %t), want 5000", tr.Altitude, tr.AltitudeValid)
+	}
+	if !tr.Airborne() || tr.TrackType() != MiscTrueTrack {
+		t.Errorf("Misc = %X, want airborne true track", tr.Misc)
+	}
+	if !tr.HVelocityValid || tr.HVelocity != 123 {
+		t.Errorf("HVelocity = %d, want 123", tr.HVelocity)
+	}
+	if !tr.VVelocityValid || tr.VVelocity != 64 {
+		t.Errorf("VVelocity = %d, want 64", tr.VVelocity)
+	}
+	if tr.CallSign != "N825V" {
+		t.Errorf("CallSign = %q, want N825V", tr.CallSign)
+	}
+}
+
+func TestNewHeartbeat(t *testing.T) {
+	hb := NewHeartbeat(time.Date(2020, 1, 2, 23, 59, 59, 0, time.UTC), HeartbeatGPSPosValid, HeartbeatUTCOK)
+	if hb.Timestamp != 86399 {
+		t.Errorf("Timestamp = %d, want 86399", hb.Timestamp)
+	}
+	if hb.TimeOfDay() != 86399*time.Second {
+		t.Errorf("TimeOfDay() = %s, want 23h59m59s", hb.TimeOfDay())
+	}
+}
+
+func TestCRC(t *testing.T) {
+	// Example heartbeat from the GDL90 specification, section 2.2.4
+	data := []byte{0x00, 0x81, 0x41, 0xDB, 0xD0, 0x08, 0x02}
+	frame := []byte{0x7E, 0x00, 0x81, 0x41, 0xDB, 0xD0, 0x08, 0x02, 0xB3, 0x8B, 0x7E}
+
+	if got := crcCompute(data); got != 0x8BB3 {
+		t.Errorf("crcCompute() = 0x%04X, want 0x8BB3", got)
+	}
+	if got := Frame(appendFCS(append([]byte(nil), data...))); !bytes.Equal(got, frame) {
+		t.Errorf("Frame(appendFCS()) = % X, want % X", got, frame)
+	}
+	if _, err := Decode(frame); err != nil {
+		t.Errorf("Decode() error = %v", err)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	good := []byte{0x7E, 0x00, 0x81, 0x41, 0xDB, 0xD0, 0x08, 0x02, 0xB3, 0x8B, 0x7E}
+	badFCS := []byte{0x7E, 0x00, 0x81, 0x41, 0xDB, 0xD0, 0x08, 0x03, 0xB3, 0x8B, 0x7E}
+	badFlags := []byte{0x00, 0x81, 0x7E}
+
+	var d Decoder
+	if _, err := d.Decode(good); err != nil {
+		t.Errorf("Decode() error = %v", err)
+	}
+
+	_, err := d.Decode(badFCS)
+	crcErr, ok := err.(*ChecksumError)
+	if !ok {
+		t.Fatalf("Decode() error = %v, want *ChecksumError", err)
+	}
+	if crcErr.Got != 0x8BB3 || crcErr.ID != MsgIDHeartbeat {
+		t.Errorf("ChecksumError = %+v, want received 0x8BB3 for message 0x00", crcErr)
+	}
+
+	if _, err := d.Decode(badFlags); err != ErrFrameFlags {
+		t.Errorf("Decode() error = %v, want %v", err, ErrFrameFlags)
+	}
+
+	want := Decoder{Frames: 3, Malformed: 2, ChecksumErrors: 1}
+	if d != want {
+		t.Errorf("Decoder = %+v, want %+v", d, want)
+	}
+}
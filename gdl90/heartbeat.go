@@ -0,0 +1,110 @@
+package gdl90
+
+import (
+	"fmt"
+	"time"
+)
+
+const HeartbeatSize = 7
+
+// Heartbeat status byte 1 bits
+const (
+	HeartbeatGPSPosValid    = 0x80
+	HeartbeatMaintReqd      = 0x40
+	HeartbeatIdent          = 0x20
+	HeartbeatAddrType       = 0x10
+	HeartbeatGPSBattLow     = 0x08
+	HeartbeatRATCS          = 0x04
+	HeartbeatUATInitialized = 0x01
+)
+
+// Heartbeat status byte 2 bits
+const (
+	HeartbeatTimestampMSB    = 0x80
+	HeartbeatCSARequested    = 0x40
+	HeartbeatCSANotAvailable = 0x20
+	HeartbeatUTCOK           = 0x01
+)
+
+// Heartbeat is sent once per second by the GDL90 device.
+type Heartbeat struct {
+	Status1, Status2 byte   // Status bits, see the Heartbeat* constants
+	Timestamp        uint32 // Seconds since 0000Z, 17 bits
+	UplinkCount      uint8  // Number of uplink messages received in the previous second, 5 bits
+	BasicLongCount   uint16 // Number of basic and long messages received in the previous second, 10 bits
+}
+
+// NewHeartbeat returns a Heartbeat with the timestamp set from t.
+func NewHeartbeat(t time.Time, status1, status2 byte) *Heartbeat {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	return &Heartbeat{
+		Status1:   status1,
+		Status2:   status2 &^ HeartbeatTimestampMSB,
+		Timestamp: uint32(t.Sub(midnight) / time.Second),
+	}
+}
+
+func (msg *Heartbeat) MessageID() byte {
+	return MsgIDHeartbeat
+}
+
+func (msg *Heartbeat) MarshalBinary() ([]byte, error) {
+	data := make([]byte, HeartbeatSize)
+
+	data[0] = MsgIDHeartbeat
+	data[1] = msg.Status1
+	data[2] = msg.Status2 &^ HeartbeatTimestampMSB
+	if msg.Timestamp&0x10000 != 0 {
+		data[2] |= HeartbeatTimestampMSB
+	}
+
+	// Timestamp is sent LSB first
+	data[3] = byte(msg.Timestamp)
+	data[4] = byte(msg.Timestamp >> 8)
+
+	data[5] = (msg.UplinkCount&0x1F)<<3 | byte(msg.BasicLongCount>>8)&0x03
+	data[6] = byte(msg.BasicLongCount)
+
+	return data, nil
+}
+
+func (msg *Heartbeat) UnmarshalBinary(data []byte) error {
+	if err := checkMessage(data, MsgIDHeartbeat, HeartbeatSize); err != nil {
+		return err
+	}
+
+	msg.Status1 = data[1]
+	msg.Status2 = data[2] &^ HeartbeatTimestampMSB
+
+	msg.Timestamp = uint32(data[3]) | uint32(data[4])<<8
+	if data[2]&HeartbeatTimestampMSB != 0 {
+		msg.Timestamp |= 0x10000
+	}
+
+	msg.UplinkCount = data[5] >> 3
+	msg.BasicLongCount = uint16(data[5]&0x03)<<8 | uint16(data[6])
+
+	return nil
+}
+
+// GPSPosValid returns whether the GDL90 device has a valid position fix.
+func (msg *Heartbeat) GPSPosValid() bool {
+	return msg.Status1&HeartbeatGPSPosValid != 0
+}
+
+// UTCOK returns whether the timestamp is valid UTC time.
+func (msg *Heartbeat) UTCOK() bool {
+	return msg.Status2&HeartbeatUTCOK != 0
+}
+
+// TimeOfDay returns the timestamp as a duration since 0000Z.
+func (msg *Heartbeat) TimeOfDay() time.Duration {
+	return time.Duration(msg.Timestamp) * time.Second
+}
+
+func (msg *Heartbeat) String() string {
+	return fmt.Sprintf("heartbeat GPS valid: %t, UTC OK: %t, time: %s, uplink messages: %d, basic/long messages: %d",
+		msg.GPSPosValid(), msg.UTCOK(), msg.TimeOfDay(), msg.UplinkCount, msg.BasicLongCount)
+}
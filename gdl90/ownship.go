@@ -0,0 +1,70 @@
+package gdl90
+
+import "fmt"
+
+const (
+	OwnshipGeometricAltitudeSize = 5
+
+	geoAltitudeResolution = 5 // Feet per LSB of geometric altitude
+	vfomNotAvailable      = 0x7FFF
+	vfomWarningBit        = 0x8000
+)
+
+// OwnshipGeometricAltitude contains the data from a GDL90 Ownship Geometric
+// Altitude message.
+type OwnshipGeometricAltitude struct {
+	Altitude        int    // Geometric altitude above the WGS-84 ellipsoid, ft
+	VerticalWarning bool   // Whether the vertical integrity is out of bounds
+	VFOM            uint16 // Vertical Figure of Merit, m
+	VFOMValid       bool   // Whether VFOM is available
+}
+
+func (msg *OwnshipGeometricAltitude) MessageID() byte {
+	return MsgIDOwnshipGeometricAltitude
+}
+
+func (msg *OwnshipGeometricAltitude) MarshalBinary() ([]byte, error) {
+	data := make([]byte, OwnshipGeometricAltitudeSize)
+
+	data[0] = MsgIDOwnshipGeometricAltitude
+	putInt(data[1:3], int16(clamp(float64(msg.Altitude)/geoAltitudeResolution, -INTERR-1, INTERR)))
+
+	vm := uint16(vfomNotAvailable)
+	if msg.VFOMValid {
+		vm = uint16(clamp(float64(msg.VFOM), 0, vfomNotAvailable-1))
+	}
+	if msg.VerticalWarning {
+		vm |= vfomWarningBit
+	}
+	putUint(data[3:5], vm)
+
+	return data, nil
+}
+
+func (msg *OwnshipGeometricAltitude) UnmarshalBinary(data []byte) error {
+	if err := checkMessage(data, MsgIDOwnshipGeometricAltitude, OwnshipGeometricAltitudeSize); err != nil {
+		return err
+	}
+
+	msg.Altitude = int(bytes2int(data[1:3])) * geoAltitudeResolution
+
+	vm := bytes2uint(data[3:5])
+	msg.VerticalWarning = vm&vfomWarningBit != 0
+	msg.VFOM = vm &^ vfomWarningBit
+	msg.VFOMValid = msg.VFOM != vfomNotAvailable
+	if !msg.VFOMValid {
+		msg.VFOM = 0
+	}
+
+	return nil
+}
+
+func (msg *OwnshipGeometricAltitude) String() string {
+	vfom := "invalid"
+	if msg.VFOMValid {
+		vfom = fmt.Sprintf("%dm", msg.VFOM)
+	}
+
+	return fmt.Sprintf("ownship geometric altitude %dft, vertical warning: %t, VFOM %s",
+		msg.Altitude, msg.VerticalWarning, vfom)
+}
@@ -0,0 +1,204 @@
+package gdl90
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Reference: https://www.tcpdump.org/manpages/pcap-savefile.5.html
+// Reference: https://www.tcpdump.org/linktypes.html
+
+const (
+	pcapMagicMicro       = 0xA1B2C3D4
+	pcapMagicNano        = 0xA1B23C4D
+	pcapHeaderSize       = 24
+	pcapRecordHeaderSize = 16
+	pcapMaxRecordSize    = 262144 // Largest snapshot length used by tcpdump
+
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+	linkTypeSLL2     = 276
+
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86DD
+	etherTypeVLAN = 0x8100
+
+	ipProtocolUDP = 17
+)
+
+var errNotUDP = errors.New("gdl90: not a UDP packet")
+
+// PcapReader reads the UDP payloads from a classic pcap file, skipping any
+// other packets. IPv4 and IPv6 are supported over Ethernet, Linux cooked
+// capture, loopback and raw IP link types. Fragmented IP packets are skipped.
+type PcapReader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	nano     bool
+	linkType uint32
+	Port     uint16 // If not zero, only UDP packets to this destination port are returned
+}
+
+// NewPcapReader checks the pcap file header in r and returns a PcapReader
+// positioned at the first packet.
+func NewPcapReader(r io.Reader) (*PcapReader, error) {
+	hdr := make([]byte, pcapHeaderSize)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("gdl90: reading pcap header: %w", err)
+	}
+
+	pr := &PcapReader{r: r}
+
+	switch {
+	case binary.LittleEndian.Uint32(hdr[0:4]) == pcapMagicMicro:
+		pr.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[0:4]) == pcapMagicMicro:
+		pr.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(hdr[0:4]) == pcapMagicNano:
+		pr.order, pr.nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(hdr[0:4]) == pcapMagicNano:
+		pr.order, pr.nano = binary.BigEndian, true
+	default:
+		return nil, ErrCaptureFormat
+	}
+
+	pr.linkType = pr.order.Uint32(hdr[20:24]) & 0x0FFFFFFF
+
+	switch pr.linkType {
+	case linkTypeNull, linkTypeEthernet, linkTypeRaw, linkTypeLinuxSLL, linkTypeIPv4, linkTypeIPv6, linkTypeSLL2:
+	default:
+		return nil, fmt.Errorf("gdl90: unsupported pcap link type %d", pr.linkType)
+	}
+
+	return pr, nil
+}
+
+func (pr *PcapReader) ReadPacket() (Packet, error) {
+	for {
+		var hdr [pcapRecordHeaderSize]byte
+		if _, err := io.ReadFull(pr.r, hdr[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return Packet{}, fmt.Errorf("gdl90: truncated pcap record: %w", err)
+			}
+			return Packet{}, err
+		}
+
+		sec := int64(pr.order.Uint32(hdr[0:4]))
+		frac := int64(pr.order.Uint32(hdr[4:8]))
+		if !pr.nano {
+			frac *= 1000
+		}
+
+		n := pr.order.Uint32(hdr[8:12])
+		if n > pcapMaxRecordSize {
+			return Packet{}, fmt.Errorf("gdl90: pcap record length %d too large", n)
+		}
+
+		data := make([]byte, n)
+		if _, err := io.ReadFull(pr.r, data); err != nil {
+			return Packet{}, fmt.Errorf("gdl90: truncated pcap record: %w", err)
+		}
+
+		payload, port, err := pr.udpPayload(data)
+		if err != nil || (pr.Port != 0 && port != pr.Port) {
+			continue
+		}
+
+		return Packet{Time: time.Unix(sec, frac), Data: payload}, nil
+	}
+}
+
+// udpPayload returns the UDP payload and destination port of a link layer
+// packet.
+func (pr *PcapReader) udpPayload(data []byte) ([]byte, uint16, error) {
+	var (
+		etherType uint16
+		ip        []byte
+	)
+
+	switch pr.linkType {
+	case linkTypeNull:
+		if len(data) < 4 {
+			return nil, 0, errNotUDP
+		}
+		ip = data[4:]
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return nil, 0, errNotUDP
+		}
+		etherType, ip = binary.BigEndian.Uint16(data[12:14]), data[14:]
+		if etherType == etherTypeVLAN && len(ip) >= 4 {
+			etherType, ip = binary.BigEndian.Uint16(ip[2:4]), ip[4:]
+		}
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, 0, errNotUDP
+		}
+		etherType, ip = binary.BigEndian.Uint16(data[14:16]), data[16:]
+	case linkTypeSLL2:
+		if len(data) < 20 {
+			return nil, 0, errNotUDP
+		}
+		etherType, ip = binary.BigEndian.Uint16(data[0:2]), data[20:]
+	default:
+		ip = data
+	}
+
+	if etherType != 0 && etherType != etherTypeIPv4 && etherType != etherTypeIPv6 {
+		return nil, 0, errNotUDP
+	}
+
+	return udpFromIP(ip)
+}
+
+// udpFromIP returns the UDP payload and destination port of an IPv4 or IPv6
+// packet.
+func udpFromIP(ip []byte) ([]byte, uint16, error) {
+	if len(ip) < 1 {
+		return nil, 0, errNotUDP
+	}
+
+	var udp []byte
+
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 {
+			return nil, 0, errNotUDP
+		}
+		ihl := int(ip[0]&0x0F) * 4
+		total := int(binary.BigEndian.Uint16(ip[2:4]))
+		fragment := binary.BigEndian.Uint16(ip[6:8])
+		if ip[9] != ipProtocolUDP || fragment&0x3FFF != 0 || ihl < 20 || total < ihl || total > len(ip) {
+			return nil, 0, errNotUDP
+		}
+		udp = ip[ihl:total]
+	case 6:
+		if len(ip) < 40 || ip[6] != ipProtocolUDP {
+			return nil, 0, errNotUDP
+		}
+		total := 40 + int(binary.BigEndian.Uint16(ip[4:6]))
+		if total > len(ip) {
+			return nil, 0, errNotUDP
+		}
+		udp = ip[40:total]
+	default:
+		return nil, 0, errNotUDP
+	}
+
+	if len(udp) < 8 {
+		return nil, 0, errNotUDP
+	}
+	n := int(binary.BigEndian.Uint16(udp[4:6]))
+	if n < 8 || n > len(udp) {
+		return nil, 0, errNotUDP
+	}
+
+	return udp[8:n], binary.BigEndian.Uint16(udp[2:4]), nil
+}
@@ -0,0 +1,217 @@
+package gdl90
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	TrafficReportSize = 28
+
+	latLonResolution   = 180.0 / (1 << 23) // Degrees per LSB of latitude and longitude
+	trackResolution    = 360.0 / 256       // Degrees per LSB of track/heading
+	altitudeResolution = 25                // Feet per LSB of pressure altitude
+	altitudeOffset     = -1000             // Pressure altitude of a zero value, ft
+	altitudeInvalid    = 0xFFF
+	hVelocityInvalid   = 0xFFF
+	hVelocityMax       = 0xFFE
+	vVelocityInvalid   = 0x800
+	vVelocityMax       = 0x1FE
+	vVelocityScale     = 64 // Feet per minute per LSB of vertical velocity
+	callSignSize       = 8
+)
+
+// Miscellaneous indicator bits of a TrafficReport
+const (
+	MiscTrackTypeMask   = 0x03
+	MiscTrackNotValid   = 0x00
+	MiscTrueTrack       = 0x01
+	MiscMagneticHeading = 0x02
+	MiscTrueHeading     = 0x03
+	MiscExtrapolated    = 0x04
+	MiscAirborne        = 0x08
+)
+
+// TrafficReport contains the data from a GDL90 Traffic Report. The same
+// layout is used by the OwnshipReport.
+type TrafficReport struct {
+	AlertStatus    byte    // Traffic alert status, 4 bits
+	AddressType    byte    // Participant address type, 4 bits
+	Address        uint32  // Participant address, 24 bits
+	Latitude       float64 // Degrees, positive north
+	Longitude      float64 // Degrees, positive east
+	Altitude       int     // Pressure altitude, ft
+	AltitudeValid  bool    // Whether Altitude is available
+	Misc           byte    // Miscellaneous indicators, see the Misc* constants
+	NIC            byte    // Navigation Integrity Category, 4 bits
+	NACp           byte    // Navigation Accuracy Category for Position, 4 bits
+	HVelocity      int     // Horizontal velocity, kt
+	HVelocityValid bool    // Whether HVelocity is available
+	VVelocity      int     // Vertical velocity, ft/min
+	VVelocityValid bool    // Whether VVelocity is available
+	Track          float64 // Track or heading, degrees, see Misc
+	EmitterCat     byte    // Emitter category
+	CallSign       string  // Call sign, up to 8 characters
+	Priority       byte    // Emergency/priority code, 4 bits
+}
+
+func (msg *TrafficReport) MessageID() byte {
+	return MsgIDTrafficReport
+}
+
+func (msg *TrafficReport) MarshalBinary() ([]byte, error) {
+	return msg.marshal(MsgIDTrafficReport)
+}
+
+func (msg *TrafficReport) UnmarshalBinary(data []byte) error {
+	return msg.unmarshal(data, MsgIDTrafficReport)
+}
+
+// Airborne returns whether the participant reports being airborne.
+func (msg *TrafficReport) Airborne() bool {
+	return msg.Misc&MiscAirborne != 0
+}
+
+// TrackType returns which kind of angle Track holds, one of MiscTrackNotValid,
+// MiscTrueTrack, MiscMagneticHeading or MiscTrueHeading.
+func (msg *TrafficReport) TrackType() byte {
+	return msg.Misc & MiscTrackTypeMask
+}
+
+func (msg *TrafficReport) String() string {
+	return msg.format("traffic")
+}
+
+func (msg *TrafficReport) format(name string) string {
+	alt, hvel, vvel := "invalid", "invalid", "invalid"
+	if msg.AltitudeValid {
+		alt = fmt.Sprintf("%dft", msg.Altitude)
+	}
+	if msg.HVelocityValid {
+		hvel = fmt.Sprintf("%dkt", msg.HVelocity)
+	}
+	if msg.VVelocityValid {
+		vvel = fmt.Sprintf("%dfpm", msg.VVelocity)
+	}
+
+	return fmt.Sprintf("%s %06X %q at %.5f,%.5f altitude %s, speed %s, track %.0f, vertical speed %s, NIC %d, NACp %d",
+		name, msg.Address, msg.CallSign, msg.Latitude, msg.Longitude, alt, hvel, msg.Track, vvel, msg.NIC, msg.NACp)
+}
+
+func (msg *TrafficReport) marshal(id byte) ([]byte, error) {
+	data := make([]byte, TrafficReportSize)
+
+	data[0] = id
+	data[1] = (msg.AlertStatus&0x0F)<<4 | msg.AddressType&0x0F
+	data[2] = byte(msg.Address >> 16)
+	data[3] = byte(msg.Address >> 8)
+	data[4] = byte(msg.Address)
+
+	putInt24(data[5:8], int32(math.Round(msg.Latitude/latLonResolution)))
+	putInt24(data[8:11], int32(math.Round(msg.Longitude/latLonResolution)))
+
+	alt := uint16(altitudeInvalid)
+	if msg.AltitudeValid {
+		alt = uint16(clamp(math.Round(float64(msg.Altitude-altitudeOffset)/altitudeResolution), 0, altitudeInvalid-1))
+	}
+	data[11] = byte(alt >> 4)
+	data[12] = byte(alt<<4) | msg.Misc&0x0F
+
+	data[13] = (msg.NIC&0x0F)<<4 | msg.NACp&0x0F
+
+	hvel := uint16(hVelocityInvalid)
+	if msg.HVelocityValid {
+		hvel = uint16(clamp(float64(msg.HVelocity), 0, hVelocityMax))
+	}
+	vvel := uint16(vVelocityInvalid)
+	if msg.VVelocityValid {
+		vvel = uint16(int16(clamp(math.Round(float64(msg.VVelocity)/vVelocityScale), -vVelocityMax, vVelocityMax))) & 0xFFF
+	}
+	data[14] = byte(hvel >> 4)
+	data[15] = byte(hvel<<4) | byte(vvel>>8)&0x0F
+	data[16] = byte(vvel)
+
+	data[17] = byte(int(math.Round(msg.Track/trackResolution)) & 0xFF)
+	data[18] = msg.EmitterCat
+
+	copy(data[19:27], fmt.Sprintf("%-8.8s", msg.CallSign))
+
+	data[27] = (msg.Priority & 0x0F) << 4
+
+	return data, nil
+}
+
+func (msg *TrafficReport) unmarshal(data []byte, id byte) error {
+	if err := checkMessage(data, id, TrafficReportSize); err != nil {
+		return err
+	}
+
+	msg.AlertStatus = data[1] >> 4
+	msg.AddressType = data[1] & 0x0F
+	msg.Address = uint32(data[2])<<16 | uint32(data[3])<<8 | uint32(data[4])
+
+	msg.Latitude = float64(bytes2int24(data[5:8])) * latLonResolution
+	msg.Longitude = float64(bytes2int24(data[8:11])) * latLonResolution
+
+	alt := int(data[11])<<4 | int(data[12])>>4
+	msg.AltitudeValid = alt != altitudeInvalid
+	msg.Altitude = 0
+	if msg.AltitudeValid {
+		msg.Altitude = alt*altitudeResolution + altitudeOffset
+	}
+	msg.Misc = data[12] & 0x0F
+
+	msg.NIC = data[13] >> 4
+	msg.NACp = data[13] & 0x0F
+
+	hvel := int(data[14])<<4 | int(data[15])>>4
+	msg.HVelocityValid = hvel != hVelocityInvalid
+	msg.HVelocity = 0
+	if msg.HVelocityValid {
+		msg.HVelocity = hvel
+	}
+
+	vvel := int(data[15]&0x0F)<<8 | int(data[16])
+	msg.VVelocityValid = vvel != vVelocityInvalid
+	msg.VVelocity = 0
+	if msg.VVelocityValid {
+		if vvel&0x800 != 0 {
+			vvel -= 0x1000
+		}
+		msg.VVelocity = vvel * vVelocityScale
+	}
+
+	msg.Track = float64(data[17]) * trackResolution
+	msg.EmitterCat = data[18]
+	msg.CallSign = strings.TrimRight(string(data[19:27]), " ")
+	msg.Priority = data[27] >> 4
+
+	return nil
+}
+
+// OwnshipReport contains the data from a GDL90 Ownship Report, which has the
+// same layout as a TrafficReport.
+type OwnshipReport struct {
+	TrafficReport
+}
+
+func (msg *OwnshipReport) MessageID() byte {
+	return MsgIDOwnshipReport
+}
+
+func (msg *OwnshipReport) MarshalBinary() ([]byte, error) {
+	return msg.marshal(MsgIDOwnshipReport)
+}
+
+func (msg *OwnshipReport) UnmarshalBinary(data []byte) error {
+	return msg.unmarshal(data, MsgIDOwnshipReport)
+}
+
+func (msg *OwnshipReport) String() string {
+	return msg.format("ownship")
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
@@ -0,0 +1,71 @@
+package gdl90
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	UplinkPayloadSize = 432
+	UplinkDataSize    = 4 + UplinkPayloadSize
+
+	timeOfReceptionResolution = 80 * time.Nanosecond
+	timeOfReceptionInvalid    = 0xFFFFFF
+)
+
+// UplinkData contains a UAT ground uplink message, as received by the GDL90
+// device.
+type UplinkData struct {
+	TimeOfReception      uint32 // Time since the last GPS second, in 80ns units, 24 bits
+	TimeOfReceptionValid bool   // Whether TimeOfReception is available
+	Payload              [UplinkPayloadSize]byte
+}
+
+func (msg *UplinkData) MessageID() byte {
+	return MsgIDUplinkData
+}
+
+func (msg *UplinkData) MarshalBinary() ([]byte, error) {
+	data := make([]byte, UplinkDataSize)
+
+	tor := uint32(timeOfReceptionInvalid)
+	if msg.TimeOfReceptionValid {
+		tor = msg.TimeOfReception & 0xFFFFFF
+	}
+
+	// Time of reception is sent LSB first
+	data[0] = MsgIDUplinkData
+	data[1] = byte(tor)
+	data[2] = byte(tor >> 8)
+	data[3] = byte(tor >> 16)
+	copy(data[4:], msg.Payload[:])
+
+	return data, nil
+}
+
+func (msg *UplinkData) UnmarshalBinary(data []byte) error {
+	if err := checkMessage(data, MsgIDUplinkData, UplinkDataSize); err != nil {
+		return err
+	}
+
+	msg.TimeOfReception = uint32(data[1]) | uint32(data[2])<<8 | uint32(data[3])<<16
+	msg.TimeOfReceptionValid = msg.TimeOfReception != timeOfReceptionInvalid
+	copy(msg.Payload[:], data[4:])
+
+	return nil
+}
+
+// ReceptionDelay returns the time of reception as a duration since the last
+// GPS second.
+func (msg *UplinkData) ReceptionDelay() time.Duration {
+	return time.Duration(msg.TimeOfReception) * timeOfReceptionResolution
+}
+
+func (msg *UplinkData) String() string {
+	tor := "invalid"
+	if msg.TimeOfReceptionValid {
+		tor = msg.ReceptionDelay().String()
+	}
+
+	return fmt.Sprintf("uplink data, time of reception %s, %d bytes", tor, len(msg.Payload))
+}
@@ -1,273 +1,184 @@
 package main
 
 import (
-	"errors"
+	"bufio"
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net"
-)
+	"os"
+	"time"
 
-// iLevil FLAG, CompanyID, PackageID and Version
-const (
-	FLAG     = 0x7e  // iLevil FLAG symbol
-	CID      = "LE"  // iLevil CompanyID
-	PIDAHRS  = 0x01  // AHRS PackageID
-	PIDAHRS1 = 0x01  // AHRS PackageID Version 1
-	INTERR   = 32767 // Error value for int16 types
-	UINTERR  = 65535 // Error value for uint16 types
+	"github.com/westphae/goflying/gdl90"
 )
 
-var ahrsErrorStr = "AHRS Message Error: %s"
+// handleDatagram decodes every frame in a single UDP datagram received at t
+// and writes the messages to out.
+func handleDatagram(decoder *gdl90.Decoder, out output, t time.Time, data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	scanner.Split(gdl90.ScanFrames)
+	for scanner.Scan() {
+		msg, err := decoder.Decode(scanner.Bytes())
+		if err != nil {
+			log.Printf("Malformed frame: %v (%s)\n", err, decoder)
+			continue
+		}
+		if err := out.Write(t, msg); err != nil {
+			log.Fatalf("Couldn't write output: %v\n", err)
+		}
+	}
 
-// AHRSMsg contains the data from an iLevil AHRS version 1 message
-type AHRSMsg struct {
-	companyID        string
-	packageID        byte
-	packageIDVersion byte
-	roll             int16
-	pitch            int16
-	yaw              int16
-	inclination      int16
-	turnCoord        int16
-	gLoad            int16
-	kias             int16
-	pAlt             uint16
-	vertSpeed        int16
+	if err := out.Flush(); err != nil {
+		log.Fatalf("Couldn't write output: %v\n", err)
+	}
 }
 
-func (dat *AHRSMsg) decodeAHRSMsg(msg []byte) (err error) {
-	if len(msg) != 28 {
-		err = fmt.Errorf(ahrsErrorStr, fmt.Sprintf("Message length was %d, should be 28", len(msg)))
-		return
-	}
-	if msg[0] != FLAG {
-		err = fmt.Errorf(ahrsErrorStr, "Missing FLAG 0x7E at message beginning")
-		return
-	}
-	if msg[27] != FLAG {
-		err = fmt.Errorf(ahrsErrorStr, "Missing FLAG 0x7E at message end")
-		return
-	}
-	if s := string(msg[1:3]); s != CID {
-		err = fmt.Errorf(ahrsErrorStr, fmt.Sprintf("Incorrect CompanyID: %s", string(msg[1:3])))
-		return
-	} else {
-		dat.companyID = s
-	}
-	if s := msg[3]; s != PIDAHRS {
-		err = fmt.Errorf(ahrsErrorStr, fmt.Sprintf("Expecting ProductID 0x01, received %b", msg[3]))
-		return
-	} else {
-		dat.packageID = s
-	}
-	if s := msg[4]; s != PIDAHRS1 {
-		err = fmt.Errorf(ahrsErrorStr, fmt.Sprintf("Expecting ProductID Version 0x01, received %b", msg[4]))
-		return
-	} else {
-		dat.packageIDVersion = s
-	}
-	if !crcCheck(msg) {
-		err = fmt.Errorf(ahrsErrorStr, "CRC incorrect")
-		return
+// listen decodes the live GDL90 stream, recording it to capture if not nil.
+func listen(ipAddress string, out output, capture *gdl90.CaptureWriter) {
+	conn, err := net.ListenPacket("udp", ipAddress)
+	if err != nil {
+		log.Fatalf("Couldn't dial UDP at %v: %v\n", ipAddress, err)
 	}
+	defer conn.Close()
+	log.Printf("Dialed UDP: %v\n", ipAddress)
 
-	dat.roll = bytes2int(msg[5:7])
-	dat.pitch = bytes2int(msg[7:9])
-	dat.yaw = bytes2int(msg[9:11])
-	dat.inclination = bytes2int(msg[11:13])
-	dat.turnCoord = bytes2int(msg[13:15])
-	dat.gLoad = bytes2int(msg[15:17])
-	dat.kias = bytes2int(msg[17:19])
-	dat.pAlt = bytes2uint(msg[19:21])
-	dat.vertSpeed = bytes2int(msg[21:23])
+	var decoder gdl90.Decoder
+	buffer := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			log.Printf("Error: %v\n", err)
+			continue
+		}
 
-	return
-}
+		now := time.Now()
 
-func (dat *AHRSMsg) Roll() (roll float64, err error) {
-	if dat.roll == INTERR {
-		err = errors.New("Bad Roll value")
-	} else {
-		roll = float64(dat.roll) / 10
-	}
-	return
-}
+		if capture != nil {
+			if err := capture.WritePacket(gdl90.Packet{Time: now, Data: buffer[:n]}); err != nil {
+				log.Fatalf("Couldn't record packet: %v\n", err)
+			}
+			if err := capture.Flush(); err != nil {
+				log.Fatalf("Couldn't record packet: %v\n", err)
+			}
+		}
 
-func (dat *AHRSMsg) Pitch() (pitch float64, err error) {
-	if dat.pitch == INTERR {
-		err = errors.New("Bad Pitch value")
-	} else {
-		pitch = float64(dat.pitch) / 10
+		handleDatagram(&decoder, out, now, buffer[:n])
 	}
-	return
 }
 
-func (dat *AHRSMsg) Yaw() (yaw float64, err error) {
-	if dat.yaw == INTERR {
-		err = errors.New("Bad Yaw value")
-	} else {
-		yaw = float64(dat.yaw) / 10
+// replay sends a capture file either through the decoder or, if sendTo is
+// set, out to that UDP address.
+func replay(filename string, port int, speed float64, out output, sendTo string) {
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Fatalf("Couldn't open capture file: %v\n", err)
 	}
-	return
-}
+	defer f.Close()
 
-func (dat *AHRSMsg) Inclination() (inclination float64, err error) {
-	if dat.inclination == INTERR {
-		err = errors.New("Bad Inclination value")
-	} else {
-		inclination = float64(dat.inclination) / 10
+	src, err := gdl90.OpenCapture(f)
+	if err != nil {
+		log.Fatalf("Couldn't read capture file %s: %v\n", filename, err)
 	}
-	return
-}
-
-func (dat *AHRSMsg) TurnCoord() (turnCoord float64, err error) {
-	if dat.turnCoord == INTERR {
-		err = errors.New("Bad TurnCoord value")
-	} else {
-		turnCoord = float64(dat.turnCoord) / 10
+	if pr, ok := src.(*gdl90.PcapReader); ok {
+		pr.Port = uint16(port)
 	}
-	return
-}
 
-func (dat *AHRSMsg) GLoad() (gLoad float64, err error) {
-	if dat.gLoad == INTERR {
-		err = errors.New("Bad GLoad value")
-	} else {
-		gLoad = float64(dat.gLoad) / 10
-	}
-	return
-}
+	var (
+		decoder gdl90.Decoder
+		handle  = func(p gdl90.Packet) error {
+			handleDatagram(&decoder, out, p.Time, p.Data)
+			return nil
+		}
+	)
 
-func (dat *AHRSMsg) KIAS() (kias float64, err error) {
-	if dat.kias == INTERR {
-		err = errors.New("Bad KIAS value")
-	} else {
-		kias = float64(dat.kias) / 10
-	}
-	return
-}
+	if sendTo != "" {
+		conn, err := net.Dial("udp", sendTo)
+		if err != nil {
+			log.Fatalf("Couldn't dial UDP at %v: %v\n", sendTo, err)
+		}
+		defer conn.Close()
+		log.Printf("Replaying %s to %v\n", filename, sendTo)
 
-func (dat *AHRSMsg) PAlt() (pAlt float64, err error) {
-	if dat.pAlt == UINTERR {
-		err = errors.New("Bad PAlt value")
-	} else {
-		pAlt = float64(dat.pAlt) - 5000
+		handle = func(p gdl90.Packet) error {
+			_, err := conn.Write(p.Data)
+			return err
+		}
 	}
-	return
-}
 
-func (dat *AHRSMsg) VertSpeed() (vertSpeed float64, err error) {
-	if dat.vertSpeed == INTERR {
-		err = errors.New("Bad VertSpeed value")
-	} else {
-		vertSpeed = float64(dat.vertSpeed)
+	if err := gdl90.Replay(context.Background(), src, speed, handle); err != nil {
+		log.Fatalf("Error replaying %s: %v\n", filename, err)
+	}
+	if sendTo == "" {
+		log.Printf("Replayed %s: %s\n", filename, &decoder)
 	}
-	return
-}
-
-func bytes2int(b []byte) int16 {
-	return (int16(b[1]) << 0) | (int16(b[0]) << 8)
-}
-
-func bytes2uint(b []byte) uint16 {
-	return (uint16(b[1]) << 0) | (uint16(b[0]) << 8)
-}
-
-func crcCheck(msg []byte) bool {
-	return true //TODO westphae: implement this
 }
 
 func main() {
 	var (
-		ipAddress   string
-		n           int
-		err         error
-		roll        float64
-		pitch       float64
-		yaw         float64
-		inclination float64
-		turnCoord   float64
-		gLoad       float64
-		kias        float64
-		pAlt        float64
-		vertSpeed   float64
+		ipAddress  string
+		port       int
+		recordFile string
+		replayFile string
+		speed      float64
+		sendTo     string
+		format     string
 	)
 
+	flag.IntVar(&port, "port", 4000, "UDP port of the GDL90 stream")
+	flag.StringVar(&recordFile, "record", "", "record the received stream to this capture file")
+	flag.StringVar(&replayFile, "replay", "", "replay this capture or pcap file instead of listening")
+	flag.Float64Var(&speed, "speed", 1, "replay speed relative to the original stream, 0 for as fast as possible")
+	flag.StringVar(&format, "format", "pretty", "output format: pretty, json (one object per line) or csv")
+	flag.StringVar(&sendTo, "to", "", "send the replayed stream to this UDP address, e.g. 127.0.0.1:4000, instead of decoding it")
+
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), `gdl90Listener [ip-address]
+		fmt.Fprintf(flag.CommandLine.Output(), `gdl90Listener [flags] [ip-address]
 Parse and monitor the GDL90 stream.
 Stratux only sends the GDL90 stream to wifi-connected devices (i.e. those with a DHCP lease on the 192.168.10.x network).
 		
 To use it, connect to Stratux over wifi, determine the wifi Stratux ip address, e.g. 192.168.10.24, and then run gdl90listener 192.168.10.24.
+
+The stream can be recorded with -record and played back later with -replay, which also accepts pcap files.
+Messages are logged in a human readable layout, or written to stdout as JSON lines or CSV with -format.
+
 `)
+		flag.PrintDefaults()
 	}
 
 	flag.Parse()
-	if len(flag.Args()) == 0 {
-		ipAddress = ":4000"
-	} else {
-		ipAddress = flag.Args()[0] + ":4000"
-	}
 
-	conn, err := net.ListenPacket("udp", ipAddress)
+	out, err := newOutput(format, os.Stdout)
 	if err != nil {
-		log.Fatalf("Couldn't dial UDP at %v: %v\n", ipAddress, err)
+		log.Fatalln(err)
 	}
-	defer conn.Close()
-	log.Printf("Dialed UDP: %v\n", ipAddress)
 
-	ahrsMsg := new(AHRSMsg)
-	buffer := make([]byte, 1024)
-	for {
-		n, _, err = conn.ReadFrom(buffer)
+	if replayFile != "" {
+		replay(replayFile, port, speed, out, sendTo)
+		return
+	}
+
+	if len(flag.Args()) == 0 {
+		ipAddress = fmt.Sprintf(":%d", port)
+	} else {
+		ipAddress = fmt.Sprintf("%s:%d", flag.Args()[0], port)
+	}
+
+	var capture *gdl90.CaptureWriter
+	if recordFile != "" {
+		f, err := os.Create(recordFile)
 		if err != nil {
-			log.Printf("Error: %v\n", err)
-		} else {
-			// log.Printf("Received %s (len %d) from %s\n", string(buffer[0:n]), n, addr)
-			err = ahrsMsg.decodeAHRSMsg(buffer[0:n])
-			if err != nil {
-				continue
-				// log.Println(err)
-			} else {
-				roll, err = ahrsMsg.Roll()
-				if err == nil {
-					log.Printf("%12s %+3.1f", "Roll", roll)
-				}
-				pitch, err = ahrsMsg.Pitch()
-				if err == nil {
-					log.Printf("%12s  %+2.1f", "Pitch", pitch)
-				}
-				yaw, err = ahrsMsg.Yaw()
-				if err == nil {
-					log.Printf("%12s %+3.1f", "Yaw", yaw)
-				}
-				inclination, err = ahrsMsg.Inclination()
-				if err == nil {
-					log.Printf("%12s  %+2.1f", "Inclination", inclination)
-				}
-				turnCoord, err = ahrsMsg.TurnCoord()
-				if err == nil {
-					log.Printf("%12s %+3.1f", "TurnCoord", turnCoord)
-				}
-				gLoad, err = ahrsMsg.GLoad()
-				if err == nil {
-					log.Printf("%12s   %+1.1f", "GLoad", gLoad)
-				}
-				kias, err = ahrsMsg.KIAS()
-				if err == nil {
-					log.Printf("%12s %+4.1f", "KIAS", kias)
-				}
-				pAlt, err = ahrsMsg.PAlt()
-				if err == nil {
-					log.Printf("%12s %+5.0f", "PAlt", pAlt)
-				}
-				vertSpeed, err = ahrsMsg.VertSpeed()
-				if err == nil {
-					log.Printf("%12s %+5.0f", "VertSpeed", vertSpeed)
-				}
-				log.Println()
-			}
+			log.Fatalf("Couldn't create capture file: %v\n", err)
 		}
+		defer f.Close()
+
+		if capture, err = gdl90.NewCaptureWriter(f); err != nil {
+			log.Fatalf("Couldn't write capture file: %v\n", err)
+		}
+		log.Printf("Recording to %s\n", recordFile)
 	}
+
+	listen(ipAddress, out, capture)
 }
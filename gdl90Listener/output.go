@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/westphae/goflying/gdl90"
+)
+
+// output writes decoded messages in one of the supported formats.
+type output interface {
+	Write(t time.Time, msg gdl90.Message) error
+	Flush() error
+}
+
+func newOutput(format string, w io.Writer) (output, error) {
+	switch format {
+	case "pretty":
+		return prettyOutput{}, nil
+	case "json":
+		return &jsonOutput{enc: json.NewEncoder(w)}, nil
+	case "csv":
+		return &csvOutput{w: csv.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q, should be pretty, json or csv", format)
+	}
+}
+
+// field is a single named value of a message, nil when invalid.
+type field struct {
+	name  string
+	value interface{}
+}
+
+// csvColumns lists every field name msgFields can return, in CSV column order.
+var csvColumns = []string{
+	"time", "type", "id",
+	// Heartbeat
+	"gps_pos_valid", "utc_ok", "timestamp", "uplink_count", "basic_long_count",
+	// iLevil and ForeFlight AHRS
+	"roll", "pitch", "yaw", "heading", "heading_magnetic", "inclination", "turn_coord", "g_load",
+	"kias", "ias", "tas", "p_alt", "vert_speed",
+	// Traffic and Ownship reports
+	"address", "address_type", "callsign", "latitude", "longitude", "altitude", "airborne", "track",
+	"h_velocity", "v_velocity", "nic", "nacp", "emitter_category", "alert_status", "priority",
+	// Ownship Geometric Altitude
+	"geo_altitude", "vertical_warning", "vfom",
+	// Uplink Data and unknown messages
+	"time_of_reception", "size",
+}
+
+// msgFields returns the type name and fields of msg.
+func msgFields(msg gdl90.Message) (string, []field) {
+	switch m := msg.(type) {
+	case *gdl90.Heartbeat:
+		return "heartbeat", []field{
+			{"gps_pos_valid", m.GPSPosValid()},
+			{"utc_ok", m.UTCOK()},
+			{"timestamp", m.Timestamp},
+			{"uplink_count", m.UplinkCount},
+			{"basic_long_count", m.BasicLongCount},
+		}
+	case *gdl90.AHRSMsg:
+		return "ahrs", []field{
+			{"roll", valueOrNull(m.Roll())},
+			{"pitch", valueOrNull(m.Pitch())},
+			{"yaw", valueOrNull(m.Yaw())},
+			{"inclination", valueOrNull(m.Inclination())},
+			{"turn_coord", valueOrNull(m.TurnCoord())},
+			{"g_load", valueOrNull(m.GLoad())},
+			{"kias", valueOrNull(m.KIAS())},
+			{"p_alt", valueOrNull(m.PAlt())},
+			{"vert_speed", valueOrNull(m.VertSpeed())},
+		}
+	case *gdl90.ForeFlightAHRS:
+		return "foreflight_ahrs", []field{
+			{"roll", validOrNull(m.RollValid, m.Roll)},
+			{"pitch", validOrNull(m.PitchValid, m.Pitch)},
+			{"heading", validOrNull(m.HeadingValid, m.Heading)},
+			{"heading_magnetic", validOrNull(m.HeadingValid, m.HeadingMagnetic)},
+			{"ias", validOrNull(m.IASValid, m.IAS)},
+			{"tas", validOrNull(m.TASValid, m.TAS)},
+		}
+	case *gdl90.TrafficReport:
+		return "traffic", trafficFields(m)
+	case *gdl90.OwnshipReport:
+		return "ownship", trafficFields(&m.TrafficReport)
+	case *gdl90.OwnshipGeometricAltitude:
+		return "ownship_geometric_altitude", []field{
+			{"geo_altitude", m.Altitude},
+			{"vertical_warning", m.VerticalWarning},
+			{"vfom", validOrNull(m.VFOMValid, m.VFOM)},
+		}
+	case *gdl90.UplinkData:
+		return "uplink", []field{
+			{"time_of_reception", validOrNull(m.TimeOfReceptionValid, m.ReceptionDelay().Seconds())},
+			{"size", len(m.Payload)},
+		}
+	case *gdl90.UnknownMsg:
+		return "unknown", []field{
+			{"size", len(m.Data)},
+		}
+	default:
+		return "unknown", nil
+	}
+}
+
+func trafficFields(m *gdl90.TrafficReport) []field {
+	return []field{
+		{"address", fmt.Sprintf("%06X", m.Address)},
+		{"address_type", m.AddressType},
+		{"callsign", m.CallSign},
+		{"latitude", m.Latitude},
+		{"longitude", m.Longitude},
+		{"altitude", validOrNull(m.AltitudeValid, m.Altitude)},
+		{"airborne", m.Airborne()},
+		{"track", validOrNull(m.TrackType() != gdl90.MiscTrackNotValid, m.Track)},
+		{"h_velocity", validOrNull(m.HVelocityValid, m.HVelocity)},
+		{"v_velocity", validOrNull(m.VVelocityValid, m.VVelocity)},
+		{"nic", m.NIC},
+		{"nacp", m.NACp},
+		{"emitter_category", m.EmitterCat},
+		{"alert_status", m.AlertStatus},
+		{"priority", m.Priority},
+	}
+}
+
+func valueOrNull(v float64, err error) interface{} {
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func validOrNull(valid bool, v interface{}) interface{} {
+	if !valid {
+		return nil
+	}
+	return v
+}
+
+// prettyOutput logs messages in a human readable layout.
+type prettyOutput struct{}
+
+func (prettyOutput) Write(t time.Time, msg gdl90.Message) error {
+	switch m := msg.(type) {
+	case *gdl90.AHRSMsg:
+		logAHRSMsg(m)
+	case fmt.Stringer:
+		log.Println(m)
+	default:
+		log.Printf("message ID 0x%02X\n", msg.MessageID())
+	}
+	return nil
+}
+
+func (prettyOutput) Flush() error {
+	return nil
+}
+
+func logAHRSMsg(ahrsMsg *gdl90.AHRSMsg) {
+	if roll, err := ahrsMsg.Roll(); err == nil {
+		log.Printf("%12s %+3.1f", "Roll", roll)
+	}
+	if pitch, err := ahrsMsg.Pitch(); err == nil {
+		log.Printf("%12s  %+2.1f", "Pitch", pitch)
+	}
+	if yaw, err := ahrsMsg.Yaw(); err == nil {
+		log.Printf("%12s %+3.1f", "Yaw", yaw)
+	}
+	if inclination, err := ahrsMsg.Inclination(); err == nil {
+		log.Printf("%12s  %+2.1f", "Inclination", inclination)
+	}
+	if turnCoord, err := ahrsMsg.TurnCoord(); err == nil {
+		log.Printf("%12s %+3.1f", "TurnCoord", turnCoord)
+	}
+	if gLoad, err := ahrsMsg.GLoad(); err == nil {
+		log.Printf("%12s   %+1.1f", "GLoad", gLoad)
+	}
+	if kias, err := ahrsMsg.KIAS(); err == nil {
+		log.Printf("%12s %+4.1f", "KIAS", kias)
+	}
+	if pAlt, err := ahrsMsg.PAlt(); err == nil {
+		log.Printf("%12s %+5.0f", "PAlt", pAlt)
+	}
+	if vertSpeed, err := ahrsMsg.VertSpeed(); err == nil {
+		log.Printf("%12s %+5.0f", "VertSpeed", vertSpeed)
+	}
+	log.Println()
+}
+
+// jsonOutput writes one JSON object per message. Every field of the message
+// type is present, with null for invalid values.
+type jsonOutput struct {
+	enc *json.Encoder
+}
+
+func (o *jsonOutput) Write(t time.Time, msg gdl90.Message) error {
+	name, fields := msgFields(msg)
+
+	obj := orderedObject{
+		{"time", t.UTC().Format(time.RFC3339Nano)},
+		{"type", name},
+		{"id", msg.MessageID()},
+	}
+
+	return o.enc.Encode(append(obj, fields...))
+}
+
+func (o *jsonOutput) Flush() error {
+	return nil
+}
+
+// orderedObject marshals to a JSON object keeping the order of its fields.
+type orderedObject []field
+
+func (obj orderedObject) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, f := range obj {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendQuote(buf, f.name)
+		buf = append(buf, ':')
+
+		v, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, v...)
+	}
+	return append(buf, '}'), nil
+}
+
+// csvOutput writes one row per message under a header holding csvColumns.
+// Fields which don't apply to the message type or are invalid are empty.
+type csvOutput struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (o *csvOutput) Write(t time.Time, msg gdl90.Message) error {
+	if !o.headerWritten {
+		if err := o.w.Write(csvColumns); err != nil {
+			return err
+		}
+		o.headerWritten = true
+	}
+
+	name, fields := msgFields(msg)
+
+	values := map[string]interface{}{
+		"time": t.UTC().Format(time.RFC3339Nano),
+		"type": name,
+		"id":   msg.MessageID(),
+	}
+	for _, f := range fields {
+		values[f.name] = f.value
+	}
+
+	row := make([]string, len(csvColumns))
+	for i, col := range csvColumns {
+		row[i] = csvValue(values[col])
+	}
+
+	return o.w.Write(row)
+}
+
+func (o *csvOutput) Flush() error {
+	o.w.Flush()
+	return o.w.Error()
+}
+
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/westphae/goflying/gdl90"
+)
+
+func TestOutput(t *testing.T) {
+	ahrs := gdl90.NewAHRSMsg()
+	ahrs.SetRoll(10.5)
+	ahrs.SetPitch(-2)
+	ahrs.SetGLoad(1.5)
+
+	traffic := gdl90.TrafficReport{
+		Address: 0xABCDEF, AddressType: 1, CallSign: "N12345",
+		Latitude: 45.5, Longitude: -122.25, Altitude: 3500, AltitudeValid: true,
+		Misc: gdl90.MiscAirborne | gdl90.MiscTrueTrack, Track: 90,
+		HVelocity: 120, HVelocityValid: true, NIC: 8, NACp: 9, EmitterCat: 1,
+	}
+
+	tm := time.Date(2020, 6, 1, 12, 0, 0, 500000000, time.FixedZone("EDT", -4*3600))
+	const ts = "2020-06-01T16:00:00.5Z"
+
+	tests := []struct {
+		name string
+		msg  gdl90.Message
+		json string
+		csv  map[string]string // Non-empty columns besides time
+	}{
+		{
+			"heartbeat",
+			&gdl90.Heartbeat{Status1: gdl90.HeartbeatGPSPosValid, Timestamp: 3600, UplinkCount: 2, BasicLongCount: 10},
+			`{"time":"` + ts + `","type":"heartbeat","id":0,"gps_pos_valid":true,"utc_ok":false,"timestamp":3600,` +
+				`"uplink_count":2,"basic_long_count":10}`,
+			map[string]string{"type": "heartbeat", "id": "0", "gps_pos_valid": "true", "utc_ok": "false",
+				"timestamp": "3600", "uplink_count": "2", "basic_long_count": "10"},
+		},
+		{
+			"ahrs",
+			ahrs,
+			`{"time":"` + ts + `","type":"ahrs","id":76,"roll":10.5,"pitch":-2,"yaw":null,"inclination":null,` +
+				`"turn_coord":null,"g_load":1.5,"kias":null,"p_alt":null,"vert_speed":null}`,
+			map[string]string{"type": "ahrs", "id": "76", "roll": "10.5", "pitch": "-2", "g_load": "1.5"},
+		},
+		{
+			"foreflight ahrs",
+			&gdl90.ForeFlightAHRS{Roll: -5.5, RollValid: true, Heading: 90, HeadingValid: true, HeadingMagnetic: true,
+				TAS: 110, TASValid: true},
+			`{"time":"` + ts + `","type":"foreflight_ahrs","id":101,"roll":-5.5,"pitch":null,"heading":90,` +
+				`"heading_magnetic":true,"ias":null,"tas":110}`,
+			map[string]string{"type": "foreflight_ahrs", "id": "101", "roll": "-5.5", "heading": "90",
+				"heading_magnetic": "true", "tas": "110"},
+		},
+		{
+			"traffic",
+			&traffic,
+			`{"time":"` + ts + `","type":"traffic","id":20,"address":"ABCDEF","address_type":1,"callsign":"N12345",` +
+				`"latitude":45.5,"longitude":-122.25,"altitude":3500,"airborne":true,"track":90,"h_velocity":120,` +
+				`"v_velocity":null,"nic":8,"nacp":9,"emitter_category":1,"alert_status":0,"priority":0}`,
+			map[string]string{"type": "traffic", "id": "20", "address": "ABCDEF", "address_type": "1",
+				"callsign": "N12345", "latitude": "45.5", "longitude": "-122.25", "altitude": "3500",
+				"airborne": "true", "track": "90", "h_velocity": "120", "nic": "8", "nacp": "9",
+				"emitter_category": "1", "alert_status": "0", "priority": "0"},
+		},
+		{
+			"ownship",
+			&gdl90.OwnshipReport{TrafficReport: gdl90.TrafficReport{Address: 0x12, Latitude: 1, Longitude: 2}},
+			`{"time":"` + ts + `","type":"ownship","id":10,"address":"000012","address_type":0,"callsign":"",` +
+				`"latitude":1,"longitude":2,"altitude":null,"airborne":false,"track":null,"h_velocity":null,` +
+				`"v_velocity":null,"nic":0,"nacp":0,"emitter_category":0,"alert_status":0,"priority":0}`,
+			map[string]string{"type": "ownship", "id": "10", "address": "000012", "address_type": "0",
+				"latitude": "1", "longitude": "2", "airborne": "false", "nic": "0", "nacp": "0",
+				"emitter_category": "0", "alert_status": "0", "priority": "0"},
+		},
+		{
+			"ownship geometric altitude",
+			&gdl90.OwnshipGeometricAltitude{Altitude: 3600, VFOM: 10},
+			`{"time":"` + ts + `","type":"ownship_geometric_altitude","id":11,"geo_altitude":3600,` +
+				`"vertical_warning":false,"vfom":null}`,
+			map[string]string{"type": "ownship_geometric_altitude", "id": "11", "geo_altitude": "3600",
+				"vertical_warning": "false"},
+		},
+		{
+			"uplink",
+			&gdl90.UplinkData{TimeOfReception: 12500, TimeOfReceptionValid: true},
+			`{"time":"` + ts + `","type":"uplink","id":7,"time_of_reception":0.001,"size":432}`,
+			map[string]string{"type": "uplink", "id": "7", "time_of_reception": "0.001", "size": "432"},
+		},
+		{
+			"unknown",
+			&gdl90.UnknownMsg{Data: []byte{0x99, 1, 2}},
+			`{"time":"` + ts + `","type":"unknown","id":153,"size":3}`,
+			map[string]string{"type": "unknown", "id": "153", "size": "3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			o, err := newOutput("json", &buf)
+			if err != nil {
+				t.Fatalf("newOutput(json) error = %v", err)
+			}
+			if err := o.Write(tm, tt.msg); err != nil {
+				t.Fatalf("json Write() error = %v", err)
+			}
+			if err := o.Flush(); err != nil {
+				t.Fatalf("json Flush() error = %v", err)
+			}
+			if got := strings.TrimSuffix(buf.String(), "\n"); got != tt.json {
+				t.Errorf("json output\n%s\nwant\n%s", got, tt.json)
+			}
+
+			buf.Reset()
+			if o, err = newOutput("csv", &buf); err != nil {
+				t.Fatalf("newOutput(csv) error = %v", err)
+			}
+			if err := o.Write(tm, tt.msg); err != nil {
+				t.Fatalf("csv Write() error = %v", err)
+			}
+			if err := o.Flush(); err != nil {
+				t.Fatalf("csv Flush() error = %v", err)
+			}
+			rows, err := csv.NewReader(&buf).ReadAll()
+			if err != nil || len(rows) != 2 {
+				t.Fatalf("csv output = %q, %v, want a header and a row", rows, err)
+			}
+			if got, want := strings.Join(rows[0], ","), strings.Join(csvColumns, ","); got != want {
+				t.Errorf("csv header = %s, want %s", got, want)
+			}
+			for i, col := range rows[0] {
+				want := tt.csv[col]
+				if col == "time" {
+					want = ts
+				}
+				if rows[1][i] != want {
+					t.Errorf("csv column %s = %q, want %q", col, rows[1][i], want)
+				}
+			}
+		})
+	}
+}
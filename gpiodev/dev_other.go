@@ -0,0 +1,10 @@
+//go:build !linux
+
+package gpiodev
+
+import "errors"
+
+// Open is only supported on Linux.
+func Open(chip, offset int) (*Line, error) {
+	return nil, errors.New("gpiodev: the GPIO character device is only available on Linux")
+}
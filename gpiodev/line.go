@@ -0,0 +1,113 @@
+/*
+Package gpiodev watches GPIO lines for edges through the Linux GPIO character device, /dev/gpiochipN.
+
+The kernel timestamps each edge in its interrupt handler, so a Line knows when a chip raised its interrupt
+pin however late the reading goroutine gets scheduled.  A Line has the Edges method of sensors.EdgeSource,
+so it can pace the IMU drivers by their data-ready interrupt.
+*/
+package gpiodev
+
+import (
+	"sync"
+	"time"
+)
+
+// edgeBufSize is the number of edges a Line holds for a slow reader before dropping the oldest.
+const edgeBufSize = 16
+
+// Event is one edge seen on a line.
+type Event struct {
+	Time   time.Time // Kernel timestamp of the edge
+	Rising bool
+}
+
+// Conn is an open line request, the layer a Line reads its events through.
+type Conn interface {
+	ReadEvent() (Event, error) // Waits for the next edge
+	Close() error              // Makes a waiting ReadEvent return an error
+}
+
+/*
+Line delivers the times of the rising edges read from a Conn.
+If the reader falls behind, the oldest edges are dropped and counted.
+*/
+type Line struct {
+	conn  Conn
+	edges chan time.Time
+	done  chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	err     error
+	dropped uint64
+}
+
+// New returns a Line reading from c until it fails or the Line is closed.
+func New(c Conn) *Line {
+	l := &Line{conn: c, edges: make(chan time.Time, edgeBufSize), done: make(chan struct{})}
+	go l.run()
+	return l
+}
+
+func (l *Line) run() {
+	defer close(l.done)
+	defer close(l.edges)
+
+	for {
+		e, err := l.conn.ReadEvent()
+		if err != nil {
+			l.mu.Lock()
+			if !l.closed {
+				l.err = err
+			}
+			l.mu.Unlock()
+			return
+		}
+		if !e.Rising {
+			continue
+		}
+
+		select {
+		case l.edges <- e.Time:
+		default: // Make room by dropping the oldest edge; only run sends, so there is room afterwards
+			select {
+			case <-l.edges:
+				l.mu.Lock()
+				l.dropped++
+				l.mu.Unlock()
+			default:
+			}
+			l.edges <- e.Time
+		}
+	}
+}
+
+// Edges returns a channel receiving the time of each rising edge.  It is closed when the line fails or is closed.
+func (l *Line) Edges() <-chan time.Time {
+	return l.edges
+}
+
+// Err returns the error that stopped the line, or nil if it is still running or was closed.
+func (l *Line) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Dropped returns the number of edges dropped because they weren't received in time.
+func (l *Line) Dropped() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.dropped
+}
+
+// Close releases the line and waits for the Edges channel to be closed.
+func (l *Line) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+
+	err := l.conn.Close()
+	<-l.done
+	return err
+}
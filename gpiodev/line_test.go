@@ -0,0 +1,85 @@
+package gpiodev
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeConn delivers the events sent on its channel, and io.EOF once it is closed.
+type fakeConn struct {
+	events chan Event
+	closed chan struct{}
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{events: make(chan Event), closed: make(chan struct{})}
+}
+
+func (c *fakeConn) ReadEvent() (Event, error) {
+	select {
+	case e, ok := <-c.events:
+		if !ok {
+			return Event{}, io.EOF
+		}
+		return e, nil
+	case <-c.closed:
+		return Event{}, os.ErrClosed
+	}
+}
+
+func (c *fakeConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestLine(t *testing.T) {
+	c := newFakeConn()
+	l := New(c)
+	t0 := time.Now()
+
+	// Falling edges are skipped, and once the buffer is full the oldest edges are dropped
+	for i := 0; i < edgeBufSize+4; i++ {
+		c.events <- Event{Time: t0.Add(time.Duration(i) * time.Millisecond), Rising: true}
+		c.events <- Event{Time: t0, Rising: false}
+	}
+	close(c.events)
+
+	i := 4
+	for ts := range l.Edges() {
+		if want := t0.Add(time.Duration(i) * time.Millisecond); !ts.Equal(want) {
+			t.Errorf("edge %d at %v, want %v", i, ts.Sub(t0), want.Sub(t0))
+		}
+		i++
+	}
+	if i != edgeBufSize+4 {
+		t.Errorf("got edges up to %d, want %d", i, edgeBufSize+4)
+	}
+	if n := l.Dropped(); n != 4 {
+		t.Errorf("Dropped() = %d, want 4", n)
+	}
+	if err := l.Err(); err != io.EOF {
+		t.Errorf("Err() after the line failed = %v, want EOF", err)
+	}
+}
+
+func TestLineClose(t *testing.T) {
+	c := newFakeConn()
+	l := New(c)
+	t0 := time.Now()
+	c.events <- Event{Time: t0, Rising: true}
+
+	if ts := <-l.Edges(); !ts.Equal(t0) {
+		t.Errorf("edge at %v, want %v", ts, t0)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, ok := <-l.Edges(); ok {
+		t.Errorf("Edges() not closed by Close()")
+	}
+	if err := l.Err(); err != nil {
+		t.Errorf("Err() after Close() = %v", err)
+	}
+}
@@ -1,77 +1,215 @@
 package goflying
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/kidoman/embd"
 )
 
-// I2CBus wraps an I2CBus interface with debugging support
+var ErrI2CTimeout = errors.New("i2c: transaction timed out")
+
+/*
+I2CBus wraps an I2CBus interface with debugging, recording, retry and error counting support.
+The zero values of Retries, Backoff and Timeout give a single attempt with no deadline,
+the behavior of the bare bus.
+*/
 type I2CBus struct {
-	I2CBus embd.I2CBus
+	I2CBus   embd.I2CBus
+	Recorder *I2CRecorder  // Records every transaction when set, otherwise I2CCapture does
+	Retries  int           // Number of times a failed transaction is retried, except a write that timed out
+	Backoff  time.Duration // Wait before the first retry, doubled for each following one
+	Timeout  time.Duration // Deadline for each attempt of a transaction, none if 0
+
+	mu      sync.Mutex
+	stats   map[i2cKey]*I2CStats
+	pending chan struct{} // Closed when the last attempt abandoned after Timeout finishes
+}
+
+// record writes a completed transaction to the bus's recorder, if any.
+func (b *I2CBus) record(op I2COp, addr byte, reg int, value []byte, err error) {
+	r := b.Recorder
+	if r == nil {
+		r = I2CCapture
+	}
+	if r == nil {
+		return
+	}
+
+	t := I2CTransaction{T: time.Now(), Op: op, Addr: addr, Reg: reg, Data: value}
+	if err != nil {
+		t.Err = err.Error()
+		if op == I2CRead {
+			t.Data = nil
+		}
+	}
+	r.Record(t)
+}
+
+// attempt runs f once, giving up on it after the bus's Timeout.
+// A timed out f keeps running in the background, so it mustn't write to memory shared with the caller.
+// No attempt starts until the last timed out one has finished, so that they can't overlap on the bus,
+// and waiting for it counts toward the Timeout.
+func (b *I2CBus) attempt(f func() ([]byte, error)) ([]byte, error) {
+	if b.Timeout <= 0 {
+		return f()
+	}
+
+	timer := time.NewTimer(b.Timeout)
+	defer timer.Stop()
+
+	b.mu.Lock()
+	pending := b.pending
+	b.mu.Unlock()
+	if pending != nil {
+		select {
+		case <-pending:
+		case <-timer.C:
+			return nil, ErrI2CTimeout
+		}
+	}
+
+	type result struct {
+		value []byte
+		err   error
+	}
+	c := make(chan result, 1)
+	done := make(chan struct{})
+	go func() {
+		v, err := f()
+		c <- result{v, err}
+		close(done)
+	}()
+
+	select {
+	case r := <-c:
+		return r.value, r.err
+	case <-timer.C:
+		b.mu.Lock()
+		b.pending = done
+		b.mu.Unlock()
+		return nil, ErrI2CTimeout
+	}
+}
+
+/*
+transact performs a transaction with f, retrying it with backoff up to retries times if it fails.
+f returns the bytes read, for a read, while value is the data written, for a write.
+Every attempt is recorded and counted.
+*/
+func (b *I2CBus) transact(op I2COp, addr byte, reg int, value []byte, retries int, f func() ([]byte, error)) ([]byte, error) {
+	backoff := b.Backoff
+	for n := 0; ; n++ {
+		v, err := b.attempt(f)
+		if op == I2CWrite {
+			v = value
+		}
+		// A write that timed out may still happen, and mustn't happen twice
+		final := err == nil || n >= retries || (op == I2CWrite && errors.Is(err, ErrI2CTimeout))
+		b.record(op, addr, reg, v, err)
+		b.count(addr, reg, n, final, err)
+
+		if final {
+			return v, err
+		}
+
+		Debugf("i2c: retrying %s 0x%02X at %d after error: %v", op, addr, reg, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
 }
 
 //goland:noinspection GoStandardMethods
 func (b *I2CBus) ReadByte(addr byte) (byte, error) {
-	if !Debugging {
-		return b.I2CBus.ReadByte(addr)
+	if Debugging {
+		Logger.Printf("i2c: reading a byte from address 0x%02X", addr)
 	}
 
-	bytes, err := b.ReadBytes(addr, 1)
+	bytes, err := b.transact(I2CRead, addr, NoReg, nil, b.Retries, func() ([]byte, error) {
+		v, err := b.I2CBus.ReadByte(addr)
+		return []byte{v}, err
+	})
 	if len(bytes) < 1 {
 		return 0, err
 	}
 
+	if Debugging {
+		Logger.Printf("i2c: received from 0x%02X: %s", addr, debugBytes(bytes))
+	}
+
 	return bytes[0], err
 }
 
 func (b *I2CBus) ReadBytes(addr byte, num int) ([]byte, error) {
-	if !Debugging {
-		return b.I2CBus.ReadBytes(addr, num)
+	if Debugging {
+		Logger.Printf("i2c: reading %d bytes from address 0x%02X", num, addr)
 	}
 
-	Logger.Printf("i2c: reading %d bytes from address 0x%02X", num, addr)
+	bytes, err := b.transact(I2CRead, addr, NoReg, nil, b.Retries, func() ([]byte, error) {
+		return b.I2CBus.ReadBytes(addr, num)
+	})
 
-	bytes, err := b.I2CBus.ReadBytes(addr, num)
-	if len(bytes) < 1 {
-		return bytes, err
+	if Debugging && len(bytes) > 0 {
+		Logger.Printf("i2c: received from 0x%02X: %s", addr, debugBytes(bytes))
 	}
 
-	Logger.Printf("i2c: received from 0x%02X: %s", addr, debugBytes(bytes))
-
 	return bytes, err
 }
 
 //goland:noinspection GoStandardMethods
 func (b *I2CBus) WriteByte(addr, value byte) error {
-	if !Debugging {
-		return b.I2CBus.WriteByte(addr, value)
+	if Debugging {
+		Logger.Printf("i2c: writing to 0x%02X: %s", addr, debugBytes([]byte{value}))
 	}
 
-	return b.WriteBytes(addr, []byte{value})
+	_, err := b.transact(I2CWrite, addr, NoReg, []byte{value}, b.Retries, func() ([]byte, error) {
+		return nil, b.I2CBus.WriteByte(addr, value)
+	})
+	return err
 }
 
 func (b *I2CBus) WriteBytes(addr byte, value []byte) error {
-	if !Debugging {
-		return b.I2CBus.WriteBytes(addr, value)
+	if Debugging {
+		Logger.Printf("i2c: writing to 0x%02X: %s", addr, debugBytes(value))
 	}
 
-	Logger.Printf("i2c: writing to 0x%02X: %s", addr, debugBytes(value))
-
-	return b.I2CBus.WriteBytes(addr, value)
+	_, err := b.transact(I2CWrite, addr, NoReg, value, b.Retries, func() ([]byte, error) {
+		return nil, b.I2CBus.WriteBytes(addr, value)
+	})
+	return err
 }
 
 func (b *I2CBus) ReadFromReg(addr, reg byte, value []byte) error {
-	if !Debugging {
-		return b.I2CBus.ReadFromReg(addr, reg, value)
-	}
+	return b.readFromReg(addr, reg, value, b.Retries)
+}
 
-	Logger.Printf("i2c: reading %d bytes from address 0x%02X at 0x%02X", len(value), addr, reg)
+/*
+ReadFromRegOnce reads like ReadFromReg, but never retries a failed read.
+It is for registers such as a FIFO, where a failed read may already have consumed some of the data
+and a second read would consume more.
+*/
+func (b *I2CBus) ReadFromRegOnce(addr, reg byte, value []byte) error {
+	return b.readFromReg(addr, reg, value, 0)
+}
 
-	err := b.I2CBus.ReadFromReg(addr, reg, value)
+func (b *I2CBus) readFromReg(addr, reg byte, value []byte, retries int) error {
+	if Debugging {
+		Logger.Printf("i2c: reading %d bytes from address 0x%02X at 0x%02X", len(value), addr, reg)
+	}
+
+	bytes, err := b.transact(I2CRead, addr, int(reg), nil, retries, func() ([]byte, error) {
+		buf := make([]byte, len(value))
+		err := b.I2CBus.ReadFromReg(addr, reg, buf)
+		return buf, err
+	})
+	copy(value, bytes)
 
-	Logger.Printf("i2c: received from 0x%02X at 0x%02X: %s", addr, reg, debugBytes(value))
+	if Debugging {
+		Logger.Printf("i2c: received from 0x%02X at 0x%02X: %s", addr, reg, debugBytes(value))
+	}
 
 	return err
 }
@@ -93,33 +231,37 @@ func (b *I2CBus) ReadWordFromReg(addr, reg byte) (uint16, error) {
 }
 
 func (b *I2CBus) WriteToReg(addr, reg byte, value []byte) error {
-	if !Debugging {
-		return b.I2CBus.WriteToReg(addr, reg, value)
+	if Debugging {
+		Logger.Printf("i2c: writing to 0x%02X at 0x%02X: %s", addr, reg, debugBytes(value))
 	}
 
-	Logger.Printf("i2c: writing to 0x%02X at 0x%02X: %s", addr, reg, debugBytes(value))
-
-	return b.I2CBus.WriteToReg(addr, reg, value)
+	_, err := b.transact(I2CWrite, addr, int(reg), value, b.Retries, func() ([]byte, error) {
+		return nil, b.I2CBus.WriteToReg(addr, reg, value)
+	})
+	return err
 }
 
 func (b *I2CBus) WriteByteToReg(addr, reg, value byte) error {
-	if !Debugging {
-		return b.I2CBus.WriteByteToReg(addr, reg, value)
+	if Debugging {
+		Logger.Printf("i2c: writing to 0x%02X at 0x%02X: %s", addr, reg, debugBytes([]byte{value}))
 	}
 
-	Logger.Printf("i2c: writing to 0x%02X at 0x%02X: %s", addr, reg, debugBytes([]byte{value}))
-
-	return b.I2CBus.WriteByteToReg(addr, reg, value)
+	_, err := b.transact(I2CWrite, addr, int(reg), []byte{value}, b.Retries, func() ([]byte, error) {
+		return nil, b.I2CBus.WriteByteToReg(addr, reg, value)
+	})
+	return err
 }
 
 func (b *I2CBus) WriteWordToReg(addr, reg byte, value uint16) error {
-	if !Debugging {
-		return b.I2CBus.WriteWordToReg(addr, reg, value)
+	word := []byte{byte(value >> 8), byte(value)}
+	if Debugging {
+		Logger.Printf("i2c: writing to 0x%02X at 0x%02X: %s", addr, reg, debugBytes(word))
 	}
 
-	Logger.Printf("i2c: writing to 0x%02X at 0x%02X: %s", addr, reg, debugBytes([]byte{byte(value >> 8), byte(value)}))
-
-	return b.I2CBus.WriteWordToReg(addr, reg, value)
+	_, err := b.transact(I2CWrite, addr, int(reg), word, b.Retries, func() ([]byte, error) {
+		return nil, b.I2CBus.WriteWordToReg(addr, reg, value)
+	})
+	return err
 }
 
 func (b *I2CBus) Close() error {
@@ -0,0 +1,285 @@
+package goflying
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// I2COp is the direction of an I2C transaction.
+type I2COp string
+
+const (
+	I2CRead  I2COp = "read"
+	I2CWrite I2COp = "write"
+
+	NoReg = -1 // Register of a raw ReadBytes or WriteBytes transaction
+)
+
+var (
+	ErrReplayEnd      = errors.New("i2c: no more transactions in capture")
+	ErrReplayMismatch = errors.New("i2c: transaction doesn't match capture")
+)
+
+// I2CCapture, when set, records the transactions of every I2CBus without its own Recorder.
+// StartI2CCapture sets it to record to a file.
+var I2CCapture *I2CRecorder
+
+var i2cCaptureFile *os.File // Opened by StartI2CCapture
+
+// StartI2CCapture creates the capture file name and records the transactions of every I2CBus without
+// its own Recorder to it.  It should be called before the buses are used.
+func StartI2CCapture(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("i2c: creating capture file: %w", err)
+	}
+	I2CCapture, i2cCaptureFile = NewI2CRecorder(f), f
+	return nil
+}
+
+// StopI2CCapture stops the recording started by StartI2CCapture and closes the capture file.
+// It should be called once the buses are no longer used.
+func StopI2CCapture() error {
+	f := i2cCaptureFile
+	I2CCapture, i2cCaptureFile = nil, nil
+	if f == nil {
+		return nil
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("i2c: closing capture file: %w", err)
+	}
+	return nil
+}
+
+// I2CData is the payload of an I2C transaction, stored as hex in a capture file.
+type I2CData []byte
+
+func (d I2CData) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(d)), nil
+}
+
+func (d *I2CData) UnmarshalText(text []byte) error {
+	v, err := hex.DecodeString(string(text))
+	if err != nil {
+		return fmt.Errorf("i2c: bad data in capture: %w", err)
+	}
+	*d = v
+	return nil
+}
+
+// I2CTransaction is a single completed read or write on an I2C bus, one line of a capture file.
+type I2CTransaction struct {
+	T    time.Time `json:"t"`
+	Op   I2COp     `json:"op"`
+	Addr byte      `json:"addr"`
+	Reg  int       `json:"reg"` // NoReg for raw transactions
+	Data I2CData   `json:"data"`
+	Err  string    `json:"err,omitempty"`
+}
+
+func (t I2CTransaction) String() string {
+	s := fmt.Sprintf("%s %s 0x%02X", t.T.Format("15:04:05.000000"), t.Op, t.Addr)
+	if t.Reg != NoReg {
+		s += fmt.Sprintf(" at 0x%02X", t.Reg)
+	}
+	s += " " + debugBytes(t.Data)
+	if t.Err != "" {
+		s += ": " + t.Err
+	}
+	return s
+}
+
+// I2CRecorder writes I2C transactions to a capture file as JSON, one per line.
+// It is safe for use by several buses at once.
+type I2CRecorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewI2CRecorder returns a recorder writing to w.
+func NewI2CRecorder(w io.Writer) *I2CRecorder {
+	return &I2CRecorder{enc: json.NewEncoder(w)}
+}
+
+// Record writes t to the capture.  After the first write error, nothing more is recorded.
+func (r *I2CRecorder) Record(t I2CTransaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return
+	}
+	if err := r.enc.Encode(t); err != nil {
+		r.err = fmt.Errorf("i2c: capture stopped: %w", err)
+		Logger.Println(r.err)
+	}
+}
+
+// Err returns the error that stopped the recording, if any.
+func (r *I2CRecorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// ReadI2CCapture reads all the transactions of a capture file written by an I2CRecorder.
+func ReadI2CCapture(r io.Reader) ([]I2CTransaction, error) {
+	var tt []I2CTransaction
+	dec := json.NewDecoder(r)
+	for {
+		var t I2CTransaction
+		if err := dec.Decode(&t); err == io.EOF {
+			return tt, nil
+		} else if err != nil {
+			return tt, fmt.Errorf("i2c: reading capture transaction %d: %w", len(tt), err)
+		}
+		tt = append(tt, t)
+	}
+}
+
+type replayKey struct {
+	op   I2COp
+	addr byte
+	reg  int
+}
+
+/*
+I2CReplayBus is an embd.I2CBus serving the transactions of a capture back to the drivers.
+Transactions are replayed in their recorded order for each direction, address and register, so
+drivers polling several registers in any order, or several chips sharing the bus, replay faithfully.
+A write must match the recorded data.  The drivers pace themselves with their own timers, as on the
+real bus.
+*/
+type I2CReplayBus struct {
+	mu      sync.Mutex
+	pending map[replayKey][]I2CTransaction
+}
+
+// NewI2CReplayBus returns a bus replaying the transactions tt, as returned by ReadI2CCapture.
+func NewI2CReplayBus(tt []I2CTransaction) *I2CReplayBus {
+	b := &I2CReplayBus{pending: make(map[replayKey][]I2CTransaction)}
+	for _, t := range tt {
+		k := replayKey{t.Op, t.Addr, t.Reg}
+		b.pending[k] = append(b.pending[k], t)
+	}
+	return b
+}
+
+// Remaining returns the number of transactions not yet replayed.
+func (b *I2CReplayBus) Remaining() (n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, tt := range b.pending {
+		n += len(tt)
+	}
+	return n
+}
+
+// next removes and returns the next recorded transaction matching op, addr and reg.
+func (b *I2CReplayBus) next(op I2COp, addr byte, reg int) (I2CTransaction, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	k := replayKey{op, addr, reg}
+	tt := b.pending[k]
+	if len(tt) == 0 {
+		return I2CTransaction{}, fmt.Errorf("%w: %s 0x%02X at %d", ErrReplayEnd, op, addr, reg)
+	}
+	b.pending[k] = tt[1:]
+	return tt[0], nil
+}
+
+func (b *I2CReplayBus) read(addr byte, reg int, value []byte) error {
+	t, err := b.next(I2CRead, addr, reg)
+	if err != nil {
+		return err
+	}
+	if t.Err != "" {
+		return errors.New(t.Err)
+	}
+	if len(t.Data) != len(value) {
+		return fmt.Errorf("%w: read %d bytes, captured %s", ErrReplayMismatch, len(value), t)
+	}
+	copy(value, t.Data)
+	return nil
+}
+
+func (b *I2CReplayBus) write(addr byte, reg int, value []byte) error {
+	t, err := b.next(I2CWrite, addr, reg)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(t.Data, value) {
+		return fmt.Errorf("%w: wrote %s, captured %s", ErrReplayMismatch, debugBytes(value), t)
+	}
+	if t.Err != "" {
+		return errors.New(t.Err)
+	}
+	return nil
+}
+
+//goland:noinspection GoStandardMethods
+func (b *I2CReplayBus) ReadByte(addr byte) (byte, error) {
+	v := make([]byte, 1)
+	err := b.read(addr, NoReg, v)
+	return v[0], err
+}
+
+func (b *I2CReplayBus) ReadBytes(addr byte, num int) ([]byte, error) {
+	v := make([]byte, num)
+	if err := b.read(addr, NoReg, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+//goland:noinspection GoStandardMethods
+func (b *I2CReplayBus) WriteByte(addr, value byte) error {
+	return b.write(addr, NoReg, []byte{value})
+}
+
+func (b *I2CReplayBus) WriteBytes(addr byte, value []byte) error {
+	return b.write(addr, NoReg, value)
+}
+
+func (b *I2CReplayBus) ReadFromReg(addr, reg byte, value []byte) error {
+	return b.read(addr, int(reg), value)
+}
+
+func (b *I2CReplayBus) ReadByteFromReg(addr, reg byte) (byte, error) {
+	v := make([]byte, 1)
+	err := b.read(addr, int(reg), v)
+	return v[0], err
+}
+
+func (b *I2CReplayBus) ReadWordFromReg(addr, reg byte) (uint16, error) {
+	v := make([]byte, 2)
+	if err := b.read(addr, int(reg), v); err != nil {
+		return 0, err
+	}
+	return uint16(v[0])<<8 | uint16(v[1]), nil
+}
+
+func (b *I2CReplayBus) WriteToReg(addr, reg byte, value []byte) error {
+	return b.write(addr, int(reg), value)
+}
+
+func (b *I2CReplayBus) WriteByteToReg(addr, reg, value byte) error {
+	return b.write(addr, int(reg), []byte{value})
+}
+
+func (b *I2CReplayBus) WriteWordToReg(addr, reg byte, value uint16) error {
+	return b.write(addr, int(reg), []byte{byte(value >> 8), byte(value)})
+}
+
+func (b *I2CReplayBus) Close() error {
+	return nil
+}
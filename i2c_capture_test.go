@@ -0,0 +1,136 @@
+package goflying_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/westphae/goflying"
+	"github.com/westphae/goflying/i2ctest"
+	"github.com/westphae/goflying/sensors"
+	"github.com/westphae/goflying/sensors/bmp280"
+)
+
+func TestI2CCapture(t *testing.T) {
+	b := i2ctest.NewBus()
+	r := i2ctest.NewRegisters()
+	r.Set(0x10, 1, 2, 3)
+	b.Attach(0x42, r)
+
+	var capture bytes.Buffer
+	rec := goflying.NewI2CRecorder(&capture)
+	bus := &goflying.I2CBus{I2CBus: b, Recorder: rec}
+	bus.WriteWordToReg(0x42, 0x20, 0xABCD)
+	bus.ReadWordFromReg(0x42, 0x10)
+	bus.WriteBytes(0x42, []byte{0x11})
+	bus.ReadBytes(0x42, 2)
+	bus.ReadByteFromReg(0x43, 0)
+	if err := rec.Err(); err != nil {
+		t.Fatalf("recorder error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(capture.String()), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[0], `"op":"write","addr":66,"reg":32,"data":"abcd"`) ||
+		!strings.Contains(lines[4], `"err":"i2ctest: no device at address`) {
+		t.Fatalf("capture:\n%s", capture.String())
+	}
+
+	tt, err := goflying.ReadI2CCapture(&capture)
+	if err != nil || len(tt) != 5 {
+		t.Fatalf("ReadI2CCapture() = %v, %v", tt, err)
+	}
+	if tt[3].Reg != goflying.NoReg || !bytes.Equal(tt[3].Data, []byte{2, 3}) {
+		t.Errorf("raw read = %s", tt[3])
+	}
+
+	rb := goflying.NewI2CReplayBus(tt)
+	replay := &goflying.I2CBus{I2CBus: rb}
+	if err := replay.WriteWordToReg(0x42, 0x20, 0xABCD); err != nil {
+		t.Errorf("replayed WriteWordToReg() error = %v", err)
+	}
+	if err := replay.WriteBytes(0x42, []byte{0x12}); !errors.Is(err, goflying.ErrReplayMismatch) {
+		t.Errorf("mismatched write error = %v, want %v", err, goflying.ErrReplayMismatch)
+	}
+	if v, err := replay.ReadBytes(0x42, 2); err != nil || !bytes.Equal(v, []byte{2, 3}) {
+		t.Errorf("replayed ReadBytes() = % X, %v", v, err)
+	}
+	if w, err := replay.ReadWordFromReg(0x42, 0x10); err != nil || w != 0x0102 {
+		t.Errorf("replayed ReadWordFromReg() = %04X, %v", w, err)
+	}
+	if _, err := replay.ReadByteFromReg(0x43, 0); err == nil {
+		t.Errorf("replayed failed read succeeded")
+	}
+	if _, err := replay.ReadWordFromReg(0x42, 0x10); !errors.Is(err, goflying.ErrReplayEnd) {
+		t.Errorf("read past end of capture error = %v, want %v", err, goflying.ErrReplayEnd)
+	}
+	if n := rb.Remaining(); n != 0 {
+		t.Errorf("%d transactions not replayed", n)
+	}
+}
+
+func TestStartI2CCapture(t *testing.T) {
+	b := i2ctest.NewBus()
+	b.Attach(0x42, i2ctest.NewRegisters())
+	bus := &goflying.I2CBus{I2CBus: b}
+
+	name := filepath.Join(t.TempDir(), "capture.json")
+	if err := goflying.StartI2CCapture(name); err != nil {
+		t.Fatalf("StartI2CCapture() error = %v", err)
+	}
+	bus.WriteByteToReg(0x42, 0x20, 0xAB)
+	if err := goflying.StopI2CCapture(); err != nil {
+		t.Fatalf("StopI2CCapture() error = %v", err)
+	}
+	bus.WriteByteToReg(0x42, 0x21, 0xCD) // Not recorded
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if tt, err := goflying.ReadI2CCapture(f); err != nil || len(tt) != 1 || tt[0].Reg != 0x20 {
+		t.Errorf("ReadI2CCapture() = %v, %v, want the write to 0x20", tt, err)
+	}
+
+	if err := goflying.StartI2CCapture(filepath.Join(name, "capture.json")); err == nil {
+		goflying.StopI2CCapture()
+		t.Errorf("StartI2CCapture() in a file succeeded")
+	}
+}
+
+func TestI2CReplayDriver(t *testing.T) {
+	b := i2ctest.NewBus()
+	chip := i2ctest.NewBMP280(bmp280.ChipID3)
+	chip.SetRaw(338837, 526634)
+	b.Attach(bmp280.Address2, chip)
+
+	var capture bytes.Buffer
+	var bus sensors.I2CBus = &goflying.I2CBus{I2CBus: b, Recorder: goflying.NewI2CRecorder(&capture)}
+	want := readBMP280(t, bus)
+
+	tt, err := goflying.ReadI2CCapture(&capture)
+	if err != nil {
+		t.Fatalf("ReadI2CCapture() error = %v", err)
+	}
+	bus = &goflying.I2CBus{I2CBus: goflying.NewI2CReplayBus(tt)}
+	if got := readBMP280(t, bus); got != want {
+		t.Errorf("replayed reading = %+v, want %+v", got, want)
+	}
+}
+
+func readBMP280(t *testing.T, bus sensors.I2CBus) sensors.BMPData {
+	bmp, err := bmp280.NewBMP280(bus, bmp280.Address2, bmp280.NormalMode, bmp280.StandbyTime1ms,
+		bmp280.FilterCoeffOff, bmp280.Oversamp1x, bmp280.Oversamp1x)
+	if err != nil {
+		t.Fatalf("NewBMP280() error = %v", err)
+	}
+	defer bmp.Close()
+
+	c, cancel := bmp.Subscribe(1)
+	defer cancel()
+	d := <-c
+	return sensors.BMPData{Temperature: d.Temperature, Pressure: d.Pressure}
+}
@@ -0,0 +1,111 @@
+package goflying
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+type i2cKey struct {
+	addr byte
+	reg  int
+}
+
+// I2CStats counts the transactions with one register of one device on an I2CBus, or with all of them.
+type I2CStats struct {
+	Addr          byte      `json:"addr"`
+	Reg           int       `json:"reg"`          // NoReg for raw transactions, or totals over a device's registers
+	Transactions  uint64    `json:"transactions"` // Completed transactions, after any retries
+	Errors        uint64    `json:"errors"`       // Failed attempts, including timeouts
+	Timeouts      uint64    `json:"timeouts"`     // Attempts abandoned after the bus's Timeout
+	Retries       uint64    `json:"retries"`      // Attempts after the first one
+	Failures      uint64    `json:"failures"`     // Transactions that failed on every attempt
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime,omitempty"`
+}
+
+// add accumulates the counts of s into t, keeping the most recent error.
+func (t *I2CStats) add(s *I2CStats) {
+	t.Transactions += s.Transactions
+	t.Errors += s.Errors
+	t.Timeouts += s.Timeouts
+	t.Retries += s.Retries
+	t.Failures += s.Failures
+	if s.LastErrorTime.After(t.LastErrorTime) {
+		t.LastError, t.LastErrorTime = s.LastError, s.LastErrorTime
+	}
+}
+
+// count tallies attempt n (0 for the first) of a transaction, which failed with err if not nil.
+// final is set for the last attempt, after which the transaction isn't retried.
+func (b *I2CBus) count(addr byte, reg int, n int, final bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.stats == nil {
+		b.stats = make(map[i2cKey]*I2CStats)
+	}
+	k := i2cKey{addr, reg}
+	s, ok := b.stats[k]
+	if !ok {
+		s = &I2CStats{Addr: addr, Reg: reg}
+		b.stats[k] = s
+	}
+
+	if n > 0 {
+		s.Retries++
+	}
+	if err == nil {
+		s.Transactions++
+		return
+	}
+
+	s.Errors++
+	if errors.Is(err, ErrI2CTimeout) {
+		s.Timeouts++
+	}
+	s.LastError, s.LastErrorTime = err.Error(), time.Now()
+	if final {
+		s.Transactions++
+		s.Failures++
+	}
+}
+
+// Stats returns the counts for every register accessed on the bus, ordered by address and register.
+func (b *I2CBus) Stats() []I2CStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := make([]I2CStats, 0, len(b.stats))
+	for _, s := range b.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Addr != stats[j].Addr {
+			return stats[i].Addr < stats[j].Addr
+		}
+		return stats[i].Reg < stats[j].Reg
+	})
+	return stats
+}
+
+// AddrStats returns the counts totalled over all the transactions with the device at addr.
+func (b *I2CBus) AddrStats(addr byte) I2CStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := I2CStats{Addr: addr, Reg: NoReg}
+	for k, s := range b.stats {
+		if k.addr == addr {
+			t.add(s)
+		}
+	}
+	return t
+}
+
+// ResetStats clears all the counts.
+func (b *I2CBus) ResetStats() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stats = nil
+}
@@ -0,0 +1,153 @@
+package goflying_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/westphae/goflying"
+	"github.com/westphae/goflying/i2ctest"
+)
+
+var errFlaky = errors.New("flaky connector")
+
+// flaky fails its next failures register reads, taking delay over each read and writeDelay over each write.
+type flaky struct {
+	*i2ctest.Registers
+	failures      int
+	delay         time.Duration
+	writeDelay    time.Duration
+	active, calls int32 // Accesses in progress and made
+	overlapped    int32 // Set if two accesses were ever in progress at once
+}
+
+// access counts an access taking delay, noting whether it overlaps another.
+func (d *flaky) access(delay time.Duration) {
+	if atomic.AddInt32(&d.active, 1) > 1 {
+		atomic.StoreInt32(&d.overlapped, 1)
+	}
+	atomic.AddInt32(&d.calls, 1)
+	time.Sleep(delay)
+	atomic.AddInt32(&d.active, -1)
+}
+
+func (d *flaky) WriteReg(reg byte, value []byte) error {
+	d.access(d.writeDelay)
+	return d.Registers.WriteReg(reg, value)
+}
+
+func (d *flaky) ReadReg(reg byte, value []byte) error {
+	d.access(d.delay)
+	if d.failures > 0 {
+		d.failures--
+		return errFlaky
+	}
+	return d.Registers.ReadReg(reg, value)
+}
+
+func TestI2CRetries(t *testing.T) {
+	tests := []struct {
+		name                                        string
+		failures, retries                           int
+		wantErr                                     error
+		wantTransactions, wantRetries, wantFailures uint64
+	}{
+		{"no errors", 0, 0, nil, 1, 0, 0},
+		{"no retries", 1, 0, errFlaky, 1, 0, 1},
+		{"recovers", 2, 3, nil, 1, 2, 0},
+		{"gives up", 3, 2, errFlaky, 1, 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := i2ctest.NewBus()
+			r := i2ctest.NewRegisters()
+			r.Set(0x10, 0x42)
+			b.Attach(0x68, &flaky{Registers: r, failures: tt.failures})
+			bus := &goflying.I2CBus{I2CBus: b, Retries: tt.retries, Backoff: time.Millisecond}
+
+			v, err := bus.ReadByteFromReg(0x68, 0x10)
+			if !errors.Is(err, tt.wantErr) || (err == nil && v != 0x42) {
+				t.Errorf("ReadByteFromReg() = %X, %v, want 42, %v", v, err, tt.wantErr)
+			}
+
+			s := bus.Stats()
+			if len(s) != 1 || s[0].Addr != 0x68 || s[0].Reg != 0x10 {
+				t.Fatalf("Stats() = %+v", s)
+			}
+			if s[0].Transactions != tt.wantTransactions || s[0].Retries != tt.wantRetries ||
+				s[0].Failures != tt.wantFailures || s[0].Errors != uint64(tt.failures) {
+				t.Errorf("Stats() = %+v", s[0])
+			}
+		})
+	}
+}
+
+func TestI2CReadOnce(t *testing.T) {
+	b := i2ctest.NewBus()
+	d := &flaky{Registers: i2ctest.NewRegisters(), failures: 1}
+	b.Attach(0x68, d)
+	bus := &goflying.I2CBus{I2CBus: b, Retries: 3, Backoff: time.Millisecond}
+
+	if err := bus.ReadFromRegOnce(0x68, 0x74, make([]byte, 14)); !errors.Is(err, errFlaky) {
+		t.Errorf("ReadFromRegOnce() error = %v, want %v", err, errFlaky)
+	}
+	if s := bus.AddrStats(0x68); d.calls != 1 || s.Retries != 0 || s.Transactions != 1 || s.Failures != 1 {
+		t.Errorf("%d reads, AddrStats(0x68) = %+v, want one failed read", d.calls, s)
+	}
+}
+
+func TestI2CTimeout(t *testing.T) {
+	b := i2ctest.NewBus()
+	slow := &flaky{Registers: i2ctest.NewRegisters(), delay: 50 * time.Millisecond}
+	b.Attach(0x68, slow)
+	b.Attach(0x76, i2ctest.NewRegisters())
+	bus := &goflying.I2CBus{I2CBus: b, Retries: 1, Timeout: 10 * time.Millisecond}
+
+	// A timed out transaction still holds the bus, so the healthy device goes first
+	bus.WriteByteToReg(0x76, 0xF4, 0x27)
+	if _, err := bus.ReadByteFromReg(0x68, 0x10); !errors.Is(err, goflying.ErrI2CTimeout) {
+		t.Errorf("ReadByteFromReg() error = %v, want %v", err, goflying.ErrI2CTimeout)
+	}
+	bus.ReadByteFromReg(0x68, 0x11)
+
+	if s := bus.AddrStats(0x68); s.Transactions != 2 || s.Timeouts != 4 || s.Failures != 2 ||
+		s.LastError != goflying.ErrI2CTimeout.Error() {
+		t.Errorf("AddrStats(0x68) = %+v", s)
+	}
+	if s := bus.AddrStats(0x76); s.Transactions != 1 || s.Errors != 0 {
+		t.Errorf("AddrStats(0x76) = %+v", s)
+	}
+	if calls := atomic.LoadInt32(&slow.calls); calls != 1 {
+		t.Errorf("%d reads started while the first was still going, want none", calls-1)
+	}
+
+	bus.ResetStats()
+	if s := bus.Stats(); len(s) != 0 {
+		t.Errorf("Stats() after ResetStats() = %+v", s)
+	}
+}
+
+func TestI2CWriteTimeout(t *testing.T) {
+	b := i2ctest.NewBus()
+	slow := &flaky{Registers: i2ctest.NewRegisters(), writeDelay: 20 * time.Millisecond}
+	b.Attach(0x68, slow)
+	bus := &goflying.I2CBus{I2CBus: b, Retries: 3, Timeout: 10 * time.Millisecond, Backoff: 30 * time.Millisecond}
+
+	if err := bus.WriteByteToReg(0x68, 0x10, 1); !errors.Is(err, goflying.ErrI2CTimeout) {
+		t.Errorf("WriteByteToReg() error = %v, want %v", err, goflying.ErrI2CTimeout)
+	}
+	if s := bus.AddrStats(0x68); s.Retries != 0 || s.Timeouts != 1 || s.Transactions != 1 || s.Failures != 1 {
+		t.Errorf("AddrStats(0x68) = %+v, want one failed transaction with no retries of the timed out write", s)
+	}
+
+	// A read is retried once the timed out access has finished, without overlapping it
+	if _, err := bus.ReadByteFromReg(0x68, 0x10); err != nil {
+		t.Errorf("ReadByteFromReg() error = %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if calls := atomic.LoadInt32(&slow.calls); calls != 2 || atomic.LoadInt32(&slow.overlapped) != 0 {
+		t.Errorf("%d accesses, overlapping %v, want 2 apart", calls, slow.overlapped != 0)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Package i2cdev talks to I2C devices through the Linux i2c-dev interface, /dev/i2c-N.
+
+A Bus has the methods of embd.I2CBus, so it can be passed to the drivers in the sensors packages as a
+sensors.I2CBus or wrapped in a goflying.I2CBus, without needing embd's host drivers.
+Register accesses are combined transfers with a repeated start (I2C_RDWR), while raw reads and writes
+go to the address selected with I2C_SLAVE.
+*/
+package i2cdev
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// FlagRead marks a Msg reading from the device rather than writing to it.
+const FlagRead = 0x0001
+
+var ErrShortTransfer = errors.New("i2cdev: short transfer")
+
+// Msg is one message of a combined transfer.
+type Msg struct {
+	Addr  uint16
+	Flags uint16
+	Buf   []byte
+}
+
+// Conn is an open i2c-dev character device, the layer a Bus talks through.
+type Conn interface {
+	SetAddress(addr uint16) error // I2C_SLAVE, selects the device for Read and Write
+	Transfer(msgs []Msg) error    // I2C_RDWR, performs msgs without releasing the bus between them
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+	Close() error
+}
+
+// Bus is an I2C bus accessed through a Conn.  It is safe for use by several drivers at once.
+type Bus struct {
+	mu      sync.Mutex
+	conn    Conn
+	addr    byte
+	addrSet bool
+}
+
+// New returns a Bus talking through c.
+func New(c Conn) *Bus {
+	return &Bus{conn: c}
+}
+
+// setAddress selects addr for raw reads and writes, if it isn't already.
+func (b *Bus) setAddress(addr byte) error {
+	if b.addrSet && b.addr == addr {
+		return nil
+	}
+	if err := b.conn.SetAddress(uint16(addr)); err != nil {
+		b.addrSet = false
+		return fmt.Errorf("i2cdev: selecting address 0x%02X: %w", addr, err)
+	}
+	b.addr, b.addrSet = addr, true
+	return nil
+}
+
+func (b *Bus) transfer(msgs ...Msg) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.conn.Transfer(msgs); err != nil {
+		return fmt.Errorf("i2cdev: transfer with 0x%02X: %w", msgs[0].Addr, err)
+	}
+	return nil
+}
+
+//goland:noinspection GoStandardMethods
+func (b *Bus) ReadByte(addr byte) (byte, error) {
+	v, err := b.ReadBytes(addr, 1)
+	if err != nil {
+		return 0, err
+	}
+	return v[0], nil
+}
+
+func (b *Bus) ReadBytes(addr byte, num int) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.setAddress(addr); err != nil {
+		return nil, err
+	}
+	v := make([]byte, num)
+	n, err := b.conn.Read(v)
+	if err != nil {
+		return nil, fmt.Errorf("i2cdev: reading from 0x%02X: %w", addr, err)
+	}
+	if n != num {
+		return nil, fmt.Errorf("%w: read %d of %d bytes from 0x%02X", ErrShortTransfer, n, num, addr)
+	}
+	return v, nil
+}
+
+//goland:noinspection GoStandardMethods
+func (b *Bus) WriteByte(addr, value byte) error {
+	return b.WriteBytes(addr, []byte{value})
+}
+
+func (b *Bus) WriteBytes(addr byte, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.setAddress(addr); err != nil {
+		return err
+	}
+	n, err := b.conn.Write(value)
+	if err != nil {
+		return fmt.Errorf("i2cdev: writing to 0x%02X: %w", addr, err)
+	}
+	if n != len(value) {
+		return fmt.Errorf("%w: wrote %d of %d bytes to 0x%02X", ErrShortTransfer, n, len(value), addr)
+	}
+	return nil
+}
+
+func (b *Bus) ReadFromReg(addr, reg byte, value []byte) error {
+	return b.transfer(
+		Msg{Addr: uint16(addr), Buf: []byte{reg}},
+		Msg{Addr: uint16(addr), Flags: FlagRead, Buf: value},
+	)
+}
+
+func (b *Bus) ReadByteFromReg(addr, reg byte) (byte, error) {
+	v := make([]byte, 1)
+	if err := b.ReadFromReg(addr, reg, v); err != nil {
+		return 0, err
+	}
+	return v[0], nil
+}
+
+func (b *Bus) ReadWordFromReg(addr, reg byte) (uint16, error) {
+	v := make([]byte, 2)
+	if err := b.ReadFromReg(addr, reg, v); err != nil {
+		return 0, err
+	}
+	return uint16(v[0])<<8 | uint16(v[1]), nil
+}
+
+func (b *Bus) WriteToReg(addr, reg byte, value []byte) error {
+	return b.transfer(Msg{Addr: uint16(addr), Buf: append([]byte{reg}, value...)})
+}
+
+func (b *Bus) WriteByteToReg(addr, reg, value byte) error {
+	return b.WriteToReg(addr, reg, []byte{value})
+}
+
+func (b *Bus) WriteWordToReg(addr, reg byte, value uint16) error {
+	return b.WriteToReg(addr, reg, []byte{byte(value >> 8), byte(value)})
+}
+
+// Close closes the Conn.
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conn.Close()
+}
@@ -0,0 +1,142 @@
+package i2cdev
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"syscall"
+	"testing"
+
+	"github.com/kidoman/embd"
+	"github.com/westphae/goflying/i2ctest"
+	"github.com/westphae/goflying/sensors/bmp280"
+)
+
+var _ embd.I2CBus = (*Bus)(nil)
+
+// fakeConn serves the i2c-dev calls from an i2ctest.Bus, counting the ioctls.
+type fakeConn struct {
+	bus             *i2ctest.Bus
+	addr            byte
+	slaves, rdwrs   int
+	short, nackAddr bool
+	closed          bool
+}
+
+func (c *fakeConn) SetAddress(addr uint16) error {
+	c.slaves++
+	c.addr = byte(addr)
+	return nil
+}
+
+func (c *fakeConn) Transfer(msgs []Msg) error {
+	c.rdwrs++
+	if c.nackAddr {
+		return syscall.EIO
+	}
+	addr := byte(msgs[0].Addr)
+	switch {
+	case len(msgs) == 2 && msgs[0].Flags == 0 && msgs[1].Flags == FlagRead:
+		return c.bus.ReadFromReg(addr, msgs[0].Buf[0], msgs[1].Buf)
+	case len(msgs) == 1 && msgs[0].Flags == 0:
+		return c.bus.WriteBytes(addr, msgs[0].Buf)
+	}
+	return syscall.EINVAL
+}
+
+func (c *fakeConn) Read(p []byte) (int, error) {
+	v, err := c.bus.ReadBytes(c.addr, len(p))
+	if c.short {
+		return copy(p, v[:len(v)-1]), err
+	}
+	return copy(p, v), err
+}
+
+func (c *fakeConn) Write(p []byte) (int, error) {
+	return len(p), c.bus.WriteBytes(c.addr, p)
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func newTestBus() (*Bus, *fakeConn, *i2ctest.Registers) {
+	r := i2ctest.NewRegisters()
+	r.Set(0x10, 1, 2, 3, 4)
+	c := &fakeConn{bus: i2ctest.NewBus()}
+	c.bus.Attach(0x42, r)
+	return New(c), c, r
+}
+
+func TestBusRegisters(t *testing.T) {
+	b, c, r := newTestBus()
+
+	v := make([]byte, 3)
+	if err := b.ReadFromReg(0x42, 0x11, v); err != nil || !bytes.Equal(v, []byte{2, 3, 4}) {
+		t.Errorf("ReadFromReg() = % X, %v, want 02 03 04", v, err)
+	}
+	if w, err := b.ReadWordFromReg(0x42, 0x10); err != nil || w != 0x0102 {
+		t.Errorf("ReadWordFromReg() = %04X, %v, want 0102", w, err)
+	}
+	if err := b.WriteWordToReg(0x42, 0x20, 0xABCD); err != nil || !bytes.Equal(r.Get(0x20, 2), []byte{0xAB, 0xCD}) {
+		t.Errorf("WriteWordToReg() wrote % X, %v", r.Get(0x20, 2), err)
+	}
+	if err := b.WriteByteToReg(0x42, 0x22, 0xEF); err != nil || r.Get(0x22, 1)[0] != 0xEF {
+		t.Errorf("WriteByteToReg() wrote %X, %v", r.Get(0x22, 1)[0], err)
+	}
+	if c.rdwrs != 4 || c.slaves != 0 {
+		t.Errorf("%d I2C_RDWR and %d I2C_SLAVE ioctls, want 4 and 0", c.rdwrs, c.slaves)
+	}
+
+	c.nackAddr = true
+	if _, err := b.ReadByteFromReg(0x42, 0x10); !errors.Is(err, syscall.EIO) {
+		t.Errorf("ReadByteFromReg() error = %v, want %v", err, syscall.EIO)
+	}
+}
+
+func TestBusRaw(t *testing.T) {
+	b, c, _ := newTestBus()
+
+	if err := b.WriteByte(0x42, 0x12); err != nil {
+		t.Errorf("WriteByte() error = %v", err)
+	}
+	if v, err := b.ReadBytes(0x42, 2); err != nil || !bytes.Equal(v, []byte{3, 4}) {
+		t.Errorf("ReadBytes() = % X, %v, want 03 04", v, err)
+	}
+	if c.slaves != 1 {
+		t.Errorf("%d I2C_SLAVE ioctls for one address, want 1", c.slaves)
+	}
+	if _, err := b.ReadByte(0x43); !errors.Is(err, i2ctest.ErrNoDevice) || c.slaves != 2 {
+		t.Errorf("ReadByte() error = %v after %d I2C_SLAVE ioctls", err, c.slaves)
+	}
+
+	c.short = true
+	if _, err := b.ReadBytes(0x42, 2); !errors.Is(err, ErrShortTransfer) {
+		t.Errorf("short ReadBytes() error = %v, want %v", err, ErrShortTransfer)
+	}
+
+	if err := b.Close(); err != nil || !c.closed {
+		t.Errorf("Close() error = %v, closed %t", err, c.closed)
+	}
+}
+
+func TestBusDriver(t *testing.T) {
+	c := &fakeConn{bus: i2ctest.NewBus()}
+	chip := i2ctest.NewBMP280(bmp280.ChipID3)
+	chip.SetRaw(338837, 526634)
+	c.bus.Attach(bmp280.Address2, chip)
+
+	bmp, err := bmp280.NewBMP280(New(c), bmp280.Address2, bmp280.NormalMode, bmp280.StandbyTime1ms,
+		bmp280.FilterCoeffOff, bmp280.Oversamp1x, bmp280.Oversamp1x)
+	if err != nil {
+		t.Fatalf("NewBMP280() error = %v", err)
+	}
+	defer bmp.Close()
+
+	sub, cancel := bmp.Subscribe(1)
+	defer cancel()
+	if d := <-sub; math.Abs(d.Pressure-1006.4693) > 0.01 {
+		t.Errorf("pressure = %.4fhPa, want 1006.4693hPa", d.Pressure)
+	}
+}
@@ -0,0 +1,70 @@
+package i2cdev
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// ioctl requests from linux/i2c-dev.h
+const (
+	ioctlSlave = 0x0703
+	ioctlRdwr  = 0x0707
+)
+
+// i2cMsg is struct i2c_msg from linux/i2c.h.
+type i2cMsg struct {
+	addr  uint16
+	flags uint16
+	len   uint16
+	buf   uintptr
+}
+
+// i2cRdwrData is struct i2c_rdwr_ioctl_data from linux/i2c-dev.h.
+type i2cRdwrData struct {
+	msgs  uintptr
+	nmsgs uint32
+}
+
+// dev is a Conn to an i2c-dev character device.
+type dev struct {
+	*os.File
+}
+
+// Open opens /dev/i2c-n.
+func Open(n int) (*Bus, error) {
+	f, err := os.OpenFile(fmt.Sprintf("/dev/i2c-%d", n), os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("i2cdev: %w", err)
+	}
+	return New(dev{f}), nil
+}
+
+func (d dev) ioctl(req, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d.Fd(), req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (d dev) SetAddress(addr uint16) error {
+	return d.ioctl(ioctlSlave, uintptr(addr))
+}
+
+func (d dev) Transfer(msgs []Msg) error {
+	m := make([]i2cMsg, len(msgs))
+	for i, msg := range msgs {
+		if len(msg.Buf) == 0 || len(msg.Buf) > 0xFFFF {
+			return fmt.Errorf("message of %d bytes", len(msg.Buf))
+		}
+		m[i] = i2cMsg{addr: msg.Addr, flags: msg.Flags, len: uint16(len(msg.Buf)), buf: uintptr(unsafe.Pointer(&msg.Buf[0]))}
+	}
+	data := i2cRdwrData{msgs: uintptr(unsafe.Pointer(&m[0])), nmsgs: uint32(len(m))}
+
+	err := d.ioctl(ioctlRdwr, uintptr(unsafe.Pointer(&data)))
+	runtime.KeepAlive(msgs)
+	runtime.KeepAlive(m)
+	return err
+}
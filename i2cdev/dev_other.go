@@ -0,0 +1,10 @@
+//go:build !linux
+
+package i2cdev
+
+import "errors"
+
+// Open is only supported on Linux.
+func Open(n int) (*Bus, error) {
+	return nil, errors.New("i2cdev: i2c-dev is only available on Linux")
+}
@@ -0,0 +1,83 @@
+package i2ctest
+
+// Factory trimming data read from a real BME280, registers 0x88 to 0xA1 and 0xE1 to 0xE7.
+// The first 24 bytes are also valid trimming data for a BMP280.
+var (
+	BoschCalibration    = []byte{0xEE, 0x6E, 0xCA, 0x68, 0x32, 0x00, 0x48, 0x92, 0xD6, 0xD6, 0xD0, 0x0B, 0x7F, 0x19, 0x1F, 0x00, 0xF9, 0xFF, 0xAC, 0x26, 0x0A, 0xD8, 0xBD, 0x10, 0x00, 0x4B}
+	BoschHumCalibration = []byte{0x80, 0x01, 0x00, 0x10, 0x2D, 0x03, 0x1E}
+)
+
+const (
+	boschRegChipID    = 0xD0
+	boschRegSoftReset = 0xE0
+	boschRegCtrlHum   = 0xF2
+	boschRegCtrlMeas  = 0xF4
+	boschRegData      = 0xF7
+	boschResetCode    = 0xB6
+)
+
+// raw20 packs a 20-bit raw reading into the MSB, LSB and XLSB data registers.
+func raw20(v int32) []byte {
+	return []byte{byte(v >> 12), byte(v >> 4), byte(v << 4)}
+}
+
+// BMP280 models a Bosch BMP280 pressure sensor with the BoschCalibration trimming data.
+type BMP280 struct {
+	*Registers
+}
+
+// NewBMP280 returns a BMP280 reporting chipID, one of 0x56, 0x57 or 0x58.
+func NewBMP280(chipID byte) *BMP280 {
+	d := &BMP280{NewRegisters()}
+	d.Set(boschRegChipID, chipID)
+	d.Set(0x88, BoschCalibration[:24]...)
+	return d
+}
+
+// SetRaw sets the raw 20-bit pressure and temperature readings.
+func (d *BMP280) SetRaw(press, temp int32) {
+	d.Set(boschRegData, append(raw20(press), raw20(temp)...)...)
+}
+
+// WriteReg handles a soft reset, which puts the chip back to sleep with default settings.
+func (d *BMP280) WriteReg(reg byte, value []byte) error {
+	if reg == boschRegSoftReset {
+		if value[0] == boschResetCode {
+			d.Set(boschRegCtrlMeas, 0, 0)
+		}
+		return nil
+	}
+	return d.Registers.WriteReg(reg, value)
+}
+
+// BME280 models a Bosch BME280 pressure, temperature and humidity sensor with the BoschCalibration trimming data.
+type BME280 struct {
+	*Registers
+}
+
+// NewBME280 returns a BME280.
+func NewBME280() *BME280 {
+	d := &BME280{NewRegisters()}
+	d.Set(boschRegChipID, 0x60)
+	d.Set(0x88, BoschCalibration...)
+	d.Set(0xE1, BoschHumCalibration...)
+	return d
+}
+
+// SetRaw sets the raw 20-bit pressure and temperature and 16-bit humidity readings.
+func (d *BME280) SetRaw(press, temp int32, hum uint16) {
+	v := append(raw20(press), raw20(temp)...)
+	d.Set(boschRegData, append(v, byte(hum>>8), byte(hum))...)
+}
+
+// WriteReg handles a soft reset, which puts the chip back to sleep with default settings.
+func (d *BME280) WriteReg(reg byte, value []byte) error {
+	if reg == boschRegSoftReset {
+		if value[0] == boschResetCode {
+			d.Set(boschRegCtrlHum, 0)
+			d.Set(boschRegCtrlMeas, 0, 0)
+		}
+		return nil
+	}
+	return d.Registers.WriteReg(reg, value)
+}
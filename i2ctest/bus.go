@@ -0,0 +1,214 @@
+/*
+Package i2ctest provides an in-memory embd.I2CBus with emulated sensor chips, so that drivers can be
+tested without hardware.
+
+A Bus holds a Device at each I2C address and records every transaction.
+Registers is a Device emulating a plain register map whose contents tests can set or script,
+and BMP280, BME280, MPU9250 (with its AK8963 magnetometer) and ICM20948 model those chips
+closely enough for the drivers in the sensors packages.
+The Bus can be used directly or wrapped in a goflying.I2CBus.
+*/
+package i2ctest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/kidoman/embd"
+)
+
+// ErrNoDevice is returned for transactions with an address that has no Device attached.
+var ErrNoDevice = errors.New("i2ctest: no device at address")
+
+// Device is a chip attached to a Bus.
+// Multi-byte reads and writes start at register reg.
+type Device interface {
+	ReadReg(reg byte, value []byte) error
+	WriteReg(reg byte, value []byte) error
+}
+
+// Op is the direction of a Transaction.
+type Op int
+
+const (
+	Read Op = iota
+	Write
+)
+
+func (op Op) String() string {
+	if op == Write {
+		return "write"
+	}
+	return "read"
+}
+
+// Transaction records one bus operation.
+type Transaction struct {
+	Op   Op
+	Addr byte
+	Reg  byte
+	Data []byte // Bytes read or written, after Reg
+	Err  error
+}
+
+func (t Transaction) String() string {
+	s := fmt.Sprintf("%s 0x%02X at 0x%02X: % X", t.Op, t.Addr, t.Reg, t.Data)
+	if t.Err != nil {
+		s += fmt.Sprintf(" (%s)", t.Err)
+	}
+	return s
+}
+
+// Bus is an in-memory embd.I2CBus.
+// Transactions are serialized, as on a real bus.
+type Bus struct {
+	mu           sync.Mutex
+	devices      map[byte]Device
+	pointers     map[byte]byte // Register pointer of each address, for reads without a register
+	transactions []Transaction
+}
+
+var _ embd.I2CBus = (*Bus)(nil)
+
+// NewBus returns an empty Bus.
+func NewBus() *Bus {
+	return &Bus{
+		devices:  make(map[byte]Device),
+		pointers: make(map[byte]byte),
+	}
+}
+
+// Attach puts d on the bus at addr, replacing any Device already there.
+func (b *Bus) Attach(addr byte, d Device) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.devices[addr] = d
+}
+
+// Detach removes the Device at addr, so that transactions with it fail as if it were unplugged.
+func (b *Bus) Detach(addr byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.devices, addr)
+}
+
+// Transactions returns a copy of all transactions since the Bus was created or last cleared.
+func (b *Bus) Transactions() []Transaction {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Transaction(nil), b.transactions...)
+}
+
+// ClearTransactions forgets all recorded transactions.
+func (b *Bus) ClearTransactions() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.transactions = nil
+}
+
+// LastWrite returns the bytes most recently written to register reg at addr, and whether there were any.
+func (b *Bus) LastWrite(addr, reg byte) (value []byte, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := len(b.transactions) - 1; i >= 0; i-- {
+		t := b.transactions[i]
+		if t.Op == Write && t.Addr == addr && t.Reg == reg && len(t.Data) > 0 && t.Err == nil {
+			return t.Data, true
+		}
+	}
+	return nil, false
+}
+
+func (b *Bus) read(addr, reg byte, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err := ErrNoDevice
+	if d, ok := b.devices[addr]; ok {
+		err = d.ReadReg(reg, value)
+	}
+	b.transactions = append(b.transactions, Transaction{Read, addr, reg, append([]byte(nil), value...), err})
+	return err
+}
+
+func (b *Bus) write(addr, reg byte, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err := ErrNoDevice
+	if d, ok := b.devices[addr]; ok {
+		b.pointers[addr] = reg
+		err = nil
+		if len(value) > 0 {
+			err = d.WriteReg(reg, value)
+		}
+	}
+	b.transactions = append(b.transactions, Transaction{Write, addr, reg, append([]byte(nil), value...), err})
+	return err
+}
+
+//goland:noinspection GoStandardMethods
+func (b *Bus) ReadByte(addr byte) (byte, error) {
+	v, err := b.ReadBytes(addr, 1)
+	return v[0], err
+}
+
+// ReadBytes reads num bytes starting at the register last written to addr.
+func (b *Bus) ReadBytes(addr byte, num int) ([]byte, error) {
+	b.mu.Lock()
+	reg := b.pointers[addr]
+	b.mu.Unlock()
+
+	value := make([]byte, num)
+	err := b.read(addr, reg, value)
+	return value, err
+}
+
+//goland:noinspection GoStandardMethods
+func (b *Bus) WriteByte(addr, value byte) error {
+	return b.WriteBytes(addr, []byte{value})
+}
+
+// WriteBytes writes value[1:] starting at register value[0], or only sets the register pointer
+// if value has a single byte.
+func (b *Bus) WriteBytes(addr byte, value []byte) error {
+	if len(value) == 0 {
+		return nil
+	}
+	return b.write(addr, value[0], value[1:])
+}
+
+func (b *Bus) ReadFromReg(addr, reg byte, value []byte) error {
+	return b.read(addr, reg, value)
+}
+
+func (b *Bus) ReadByteFromReg(addr, reg byte) (byte, error) {
+	v := make([]byte, 1)
+	err := b.read(addr, reg, v)
+	return v[0], err
+}
+
+// ReadWordFromReg reads a big-endian word, as embd does.
+func (b *Bus) ReadWordFromReg(addr, reg byte) (uint16, error) {
+	v := make([]byte, 2)
+	err := b.read(addr, reg, v)
+	return uint16(v[0])<<8 | uint16(v[1]), err
+}
+
+func (b *Bus) WriteToReg(addr, reg byte, value []byte) error {
+	return b.write(addr, reg, value)
+}
+
+func (b *Bus) WriteByteToReg(addr, reg, value byte) error {
+	return b.write(addr, reg, []byte{value})
+}
+
+// WriteWordToReg writes a big-endian word, as embd does.
+func (b *Bus) WriteWordToReg(addr, reg byte, value uint16) error {
+	return b.write(addr, reg, []byte{byte(value >> 8), byte(value)})
+}
+
+func (b *Bus) Close() error {
+	return nil
+}
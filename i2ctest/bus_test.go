@@ -0,0 +1,138 @@
+package i2ctest
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/westphae/goflying"
+)
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+	r := NewRegisters()
+	r.Set(0x10, 1, 2, 3, 4)
+	b.Attach(0x42, r)
+	bus := &goflying.I2CBus{I2CBus: b}
+
+	v := make([]byte, 3)
+	if err := bus.ReadFromReg(0x42, 0x11, v); err != nil || !bytes.Equal(v, []byte{2, 3, 4}) {
+		t.Errorf("ReadFromReg() = % X, %v, want 02 03 04", v, err)
+	}
+	if w, err := bus.ReadWordFromReg(0x42, 0x10); err != nil || w != 0x0102 {
+		t.Errorf("ReadWordFromReg() = %04X, %v, want 0102", w, err)
+	}
+	if err := bus.WriteWordToReg(0x42, 0x20, 0xABCD); err != nil || !bytes.Equal(r.Get(0x20, 2), []byte{0xAB, 0xCD}) {
+		t.Errorf("WriteWordToReg() wrote % X, %v", r.Get(0x20, 2), err)
+	}
+
+	// Raw reads start at the register pointer set by the last write
+	if err := bus.WriteBytes(0x42, []byte{0x12}); err != nil {
+		t.Errorf("WriteBytes() error = %v", err)
+	}
+	if v, err := bus.ReadBytes(0x42, 2); err != nil || !bytes.Equal(v, []byte{3, 4}) {
+		t.Errorf("ReadBytes() = % X, %v, want 03 04", v, err)
+	}
+
+	if _, err := bus.ReadByteFromReg(0x43, 0); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("read from empty address error = %v, want %v", err, ErrNoDevice)
+	}
+	b.Detach(0x42)
+	if err := bus.WriteByteToReg(0x42, 0, 0); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("write to detached device error = %v, want %v", err, ErrNoDevice)
+	}
+
+	tt := b.Transactions()
+	if len(tt) != 7 {
+		t.Fatalf("got %d transactions, want 7: %v", len(tt), tt)
+	}
+	if want := (Transaction{Write, 0x42, 0x20, []byte{0xAB, 0xCD}, nil}); tt[2].String() != want.String() {
+		t.Errorf("transaction 2 = %s, want %s", tt[2], want)
+	}
+	if v, ok := b.LastWrite(0x42, 0x20); !ok || !bytes.Equal(v, []byte{0xAB, 0xCD}) {
+		t.Errorf("LastWrite() = % X, %t", v, ok)
+	}
+	b.ClearTransactions()
+	if len(b.Transactions()) != 0 {
+		t.Errorf("transactions not cleared")
+	}
+}
+
+func TestRegistersScript(t *testing.T) {
+	r := NewRegisters()
+	r.Set(0x3B, 0, 1)
+	r.Script(0x3B, []byte{0, 2}, []byte{0, 3})
+
+	v := make([]byte, 2)
+	for _, want := range []byte{2, 3, 3} {
+		r.ReadReg(0x3B, v)
+		if v[1] != want {
+			t.Errorf("scripted read = %d, want %d", v[1], want)
+		}
+	}
+
+	errBus := errors.New("bus error")
+	r.Fail(0x3B, errBus)
+	if err := r.ReadReg(0x3B, v); !errors.Is(err, errBus) {
+		t.Errorf("ReadReg() error = %v, want %v", err, errBus)
+	}
+	r.Fail(0x3B, nil)
+	if err := r.ReadReg(0x3B, v); err != nil {
+		t.Errorf("ReadReg() error = %v after clearing failure", err)
+	}
+}
+
+func TestMPU9250AuxBus(t *testing.T) {
+	d := NewMPU9250()
+	d.AK8963.SetField(100, -200, 300)
+
+	// Slave 0 reads the AK8963 status and data
+	d.WriteReg(mpuRegI2CSlv0Addr, []byte{mpuBitSlaveRead | AK8963Address, akRegST1, mpuBitSlaveEnable | 8})
+	v := make([]byte, 8)
+	d.ReadReg(mpuRegExtSensData, v)
+	if want := []byte{akBitDRDY, 100, 0, 0x38, 0xFF, 0x2C, 0x01, 0}; !bytes.Equal(v, want) {
+		t.Errorf("EXT_SENS_DATA = % X, want % X", v, want)
+	}
+	if st1 := d.AK8963.Get(akRegST1, 1)[0]; st1 != 0 {
+		t.Errorf("ST1 = %X after reading ST2, want 0", st1)
+	}
+
+	// Slave 1 writes CNTL1
+	d.WriteReg(mpuRegI2CSlv0Addr+3, []byte{AK8963Address, 0x0A, mpuBitSlaveEnable | 1})
+	d.WriteReg(mpuRegI2CSlv0DO+1, []byte{0x11})
+	if cntl1 := d.AK8963.Get(0x0A, 1)[0]; cntl1 != 0x11 {
+		t.Errorf("AK8963 CNTL1 = %X, want 11", cntl1)
+	}
+}
+
+func TestMPU9250DMPMemory(t *testing.T) {
+	d := NewMPU9250()
+	d.WriteReg(mpuRegBankSel, []byte{0x04, 0xF0})
+	d.WriteReg(mpuRegMemRW, []byte{1, 2, 3})
+	if v := d.DMPMemory(0x04F0, 3); !bytes.Equal(v, []byte{1, 2, 3}) {
+		t.Errorf("DMP memory = % X, want 01 02 03", v)
+	}
+	if who := d.Get(mpuRegWhoAmI, 1)[0]; who != 0x71 {
+		t.Errorf("WHO_AM_I = %X after DMP write, want 71", who)
+	}
+}
+
+func TestICM20948Banks(t *testing.T) {
+	d := NewICM20948()
+	v := make([]byte, 1)
+	if d.ReadReg(0x00, v); v[0] != 0xEA {
+		t.Errorf("WHO_AM_I = %X, want EA", v[0])
+	}
+
+	d.WriteReg(icmRegBank, []byte{2 << 4})
+	d.WriteReg(0x01, []byte{0x55})
+	if d.ReadReg(icmRegBank, v); v[0] != 2<<4 || d.SelectedBank() != 2 {
+		t.Errorf("REG_BANK_SEL = %X, want 20", v[0])
+	}
+	if got := d.Bank(2).Get(0x01, 1)[0]; got != 0x55 {
+		t.Errorf("bank 2 register 1 = %X, want 55", got)
+	}
+	if got := d.Bank(0).Get(0x01, 1)[0]; got != 0 {
+		t.Errorf("bank 0 register 1 = %X, want 0", got)
+	}
+}
@@ -0,0 +1,30 @@
+package i2ctest
+
+import "time"
+
+/*
+Edges stands in for the GPIO line wired to a chip's interrupt pin.
+It has the Edges method of sensors.EdgeSource, and the test fires the edges.
+*/
+type Edges struct {
+	c chan time.Time
+}
+
+// NewEdges returns an Edges with no edges pending.
+func NewEdges() *Edges {
+	return &Edges{c: make(chan time.Time)}
+}
+
+// Fire delivers an edge at time t, waiting until the driver has taken it.
+func (e *Edges) Fire(t time.Time) {
+	e.c <- t
+}
+
+// Close closes the channel, as a failing GPIO line would.
+func (e *Edges) Close() {
+	close(e.c)
+}
+
+func (e *Edges) Edges() <-chan time.Time {
+	return e.c
+}
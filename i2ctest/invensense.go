@@ -0,0 +1,442 @@
+package i2ctest
+
+import "sync"
+
+const (
+	AK8963Address = 0x0C // Address of the AK8963 on the MPU9250's auxiliary bus
+
+	mpuRegFIFOEn      = 0x23
+	mpuRegI2CSlv0Addr = 0x25 // Slave n has ADDR, REG and CTRL at 0x25+3n
+	mpuRegIntStatus   = 0x3A
+	mpuRegAccel       = 0x3B
+	mpuRegTemp        = 0x41
+	mpuRegGyro        = 0x43
+	mpuRegExtSensData = 0x49 // 24 bytes read from the auxiliary bus slaves
+	mpuRegI2CSlv0DO   = 0x63 // Slave n has DO at 0x63+n
+	mpuRegUserCtrl    = 0x6A
+	mpuRegPwrMgmt1    = 0x6B
+	mpuRegBankSel     = 0x6D
+	mpuRegMemRW       = 0x6F
+	mpuRegFIFOCount   = 0x72
+	mpuRegFIFORW      = 0x74
+	mpuRegWhoAmI      = 0x75
+	mpuNumSlaves      = 2    // Slaves modeled
+	mpuBitReset       = 0x80 // Of PWR_MGMT_1, on both the MPU9250 and ICM20948
+	mpuBitSlaveRead   = 0x80 // Of I2C_SLVn_ADDR
+	mpuBitSlaveEnable = 0x80 // Of I2C_SLVn_CTRL
+	mpuBitFIFOEnable  = 0x40 // Of USER_CTRL, on both the MPU9250 and ICM20948
+	mpuBitFIFOReset   = 0x04 // Of USER_CTRL
+	mpuBitFIFOOflow   = 0x10 // Of INT_STATUS
+	fifoSize          = 512  // Bytes, on both the MPU9250 and ICM20948
+
+	akRegST1    = 0x02
+	akRegHXL    = 0x03
+	akRegST2    = 0x09
+	akBitDRDY   = 0x01
+	icmRegBank  = 0x7F
+	icmRegPwr1  = 0x06
+	icmRegAccel = 0x2D
+	icmRegGyro  = 0x33
+	icmRegTemp  = 0x39
+
+	icmRegUserCtrl     = 0x03
+	icmRegIntStatus2   = 0x1B
+	icmRegFIFOEn2      = 0x67
+	icmRegFIFORst      = 0x68
+	icmRegFIFOCount    = 0x70
+	icmRegFIFORW       = 0x72
+	icmBitsFIFOOflow   = 0x1F // Of INT_STATUS_2
+	icmBitFIFOAccel    = 0x10 // Of FIFO_EN_2, whose bits 1 to 3 enable the gyro axes and bit 0 the temperature
+	icmBitsFIFOGyroXYZ = 0x0E
+)
+
+/*
+fifo emulates the FIFO of the InvenSense chips.  When it is full the oldest bytes are dropped,
+so what is left may no longer start on a sample boundary, and the overflow is flagged until the
+interrupt status is read.
+*/
+type fifo struct {
+	data     []byte
+	overflow bool
+}
+
+func (f *fifo) push(frame []byte) {
+	f.data = append(f.data, frame...)
+	if n := len(f.data) - fifoSize; n > 0 {
+		f.data = f.data[n:]
+		f.overflow = true
+	}
+}
+
+// read pops value from the FIFO for a FIFO_R_W read, unless it fails with err.
+// A failed read only takes the first byte, as a transfer cut short after it would.
+func (f *fifo) read(value []byte, err error) error {
+	if err != nil {
+		f.pop(value[:1])
+		return err
+	}
+	f.pop(value)
+	return nil
+}
+
+// pop fills value from the front of the FIFO.  Reading an empty FIFO returns 0xFF.
+func (f *fifo) pop(value []byte) {
+	n := copy(value, f.data)
+	f.data = f.data[n:]
+	for i := n; i < len(value); i++ {
+		value[i] = 0xFF
+	}
+}
+
+// count returns the FIFO_COUNTH and FIFO_COUNTL registers.
+func (f *fifo) count() []byte {
+	return []byte{byte(len(f.data) >> 8), byte(len(f.data))}
+}
+
+func (f *fifo) reset() {
+	f.data = nil
+}
+
+// setVector sets three consecutive big-endian words starting at reg.
+func setVector(r *Registers, reg byte, v1, v2, v3 int16) {
+	r.Set(reg, byte(uint16(v1)>>8), byte(v1), byte(uint16(v2)>>8), byte(v2), byte(uint16(v3)>>8), byte(v3))
+}
+
+/*
+MPU9250 models an InvenSense MPU9250 with its AK8963 magnetometer on the auxiliary I2C bus.
+The auxiliary bus slaves 0 and 1 are emulated: a slave configured to read copies the AK8963's registers
+into EXT_SENS_DATA whenever they are read, and a slave configured to write does so when its CTRL or DO
+register is written.  DMP memory is accessed through BANK_SEL, MEM_START_ADDR and MEM_R_W.
+The 512-byte FIFO is filled by PushFIFO and read through FIFO_COUNTH and FIFO_R_W.
+A FIFO_R_W read made to fail with Fail still takes a byte out of the FIFO, as a transfer cut short does.
+*/
+type MPU9250 struct {
+	*Registers
+	AK8963 *AK8963
+
+	mu   sync.Mutex
+	dmp  [1 << 16]byte
+	fifo fifo
+}
+
+// NewMPU9250 returns an MPU9250, with WHO_AM_I 0x71, and its AK8963.
+func NewMPU9250() *MPU9250 {
+	d := &MPU9250{Registers: NewRegisters(), AK8963: NewAK8963()}
+	d.Set(mpuRegWhoAmI, 0x71)
+	d.Set(mpuRegPwrMgmt1, 0x01)
+	return d
+}
+
+// SetAccel sets the raw accelerometer readings.
+func (d *MPU9250) SetAccel(a1, a2, a3 int16) {
+	setVector(d.Registers, mpuRegAccel, a1, a2, a3)
+}
+
+// SetGyro sets the raw gyro readings.
+func (d *MPU9250) SetGyro(g1, g2, g3 int16) {
+	setVector(d.Registers, mpuRegGyro, g1, g2, g3)
+}
+
+// SetTemp sets the raw die temperature reading.
+func (d *MPU9250) SetTemp(t int16) {
+	d.SetWord(mpuRegTemp, t)
+}
+
+/*
+PushFIFO queues n samples of the current readings in the FIFO, as the chip does at each sample
+when FIFO_EN in USER_CTRL is set.  Each sample holds the readings enabled in the FIFO_EN register,
+in register order: accelerometer, temperature, then the gyro axes.
+*/
+func (d *MPU9250) PushFIFO(n int) {
+	if d.Get(mpuRegUserCtrl, 1)[0]&mpuBitFIFOEnable == 0 {
+		return
+	}
+	en := d.Get(mpuRegFIFOEn, 1)[0]
+	var frame []byte
+	if en&0x08 != 0 {
+		frame = append(frame, d.Get(mpuRegAccel, 6)...)
+	}
+	if en&0x80 != 0 {
+		frame = append(frame, d.Get(mpuRegTemp, 2)...)
+	}
+	for i, bit := range []byte{0x40, 0x20, 0x10} {
+		if en&bit != 0 {
+			frame = append(frame, d.Get(mpuRegGyro+byte(2*i), 2)...)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := 0; i < n; i++ {
+		d.fifo.push(frame)
+	}
+}
+
+// DMPMemory returns n bytes of DMP memory starting at addr, whose high byte is the memory bank.
+func (d *MPU9250) DMPMemory(addr uint16, n int) []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v := make([]byte, n)
+	for i := range v {
+		v[i] = d.dmp[addr+uint16(i)]
+	}
+	return v
+}
+
+// memAccess reads or writes value at the DMP memory address in BANK_SEL and MEM_START_ADDR,
+// then advances the address.
+func (d *MPU9250) memAccess(value []byte, write bool) {
+	a := d.Get(mpuRegBankSel, 2)
+	addr := uint16(a[0])<<8 | uint16(a[1])
+
+	d.mu.Lock()
+	for i := range value {
+		if write {
+			d.dmp[addr] = value[i]
+		} else {
+			value[i] = d.dmp[addr]
+		}
+		addr++
+	}
+	d.mu.Unlock()
+
+	d.Set(mpuRegBankSel, byte(addr>>8), byte(addr))
+}
+
+// runSlaves performs the transfers of the enabled auxiliary bus slaves in the given direction.
+func (d *MPU9250) runSlaves(read bool) {
+	ext := mpuRegExtSensData
+	for n := 0; n < mpuNumSlaves; n++ {
+		cfg := d.Get(mpuRegI2CSlv0Addr+byte(3*n), 3)
+		addr, reg, ctrl := cfg[0], cfg[1], cfg[2]
+		slaveRead := addr&mpuBitSlaveRead != 0
+		if ctrl&mpuBitSlaveEnable == 0 || slaveRead != read {
+			continue
+		}
+
+		if read {
+			v := make([]byte, ctrl&0x0F)
+			if addr&^mpuBitSlaveRead == AK8963Address {
+				d.AK8963.ReadReg(reg, v)
+			}
+			d.Set(byte(ext), v...)
+			ext += len(v)
+		} else if addr == AK8963Address {
+			d.AK8963.WriteReg(reg, d.Get(mpuRegI2CSlv0DO+byte(n), 1))
+		}
+	}
+}
+
+// ReadReg handles DMP memory, FIFO, interrupt status and auxiliary bus reads.
+func (d *MPU9250) ReadReg(reg byte, value []byte) error {
+	switch {
+	case reg == mpuRegMemRW:
+		d.memAccess(value, false)
+		return nil
+	case reg == mpuRegFIFORW:
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.fifo.read(value, d.Registers.failure(reg))
+	case reg == mpuRegFIFOCount:
+		d.mu.Lock()
+		d.Set(mpuRegFIFOCount, d.fifo.count()...)
+		d.mu.Unlock()
+	case reg == mpuRegIntStatus:
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		status := d.Get(mpuRegIntStatus, 1)[0] &^ mpuBitFIFOOflow
+		if d.fifo.overflow {
+			status |= mpuBitFIFOOflow
+		}
+		d.fifo.overflow = false // Cleared by reading
+		d.Set(mpuRegIntStatus, status)
+	case reg >= mpuRegExtSensData && reg < mpuRegExtSensData+24:
+		d.runSlaves(true)
+	}
+	return d.Registers.ReadReg(reg, value)
+}
+
+// WriteReg handles DMP memory, reset and auxiliary bus writes.
+func (d *MPU9250) WriteReg(reg byte, value []byte) error {
+	if reg == mpuRegMemRW {
+		d.memAccess(value, true)
+		return nil
+	}
+
+	if err := d.Registers.WriteReg(reg, value); err != nil {
+		return err
+	}
+	if reg == mpuRegPwrMgmt1 && value[0]&mpuBitReset != 0 {
+		d.Set(mpuRegPwrMgmt1, 0x01) // Reset completes immediately
+	}
+	if reg == mpuRegUserCtrl && value[0]&mpuBitFIFOReset != 0 {
+		d.mu.Lock()
+		d.fifo.reset()
+		d.mu.Unlock()
+		d.Set(mpuRegUserCtrl, value[0]&^mpuBitFIFOReset) // Reset completes immediately
+	}
+	for n := 0; n < mpuNumSlaves; n++ {
+		if reg == mpuRegI2CSlv0Addr+byte(3*n)+2 || reg == mpuRegI2CSlv0DO+byte(n) {
+			d.runSlaves(false)
+		}
+	}
+	return nil
+}
+
+// AK8963 models an AsahiKASEI AK8963 magnetometer, with unity sensitivity adjustment.
+type AK8963 struct {
+	*Registers
+}
+
+// NewAK8963 returns an AK8963 with no data ready.
+func NewAK8963() *AK8963 {
+	d := &AK8963{NewRegisters()}
+	d.Set(0x00, 0x48)
+	d.Set(0x10, 128, 128, 128)
+	return d
+}
+
+// SetField sets the raw magnetometer readings and flags them as ready.
+func (d *AK8963) SetField(m1, m2, m3 int16) {
+	d.Set(akRegHXL, byte(m1), byte(uint16(m1)>>8), byte(m2), byte(uint16(m2)>>8), byte(m3), byte(uint16(m3)>>8))
+	d.Set(akRegST1, akBitDRDY)
+}
+
+// ReadReg clears the data ready flag once ST2 has been read, as the chip does.
+func (d *AK8963) ReadReg(reg byte, value []byte) error {
+	if err := d.Registers.ReadReg(reg, value); err != nil {
+		return err
+	}
+	if reg <= akRegST2 && int(reg)+len(value) > akRegST2 {
+		d.Set(akRegST1, 0)
+	}
+	return nil
+}
+
+/*
+ICM20948 models an InvenSense ICM20948, with its four register banks selected by REG_BANK_SEL.
+WHO_AM_I on bank 0 reads 0xEA.  The magnetometer isn't modeled.
+The 512-byte FIFO is filled by PushFIFO and read through FIFO_COUNTH and FIFO_R_W on bank 0.
+A FIFO_R_W read made to fail with Fail still takes a byte out of the FIFO, as a transfer cut short does.
+*/
+type ICM20948 struct {
+	mu    sync.Mutex
+	bank  int
+	banks [4]*Registers
+	fifo  fifo
+}
+
+// NewICM20948 returns an ICM20948 with bank 0 selected.
+func NewICM20948() *ICM20948 {
+	d := new(ICM20948)
+	for i := range d.banks {
+		d.banks[i] = NewRegisters()
+	}
+	d.banks[0].Set(0x00, 0xEA)
+	d.banks[0].Set(icmRegPwr1, 0x41)
+	return d
+}
+
+// Bank returns the registers of bank n, 0 to 3.
+func (d *ICM20948) Bank(n int) *Registers {
+	return d.banks[n]
+}
+
+// SelectedBank returns the bank currently selected by REG_BANK_SEL.
+func (d *ICM20948) SelectedBank() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.bank
+}
+
+// SetAccel sets the raw accelerometer readings.
+func (d *ICM20948) SetAccel(a1, a2, a3 int16) {
+	setVector(d.banks[0], icmRegAccel, a1, a2, a3)
+}
+
+// SetGyro sets the raw gyro readings.
+func (d *ICM20948) SetGyro(g1, g2, g3 int16) {
+	setVector(d.banks[0], icmRegGyro, g1, g2, g3)
+}
+
+// SetTemp sets the raw die temperature reading.
+func (d *ICM20948) SetTemp(t int16) {
+	d.banks[0].SetWord(icmRegTemp, t)
+}
+
+/*
+PushFIFO queues n samples of the current readings in the FIFO, as the chip does at each sample
+when FIFO_EN in USER_CTRL is set.  Each sample holds the readings enabled in the FIFO_EN_2 register,
+in register order: accelerometer, gyro, then temperature.  The gyro axes are only queued together.
+*/
+func (d *ICM20948) PushFIFO(n int) {
+	b := d.banks[0]
+	if b.Get(icmRegUserCtrl, 1)[0]&mpuBitFIFOEnable == 0 {
+		return
+	}
+	en := b.Get(icmRegFIFOEn2, 1)[0]
+	var frame []byte
+	if en&icmBitFIFOAccel != 0 {
+		frame = append(frame, b.Get(icmRegAccel, 6)...)
+	}
+	if en&icmBitsFIFOGyroXYZ == icmBitsFIFOGyroXYZ {
+		frame = append(frame, b.Get(icmRegGyro, 6)...)
+	}
+	if en&0x01 != 0 {
+		frame = append(frame, b.Get(icmRegTemp, 2)...)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := 0; i < n; i++ {
+		d.fifo.push(frame)
+	}
+}
+
+// ReadReg reads from the selected bank, handling FIFO and interrupt status reads on bank 0.
+func (d *ICM20948) ReadReg(reg byte, value []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if reg == icmRegBank {
+		value[0] = byte(d.bank << 4)
+		return nil
+	}
+	if d.bank == 0 {
+		switch reg {
+		case icmRegFIFORW:
+			return d.fifo.read(value, d.banks[0].failure(reg))
+		case icmRegFIFOCount:
+			d.banks[0].Set(icmRegFIFOCount, d.fifo.count()...)
+		case icmRegIntStatus2:
+			var status byte
+			if d.fifo.overflow {
+				status = icmBitsFIFOOflow
+			}
+			d.fifo.overflow = false // Cleared by reading
+			d.banks[0].Set(icmRegIntStatus2, status)
+		}
+	}
+	return d.banks[d.bank].ReadReg(reg, value)
+}
+
+// WriteReg writes to the selected bank, or selects a bank.
+func (d *ICM20948) WriteReg(reg byte, value []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if reg == icmRegBank {
+		d.bank = int(value[0]>>4) & 0x03
+		return nil
+	}
+	if err := d.banks[d.bank].WriteReg(reg, value); err != nil {
+		return err
+	}
+	if d.bank == 0 && reg == icmRegPwr1 && value[0]&mpuBitReset != 0 {
+		d.banks[0].Set(icmRegPwr1, 0x41) // Reset completes immediately
+	}
+	if d.bank == 0 && reg == icmRegFIFORst && value[0] != 0 {
+		d.fifo.reset() // The FIFO stays empty until the reset is released, which makes no difference here
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package i2ctest
+
+import "sync"
+
+/*
+Registers is a Device emulating a chip's 256-byte register map.
+Multi-byte accesses auto-increment the register address, as on most sensor chips.
+Tests can set register contents directly with Set, or script them with Script to change from one
+read to the next.
+The chip models embed Registers and intercept the registers that have side effects.
+*/
+type Registers struct {
+	mu      sync.Mutex
+	regs    [256]byte
+	scripts map[byte][][]byte
+	fail    map[byte]error
+}
+
+// NewRegisters returns a register map with all registers zero.
+func NewRegisters() *Registers {
+	return &Registers{
+		scripts: make(map[byte][][]byte),
+		fail:    make(map[byte]error),
+	}
+}
+
+// Set sets the registers starting at reg to values.
+func (r *Registers) Set(reg byte, values ...byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.set(reg, values)
+}
+
+func (r *Registers) set(reg byte, values []byte) {
+	for i, v := range values {
+		r.regs[reg+byte(i)] = v
+	}
+}
+
+// SetWord sets the big-endian word at registers reg and reg+1.
+func (r *Registers) SetWord(reg byte, value int16) {
+	r.Set(reg, byte(uint16(value)>>8), byte(value))
+}
+
+// Get returns n registers starting at reg.
+func (r *Registers) Get(reg byte, n int) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v := make([]byte, n)
+	for i := range v {
+		v[i] = r.regs[reg+byte(i)]
+	}
+	return v
+}
+
+// Script queues frames to be copied into the registers starting at reg, one frame just before each
+// read that starts at reg.  Once the frames run out the registers keep the last one.
+func (r *Registers) Script(reg byte, frames ...[]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scripts[reg] = append(r.scripts[reg], frames...)
+}
+
+// Fail makes every access starting at reg return err, or succeed again if err is nil.
+func (r *Registers) Fail(reg byte, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		delete(r.fail, reg)
+		return
+	}
+	r.fail[reg] = err
+}
+
+// failure returns the error set by Fail for accesses starting at reg, if any.
+func (r *Registers) failure(reg byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fail[reg]
+}
+
+// ReadReg reads len(value) registers starting at reg, after applying the next scripted frame for reg.
+func (r *Registers) ReadReg(reg byte, value []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.fail[reg]; err != nil {
+		return err
+	}
+	if frames := r.scripts[reg]; len(frames) > 0 {
+		r.set(reg, frames[0])
+		r.scripts[reg] = frames[1:]
+	}
+	for i := range value {
+		value[i] = r.regs[reg+byte(i)]
+	}
+	return nil
+}
+
+// WriteReg writes value to the registers starting at reg.
+func (r *Registers) WriteReg(reg byte, value []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.fail[reg]; err != nil {
+		return err
+	}
+	r.set(reg, value)
+	return nil
+}
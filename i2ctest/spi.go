@@ -0,0 +1,69 @@
+package i2ctest
+
+import (
+	"errors"
+	"sync"
+)
+
+const spiReadBit = 0x80
+
+var ErrSPIFrame = errors.New("i2ctest: malformed SPI transfer")
+
+/*
+SPI connects a Device to an SPI bus, decoding each transfer the way the chips do.
+The first byte is the register address, with bit 7 set for a read, which fills the rest of the transfer.
+InvenSense chips take a burst of data after a write address.  Bosch chips take address and data pairs,
+and only have registers from 0x80 up, so bit 7 of the address is dropped instead.
+It has the TransferAndReceiveData method of embd.SPIBus and sensors.SPIBus.
+*/
+type SPI struct {
+	Device Device
+	Bosch  bool
+
+	mu     sync.Mutex
+	frames [][]byte
+}
+
+// NewSPI returns an SPI bus with d attached, decoding transfers for a Bosch chip if bosch is set.
+func NewSPI(d Device, bosch bool) *SPI {
+	return &SPI{Device: d, Bosch: bosch}
+}
+
+// Frames returns a copy of every transfer sent so far.
+func (s *SPI) Frames() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.frames...)
+}
+
+func (s *SPI) TransferAndReceiveData(data []byte) error {
+	s.mu.Lock()
+	s.frames = append(s.frames, append([]byte(nil), data...))
+	s.mu.Unlock()
+
+	if len(data) < 2 {
+		return ErrSPIFrame
+	}
+	addr := data[0]
+
+	if addr&spiReadBit != 0 {
+		reg := addr &^ spiReadBit
+		if s.Bosch {
+			reg = addr
+		}
+		return s.Device.ReadReg(reg, data[1:])
+	}
+
+	if !s.Bosch {
+		return s.Device.WriteReg(addr, data[1:])
+	}
+	if len(data)%2 != 0 {
+		return ErrSPIFrame
+	}
+	for i := 0; i < len(data); i += 2 {
+		if err := s.Device.WriteReg(data[i]|spiReadBit, data[i+1:i+2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
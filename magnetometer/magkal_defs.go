@@ -14,11 +14,15 @@ const (
 	AvgMagField = 4390
 )
 
+// MagKalState is the calibration found by a MagKal algorithm.
+// A magnetometer measurement m is calibrated by K*m + L, then by Ellipsoid if the algorithm fits one.
 type MagKalState struct {
-	T      float64                // Time when state last updated
-	K      [3]float64             // Scaling factor for magnetometer
-	L      [3]float64             // Offset for magnetometer
-	LogMap map[string]interface{} // Map only for analysis/debugging
+	T         float64                // Time when state last updated
+	K         [3]float64             // Scaling factor for magnetometer
+	L         [3]float64             // Offset for magnetometer
+	Ellipsoid Ellipsoid              // Further soft-iron calibration, used if its Radius isn't zero
+	Quality   MagKalQuality          // How far the calibration can be trusted
+	LogMap    map[string]interface{} // Map only for analysis/debugging
 }
 
 // NewMagKal returns a new MagKal object that runs the algorithm passed to it.
@@ -63,14 +67,34 @@ func (s *MagKalState) updateLogMap(m *ahrs.Measurement, p map[string]interface{}
 		"L1":  func(s *MagKalState, m *ahrs.Measurement) float64 { return s.L[0] },
 		"L2":  func(s *MagKalState, m *ahrs.Measurement) float64 { return s.L[1] },
 		"L3":  func(s *MagKalState, m *ahrs.Measurement) float64 { return s.L[2] },
-		"MM1": func(s *MagKalState, m *ahrs.Measurement) float64 { return s.K[0]*m.M1 + s.L[0] },
-		"MM2": func(s *MagKalState, m *ahrs.Measurement) float64 { return s.K[1]*m.M2 + s.L[1] },
-		"MM3": func(s *MagKalState, m *ahrs.Measurement) float64 { return s.K[2]*m.M3 + s.L[2] },
+		"MM1": func(s *MagKalState, m *ahrs.Measurement) float64 { return s.Calibrate(m.M1, m.M2, m.M3)[0] },
+		"MM2": func(s *MagKalState, m *ahrs.Measurement) float64 { return s.Calibrate(m.M1, m.M2, m.M3)[1] },
+		"MM3": func(s *MagKalState, m *ahrs.Measurement) float64 { return s.Calibrate(m.M1, m.M2, m.M3)[2] },
 	}
 
 	for k := range logMapFunc {
 		p[k] = logMapFunc[k](s, m)
 	}
+
+	p["N"] = float64(s.Quality.N)
+	p["Spread"] = s.Quality.Spread
+	p["Coverage"] = s.Quality.Coverage
+	p["Converged"] = 0.0
+	if s.Quality.Converged {
+		p["Converged"] = 1.0
+	}
+}
+
+// Calibrate returns the calibrated magnetometer measurement m1, m2, m3, which should have magnitude AvgMagField.
+func (s *MagKalState) Calibrate(m1, m2, m3 float64) (c [3]float64) {
+	c = [3]float64{s.K[0]*m1 + s.L[0], s.K[1]*m2 + s.L[1], s.K[2]*m3 + s.L[2]}
+	if s.Ellipsoid.Radius != 0 {
+		c = s.Ellipsoid.Correct(c)
+		for i := range c {
+			c[i] *= AvgMagField / s.Ellipsoid.Radius
+		}
+	}
+	return
 }
 
 // NormDiff calculates the norm of the diff of two 3-vectors to see how different they are.
@@ -0,0 +1,246 @@
+// The Ellipsoid procedure fits an ellipsoid to magnetometer readings taken in many orientations.
+// Unlike K, L it corrects soft-iron distortion along any axes, not just the magnetometer's own.
+package magkal
+
+import (
+	"errors"
+	"math"
+
+	"github.com/westphae/goflying/sensors"
+)
+
+// MinEllipsoidSamples is the fewest readings FitEllipsoid will fit an ellipsoid to.
+var MinEllipsoidSamples = 50
+
+// ErrEllipsoid is returned when magnetometer readings don't determine an ellipsoid.
+var ErrEllipsoid = errors.New("magkal: readings don't determine an ellipsoid")
+
+/*
+Ellipsoid is a magnetometer calibration: readings m of a constant field taken in any orientation lie on
+an ellipsoid, and
+
+	M = Soft (m - Center)
+
+maps them onto a sphere of radius Radius.  Soft is symmetric with unit determinant, so it corrects
+soft-iron distortion without changing the scale of the readings, and Center is the hard-iron offset.
+*/
+type Ellipsoid struct {
+	Center [3]float64    // Hard-iron offset
+	Soft   [3][3]float64 // Soft-iron correction
+	Radius float64       // Field magnitude after correction
+}
+
+/*
+FitEllipsoid fits an ellipsoid to magnetometer readings by least squares.
+The readings should be spread over as many orientations as possible, ideally by turning the sensor
+through every heading while upright, inverted and on each side.
+*/
+func FitEllipsoid(m [][3]float64) (e Ellipsoid, err error) {
+	if len(m) < MinEllipsoidSamples {
+		return e, ErrEllipsoid
+	}
+
+	// Center and scale the readings so that the normal equations are well conditioned
+	var mu [3]float64
+	for _, v := range m {
+		for i := range mu {
+			mu[i] += v[i] / float64(len(m))
+		}
+	}
+	var s float64
+	for _, v := range m {
+		for i := range mu {
+			s += (v[i] - mu[i]) * (v[i] - mu[i])
+		}
+	}
+	s = math.Sqrt(s / float64(len(m)))
+	if s < Small {
+		return e, ErrEllipsoid
+	}
+
+	// Fit the quadric y^T Q y + 2 u^T y = 1 to the scaled readings y
+	x := make([][]float64, len(m))
+	b := make([][]float64, len(m))
+	for k, v := range m {
+		y := [3]float64{(v[0] - mu[0]) / s, (v[1] - mu[1]) / s, (v[2] - mu[2]) / s}
+		x[k] = []float64{y[0] * y[0], y[1] * y[1], y[2] * y[2],
+			2 * y[0] * y[1], 2 * y[0] * y[2], 2 * y[1] * y[2],
+			2 * y[0], 2 * y[1], 2 * y[2]}
+		b[k] = []float64{1}
+	}
+	xt := matTranspose(x)
+	p, ok := matSolve(matMul(xt, x), matMul(xt, b))
+	if !ok {
+		return e, ErrEllipsoid
+	}
+
+	e, ok = quadricEllipsoid([3][3]float64{
+		{p[0][0], p[3][0], p[4][0]},
+		{p[3][0], p[1][0], p[5][0]},
+		{p[4][0], p[5][0], p[2][0]},
+	}, [3]float64{p[6][0], p[7][0], p[8][0]})
+	if !ok {
+		return e, ErrEllipsoid
+	}
+
+	// Undo the scaling
+	for i := range e.Center {
+		e.Center[i] = mu[i] + s*e.Center[i]
+	}
+	e.Radius *= s
+	return e, nil
+}
+
+// quadricEllipsoid returns the ellipsoid y^T q y + 2 u^T y = 1, or false if the quadric isn't an ellipsoid.
+func quadricEllipsoid(q [3][3]float64, u [3]float64) (e Ellipsoid, ok bool) {
+	qm := [][]float64{q[0][:], q[1][:], q[2][:]}
+	c, ok := matSolve(qm, [][]float64{{-u[0]}, {-u[1]}, {-u[2]}})
+	if !ok {
+		return e, false
+	}
+
+	// (y-c)^T q (y-c) = 1 + c^T q c
+	k := 1.0
+	for i := 0; i < 3; i++ {
+		e.Center[i] = c[i][0]
+		k -= u[i] * c[i][0]
+	}
+
+	vals, vecs := symEigen3(q)
+	det := 1.0
+	for i := range vals {
+		vals[i] /= k
+		if vals[i] <= 0 {
+			return e, false
+		}
+		det *= vals[i]
+	}
+
+	// Soft = Radius sqrt(q/k), with Radius the geometric mean of the semi-axes
+	e.Radius = math.Pow(det, -1.0/6)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for n := 0; n < 3; n++ {
+				e.Soft[i][j] += e.Radius * math.Sqrt(vals[n]) * vecs[i][n] * vecs[j][n]
+			}
+		}
+	}
+	return e, true
+}
+
+// Correct returns the corrected magnetometer reading m.
+func (e *Ellipsoid) Correct(m [3]float64) (c [3]float64) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			c[i] += e.Soft[i][j] * (m[j] - e.Center[j])
+		}
+	}
+	return
+}
+
+/*
+Apply sets the magnetometer bias M01..M03 and rescaling matrix Ms11..Ms33 of cal so that a driver using it
+makes the corrections of e, given that e was fitted to readings made using cal.
+It returns ErrEllipsoid if the rescaling matrix of cal is singular.
+*/
+func (e *Ellipsoid) Apply(cal *sensors.IMUCalData) error {
+	ms := [][]float64{
+		{cal.Ms11, cal.Ms12, cal.Ms13},
+		{cal.Ms21, cal.Ms22, cal.Ms23},
+		{cal.Ms31, cal.Ms32, cal.Ms33},
+	}
+
+	// Soft (Ms (m - M0) - Center) = Soft Ms (m - (M0 + Ms^-1 Center))
+	d, ok := matSolve(ms, [][]float64{{e.Center[0]}, {e.Center[1]}, {e.Center[2]}})
+	if !ok {
+		return ErrEllipsoid
+	}
+	s := matMul([][]float64{e.Soft[0][:], e.Soft[1][:], e.Soft[2][:]}, ms)
+
+	cal.M01, cal.M02, cal.M03 = cal.M01+d[0][0], cal.M02+d[1][0], cal.M03+d[2][0]
+	cal.Ms11, cal.Ms12, cal.Ms13 = s[0][0], s[0][1], s[0][2]
+	cal.Ms21, cal.Ms22, cal.Ms23 = s[1][0], s[1][1], s[1][2]
+	cal.Ms31, cal.Ms32, cal.Ms33 = s[2][0], s[2][1], s[2][2]
+	return nil
+}
+
+// symEigen3 returns the eigenvalues of the symmetric matrix a and the eigenvectors, as the columns of vecs,
+// by Jacobi rotations.
+func symEigen3(a [3][3]float64) (vals [3]float64, vecs [3][3]float64) {
+	vecs = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for sweep := 0; sweep < 50; sweep++ {
+		off := a[0][1]*a[0][1] + a[0][2]*a[0][2] + a[1][2]*a[1][2]
+		if off < 1e-30*(a[0][0]*a[0][0]+a[1][1]*a[1][1]+a[2][2]*a[2][2]) {
+			break
+		}
+		for p := 0; p < 2; p++ {
+			for q := p + 1; q < 3; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := math.Copysign(1, theta) / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < 3; k++ { // a = a J
+					akp, akq := a[k][p], a[k][q]
+					a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+				}
+				for k := 0; k < 3; k++ { // a = J^T a
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+				}
+				for k := 0; k < 3; k++ {
+					vkp, vkq := vecs[k][p], vecs[k][q]
+					vecs[k][p], vecs[k][q] = c*vkp-s*vkq, s*vkp+c*vkq
+				}
+			}
+		}
+	}
+	return [3]float64{a[0][0], a[1][1], a[2][2]}, vecs
+}
+
+// matSolve solves a x = b by Gaussian elimination with partial pivoting, returning false if a is singular.
+func matSolve(a, b [][]float64) (x [][]float64, ok bool) {
+	n := len(a)
+	m := make([][]float64, n) // a augmented with b
+	var scale float64
+	for i := range m {
+		m[i] = append(append([]float64{}, a[i]...), b[i]...)
+		for _, v := range a[i] {
+			scale = math.Max(scale, math.Abs(v))
+		}
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(m[r][col]) > math.Abs(m[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(m[pivot][col]) <= 1e-12*scale {
+			return nil, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for r := col + 1; r < n; r++ {
+			f := m[r][col] / m[col][col]
+			for j := col; j < len(m[r]); j++ {
+				m[r][j] -= f * m[col][j]
+			}
+		}
+	}
+
+	x = make([][]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		x[i] = make([]float64, len(b[i]))
+		for j := range x[i] {
+			v := m[i][n+j]
+			for k := i + 1; k < n; k++ {
+				v -= m[i][k] * x[k][j]
+			}
+			x[i][j] = v / m[i][i]
+		}
+	}
+	return x, true
+}
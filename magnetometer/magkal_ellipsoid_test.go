@@ -0,0 +1,130 @@
+package magkal
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/westphae/goflying/sensors"
+)
+
+// Soft-iron distortion and hard-iron offset of the simulated magnetometer
+var (
+	distortion = [3][3]float64{{1.2, 0.1, -0.05}, {0.1, 0.9, 0.08}, {-0.05, 0.08, 1.05}}
+	offset     = [3]float64{12, -30, 7}
+)
+
+// distortedReadings returns readings of a field of magnitude r in n random orientations.
+func distortedReadings(n int, r, noise float64) [][3]float64 {
+	rnd := rand.New(rand.NewSource(1))
+	m := make([][3]float64, n)
+	for k := range m {
+		var u [3]float64
+		for i := range u {
+			u[i] = rnd.NormFloat64()
+		}
+		norm := NormVec(u)
+		for i := range m[k] {
+			m[k][i] = offset[i] + rnd.NormFloat64()*noise
+			for j := range u {
+				m[k][i] += distortion[i][j] * u[j] / norm * r
+			}
+		}
+	}
+	return m
+}
+
+func TestFitEllipsoid(t *testing.T) {
+	tests := []struct {
+		name  string
+		noise float64
+		tol   float64
+	}{
+		{"Exact", 0, 1e-6},
+		{"Noisy", 0.2, 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := distortedReadings(500, 50, tt.noise)
+			e, err := FitEllipsoid(m)
+			if err != nil {
+				t.Fatalf("FitEllipsoid() error = %v", err)
+			}
+
+			for i := range offset {
+				if math.Abs(e.Center[i]-offset[i]) > tt.tol {
+					t.Errorf("Center = %v, want %v", e.Center, offset)
+					break
+				}
+			}
+			for i := 0; i < 3; i++ {
+				for j := 0; j < 3; j++ {
+					if math.Abs(e.Soft[i][j]-e.Soft[j][i]) > 1e-9 {
+						t.Errorf("Soft = %v isn't symmetric", e.Soft)
+					}
+				}
+			}
+			for _, v := range m {
+				c := e.Correct(v)
+				if got := NormVec(c); math.Abs(got-e.Radius) > 2*tt.tol+1e-6 {
+					t.Fatalf("corrected reading %v has magnitude %v, want %v", c, got, e.Radius)
+				}
+			}
+		})
+	}
+}
+
+func TestFitEllipsoidErrors(t *testing.T) {
+	flat := distortedReadings(100, 50, 0)
+	for k := range flat {
+		flat[k][2] = 0
+	}
+
+	for name, m := range map[string][][3]float64{
+		"TooFew": distortedReadings(MinEllipsoidSamples-1, 50, 0),
+		"Flat":   flat,
+	} {
+		if _, err := FitEllipsoid(m); !errors.Is(err, ErrEllipsoid) {
+			t.Errorf("%s: FitEllipsoid() error = %v, want ErrEllipsoid", name, err)
+		}
+	}
+}
+
+func TestEllipsoidApply(t *testing.T) {
+	raw := distortedReadings(200, 50, 0)
+
+	// Readings made with a previous calibration
+	cal := sensors.IMUCalData{M01: 3, M02: -2, M03: 1, Ms11: 1.1, Ms12: 0.02, Ms22: 0.95, Ms33: 1}
+	correct := func(cal *sensors.IMUCalData, v [3]float64) [3]float64 {
+		mm := [3]float64{v[0] - cal.M01, v[1] - cal.M02, v[2] - cal.M03}
+		return [3]float64{
+			cal.Ms11*mm[0] + cal.Ms12*mm[1] + cal.Ms13*mm[2],
+			cal.Ms21*mm[0] + cal.Ms22*mm[1] + cal.Ms23*mm[2],
+			cal.Ms31*mm[0] + cal.Ms32*mm[1] + cal.Ms33*mm[2],
+		}
+	}
+	m := make([][3]float64, len(raw))
+	for k, v := range raw {
+		m[k] = correct(&cal, v)
+	}
+
+	e, err := FitEllipsoid(m)
+	if err != nil {
+		t.Fatalf("FitEllipsoid() error = %v", err)
+	}
+	if err := e.Apply(&cal); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	for _, v := range raw {
+		c := correct(&cal, v)
+		if got := NormVec(c); math.Abs(got-e.Radius) > 1e-6 {
+			t.Fatalf("reading %v is calibrated to %v with magnitude %v, want %v", v, c, got, e.Radius)
+		}
+	}
+
+	if err := e.Apply(&sensors.IMUCalData{}); !errors.Is(err, ErrEllipsoid) {
+		t.Errorf("Apply() to a singular calibration error = %v, want ErrEllipsoid", err)
+	}
+}
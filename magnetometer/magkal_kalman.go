@@ -55,6 +55,8 @@ func ComputeKalman(nn MagKalState, cIn chan ahrs.Measurement, cOut chan MagKalSt
 	n.h[0] = make([]float64, 6)
 	id := matIdentity(6)
 
+	var q qualityTracker
+
 	for m := range cIn { // Receive input measurements
 		n.u = [][]float64{{m.M1 / AvgMagField}, {m.M2 / AvgMagField}, {m.M3 / AvgMagField}}
 
@@ -98,6 +100,7 @@ func ComputeKalman(nn MagKalState, cIn chan ahrs.Measurement, cOut chan MagKalSt
 		n.T = m.T
 		n.K = [3]float64{n.x[0][0], n.x[2][0], n.x[4][0]}
 		n.L = [3]float64{n.x[1][0] * AvgMagField, n.x[3][0] * AvgMagField, n.x[5][0] * AvgMagField}
+		q.update(&n.MagKalState, &m)
 		n.updateLogMap(&m, n.LogMap)
 		n.updateKalmanLogMap()
 
@@ -141,8 +144,8 @@ func (n *MagKalStateKalman) updateKalmanLogMap2() {
 		n.LogMap[fmt.Sprintf("h%d", i)] = n.h[0][i]
 		n.LogMap[fmt.Sprintf("kk%d", i)] = n.kk[i][0]
 		for j := 0; j < 6; j++ {
-			n.LogMap[fmt.Sprintf("p%d%d", i)] = n.p[i][j]
-			n.LogMap[fmt.Sprintf("q%d%d", i)] = n.p[i][j]
+			n.LogMap[fmt.Sprintf("p%d%d", i, j)] = n.p[i][j]
+			n.LogMap[fmt.Sprintf("q%d%d", i, j)] = n.p[i][j]
 		}
 	}
 	n.LogMap["r"] = n.r[0][0]
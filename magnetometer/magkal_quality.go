@@ -0,0 +1,90 @@
+package magkal
+
+import (
+	"math"
+
+	"github.com/westphae/goflying/ahrs"
+)
+
+var (
+	// QualityWindow is the number of recent measurements the quality of a calibration is judged by.
+	QualityWindow = 500
+	// MinConvergedSamples is the fewest measurements a calibration must have seen to have converged.
+	MinConvergedSamples = 300
+	// MaxConvergedSpread is the largest relative spread of calibrated field magnitudes of a converged calibration.
+	MaxConvergedSpread = 0.05
+	// MinConvergedCoverage is the smallest fraction of directions recent measurements must cover
+	// for a calibration to have converged.  A full turn in level flight covers about a quarter of them.
+	MinConvergedCoverage = 0.2
+)
+
+const (
+	azimuthBins   = 8 // Sectors of the calibrated field direction around the magnetometer's 3-axis
+	elevationBins = 4 // Bands of equal area from the 3-axis down to its opposite
+)
+
+// MagKalQuality measures how far a calibration can be trusted for magnetic heading.
+type MagKalQuality struct {
+	N         int     // Number of valid magnetometer measurements seen
+	Spread    float64 // RMS spread of recent calibrated field magnitudes, relative to their mean
+	Coverage  float64 // Fraction of directions recent calibrated measurements point in, from 0 to 1
+	Converged bool    // Whether N, Spread and Coverage are all good enough to trust
+}
+
+// qualityTracker keeps the recent measurements that a calibration's quality is judged by.
+type qualityTracker struct {
+	window [][3]float64
+	next   int // Index of the oldest measurement once window is full
+}
+
+// update adds measurement m to the window, if it is valid, and judges the quality of calibration s.
+func (q *qualityTracker) update(s *MagKalState, m *ahrs.Measurement) {
+	if !m.MValid {
+		return
+	}
+	v := [3]float64{m.M1, m.M2, m.M3}
+	if len(q.window) < QualityWindow {
+		q.window = append(q.window, v)
+	} else {
+		q.window[q.next] = v
+		q.next = (q.next + 1) % len(q.window)
+	}
+
+	s.Quality.N++
+	var sum, sum2 float64
+	var bins [azimuthBins * elevationBins]bool
+	for _, v := range q.window {
+		c := s.Calibrate(v[0], v[1], v[2])
+		b := NormVec(c)
+		sum += b
+		sum2 += b * b
+		if b < Small {
+			continue
+		}
+		az := int((math.Atan2(c[1], c[0]) + Pi) / (2 * Pi) * azimuthBins)
+		if az == azimuthBins {
+			az--
+		}
+		el := int((c[2]/b + 1) / 2 * elevationBins)
+		if el == elevationBins {
+			el--
+		}
+		bins[az*elevationBins+el] = true
+	}
+
+	n := float64(len(q.window))
+	mean := sum / n
+	s.Quality.Spread = 1
+	if mean > Small {
+		s.Quality.Spread = math.Sqrt(math.Max(sum2/n-mean*mean, 0)) / mean
+	}
+	var covered int
+	for _, hit := range bins {
+		if hit {
+			covered++
+		}
+	}
+	s.Quality.Coverage = float64(covered) / float64(len(bins))
+	s.Quality.Converged = s.Quality.N >= MinConvergedSamples &&
+		s.Quality.Spread <= MaxConvergedSpread && s.Quality.Coverage >= MinConvergedCoverage
+}
@@ -0,0 +1,107 @@
+package magkal
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/westphae/goflying/ahrs"
+)
+
+// runMagKal runs algorithm f from k, l over the measurements m and returns the final state.
+func runMagKal(f func(MagKalState, chan ahrs.Measurement, chan MagKalState), k, l [3]float64, m [][3]float64, valid bool) MagKalState {
+	cIn, cOut := NewMagKal(k, l, f)
+	defer close(cIn)
+
+	var meas ahrs.Measurement
+	for i, v := range m {
+		meas = ahrs.Measurement{MValid: valid, M1: v[0], M2: v[1], M3: v[2], T: float64(i)}
+		cIn <- meas
+	}
+
+	// Results are only sent while they are being received, so keep repeating the last measurement until one is
+	for {
+		select {
+		case cIn <- meas:
+		case s := <-cOut:
+			return s
+		}
+	}
+}
+
+// coneReadings returns readings of a field of magnitude r within angle of the 1-axis.
+func coneReadings(n int, r, angle float64) [][3]float64 {
+	rnd := rand.New(rand.NewSource(2))
+	m := make([][3]float64, n)
+	for k := range m {
+		z := 1 - rnd.Float64()*(1-math.Cos(angle))
+		az := rnd.Float64() * 2 * Pi
+		m[k] = [3]float64{r * z, r * math.Sqrt(1-z*z) * math.Cos(az), r * math.Sqrt(1-z*z) * math.Sin(az)}
+	}
+	return m
+}
+
+func TestMagKalQuality(t *testing.T) {
+	const field = 50.0
+	k := AvgMagField / field
+	kCal := [3]float64{k, k, k}
+	var zeros [3]float64
+
+	tests := []struct {
+		name      string
+		f         func(MagKalState, chan ahrs.Measurement, chan MagKalState)
+		k         [3]float64
+		m         [][3]float64
+		valid     bool
+		converged bool
+	}{
+		{"TrivialCalibrated", ComputeTrivial, kCal, coneReadings(1000, field, Pi), true, true},
+		{"TrivialDistorted", ComputeTrivial, kCal, distortedReadings(1000, field, 0), true, false},
+		{"TrivialNarrow", ComputeTrivial, kCal, coneReadings(1000, field, 20*Deg), true, false},
+		{"TrivialInvalid", ComputeTrivial, kCal, coneReadings(1000, field, Pi), false, false},
+		{"TrivialFew", ComputeTrivial, kCal, coneReadings(MinConvergedSamples/2, field, Pi), true, false},
+		{"SimpleDistorted", ComputeSimple, zeros, distortedReadings(1000, field, 0), true, false},
+		{"RLSDistorted", ComputeRLS, zeros, distortedReadings(1000, field, 0), true, true},
+		{"RLSNoisy", ComputeRLS, kCal, distortedReadings(2000, field, 0.2), true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := runMagKal(tt.f, tt.k, zeros, tt.m, tt.valid)
+			q := s.Quality
+			if q.Converged != tt.converged {
+				t.Errorf("Converged = %v, want %v, with %+v", q.Converged, tt.converged, q)
+			}
+			if !tt.valid && q.N != 0 {
+				t.Errorf("N = %d from invalid measurements, want 0", q.N)
+			}
+			if tt.valid && q.N < len(tt.m) {
+				t.Errorf("N = %d, want at least %d", q.N, len(tt.m))
+			}
+			if q.Converged {
+				for _, v := range tt.m {
+					if b := NormVec(s.Calibrate(v[0], v[1], v[2])); math.Abs(b/AvgMagField-1) > 2*MaxConvergedSpread {
+						t.Fatalf("reading %v is calibrated to magnitude %v, want %v", v, b, AvgMagField)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestRLSZeroFirst checks that zero readings from a magnetometer that isn't ready yet don't poison the fit.
+func TestRLSZeroFirst(t *testing.T) {
+	const field = 50.0
+	var zeros [3]float64
+	m := distortedReadings(1000, field, 0)
+	s := runMagKal(ComputeRLS, zeros, zeros, append(make([][3]float64, 5), m...), true)
+
+	if !s.Quality.Converged {
+		t.Fatalf("not converged after zero readings, K = %v, with %+v", s.K, s.Quality)
+	}
+	for _, v := range m {
+		if b := NormVec(s.Calibrate(v[0], v[1], v[2])); math.Abs(b/AvgMagField-1) > 2*MaxConvergedSpread {
+			t.Fatalf("reading %v is calibrated to magnitude %v, want %v", v, b, AvgMagField)
+		}
+	}
+}
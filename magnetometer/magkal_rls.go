@@ -0,0 +1,102 @@
+// The RLS procedure fits an ellipsoid to the magnetometer measurements by recursive least squares.
+// Like the Ellipsoid procedure it corrects soft-iron distortion along any axes, but it refines
+// the calibration with each measurement, so it can run in flight.
+package magkal
+
+import "github.com/westphae/goflying/ahrs"
+
+const (
+	rlsUncertainty = 1.0           // Initial uncertainty of the ellipsoid coefficients
+	rlsForgetting  = 0.9999        // Weight of older measurements relative to the next, less than 1 to track changes
+	rlsMaxGain     = 1e3           // Limit on the growth of the uncertainty while the measurements don't change
+	rlsParams      = 9             // Coefficients of the quadric y^T Q y + 2 u^T y = 1
+	rlsStart       = 2 * rlsParams // Measurements before the fitted ellipsoid is used
+)
+
+func ComputeRLS(s MagKalState, cIn chan ahrs.Measurement, cOut chan MagKalState) {
+	var (
+		p  = []float64{1, 1, 1, 0, 0, 0, 0, 0, 0} // Start from the unit sphere
+		pp = matSMul(rlsUncertainty*rlsUncertainty, matIdentity(rlsParams))
+		h  = make([]float64, rlsParams)
+		n  int
+		q  qualityTracker
+	)
+
+	for m := range cIn { // Receive input measurements
+		s.T = m.T // Update the MagKalState
+
+		if m.MValid && NormVec(s.K) < Small && NormVec([3]float64{m.M1, m.M2, m.M3}) < Small {
+			m.MValid = false // A magnetometer that isn't ready yet may read zero, which can't give the starting K
+		}
+		if m.MValid {
+			if NormVec(s.K) < Small { // Start from the magnitude of the first measurement
+				k := AvgMagField / NormVec([3]float64{m.M1, m.M2, m.M3})
+				s.K = [3]float64{k, k, k}
+				s.L = [3]float64{0, 0, 0}
+			}
+
+			// The ellipsoid is fitted to the K, L calibrated measurements y, in units of AvgMagField
+			y := [3]float64{
+				(s.K[0]*m.M1 + s.L[0]) / AvgMagField,
+				(s.K[1]*m.M2 + s.L[1]) / AvgMagField,
+				(s.K[2]*m.M3 + s.L[2]) / AvgMagField,
+			}
+			h[0], h[1], h[2] = y[0]*y[0], y[1]*y[1], y[2]*y[2]
+			h[3], h[4], h[5] = 2*y[0]*y[1], 2*y[0]*y[2], 2*y[1]*y[2]
+			h[6], h[7], h[8] = 2*y[0], 2*y[1], 2*y[2]
+
+			// Gain g = P h / (forgetting + h^T P h)
+			ph := make([]float64, rlsParams)
+			d := rlsForgetting
+			for i := range ph {
+				for j := range h {
+					ph[i] += pp[i][j] * h[j]
+				}
+				d += h[i] * ph[i]
+			}
+			r := 1.0 // Residual of the measurement
+			for i := range p {
+				r -= h[i] * p[i]
+			}
+			for i := range p {
+				p[i] += ph[i] / d * r
+			}
+			// P = (P - g h^T P) / forgetting, unless it has grown too large
+			f := 1 / rlsForgetting
+			var tr float64
+			for i := range pp {
+				tr += pp[i][i]
+			}
+			if tr > rlsMaxGain*rlsParams*rlsUncertainty*rlsUncertainty {
+				f = 1
+			}
+			for i := range pp {
+				for j := range pp[i] {
+					pp[i][j] = (pp[i][j] - ph[i]*ph[j]/d) * f
+				}
+			}
+
+			n++
+			if e, ok := quadricEllipsoid([3][3]float64{
+				{p[0], p[3], p[4]},
+				{p[3], p[1], p[5]},
+				{p[4], p[5], p[2]},
+			}, [3]float64{p[6], p[7], p[8]}); ok && n >= rlsStart {
+				for i := range e.Center {
+					e.Center[i] *= AvgMagField
+				}
+				e.Radius *= AvgMagField
+				s.Ellipsoid = e
+			}
+		}
+
+		q.update(&s, &m)
+		s.updateLogMap(&m, s.LogMap)
+		select {
+		case cOut <- s: // Send results when requested, non-blocking
+		default:
+		}
+	}
+
+	close(cOut) // When cIn is closed, close cOut
+}
@@ -20,6 +20,7 @@ func ComputeSimple(s MagKalState, cIn chan ahrs.Measurement, cOut chan MagKalSta
 		s.L = [3]float64{0, 0, 0}
 	}
 
+	var q qualityTracker
 	for m := range cIn { // Receive input measurements
 		s.T = m.T // Update the MagKalState
 		m1Min, m1Max = math.Min(m1Min, m.M1), math.Max(m1Max, m.M1)
@@ -41,6 +42,7 @@ func ComputeSimple(s MagKalState, cIn chan ahrs.Measurement, cOut chan MagKalSta
 			s.L[2] = -s.K[2] * (m3Max + m3Min) / 2
 		}
 
+		q.update(&s, &m)
 		s.updateLogMap(&m, s.LogMap)
 		select {
 		case cOut <- s: // Send results when requested, non-blocking
@@ -10,8 +10,10 @@ func ComputeTrivial(s MagKalState, cIn chan ahrs.Measurement, cOut chan MagKalSt
 		s.L = [3]float64{0, 0, 0}
 	}
 
+	var q qualityTracker
 	for m := range cIn { // Receive input measurements
 		s.T = m.T // Update the MagKalState
+		q.update(&s, &m)
 		s.updateLogMap(&m, s.LogMap)
 		select {
 		case cOut <- s: // Send results when requested, non-blocking
@@ -0,0 +1,206 @@
+package sensors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var (
+	// MaxCalRate is the rotation rate, in °/s, above which the IMU is taken to be moving during a calibration.
+	MaxCalRate = 5.0
+	// MaxCalFaceAngle is how far, in degrees, the IMU may be tilted from the face it is asked to rest on.
+	MaxCalFaceAngle = 20.0
+)
+
+var (
+	ErrCalMoving = errors.New("sensors: IMU moved while collecting calibration readings")
+	ErrCalFace   = errors.New("sensors: IMU isn't resting on the requested face")
+	ErrAccelCal  = errors.New("sensors: readings don't determine the accelerometer calibration")
+)
+
+// AccelFace is one of the six orientations of a six-position accelerometer calibration.
+type AccelFace int
+
+const (
+	FaceZUp AccelFace = iota // Level, right way up
+	FaceZDown
+	FaceXUp
+	FaceXDown
+	FaceYUp
+	FaceYDown
+)
+
+func (f AccelFace) String() string {
+	switch f {
+	case FaceZUp:
+		return "Z axis up"
+	case FaceZDown:
+		return "Z axis down"
+	case FaceXUp:
+		return "X axis up"
+	case FaceXDown:
+		return "X axis down"
+	case FaceYUp:
+		return "Y axis up"
+	case FaceYDown:
+		return "Y axis down"
+	default:
+		return fmt.Sprintf("AccelFace(%d)", int(f))
+	}
+}
+
+// Gravity returns the reading, in G, of a perfect accelerometer resting on face f.
+func (f AccelFace) Gravity() (g [3]float64) {
+	axis := [...]int{2, 2, 0, 0, 1, 1}[f]
+	g[axis] = 1
+	if f%2 == 1 {
+		g[axis] = -1
+	}
+	return
+}
+
+/*
+AccelCal corrects accelerometer readings for offset, scale and misalignment, after the hardware biases
+have been removed:
+
+	A = S (a - B)
+
+where a is the reading and A the corrected reading, in G.  The off-diagonal terms of S correct for
+misaligned axes and cross-axis sensitivity.  The zero value makes no correction.
+*/
+type AccelCal struct {
+	B [3]float64    // Offset, G
+	S [3][3]float64 // Scale and misalignment
+}
+
+// Correct applies the calibration to the accelerometer readings in d.
+func (c *AccelCal) Correct(d *IMUData) {
+	if c.S == [3][3]float64{} {
+		return
+	}
+	a := [3]float64{d.A1 - c.B[0], d.A2 - c.B[1], d.A3 - c.B[2]}
+	d.A1 = c.S[0][0]*a[0] + c.S[0][1]*a[1] + c.S[0][2]*a[2]
+	d.A2 = c.S[1][0]*a[0] + c.S[1][1]*a[1] + c.S[1][2]*a[2]
+	d.A3 = c.S[2][0]*a[0] + c.S[2][1]*a[1] + c.S[2][2]*a[2]
+}
+
+/*
+SolveAccelCal finds the calibration from the mean readings taken with the IMU resting on each of
+the six faces, indexed by AccelFace.  Each row of S and the matching element of -S B are fitted
+by least squares to the six known gravity vectors.
+*/
+func SolveAccelCal(faces [6]*IMUData) (cal AccelCal, err error) {
+	rows := make([][]float64, len(faces))
+	for i, d := range faces {
+		if d == nil {
+			return cal, fmt.Errorf("%w: no readings for %s", ErrAccelCal, AccelFace(i))
+		}
+		rows[i] = []float64{d.A1, d.A2, d.A3, 1}
+	}
+
+	var sb [3]float64 // -S B
+	for r := 0; r < 3; r++ {
+		g := make([]float64, len(faces))
+		for i := range faces {
+			g[i] = AccelFace(i).Gravity()[r]
+		}
+		x, ok := leastSquares(rows, g)
+		if !ok {
+			return cal, ErrAccelCal
+		}
+		copy(cal.S[r][:], x[:3])
+		sb[r] = -x[3]
+	}
+
+	a := make([][]float64, 3)
+	for r := range a {
+		a[r] = append(cal.S[r][:3:3], sb[r])
+	}
+	b, ok := solveLinear(a)
+	if !ok {
+		return AccelCal{}, ErrAccelCal
+	}
+	copy(cal.B[:], b)
+	return cal, nil
+}
+
+// AverageReadings averages the next n gyro/accel readings from imu, skipping any with a GAError.
+// It returns ErrCalMoving if any reading rotates faster than MaxCalRate.
+func AverageReadings(ctx context.Context, imu IMU, n int) (*IMUData, error) {
+	c, cancel := imu.Subscribe(n)
+	defer cancel()
+
+	avg := new(IMUData)
+	var t0 time.Time
+	for avg.N < n {
+		var d *IMUData
+		select {
+		case d = <-c:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if d.GAError != nil {
+			continue
+		}
+		if math.Sqrt(d.G1*d.G1+d.G2*d.G2+d.G3*d.G3) > MaxCalRate {
+			return nil, ErrCalMoving
+		}
+		avg.G1, avg.G2, avg.G3 = avg.G1+d.G1, avg.G2+d.G2, avg.G3+d.G3
+		avg.A1, avg.A2, avg.A3 = avg.A1+d.A1, avg.A2+d.A2, avg.A3+d.A3
+		avg.Temp += d.Temp
+		if avg.N == 0 {
+			t0 = d.T
+		}
+		avg.T, avg.DT = d.T, d.T.Sub(t0)
+		avg.N++
+	}
+
+	k := float64(avg.N)
+	avg.G1, avg.G2, avg.G3 = avg.G1/k, avg.G2/k, avg.G3/k
+	avg.A1, avg.A2, avg.A3 = avg.A1/k, avg.A2/k, avg.A3/k
+	avg.Temp /= k
+	return avg, nil
+}
+
+/*
+CalibrateAccel guides a six-position accelerometer calibration of imu.
+For each face in turn it calls prompt, which should ask the user to rest the IMU on that face and return
+once it is still, then averages n readings.  If the IMU moved or isn't on the right face, prompt is called
+again for the same face with the reason, ErrCalMoving or ErrCalFace, as retry.  An error from prompt aborts
+the calibration.
+The readings should be uncorrected by any previous AccelCal.
+*/
+func CalibrateAccel(ctx context.Context, imu IMU, n int, prompt func(face AccelFace, retry error) error) (AccelCal, error) {
+	var faces [6]*IMUData
+	for i := range faces {
+		face := AccelFace(i)
+		var retry error
+		for faces[i] == nil {
+			if err := prompt(face, retry); err != nil {
+				return AccelCal{}, err
+			}
+			d, err := AverageReadings(ctx, imu, n)
+			switch {
+			case errors.Is(err, ErrCalMoving):
+				retry = err
+			case err != nil:
+				return AccelCal{}, err
+			case !onFace(d, face):
+				retry = ErrCalFace
+			default:
+				faces[i] = d
+			}
+		}
+	}
+	return SolveAccelCal(faces)
+}
+
+// onFace reports whether the mean accelerometer reading d is within MaxCalFaceAngle of the gravity of face.
+func onFace(d *IMUData, face AccelFace) bool {
+	g := face.Gravity()
+	a := math.Sqrt(d.A1*d.A1 + d.A2*d.A2 + d.A3*d.A3)
+	return a > 0 && (d.A1*g[0]+d.A2*g[1]+d.A3*g[2])/a >= math.Cos(MaxCalFaceAngle*math.Pi/180)
+}
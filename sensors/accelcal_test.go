@@ -0,0 +1,114 @@
+package sensors
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// miscalibrated returns the reading of an accelerometer with offset b and the inverse of correction s,
+// for a true specific force of g.
+func miscalibrated(g [3]float64, b [3]float64, sInv [3][3]float64) *IMUData {
+	var a [3]float64
+	for r := range a {
+		a[r] = b[r] + sInv[r][0]*g[0] + sInv[r][1]*g[1] + sInv[r][2]*g[2]
+	}
+	return &IMUData{A1: a[0], A2: a[1], A3: a[2], N: 1}
+}
+
+var (
+	testAccelB    = [3]float64{0.02, -0.03, 0.05}
+	testAccelSInv = [3][3]float64{{1.02, 0.01, 0}, {-0.005, 0.97, 0.02}, {0.01, 0, 1.04}}
+)
+
+func TestSolveAccelCal(t *testing.T) {
+	var faces [6]*IMUData
+	for i := range faces {
+		faces[i] = miscalibrated(AccelFace(i).Gravity(), testAccelB, testAccelSInv)
+	}
+	cal, err := SolveAccelCal(faces)
+	if err != nil {
+		t.Fatalf("SolveAccelCal() error = %v", err)
+	}
+	for r := 0; r < 3; r++ {
+		if math.Abs(cal.B[r]-testAccelB[r]) > 1e-9 {
+			t.Errorf("B = %v, want %v", cal.B, testAccelB)
+			break
+		}
+	}
+
+	// An arbitrary orientation is corrected too
+	g := [3]float64{0.6, -0.48, 0.64}
+	d := miscalibrated(g, testAccelB, testAccelSInv)
+	cal.Correct(d)
+	if got := [3]float64{d.A1, d.A2, d.A3}; math.Abs(got[0]-g[0]) > 1e-9 || math.Abs(got[1]-g[1]) > 1e-9 || math.Abs(got[2]-g[2]) > 1e-9 {
+		t.Errorf("corrected reading = %v, want %v", got, g)
+	}
+
+	faces[FaceYDown] = nil
+	if _, err := SolveAccelCal(faces); err == nil {
+		t.Errorf("SolveAccelCal() with a face missing succeeded")
+	}
+
+	var zero AccelCal
+	d = &IMUData{A1: 0.1, A2: 0.2, A3: 0.9}
+	if zero.Correct(d); d.A1 != 0.1 || d.A2 != 0.2 || d.A3 != 0.9 {
+		t.Errorf("zero AccelCal changed the reading to %+v", d)
+	}
+}
+
+// calIMU gives readings of the face it was last placed on, optionally rotating.
+type calIMU struct {
+	IMU
+	face     AccelFace
+	rotating bool
+}
+
+func (m *calIMU) Subscribe(bufSize int) (<-chan *IMUData, func()) {
+	c := make(chan *IMUData, bufSize)
+	for i := 0; i < bufSize; i++ {
+		d := miscalibrated(m.face.Gravity(), testAccelB, testAccelSInv)
+		if m.rotating {
+			d.G3 = 2 * MaxCalRate
+		}
+		c <- d
+	}
+	return c, func() {}
+}
+
+func TestCalibrateAccel(t *testing.T) {
+	imu := new(calIMU)
+	var prompts []error
+	prompt := func(face AccelFace, retry error) error {
+		prompts = append(prompts, retry)
+		imu.face, imu.rotating = face, false
+		switch len(prompts) {
+		case 1: // Picked up too soon
+			imu.rotating = true
+		case 4: // Placed on the wrong face
+			imu.face = FaceZUp
+		}
+		return nil
+	}
+
+	cal, err := CalibrateAccel(context.Background(), imu, 10, prompt)
+	if err != nil {
+		t.Fatalf("CalibrateAccel() error = %v", err)
+	}
+	want := []error{nil, ErrCalMoving, nil, nil, ErrCalFace, nil, nil, nil}
+	if len(prompts) != len(want) {
+		t.Fatalf("prompted with %v, want %v", prompts, want)
+	}
+	for i := range want {
+		if prompts[i] != want[i] {
+			t.Errorf("prompted with %v, want %v", prompts, want)
+			break
+		}
+	}
+	for r := 0; r < 3; r++ {
+		if math.Abs(cal.B[r]-testAccelB[r]) > 1e-9 {
+			t.Errorf("B = %v, want %v", cal.B, testAccelB)
+			break
+		}
+	}
+}
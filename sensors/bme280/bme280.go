@@ -10,26 +10,66 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/kidoman/embd"
-	_ "github.com/kidoman/embd/host/all"
-
 	"github.com/westphae/goflying"
+	"github.com/westphae/goflying/sensors"
 )
 
 type Sensor struct {
 	i2CAddress byte
-	i2CBus     embd.I2CBus
+	regs       sensors.Registers
+	chipID     byte
+	t0         time.Time // Reference time for the sensors.BMPData timestamps
+
+	poller sensors.Poller
+	feed   sensors.Feed[*sensors.BMPData]
 
 	Data *MeasurementData
 }
 
+var _ sensors.Barometer = (*Sensor)(nil)
+
+func init() {
+	sensors.RegisterDriver("BME280", sensors.Signature{
+		Kind:      sensors.KindPressure,
+		Addresses: []byte{byte(I2CAddressLow), byte(I2CAddressHigh)},
+		Register:  RegisterChipID,
+		IDs:       []byte{ChipID},
+	}, func(d sensors.Descriptor) (sensors.Device, error) {
+		bme, err := NewSensor(d.Bus, I2CAddress(d.Address),
+			WithFilterCoefficient(FilterCoefficient16),
+			WithInactiveDuration(InactiveDuration62_5ms),
+			WithPressureOversampling(PressureOversampling1x),
+			WithTemperatureOversampling(TemperatureOversampling1x),
+			WithHumidityOversampling(HumidityOversampling1x),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := bme.Start(context.Background()); err != nil {
+			return nil, err
+		}
+		return bme, nil
+	})
+}
+
 // NewSensor returns a Sensor object connected to the specified I2C bus and with
 // the specified I2C address. One or more SettingFunc functions can be specified
 // for updating the configuration and control bytes during initialisation.
-func NewSensor(bus embd.I2CBus, address I2CAddress, settings ...SettingFunc) (*Sensor, error) {
+func NewSensor(bus sensors.I2CBus, address I2CAddress, settings ...SettingFunc) (*Sensor, error) {
+	return newSensor(sensors.NewI2CRegisters(bus, byte(address)), address, settings...)
+}
+
+// NewSPISensor returns a Sensor object connected to the specified SPI bus,
+// configured like NewSensor.
+func NewSPISensor(bus sensors.SPIBus, settings ...SettingFunc) (*Sensor, error) {
+	return newSensor(sensors.NewBoschSPIRegisters(bus), 0, settings...)
+}
+
+func newSensor(regs sensors.Registers, address I2CAddress, settings ...SettingFunc) (*Sensor, error) {
 	bme := &Sensor{
-		i2CBus:     bus,
+		regs:       regs,
 		i2CAddress: byte(address),
+		t0:         time.Now(),
 	}
 
 	// Make sure we can connect to the chip and read a valid ChipID
@@ -44,6 +84,8 @@ func NewSensor(bus embd.I2CBus, address I2CAddress, settings ...SettingFunc) (*S
 
 	goflying.Debugf("bme280: chip ID: 0x%02X\n", chipID)
 
+	bme.chipID = chipID
+
 	cal, err := bme.CalibrationData()
 	if err != nil {
 		return nil, fmt.Errorf("bme280: %w", err)
@@ -131,18 +173,39 @@ func (bme *Sensor) Configure(settings ...SettingFunc) error {
 	return nil
 }
 
-// Start starts the polling goroutine and returns a stop function
-func (bme *Sensor) Start(ctx context.Context) (func(), error) {
+// Start starts the polling goroutine, which runs until ctx is done or Stop is
+// called
+func (bme *Sensor) Start(ctx context.Context) error {
 	measurementDuration, err := bme.MeasurementDuration(false)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	poolCtx, cancel := context.WithCancel(ctx)
+	return bme.poller.Start(ctx, func(ctx context.Context) {
+		bme.poll(ctx, measurementDuration)
+	})
+}
 
-	go bme.poll(poolCtx, measurementDuration)
+// Stop stops the polling goroutine and waits for it to put the chip to sleep
+func (bme *Sensor) Stop() error {
+	return bme.poller.Stop()
+}
+
+// Identity returns the chip name, I2C address and chip ID
+func (bme *Sensor) Identity() sensors.Identity {
+	return sensors.Identity{Name: "BME280", Kind: sensors.KindPressure, Address: bme.i2CAddress, ChipID: bme.chipID}
+}
+
+// Health reports how the polling is going
+func (bme *Sensor) Health() sensors.Health {
+	return bme.poller.Health()
+}
 
-	return cancel, nil
+// Subscribe returns a channel receiving every new measurement, buffering up to
+// bufSize of them, and a function to cancel the subscription. Humidity is only
+// available from Data.
+func (bme *Sensor) Subscribe(bufSize int) (<-chan *sensors.BMPData, func()) {
+	return bme.feed.Subscribe(bufSize)
 }
 
 // poll sets the chip to normal mode and read the new measurement values
@@ -170,17 +233,24 @@ func (bme *Sensor) poll(ctx context.Context, frequency time.Duration) {
 		case timestamp := <-ticker.C:
 			goflying.Debugln("bme280: reading measurement data")
 
-			if err := bme.i2CBus.ReadFromReg(bme.i2CAddress, RegisterPressDataMSB, rawData); err != nil {
+			err := bme.regs.ReadFromReg(RegisterPressDataMSB, rawData)
+			bme.poller.Read(timestamp, err)
+			if err != nil {
 				goflying.Logger.Printf("bme280: error reading sensor data: %w\n", err)
 				continue
 			}
 
 			bme.Data.Update(rawData, timestamp)
+			bme.feed.Publish(&sensors.BMPData{
+				Temperature: float64(bme.Data.Temperature()),
+				Pressure:    float64(bme.Data.Pressure()),
+				T:           timestamp.Sub(bme.t0),
+			})
 
 			goflying.Debugf("bme280: new measurement data: %s\n", bme.Data)
 
 		case <-ctx.Done():
-			break
+			return
 		}
 	}
 }
@@ -189,12 +259,12 @@ func (bme *Sensor) poll(ctx context.Context, frequency time.Duration) {
 // RegisterCalibrationData and RegisterHumCalibrationData
 func (bme *Sensor) CalibrationData() (*CalibrationData, error) {
 	calibrationData := make([]byte, CalibrationDataSize)
-	if err := bme.i2CBus.ReadFromReg(bme.i2CAddress, RegisterCalibrationData, calibrationData); err != nil {
+	if err := bme.regs.ReadFromReg(RegisterCalibrationData, calibrationData); err != nil {
 		return nil, fmt.Errorf("failed to read calibration data: %w", err)
 	}
 
 	humidityCalibrationData := make([]byte, CalibrationHumDataSize)
-	if err := bme.i2CBus.ReadFromReg(bme.i2CAddress, RegisterHumCalibrationData, humidityCalibrationData); err != nil {
+	if err := bme.regs.ReadFromReg(RegisterHumCalibrationData, humidityCalibrationData); err != nil {
 		return nil, fmt.Errorf("failed to read humidity calibration data: %w", err)
 	}
 
@@ -204,7 +274,7 @@ func (bme *Sensor) CalibrationData() (*CalibrationData, error) {
 // ChipID reads chip ID from register RegisterChipID. Expected value is 0x60 for
 // BME280
 func (bme *Sensor) ChipID() (byte, error) {
-	chipID, err := bme.i2CBus.ReadByteFromReg(bme.i2CAddress, RegisterChipID)
+	chipID, err := bme.regs.ReadByteFromReg(RegisterChipID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to read chip ID: %w", err)
 	}
@@ -216,7 +286,7 @@ func (bme *Sensor) ChipID() (byte, error) {
 // register contains the chip inactive duration and IIR filter coefficient
 // values
 func (bme *Sensor) Config() (Config, error) {
-	value, err := bme.i2CBus.ReadByteFromReg(bme.i2CAddress, RegisterConfig)
+	value, err := bme.regs.ReadByteFromReg(RegisterConfig)
 
 	if err != nil {
 		return 0, fmt.Errorf("failed to read from Config register")
@@ -228,7 +298,7 @@ func (bme *Sensor) Config() (Config, error) {
 // CtrlHum reads the ctrl_hum register byte from RegisterCtrlHum. The ctrl_hum
 // register contains the humidity oversampling value
 func (bme *Sensor) CtrlHum() (CtrlHum, error) {
-	value, err := bme.i2CBus.ReadByteFromReg(bme.i2CAddress, RegisterCtrlHum)
+	value, err := bme.regs.ReadByteFromReg(RegisterCtrlHum)
 
 	if err != nil {
 		return 0, fmt.Errorf("failed to read from Humidity Control register")
@@ -241,7 +311,7 @@ func (bme *Sensor) CtrlHum() (CtrlHum, error) {
 // ctrl_meas register contains the pressure and temperature oversampling, and
 // the chip mode values
 func (bme *Sensor) CtrlMeas() (CtrlMeas, error) {
-	value, err := bme.i2CBus.ReadByteFromReg(bme.i2CAddress, RegisterCtrlMeas)
+	value, err := bme.regs.ReadByteFromReg(RegisterCtrlMeas)
 
 	if err != nil {
 		return 0, fmt.Errorf("failed to read from Control register")
@@ -363,7 +433,7 @@ func (bme *Sensor) PressureOversampling() (PressureOversampling, error) {
 // Reset triggers a soft reset on the chip. This will also reset the config and
 // control registers.
 func (bme *Sensor) Reset() error {
-	if err := bme.i2CBus.WriteByteToReg(bme.i2CAddress, RegisterSoftReset, ResetCode); err != nil {
+	if err := bme.regs.WriteByteToReg(RegisterSoftReset, ResetCode); err != nil {
 		return fmt.Errorf("failed to reset sensor: %w", err)
 	}
 
@@ -386,7 +456,7 @@ func (bme *Sensor) TemperatureOversampling() (TemperatureOversampling, error) {
 
 // SetConfig sets the config register byte on the RegisterConfig register
 func (bme *Sensor) SetConfig(value Config) error {
-	if err := bme.i2CBus.WriteByteToReg(bme.i2CAddress, RegisterConfig, byte(value)); err != nil {
+	if err := bme.regs.WriteByteToReg(RegisterConfig, byte(value)); err != nil {
 		return fmt.Errorf("failed to write to Config register")
 	}
 
@@ -397,7 +467,7 @@ func (bme *Sensor) SetConfig(value Config) error {
 // Changes to this register only become effective after a write operation to
 // RegisterCtrlMeas.
 func (bme *Sensor) SetCtrlHum(value CtrlHum) error {
-	if err := bme.i2CBus.WriteByteToReg(bme.i2CAddress, RegisterCtrlHum, byte(value)); err != nil {
+	if err := bme.regs.WriteByteToReg(RegisterCtrlHum, byte(value)); err != nil {
 		return fmt.Errorf("failed to write to Humidity Control register")
 	}
 
@@ -406,7 +476,7 @@ func (bme *Sensor) SetCtrlHum(value CtrlHum) error {
 
 // SetCtrlMeas sets the ctrl_meas register byte on the RegisterCtrlMeas register
 func (bme *Sensor) SetCtrlMeas(value CtrlMeas) error {
-	if err := bme.i2CBus.WriteByteToReg(bme.i2CAddress, RegisterCtrlMeas, byte(value)); err != nil {
+	if err := bme.regs.WriteByteToReg(RegisterCtrlMeas, byte(value)); err != nil {
 		return fmt.Errorf("failed to write to Control register")
 	}
 
@@ -2,27 +2,42 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"time"
 
-	"github.com/kidoman/embd"
-
 	"github.com/westphae/goflying"
+	"github.com/westphae/goflying/i2cdev"
 	"github.com/westphae/goflying/sensors/bme280"
 )
 
 func main() {
+	capture := flag.String("capture", "", "record the I2C transactions to this file")
+	flag.Parse()
+
 	ctx, stop := context.WithCancel(context.Background())
 	defer stop()
 
-	i2cbus := &goflying.I2CBus{I2CBus: embd.NewI2CBus(1)}
+	if *capture != "" {
+		if err := goflying.StartI2CCapture(*capture); err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer goflying.StopI2CCapture()
+	}
 
-	var bmes []*bme280.Sensor
+	bus, err := i2cdev.Open(1)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	i2cbus := &goflying.I2CBus{I2CBus: bus}
+	defer i2cbus.Close()
 
-	var stopFuncs []func()
+	var bmes []*bme280.Sensor
 	defer func() {
-		for _, f := range stopFuncs {
-			f()
+		for _, bme := range bmes {
+			bme.Stop()
 		}
 	}()
 
@@ -40,15 +55,12 @@ func main() {
 			continue
 		}
 
-		bmes = append(bmes, bme)
-
-		stopFunc, err := bme.Start(ctx)
-		if err != nil {
+		if err := bme.Start(ctx); err != nil {
 			fmt.Printf("error starting sensor polling: %s", err)
 			continue
 		}
 
-		stopFuncs = append(stopFuncs, stopFunc)
+		bmes = append(bmes, bme)
 	}
 
 	if len(bmes) == 0 {
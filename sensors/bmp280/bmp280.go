@@ -6,14 +6,12 @@ Reference 2: https://forums.adafruit.com/viewtopic.php?f=19&t=89049
 package bmp280
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math"
 	"time"
 
-	"github.com/kidoman/embd"
-	_ "github.com/kidoman/embd/host/all"
-	_ "github.com/kidoman/embd/host/rpi"
 	"github.com/westphae/goflying/sensors"
 )
 
@@ -24,7 +22,7 @@ const (
 )
 
 type BMP280 struct {
-	i2cbus *embd.I2CBus
+	i2cbus sensors.I2CBus
 
 	Address byte
 	ChipID  byte
@@ -40,9 +38,28 @@ type BMP280 struct {
 
 	T_fine int32
 
-	C      <-chan *sensors.BMPData
-	CBuf   <-chan *sensors.BMPData
-	cClose chan bool
+	C       <-chan *sensors.BMPData
+	CBuf    <-chan *sensors.BMPData
+	c, cBuf chan *sensors.BMPData // Sending ends of C and CBuf, which outlive restarts
+	poller  sensors.Poller        // Runs readSensor and tracks its health
+	feed    sensors.Feed[*sensors.BMPData]
+}
+
+var _ sensors.Barometer = (*BMP280)(nil)
+
+func init() {
+	sensors.RegisterDriver("BMP280", sensors.Signature{
+		Kind:      sensors.KindPressure,
+		Addresses: []byte{Address1, Address2},
+		Register:  RegisterChipID,
+		IDs:       []byte{ChipID1, ChipID2, ChipID3},
+	}, func(d sensors.Descriptor) (sensors.Device, error) {
+		bmp, err := NewBMP280(d.Bus, d.Address, NormalMode, StandbyTime63ms, FilterCoeff16, Oversamp1x, Oversamp1x)
+		if err != nil {
+			return nil, err
+		}
+		return bmp, nil
+	})
 }
 
 /*
@@ -55,8 +72,10 @@ tempRes is one of bmp280.OversampX (up to 16x).
 presRes is one of bmp280.XMode (low power mode, etc).
 See BMP280 datasheet for details.
 */
-func NewBMP280(i2cbus *embd.I2CBus, address, powerMode, standby, filter, tempRes, presRes byte) (bmp *BMP280, err error) {
+func NewBMP280(i2cbus sensors.I2CBus, address, powerMode, standby, filter, tempRes, presRes byte) (bmp *BMP280, err error) {
 	bmp = new(BMP280)
+	bmp.c, bmp.cBuf = make(chan *sensors.BMPData), make(chan *sensors.BMPData, BufSize)
+	bmp.C, bmp.CBuf = bmp.c, bmp.cBuf
 	bmp.i2cbus = i2cbus
 	bmp.Address = address
 
@@ -75,27 +94,64 @@ func NewBMP280(i2cbus *embd.I2CBus, address, powerMode, standby, filter, tempRes
 	bmp.config = (standby << 5) + (filter << 2)               // combine bits for config
 	bmp.control = (tempRes << 5) + (presRes << 2) + powerMode // combine bits for control
 
-	bmp.i2cWrite(RegisterSoftReset, SoftResetCode) // reset sensor
+	if err = bmp.i2cWrite(RegisterSoftReset, SoftResetCode); err != nil { // reset sensor
+		return nil, err
+	}
 
-	bmp.i2cWrite(RegisterControl, bmp.control)
-	bmp.i2cWrite(RegisterConfig, bmp.config)
+	if err = bmp.i2cWrite(RegisterControl, bmp.control); err != nil {
+		return nil, err
+	}
+	if err = bmp.i2cWrite(RegisterConfig, bmp.config); err != nil {
+		return nil, err
+	}
 
 	bmp.DigT = make(map[int]int32)
 	bmp.DigP = make(map[int]int64)
-	bmp.ReadCorrectionSettings()
+	if err = bmp.ReadCorrectionSettings(); err != nil {
+		return nil, err
+	}
 
 	bmp.t = time.Now()
 	bmp.setDelay()
 
-	go bmp.readSensor()
+	if err = bmp.Start(context.Background()); err != nil {
+		return nil, err
+	}
 
 	return
 }
 
-// Close closes the BMP280
+// Close stops polling and puts the BMP280 to sleep.
 func (bmp *BMP280) Close() {
+	bmp.Stop()
 	bmp.SetPowerMode(SleepMode)
-	bmp.cClose <- true
+}
+
+// Identity returns the chip name, I2C address and ChipID.
+func (bmp *BMP280) Identity() sensors.Identity {
+	return sensors.Identity{Name: "BMP280", Kind: sensors.KindPressure, Address: bmp.Address, ChipID: bmp.ChipID}
+}
+
+// Start polls the BMP280 in a goroutine until ctx is done or Stop is called.
+// NewBMP280 already starts it, so this is only needed to restart it after Stop or Close.
+func (bmp *BMP280) Start(ctx context.Context) error {
+	return bmp.poller.Start(ctx, bmp.readSensor)
+}
+
+// Stop stops polling the BMP280 and waits for it to finish, leaving the chip in its current power mode.
+func (bmp *BMP280) Stop() error {
+	return bmp.poller.Stop()
+}
+
+// Health reports how the BMP280 polling is going.
+func (bmp *BMP280) Health() sensors.Health {
+	return bmp.poller.Health()
+}
+
+// Subscribe returns a channel receiving every new reading, buffering up to bufSize of them,
+// and a function to cancel the subscription.
+func (bmp *BMP280) Subscribe(bufSize int) (<-chan *sensors.BMPData, func()) {
+	return bmp.feed.Subscribe(bufSize)
 }
 
 func (bmp *BMP280) setDelay() {
@@ -139,7 +195,7 @@ func (bmp *BMP280) ReadCorrectionSettings() (err error) {
 	return
 }
 
-func (bmp *BMP280) readSensor() {
+func (bmp *BMP280) readSensor(ctx context.Context) {
 	var (
 		raw_temp    int32
 		raw_press   int64
@@ -149,14 +205,7 @@ func (bmp *BMP280) readSensor() {
 
 	raw := make([]byte, 6)
 
-	cC := make(chan *sensors.BMPData)
-	defer close(cC)
-	bmp.C = cC
-	cBuf := make(chan *sensors.BMPData, BufSize)
-	defer close(cBuf)
-	bmp.CBuf = cBuf
-	bmp.cClose = make(chan bool)
-	defer close(bmp.cClose)
+	cC, cBuf := bmp.c, bmp.cBuf
 
 	clock := time.NewTicker(bmp.Delay)
 	//TODO westphae: use the clock to record actual time instead of a timer
@@ -172,6 +221,11 @@ func (bmp *BMP280) readSensor() {
 		return &d
 	}
 
+	// Restore the power mode in case Close put the chip to sleep
+	if err = bmp.i2cWrite(RegisterControl, bmp.control); err != nil {
+		log.Printf("bmp280 warning: error setting power mode: %s", err)
+	}
+
 	// Throw away initial value
 	if err = bmp.i2cReadBytes(RegisterPressDataMSB, raw); err != nil {
 		log.Printf("bmp280 warning: error reading sensor data: %s", err)
@@ -181,6 +235,7 @@ func (bmp *BMP280) readSensor() {
 		select {
 		case t = <-clock.C: // Read sensor data:
 			err = bmp.i2cReadBytes(RegisterPressDataMSB, raw)
+			bmp.poller.Read(t, err)
 			if err != nil {
 				log.Printf("bmp280 warning: error reading sensor data: %s", err)
 				continue
@@ -192,10 +247,11 @@ func (bmp *BMP280) readSensor() {
 
 			temp = bmp.CalcCompensatedTemp(raw_temp)
 			press = bmp.CalcCompensatedPress(raw_press)
+			bmp.feed.Publish(makeBMPData())
 		case cC <- makeBMPData(): // Send the latest values
 		case cBuf <- makeBMPData():
-		case <-bmp.cClose: // Stop the goroutine, ease up on the CPU
-			break
+		case <-ctx.Done(): // Stop the goroutine, ease up on the CPU
+			return
 		}
 	}
 }
@@ -448,8 +504,8 @@ func (bmp *BMP280) SetStandbyTime(standbyTime byte) error {
 }
 
 func (bmp *BMP280) i2cWrite(register, value byte) (err error) {
-	if errWrite := (*bmp.i2cbus).WriteByteToReg(bmp.Address, register, value); errWrite != nil {
-		err = fmt.Errorf("bmp280 error writing %X to %X: %s\n",
+	if errWrite := bmp.i2cbus.WriteByteToReg(bmp.Address, register, value); errWrite != nil {
+		err = fmt.Errorf("bmp280 error writing %X to %X: %s",
 			value, register, errWrite)
 	}
 	time.Sleep(ExtraReadDelay)
@@ -457,7 +513,7 @@ func (bmp *BMP280) i2cWrite(register, value byte) (err error) {
 }
 
 func (bmp *BMP280) i2cReadBytes(register byte, value []byte) (err error) {
-	if errRead := (*bmp.i2cbus).ReadFromReg(bmp.Address, register, value); errRead != nil {
+	if errRead := bmp.i2cbus.ReadFromReg(bmp.Address, register, value); errRead != nil {
 		err = fmt.Errorf("bmp280 error reading from %X: %s", register, errRead)
 	}
 	return err
@@ -0,0 +1,78 @@
+package bmp280
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/westphae/goflying/i2ctest"
+	"github.com/westphae/goflying/sensors"
+)
+
+func newTestBMP280(t *testing.T) (*BMP280, *i2ctest.BMP280) {
+	b := i2ctest.NewBus()
+	chip := i2ctest.NewBMP280(ChipID3)
+	chip.SetRaw(338837, 526634)
+	b.Attach(Address2, chip)
+
+	bmp, err := NewBMP280(b, Address2, NormalMode, StandbyTime1ms, FilterCoeffOff, Oversamp1x, Oversamp1x)
+	if err != nil {
+		t.Fatalf("NewBMP280() error = %v", err)
+	}
+	return bmp, chip
+}
+
+func TestNewBMP280(t *testing.T) {
+	bmp, chip := newTestBMP280(t)
+	defer bmp.Close()
+
+	if bmp.DigT[1] != 28398 || bmp.DigT[2] != 26826 || bmp.DigP[1] != 37448 || bmp.DigP[9] != 4285 {
+		t.Errorf("calibration DigT = %v, DigP = %v", bmp.DigT, bmp.DigP)
+	}
+	if ctrl := chip.Get(RegisterControl, 1)[0]; ctrl != Oversamp1x<<5|Oversamp1x<<2|NormalMode {
+		t.Errorf("control register = %X", ctrl)
+	}
+	if id := bmp.Identity(); id.Name != "BMP280" || id.Address != Address2 || id.ChipID != ChipID3 {
+		t.Errorf("Identity() = %s", id)
+	}
+
+	c, cancel := bmp.Subscribe(1)
+	defer cancel()
+	d := <-c
+	if math.Abs(d.Temperature-23.11) > 0.01 || math.Abs(d.Pressure-1006.4693) > 0.01 {
+		t.Errorf("reading = %.2f°C, %.4fhPa, want 23.11°C, 1006.4693hPa", d.Temperature, d.Pressure)
+	}
+	if h := bmp.Health(); h.Status != sensors.StatusRunning || h.Reads == 0 {
+		t.Errorf("Health() = %+v", h)
+	}
+}
+
+func TestBMP280Close(t *testing.T) {
+	bmp, chip := newTestBMP280(t)
+	bmp.Close()
+	if mode, _ := bmp.GetPowerMode(); mode != SleepMode {
+		t.Errorf("power mode after Close() = %X, want sleep", mode)
+	}
+
+	if err := bmp.Start(context.Background()); err != nil {
+		t.Fatalf("Start() after Close() error = %v", err)
+	}
+	defer bmp.Close()
+	c, cancel := bmp.Subscribe(1)
+	defer cancel()
+	<-c
+	if ctrl := chip.Get(RegisterControl, 1)[0]; ctrl&0x03 != NormalMode {
+		t.Errorf("power mode after restart = %X, want normal", ctrl&0x03)
+	}
+}
+
+func TestNewBMP280Errors(t *testing.T) {
+	b := i2ctest.NewBus()
+	b.Attach(Address1, i2ctest.NewBME280())
+
+	for _, addr := range []byte{Address1, Address2} {
+		if _, err := NewBMP280(b, addr, NormalMode, StandbyTime1ms, FilterCoeffOff, Oversamp1x, Oversamp1x); err == nil {
+			t.Errorf("NewBMP280() at %X succeeded", addr)
+		}
+	}
+}
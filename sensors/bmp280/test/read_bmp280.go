@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/kidoman/embd"
+	"github.com/westphae/goflying/i2cdev"
 
 	"github.com/westphae/goflying/sensors"
 	"github.com/westphae/goflying/sensors/bmp280"
@@ -13,11 +13,16 @@ import (
 func main() {
 	var cur, last *sensors.BMPData
 
-	i2cbus := embd.NewI2CBus(1)
+	bus, err := i2cdev.Open(1)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bus.Close()
 
 	var bmps []*bmp280.BMP280
 	for i, address := range []byte{bmp280.Address1, bmp280.Address2} {
-		bmp, err := bmp280.NewBMP280(&i2cbus, address,
+		bmp, err := bmp280.NewBMP280(bus, address,
 			bmp280.NormalMode, bmp280.StandbyTime63ms, bmp280.FilterCoeff16, bmp280.Oversamp1x, bmp280.Oversamp1x)
 		if err != nil {
 			fmt.Printf("no BMP280 at address %d: %s\n", i, err)
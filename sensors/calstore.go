@@ -0,0 +1,217 @@
+package sensors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// DefaultCalPath is where IMU calibration data is kept, unless the GOFLYING_IMU_CAL environment variable
+	// names another file.
+	DefaultCalPath = "/etc/imu_cal.json"
+
+	// CalVersion is the schema version of the calibration files written by a CalStore.
+	// Version 1 files, from before there was a CalStore, hold a bare IMUCalData.
+	CalVersion = 2
+)
+
+var (
+	ErrNoCal      = errors.New("sensors: no calibration data stored")
+	ErrCalVersion = errors.New("sensors: calibration file has an unsupported version")
+)
+
+// DefaultCalStore is the store the IMU drivers load their calibration data from.
+var DefaultCalStore = NewCalStore(defaultCalPath())
+
+func defaultCalPath() string {
+	if path := os.Getenv("GOFLYING_IMU_CAL"); path != "" {
+		return path
+	}
+	return DefaultCalPath
+}
+
+// calFile is the schema of version 2 calibration files.
+type calFile struct {
+	Version int                   `json:"version"`
+	Default *IMUCalData           `json:"default,omitempty"` // For devices without their own record
+	Devices map[string]IMUCalData `json:"devices"`
+}
+
+/*
+CalStore keeps calibration data in a JSON file, with a record for each device, since one box can hold
+several IMUs.  A device is keyed by the CalKey of its Identity: its serial number if it has one, or else
+its chip type and address.
+A version 1 file, holding the calibration of whichever IMU was in use, is migrated to the default record.
+The first device to load without a record of its own takes the default record over as its own, so that
+no other device, whose chip may have other full-scale settings, loads it too.  The empty key is the default record.
+Saves write a new file and rename it over the old one, so the file is never left half-written.
+*/
+type CalStore struct {
+	Path string
+
+	mu sync.Mutex // Serializes the read-modify-write of Save
+}
+
+// NewCalStore returns a store kept in the file at path.
+func NewCalStore(path string) *CalStore {
+	return &CalStore{Path: path}
+}
+
+/*
+Load returns the calibration data of the device with the given key, or ErrNoCal if there is none.
+A device without a record of its own gets the default record, if there is one, which is moved under its key.
+*/
+func (s *CalStore) Load(key string) (IMUCalData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := s.read()
+	if err != nil {
+		return IMUCalData{}, err
+	}
+	if cal, ok := f.Devices[key]; ok {
+		return cal, nil
+	}
+	if f.Default == nil {
+		return IMUCalData{}, fmt.Errorf("%w for %s in %s", ErrNoCal, key, s.Path)
+	}
+	cal := *f.Default
+	if key != "" {
+		f.Devices[key], f.Default = cal, nil
+		if err := s.write(f); err != nil {
+			return IMUCalData{}, fmt.Errorf("sensors: moving the default calibration to %s: %w", key, err)
+		}
+	}
+	return cal, nil
+}
+
+// Save stores the calibration data of the device with the given key, keeping those of the others.
+func (s *CalStore) Save(key string, cal IMUCalData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := s.read()
+	if errors.Is(err, ErrNoCal) {
+		f, err = &calFile{Devices: make(map[string]IMUCalData)}, nil
+	}
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		f.Default = &cal
+	} else {
+		f.Devices[key] = cal
+	}
+	return s.write(f)
+}
+
+// write replaces the calibration file with f.
+func (s *CalStore) write(f *calFile) error {
+	f.Version = CalVersion
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("sensors: encoding calibration data: %w", err)
+	}
+	if err := writeFileAtomic(s.Path, data); err != nil {
+		return fmt.Errorf("sensors: saving calibration data: %w", err)
+	}
+	return nil
+}
+
+/*
+Save stores d as the default record of DefaultCalStore, which the first IMU to load without a record of
+its own takes over, logging any error.
+
+Deprecated: Save the calibration of a device with DefaultCalStore.Save, keyed by its Identity's CalKey.
+*/
+func (d *IMUCalData) Save() {
+	if err := DefaultCalStore.Save("", *d); err != nil {
+		log.Println(err)
+	}
+}
+
+/*
+Load sets d to the default record of DefaultCalStore.
+
+Deprecated: Load the calibration of a device with DefaultCalStore.Load, keyed by its Identity's CalKey.
+*/
+func (d *IMUCalData) Load() error {
+	cal, err := DefaultCalStore.Load("")
+	if err != nil {
+		return err
+	}
+	*d = cal
+	return nil
+}
+
+// read reads and migrates the calibration file.  A missing file is ErrNoCal.
+func (s *CalStore) read() (*calFile, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s doesn't exist", ErrNoCal, s.Path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sensors: reading calibration data: %w", err)
+	}
+
+	var version struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &version); err != nil {
+		return nil, fmt.Errorf("sensors: decoding calibration data from %s: %w", s.Path, err)
+	}
+
+	f := new(calFile)
+	switch version.Version {
+	case 0: // Version 1 files have no version field
+		var cal IMUCalData
+		err = json.Unmarshal(data, &cal)
+		f.Default = &cal
+	case CalVersion:
+		err = json.Unmarshal(data, f)
+	default:
+		return nil, fmt.Errorf("%w: %s is version %d", ErrCalVersion, s.Path, version.Version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sensors: decoding calibration data from %s: %w", s.Path, err)
+	}
+	f.Version = CalVersion
+	if f.Devices == nil {
+		f.Devices = make(map[string]IMUCalData)
+	}
+	return f, nil
+}
+
+// writeFileAtomic replaces the file at path with data, by writing a temporary file in the same directory
+// and renaming it.
+func writeFileAtomic(path string, data []byte) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
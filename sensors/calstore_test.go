@@ -0,0 +1,122 @@
+package sensors
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCalStore(t *testing.T) {
+	dir := t.TempDir()
+	s := NewCalStore(filepath.Join(dir, "imu_cal.json"))
+
+	if _, err := s.Load("MPU9250"); !errors.Is(err, ErrNoCal) {
+		t.Errorf("Load() from a missing file error = %v, want ErrNoCal", err)
+	}
+
+	mpu := IMUCalData{A01: 1, G01: 2}
+	mpu.AccelCal.S[0][0] = 1.01
+	icm := IMUCalData{A01: 3}
+	if err := s.Save("MPU9250", mpu); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := s.Save("ICM20948", icm); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if cal, err := s.Load("MPU9250"); err != nil || cal.A01 != 1 || cal.G01 != 2 || cal.AccelCal.S[0][0] != 1.01 {
+		t.Errorf("Load(MPU9250) = %+v, %v", cal, err)
+	}
+	if cal, err := s.Load("ICM20948"); err != nil || cal.A01 != 3 {
+		t.Errorf("Load(ICM20948) = %+v, %v", cal, err)
+	}
+	if _, err := s.Load("BNO055"); !errors.Is(err, ErrNoCal) {
+		t.Errorf("Load() of an unknown device error = %v, want ErrNoCal", err)
+	}
+
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("directory holds %d files after saving, want 1", len(files))
+	}
+}
+
+func TestCalStoreMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "imu_cal.json")
+	s := NewCalStore(path)
+
+	// Version 1 files hold a bare IMUCalData
+	data, _ := json.Marshal(IMUCalData{A01: 5, Ms11: 1})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cal, err := s.Load("MPU9250"); err != nil || cal.A01 != 5 || cal.Ms11 != 1 {
+		t.Errorf("Load() from a version 1 file = %+v, %v", cal, err)
+	}
+
+	if err := s.Save("ICM20948", IMUCalData{A01: 6}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if cal, err := s.Load("MPU9250"); err != nil || cal.A01 != 5 {
+		t.Errorf("Load() of the migrated calibration = %+v, %v", cal, err)
+	}
+	// The migrated calibration belongs to the device that loaded it first
+	if _, err := s.Load("BNO055"); !errors.Is(err, ErrNoCal) {
+		t.Errorf("Load() of another device after migration error = %v, want ErrNoCal", err)
+	}
+	var f calFile
+	data, _ = os.ReadFile(path)
+	if err := json.Unmarshal(data, &f); err != nil || f.Version != CalVersion || f.Default != nil ||
+		f.Devices["MPU9250"].A01 != 5 {
+		t.Errorf("saved file = %s, %v", data, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"version": 99}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load("MPU9250"); !errors.Is(err, ErrCalVersion) {
+		t.Errorf("Load() from a version 99 file error = %v, want ErrCalVersion", err)
+	}
+	if err := s.Save("MPU9250", IMUCalData{}); !errors.Is(err, ErrCalVersion) {
+		t.Errorf("Save() over a version 99 file error = %v, want ErrCalVersion", err)
+	}
+}
+
+func TestCalStoreDefault(t *testing.T) {
+	s := DefaultCalStore
+	t.Cleanup(func() { DefaultCalStore = s })
+	DefaultCalStore = NewCalStore(filepath.Join(t.TempDir(), "imu_cal.json"))
+
+	var cal IMUCalData
+	if err := cal.Load(); !errors.Is(err, ErrNoCal) {
+		t.Errorf("Load() from a missing file error = %v, want ErrNoCal", err)
+	}
+
+	mpu := Identity{Name: "MPU9250", Address: 0x68}
+	if err := DefaultCalStore.Save(mpu.CalKey(), IMUCalData{A01: 1}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	(&IMUCalData{A01: 2}).Save()
+	if err := cal.Load(); err != nil || cal.A01 != 2 {
+		t.Errorf("Load() = %+v, %v, want the default record", cal, err)
+	}
+	if cal, err := DefaultCalStore.Load(mpu.CalKey()); err != nil || cal.A01 != 1 {
+		t.Errorf("Load(%s) = %+v, %v", mpu.CalKey(), cal, err)
+	}
+	// An ICM20948 without a record of its own takes the default record over, leaving none for others
+	icm := Identity{Name: "ICM20948", Address: 0x69}
+	if cal, err := DefaultCalStore.Load(icm.CalKey()); err != nil || cal.A01 != 2 {
+		t.Errorf("Load(%s) = %+v, %v, want the default record", icm.CalKey(), cal, err)
+	}
+	mpu.Address = 0x69
+	if cal, err := DefaultCalStore.Load(mpu.CalKey()); !errors.Is(err, ErrNoCal) {
+		t.Errorf("Load(%s) = %+v, %v, want ErrNoCal", mpu.CalKey(), cal, err)
+	}
+	if cal, err := DefaultCalStore.Load(icm.CalKey()); err != nil || cal.A01 != 2 {
+		t.Errorf("Load(%s) again = %+v, %v", icm.CalKey(), cal, err)
+	}
+	mpu.Serial = "A1B2"
+	if k := mpu.CalKey(); k != "A1B2" {
+		t.Errorf("CalKey() = %s, want the serial number", k)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+calibrate_accel walks through a six-position calibration of the accelerometer of the first IMU found on an
+I2C bus, prompting for each orientation, and saves the offset, scale and misalignment it finds with the rest
+of the IMU calibration data in sensors.DefaultCalStore.
+*/
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/westphae/goflying"
+	"github.com/westphae/goflying/i2cdev"
+	"github.com/westphae/goflying/sensors"
+	_ "github.com/westphae/goflying/sensors/icm20948" // Registers the ICM20948 driver
+	_ "github.com/westphae/goflying/sensors/mpu9250"  // Registers the MPU9250 driver
+)
+
+var instructions = map[sensors.AccelFace]string{
+	sensors.FaceZUp:   "Place the IMU flat, right way up.",
+	sensors.FaceZDown: "Turn the IMU upside down.",
+	sensors.FaceXUp:   "Stand the IMU on its edge with the X axis pointing up.",
+	sensors.FaceXDown: "Stand the IMU on its edge with the X axis pointing down.",
+	sensors.FaceYUp:   "Stand the IMU on its edge with the Y axis pointing up.",
+	sensors.FaceYDown: "Stand the IMU on its edge with the Y axis pointing down.",
+}
+
+func main() {
+	busNum := flag.Int("bus", 1, "I2C bus number, /dev/i2c-N")
+	samples := flag.Int("n", 250, "readings averaged in each orientation")
+	dryRun := flag.Bool("dry-run", false, "print the calibration without saving it")
+	capture := flag.String("capture", "", "record the I2C transactions to this file")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *capture != "" {
+		if err := goflying.StartI2CCapture(*capture); err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer goflying.StopI2CCapture()
+	}
+
+	bus, err := i2cdev.Open(*busNum)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	i2cbus := &goflying.I2CBus{I2CBus: bus}
+	defer i2cbus.Close()
+
+	imu, cal, id, err := sensors.OpenFirstIMU(i2cbus)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Calibrating %s\n", id)
+	defer imu.Stop()
+
+	// Collect readings without the previous calibration
+	imu.Stop()
+	cal.AccelCal = sensors.AccelCal{}
+	if err := imu.Start(ctx); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	prompt := func(face sensors.AccelFace, retry error) error {
+		switch {
+		case errors.Is(retry, sensors.ErrCalMoving):
+			fmt.Println("The IMU moved, try again and keep it still.")
+		case errors.Is(retry, sensors.ErrCalFace):
+			fmt.Printf("The IMU isn't %s, try again.\n", face)
+		}
+		fmt.Printf("%s (%s)  Press Enter when it is still.", instructions[face], face)
+		_, err := stdin.ReadString('\n')
+		return err
+	}
+
+	accelCal, err := sensors.CalibrateAccel(ctx, imu, *samples, prompt)
+	if err != nil {
+		fmt.Printf("\ncalibration failed: %s\n", err)
+		return
+	}
+	fmt.Printf("Offset (G): %.4f\n", accelCal.B)
+	fmt.Println("Scale and misalignment:")
+	for _, row := range accelCal.S {
+		fmt.Printf("  %.4f\n", row)
+	}
+
+	imu.Stop()
+	cal.AccelCal = accelCal
+	if *dryRun {
+		return
+	}
+	if err := sensors.DefaultCalStore.Save(id.CalKey(), *cal); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Saved to %s\n", sensors.DefaultCalStore.Path)
+}
@@ -0,0 +1,107 @@
+/*
+calibrate_mag fits an ellipsoid to magnetometer readings of the first IMU found on an I2C bus while it is
+turned through every orientation, and saves the hard-iron offset and soft-iron matrix it finds with the rest
+of the IMU calibration data in sensors.DefaultCalStore.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/westphae/goflying"
+	"github.com/westphae/goflying/i2cdev"
+	magkal "github.com/westphae/goflying/magnetometer"
+	"github.com/westphae/goflying/sensors"
+	_ "github.com/westphae/goflying/sensors/icm20948" // Registers the ICM20948 driver
+	_ "github.com/westphae/goflying/sensors/mpu9250"  // Registers the MPU9250 driver
+)
+
+func main() {
+	busNum := flag.Int("bus", 1, "I2C bus number, /dev/i2c-N")
+	samples := flag.Int("n", 1000, "magnetometer readings to fit")
+	dryRun := flag.Bool("dry-run", false, "print the calibration without saving it")
+	capture := flag.String("capture", "", "record the I2C transactions to this file")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *capture != "" {
+		if err := goflying.StartI2CCapture(*capture); err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer goflying.StopI2CCapture()
+	}
+
+	bus, err := i2cdev.Open(*busNum)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	i2cbus := &goflying.I2CBus{I2CBus: bus}
+	defer i2cbus.Close()
+
+	imu, cal, id, err := sensors.OpenFirstIMU(i2cbus)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Calibrating %s\n", id)
+	defer imu.Stop()
+
+	fmt.Println("Slowly turn the IMU through every heading while upright, inverted and on each side.")
+	c, cancel := imu.Subscribe(*samples)
+	defer cancel()
+	m := make([][3]float64, 0, *samples)
+	var tm time.Time
+	for len(m) < *samples {
+		var d *sensors.IMUData
+		select {
+		case d = <-c:
+		case <-ctx.Done():
+			fmt.Printf("\ncalibration failed: %s\n", ctx.Err())
+			return
+		}
+		if d.MagError != nil || d.TM.Equal(tm) { // Skip repeats of the last magnetometer reading
+			continue
+		}
+		tm = d.TM
+		m = append(m, [3]float64{d.M1, d.M2, d.M3})
+		if len(m)%100 == 0 {
+			fmt.Printf("\r%d/%d readings", len(m), *samples)
+		}
+	}
+	fmt.Println()
+
+	e, err := magkal.FitEllipsoid(m)
+	if err != nil {
+		fmt.Printf("calibration failed: %s\n", err)
+		return
+	}
+	fmt.Printf("Hard-iron offset: %.3f\n", e.Center)
+	fmt.Println("Soft-iron matrix:")
+	for _, row := range e.Soft {
+		fmt.Printf("  %.4f\n", row)
+	}
+	fmt.Printf("Field magnitude: %.3f\n", e.Radius)
+
+	imu.Stop()
+	if err := e.Apply(cal); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if *dryRun {
+		return
+	}
+	if err := sensors.DefaultCalStore.Save(id.CalKey(), *cal); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Saved to %s\n", sensors.DefaultCalStore.Path)
+}
@@ -1,14 +1,6 @@
 package sensors
 
-import (
-	"encoding/json"
-	"fmt"
-	"log"
-	"os"
-	"time"
-)
-
-const calDataLocation = "/etc/imu_cal.json"
+import "time"
 
 type PressureSensor struct {
 	C    <-chan *BMPData
@@ -44,8 +36,17 @@ type IMUCalData struct {
 	G01, G02, G03    float64 // Gyro hardware bias
 	M01, M02, M03    float64 // Magnetometer hardware bias
 	Ms11, Ms12, Ms13 float64 // Magnetometer rescaling matrix
-	Ms21, Ms22, Ms23 float64 // (Only diagonal is used currently)
+	Ms21, Ms22, Ms23 float64 // (Full soft-iron correction, from magkal.FitEllipsoid)
 	Ms31, Ms32, Ms33 float64
+	GyroTemp         TempBias // Gyro bias drift with die temperature, °/s
+	AccelTemp        TempBias // Accelerometer bias drift with die temperature, G
+	AccelCal         AccelCal // Accelerometer offset, scale and misalignment, from CalibrateAccel
+}
+
+// CalData returns d, so that the calibration data of a driver embedding IMUCalData can be reached
+// through an interface.
+func (d *IMUCalData) CalData() *IMUCalData {
+	return d
 }
 
 func (d *IMUCalData) Reset() {
@@ -53,40 +54,3 @@ func (d *IMUCalData) Reset() {
 	d.Ms22 = 1
 	d.Ms33 = 1
 }
-
-func (d *IMUCalData) Save() {
-	fd, err := os.OpenFile(calDataLocation, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(0644))
-	if err != nil {
-		log.Printf("error saving imu calibration data to %s: %s", calDataLocation, err.Error())
-		return
-	}
-	defer fd.Close()
-	calData, err := json.Marshal(d)
-	if err != nil {
-		log.Printf("error marshaling imu calibration data: %s", err)
-		return
-	}
-	fd.Write(calData)
-}
-
-func (d *IMUCalData) Load() (err error) {
-	errstr := "error reading imu calibration data from %s: %s"
-	fd, rerr := os.Open(calDataLocation)
-	if rerr != nil {
-		err = fmt.Errorf(errstr, calDataLocation, rerr.Error())
-		return
-	}
-	defer fd.Close()
-	buf := make([]byte, 1024)
-	count, rerr := fd.Read(buf)
-	if rerr != nil {
-		err = fmt.Errorf(errstr, calDataLocation, rerr.Error())
-		return
-	}
-	rerr = json.Unmarshal(buf[0:count], d)
-	if rerr != nil {
-		err = fmt.Errorf(errstr, calDataLocation, rerr.Error())
-		return
-	}
-	return
-}
@@ -0,0 +1,253 @@
+package sensors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRunning    = errors.New("sensors: already running")
+	ErrNotRunning = errors.New("sensors: not running")
+)
+
+// Kind tells what a sensor measures.
+type Kind int
+
+const (
+	KindIMU      Kind = iota // Gyro, accelerometer and possibly magnetometer
+	KindPressure             // Barometric pressure and temperature
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindIMU:
+		return "IMU"
+	case KindPressure:
+		return "pressure"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// Identity describes a sensor chip on a bus.
+type Identity struct {
+	Name    string // Chip name, e.g. "MPU9250" or "BMP280"
+	Kind    Kind
+	Address byte   // I2C address
+	ChipID  byte   // Value read from the chip's WHO_AM_I or ChipID register
+	Serial  string // Serial number, if the chip has one
+}
+
+func (id Identity) String() string {
+	return fmt.Sprintf("%s (%s) at 0x%02X, chip ID 0x%02X", id.Name, id.Kind, id.Address, id.ChipID)
+}
+
+// CalKey returns the key of the chip's record in a CalStore: its serial number if it has one,
+// or else its name and address, so that two chips of the same type on one bus are kept apart.
+func (id Identity) CalKey() string {
+	if id.Serial != "" {
+		return id.Serial
+	}
+	return fmt.Sprintf("%s@0x%02X", id.Name, id.Address)
+}
+
+// Status is the state of a sensor's polling.
+type Status int
+
+const (
+	StatusStopped Status = iota // Not polling
+	StatusRunning               // Polling, and the last read succeeded
+	StatusFailing               // Polling, but the last read failed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusStopped:
+		return "stopped"
+	case StatusRunning:
+		return "running"
+	case StatusFailing:
+		return "failing"
+	default:
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+}
+
+// Health summarizes how a sensor's polling is going.
+type Health struct {
+	Status    Status
+	Reads     uint64    // Number of successful reads since the driver was created
+	Errors    uint64    // Number of failed reads since the driver was created
+	LastRead  time.Time // Time of the last successful read
+	LastError error     // Error from the last failed read, if any
+}
+
+/*
+Device is implemented by all sensor drivers, so that an application can manage IMUs and barometers alike.
+Start begins polling the chip in a goroutine until ctx is done or Stop is called.
+A stopped Device can be started again.
+*/
+type Device interface {
+	Identity() Identity
+	Start(ctx context.Context) error
+	Stop() error
+	Health() Health
+}
+
+// IMU is a Device producing IMUData.
+// Subscribe returns a channel receiving each new reading and a function to cancel the subscription.
+type IMU interface {
+	Device
+	Subscribe(bufSize int) (<-chan *IMUData, func())
+}
+
+// Barometer is a Device producing BMPData.
+// Subscribe returns a channel receiving each new reading and a function to cancel the subscription.
+type Barometer interface {
+	Device
+	Subscribe(bufSize int) (<-chan *BMPData, func())
+}
+
+/*
+Poller runs a driver's polling loop and keeps track of its health.
+Drivers hold one and delegate their Start, Stop and Health methods to it,
+calling Read from the polling loop after every attempt to read the chip.
+The zero value is ready to use.
+*/
+type Poller struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	health Health
+}
+
+// Start runs poll in a new goroutine until ctx is done or Stop is called.
+func (p *Poller) Start(ctx context.Context, poll func(ctx context.Context)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.done != nil {
+		select {
+		case <-p.done: // Finished by itself, e.g. ctx was cancelled
+		default:
+			return ErrRunning
+		}
+	}
+
+	ctx, p.cancel = context.WithCancel(ctx)
+	done := make(chan struct{})
+	p.done = done
+	p.health.Status = StatusRunning
+
+	go func() {
+		defer close(done)
+		defer p.stopped()
+		poll(ctx)
+	}()
+	return nil
+}
+
+// Stop cancels the polling loop and waits for it to finish.
+func (p *Poller) Stop() error {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.cancel, p.done = nil, nil
+	p.mu.Unlock()
+
+	if done == nil {
+		return ErrNotRunning
+	}
+	cancel()
+	<-done
+	return nil
+}
+
+func (p *Poller) stopped() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.health.Status = StatusStopped
+}
+
+// Read records the outcome of an attempt to read the chip at time t.
+func (p *Poller) Read(t time.Time, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		p.health.Errors++
+		p.health.LastError = err
+		p.health.Status = StatusFailing
+		return
+	}
+	p.health.Reads++
+	p.health.LastRead = t
+	p.health.Status = StatusRunning
+}
+
+// Health returns a snapshot of the polling health.
+func (p *Poller) Health() Health {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.health
+}
+
+/*
+Feed fans out readings to any number of subscribers.
+A subscriber that falls behind loses its oldest readings rather than holding up the polling loop.
+The zero value is ready to use.
+*/
+type Feed[T any] struct {
+	mu   sync.Mutex
+	subs map[chan T]struct{}
+}
+
+// Subscribe returns a channel buffering up to bufSize readings, and a function that cancels the subscription
+// and closes the channel.
+func (f *Feed[T]) Subscribe(bufSize int) (<-chan T, func()) {
+	if bufSize < 1 {
+		bufSize = 1
+	}
+	c := make(chan T, bufSize)
+
+	f.mu.Lock()
+	if f.subs == nil {
+		f.subs = make(map[chan T]struct{})
+	}
+	f.subs[c] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			delete(f.subs, c)
+			close(c)
+		})
+	}
+}
+
+// Publish sends v to all subscribers without blocking.
+func (f *Feed[T]) Publish(v T) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for c := range f.subs {
+		select {
+		case c <- v:
+			continue
+		default: // Subscriber is full, so drop its oldest reading
+		}
+		select {
+		case <-c:
+		default:
+		}
+		select {
+		case c <- v:
+		default:
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package sensors
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPollerLifecycle(t *testing.T) {
+	var p Poller
+	if err := p.Stop(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Stop() before Start() error = %v, want %v", err, ErrNotRunning)
+	}
+
+	polls := make(chan struct{}, 2)
+	poll := func(ctx context.Context) {
+		polls <- struct{}{}
+		p.Read(time.Unix(1, 0), nil)
+		p.Read(time.Unix(2, 0), errors.New("bus error"))
+		p.Read(time.Unix(3, 0), nil)
+		<-ctx.Done()
+	}
+
+	for i := 0; i < 2; i++ { // Must be restartable
+		if err := p.Start(context.Background(), poll); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		<-polls
+		if err := p.Start(context.Background(), poll); !errors.Is(err, ErrRunning) {
+			t.Errorf("second Start() error = %v, want %v", err, ErrRunning)
+		}
+		if err := p.Stop(); err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+		if h := p.Health(); h.Status != StatusStopped {
+			t.Errorf("Status after Stop() = %s, want %s", h.Status, StatusStopped)
+		}
+	}
+
+	h := p.Health()
+	if h.Reads != 4 || h.Errors != 2 || !h.LastRead.Equal(time.Unix(3, 0)) || h.LastError == nil {
+		t.Errorf("Health() = %+v, want 4 reads, 2 errors, last read at 3s", h)
+	}
+}
+
+func TestPollerContextCancel(t *testing.T) {
+	var p Poller
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	if err := p.Start(ctx, func(ctx context.Context) {
+		defer close(done)
+		<-ctx.Done()
+	}); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	cancel()
+	<-done
+	if err := p.Start(context.Background(), func(ctx context.Context) { <-ctx.Done() }); err != nil {
+		t.Errorf("Start() after ctx cancelled error = %v", err)
+	}
+	p.Stop()
+}
+
+func TestPollerStatus(t *testing.T) {
+	var p Poller
+	p.Read(time.Now(), errors.New("bus error"))
+	if s := p.Health().Status; s != StatusFailing {
+		t.Errorf("Status after failed read = %s, want %s", s, StatusFailing)
+	}
+	p.Read(time.Now(), nil)
+	if s := p.Health().Status; s != StatusRunning {
+		t.Errorf("Status after successful read = %s, want %s", s, StatusRunning)
+	}
+}
+
+func TestFeed(t *testing.T) {
+	var f Feed[int]
+	f.Publish(0) // No subscribers yet
+
+	c1, cancel1 := f.Subscribe(2)
+	c2, cancel2 := f.Subscribe(10)
+	for i := 1; i <= 4; i++ {
+		f.Publish(i)
+	}
+
+	// The slow subscriber keeps the newest readings
+	if v1, v2 := <-c1, <-c1; v1 != 3 || v2 != 4 {
+		t.Errorf("buffered readings = %d, %d, want 3, 4", v1, v2)
+	}
+	for i := 1; i <= 4; i++ {
+		if v := <-c2; v != i {
+			t.Errorf("reading %d = %d", i, v)
+		}
+	}
+
+	cancel1()
+	cancel1() // Cancelling twice is harmless
+	if _, ok := <-c1; ok {
+		t.Errorf("channel still open after cancel")
+	}
+	f.Publish(5)
+	if v := <-c2; v != 5 {
+		t.Errorf("reading after other subscriber cancelled = %d, want 5", v)
+	}
+	cancel2()
+}
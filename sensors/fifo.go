@@ -0,0 +1,48 @@
+package sensors
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrFIFOOverflow is reported when a chip's FIFO filled up before it was read, so samples were lost.
+var ErrFIFOOverflow = errors.New("sensors: FIFO overflowed")
+
+/*
+FIFOClock timestamps the samples read in bursts from a chip's FIFO.
+The chip samples at a steady rate, so the samples of a burst are spaced by the sample period and follow on
+from those of the previous burst, whatever the delays in reading them.
+The timestamps are only pulled toward the time of reading when the chip's and host's clocks drift apart:
+the last sample can't have been taken after the burst was read, nor more than one period before.
+*/
+type FIFOClock struct {
+	Period time.Duration // Actual sample period of the chip
+	last   time.Time     // Timestamp of the previous sample, zero before the first burst
+}
+
+// Stamp returns the timestamps of the n samples of a burst read at time now.
+func (c *FIFOClock) Stamp(now time.Time, n int) []time.Time {
+	if n <= 0 {
+		return nil
+	}
+
+	last := c.last.Add(time.Duration(n) * c.Period)
+	switch {
+	case c.last.IsZero() || last.After(now):
+		last = now
+	case now.Sub(last) > c.Period:
+		last = now.Add(-c.Period)
+	}
+	c.last = last
+
+	t := make([]time.Time, n)
+	for i := range t {
+		t[i] = last.Add(-time.Duration(n-1-i) * c.Period)
+	}
+	return t
+}
+
+// Reset starts the timestamps afresh, after samples have been lost.
+func (c *FIFOClock) Reset() {
+	c.last = time.Time{}
+}
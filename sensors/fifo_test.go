@@ -0,0 +1,51 @@
+package sensors
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFIFOClock(t *testing.T) {
+	const period = 10 * time.Millisecond
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		read  time.Duration // Time of the second burst after the first
+		n     int           // Samples in the second burst
+		reset bool
+		want  time.Duration // Timestamp of the last sample of the second burst
+	}{
+		{"Steady", 32 * time.Millisecond, 3, false, 30 * time.Millisecond},
+		{"ChipFast", 25 * time.Millisecond, 3, false, 25 * time.Millisecond},
+		{"ChipSlow", 50 * time.Millisecond, 3, false, 40 * time.Millisecond},
+		{"Reset", 32 * time.Millisecond, 3, true, 32 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := FIFOClock{Period: period}
+			if got := c.Stamp(t0, 2); len(got) != 2 || !got[0].Equal(t0.Add(-period)) || !got[1].Equal(t0) {
+				t.Fatalf("first Stamp() = %v, want ending at %v", got, t0)
+			}
+			if tt.reset {
+				c.Reset()
+			}
+
+			got := c.Stamp(t0.Add(tt.read), tt.n)
+			if len(got) != tt.n {
+				t.Fatalf("Stamp() returned %d timestamps, want %d", len(got), tt.n)
+			}
+			for i, ts := range got {
+				if want := t0.Add(tt.want - time.Duration(tt.n-1-i)*period); !ts.Equal(want) {
+					t.Errorf("timestamp %d = %v, want %v", i, ts.Sub(t0), want.Sub(t0))
+				}
+			}
+		})
+	}
+
+	var c FIFOClock
+	if got := c.Stamp(t0, 0); got != nil {
+		t.Errorf("Stamp() of an empty burst = %v", got)
+	}
+}
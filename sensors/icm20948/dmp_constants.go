@@ -3,6 +3,7 @@ package icm20948
 const (
 	MPU_ADDRESS1              = 0x68
 	MPU_ADDRESS2              = 0x69
+	ICM20948_ID               = 0xEA // Value of ICMREG_WHO_AM_I
 	ICMREG_XG_OFFS_TC         = 0x00
 	ICMREG_YG_OFFS_TC         = 0x01
 	ICMREG_ZG_OFFS_TC         = 0x02
@@ -84,6 +85,15 @@ const (
 	ICMREG_FIFO_COUNTL        = 0x73
 	ICMREG_FIFO_R_W           = 0x74
 	ICMREG_WHOAMI             = 0x75
+	ICMREG_WHO_AM_I           = 0x00 // On reg bank 0
+	ICMREG_USER_CTRL_B0       = 0x03 // On reg bank 0
+	ICMREG_INT_ENABLE_1       = 0x11 // On reg bank 0
+	ICMREG_INT_STATUS_2       = 0x1B // On reg bank 0
+	ICMREG_FIFO_EN_2          = 0x67 // On reg bank 0
+	ICMREG_FIFO_RST           = 0x68 // On reg bank 0
+	ICMREG_FIFO_MODE          = 0x69 // On reg bank 0
+	ICMREG_FIFO_COUNTH_B0     = 0x70 // On reg bank 0
+	ICMREG_FIFO_R_W_B0        = 0x72 // On reg bank 0
 	ICMREG_XA_OFFSET_H        = 0x14
 	ICMREG_XA_OFFSET_L        = 0x15
 	ICMREG_YA_OFFSET_H        = 0x17
@@ -187,6 +197,11 @@ const (
 	BIT_INT_ANYRD_2CLEAR       = 0x10
 	BIT_RAW_RDY_EN             = 0x01
 	BIT_I2C_IF_DIS             = 0x10
+	BIT_FIFO_EN                = 0x40 // USER_CTRL
+	BIT_RAW_DATA_0_RDY_EN      = 0x01 // INT_ENABLE_1
+	BITS_FIFO_RST              = 0x1F // FIFO_RST
+	BITS_FIFO_ACCEL_GYRO_TEMP  = 0x1F // FIFO_EN_2: ACCEL, GYRO_Z, GYRO_Y, GYRO_X and TEMP
+	BITS_FIFO_OVERFLOW_INT     = 0x1F // INT_STATUS_2
 
 	// Misc
 	READ_FLAG                    = 0x80
@@ -4,21 +4,22 @@ package icm20948
 // Also referenced https://github.com/brianc118/ICM20948/blob/master/ICM20948.cpp
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"math"
 	"time"
 
-	"github.com/kidoman/embd"
-	_ "github.com/kidoman/embd/host/all" // Empty import needed to initialize embd library.
-	_ "github.com/kidoman/embd/host/rpi" // Empty import needed to initialize embd library.
 	"github.com/westphae/goflying/sensors"
 )
 
 const (
-	bufSize         = 250 // Size of buffer storing instantaneous sensor values
-	scaleMag        = 9830.0 / 65536
+	bufSize          = 250                    // Size of buffer storing instantaneous sensor values
+	settleTime       = 500 * time.Millisecond // Time after starting before readings count toward the averages
+	scaleMag         = 9830.0 / 65536
+	fifoFrameSize    = 14                    // Bytes per FIFO sample: accel, gyro and temp
+	fifoReadInterval = 10 * time.Millisecond // Shortest time between FIFO bursts
 )
 
 /*
@@ -29,35 +30,81 @@ type ICM20948 struct {
 	sensors.IMUSensor
 	sensors.IMUCalData
 	Address               byte
-	i2cbus                embd.I2CBus
+	regs                  sensors.Registers
 	scaleGyro, scaleAccel float64 // Max sensor reading for value 2**15-1
 	sampleRate            int
 	enableMag             bool
-	mcal1, mcal2, mcal3   float64         // Hardware magnetometer calibration values, uT
-	cClose                chan bool       // Turn off MPU polling
+	fifo                  bool                  // Read gyro/accel samples in bursts from the FIFO
+	dataReady             sensors.EdgeSource    // Data-ready interrupt edges pacing the reads, if any
+	mcal1, mcal2, mcal3   float64               // Hardware magnetometer calibration values, uT
+	chipID                byte                  // Value of the WHO_AM_I register
+	poller                sensors.Poller        // Runs readSensors and tracks its health
+	c, cAvg, cBuf         chan *sensors.IMUData // Sending ends of C, CAvg and CBuf, which outlive restarts
+	feed                  sensors.Feed[*sensors.IMUData]
+}
+
+var _ sensors.IMU = (*ICM20948)(nil)
+
+func init() {
+	sensors.RegisterDriver("ICM20948", sensors.Signature{
+		Kind:      sensors.KindIMU,
+		Addresses: []byte{MPU_ADDRESS1, MPU_ADDRESS2},
+		Register:  ICMREG_WHO_AM_I,
+		IDs:       []byte{ICM20948_ID},
+	}, func(d sensors.Descriptor) (sensors.Device, error) {
+		// ±250°/s, ±4G, 50Hz with magnetometer, as used by Stratux
+		icm, err := NewICM20948(d.Bus, d.Address, 250, 4, 50, true, false)
+		if err != nil {
+			return nil, err
+		}
+		return icm, nil
+	})
 }
 
 /*
 NewICM20948 creates a new ICM20948 object according to the supplied parameters.  If there is no ICM20948 available or there
 is an error creating the object, an error is returned.
 */
-func NewICM20948(i2cbus *embd.I2CBus, address byte, sensitivityGyro, sensitivityAccel, sampleRate int, enableMag bool, applyHWOffsets bool) (*ICM20948, error) {
+func NewICM20948(i2cbus sensors.I2CBus, address byte, sensitivityGyro, sensitivityAccel, sampleRate int, enableMag bool, applyHWOffsets bool) (*ICM20948, error) {
+	return newICM20948(sensors.NewI2CRegisters(i2cbus, address), address, false,
+		sensitivityGyro, sensitivityAccel, sampleRate, enableMag, applyHWOffsets)
+}
+
+/*
+NewICM20948SPI creates a new ICM20948 object on an SPI bus, which is fast enough to sample at 1kHz.
+The parameters are otherwise those of NewICM20948.
+*/
+func NewICM20948SPI(bus sensors.SPIBus, sensitivityGyro, sensitivityAccel, sampleRate int, enableMag bool, applyHWOffsets bool) (*ICM20948, error) {
+	return newICM20948(sensors.NewInvenSenseSPIRegisters(bus), 0, true,
+		sensitivityGyro, sensitivityAccel, sampleRate, enableMag, applyHWOffsets)
+}
+
+func newICM20948(regs sensors.Registers, address byte, spi bool, sensitivityGyro, sensitivityAccel, sampleRate int, enableMag bool, applyHWOffsets bool) (*ICM20948, error) {
 	var icm = new(ICM20948)
-	if err := icm.IMUCalData.Load(); err != nil {
-		icm.IMUCalData.Reset()
-	}
+	icm.c, icm.cAvg, icm.cBuf = make(chan *sensors.IMUData), make(chan *sensors.IMUData), make(chan *sensors.IMUData, bufSize)
+	icm.C, icm.CAvg, icm.CBuf = icm.c, icm.cAvg, icm.cBuf
 
 	icm.sampleRate = sampleRate
 	icm.enableMag = false //FIXME: enableMag. Always disabling magnetometer now.
 
-	icm.i2cbus = *i2cbus
+	icm.regs = regs
 	icm.Address = address
 
+	cal, err := sensors.DefaultCalStore.Load(icm.Identity().CalKey())
+	if err != nil {
+		cal.Reset()
+	}
+	icm.IMUCalData = cal
+
 	icm.setRegBank(0)
 
+	if v, err := icm.regRead(ICMREG_WHO_AM_I); err == nil {
+		icm.chipID = v
+	}
+
 	// Initialization of MPU
 	// Reset device.
-	if err := icm.i2cWrite(ICMREG_PWR_MGMT_1, BIT_H_RESET); err != nil {
+	if err := icm.regWrite(ICMREG_PWR_MGMT_1, BIT_H_RESET); err != nil {
 		return nil, errors.New("Error resetting ICM20948")
 	}
 
@@ -66,15 +113,22 @@ func NewICM20948(i2cbus *embd.I2CBus, address byte, sensitivityGyro, sensitivity
 	// CLKSEL = 1.
 	// From ICM-20948 register map (PWR_MGMT_1):
 	//  "NOTE: CLKSEL[2:0] should be set to 1~5 to achieve full gyroscope performance."
-	if err := icm.i2cWrite(ICMREG_PWR_MGMT_1, 0x01); err != nil {
+	if err := icm.regWrite(ICMREG_PWR_MGMT_1, 0x01); err != nil {
 		return nil, errors.New("Error waking ICM20948")
 	}
 
+	// Keep the chip in SPI mode.
+	if spi {
+		if err := icm.regWrite(ICMREG_USER_CTRL_B0, BIT_I2C_IF_DIS); err != nil {
+			return nil, errors.New("Error disabling ICM20948 I2C interface")
+		}
+	}
+
 	// Note: inv_mpu.c sets some registers here to allocate 1kB to the FIFO buffer and 3kB to the DMP.
-	// It doesn't seem to be supported in the 1.6 version of the register map and we're not using FIFO anyway,
+	// It doesn't seem to be supported in the 1.6 version of the register map and SetFIFO doesn't use the DMP,
 	// so we skip this.
 	// Don't let FIFO overwrite DMP data
-	//if err := icm.i2cWrite(ICMREG_ACCEL_CONFIG_2, BIT_FIFO_SIZE_1024|0x8); err != nil {
+	//if err := icm.regWrite(ICMREG_ACCEL_CONFIG_2, BIT_FIFO_SIZE_1024|0x8); err != nil {
 	//	return nil, errors.New("Error setting up ICM20948")
 	//}
 
@@ -107,9 +161,9 @@ func NewICM20948(i2cbus *embd.I2CBus, address byte, sensitivityGyro, sensitivity
 		return nil, err
 	}
 
-	// Turn off FIFO buffer. Not necessary - default off.
+	// Turn off FIFO buffer. Not necessary - default off until SetFIFO.
 
-	// Turn off interrupts. Not necessary - default off.
+	// Turn off interrupts. Not necessary - default off until SetDataReadyInterrupt.
 
 	//FIXME. Mag reading not set up.
 	// Set up magnetometer
@@ -120,38 +174,38 @@ func NewICM20948(i2cbus *embd.I2CBus, address byte, sensitivityGyro, sensitivity
 			}
 
 			// Set up AK8963 master mode, master clock and ES bit
-			if err := icm.i2cWrite(ICMREG_I2C_MST_CTRL, 0x40); err != nil {
+			if err := icm.regWrite(ICMREG_I2C_MST_CTRL, 0x40); err != nil {
 				return nil, errors.New("Error setting up AK8963")
 			}
 			// Slave 0 reads from AK8963
-			if err := icm.i2cWrite(ICMREG_I2C_SLV0_ADDR, BIT_I2C_READ|AK8963_I2C_ADDR); err != nil {
+			if err := icm.regWrite(ICMREG_I2C_SLV0_ADDR, BIT_I2C_READ|AK8963_I2C_ADDR); err != nil {
 				return nil, errors.New("Error setting up AK8963")
 			}
 			// Compass reads start at this register
-			if err := icm.i2cWrite(ICMREG_I2C_SLV0_REG, AK8963_ST1); err != nil {
+			if err := icm.regWrite(ICMREG_I2C_SLV0_REG, AK8963_ST1); err != nil {
 				return nil, errors.New("Error setting up AK8963")
 			}
 			// Enable 8-byte reads on slave 0
-			if err := icm.i2cWrite(ICMREG_I2C_SLV0_CTRL, BIT_SLAVE_EN|8); err != nil {
+			if err := icm.regWrite(ICMREG_I2C_SLV0_CTRL, BIT_SLAVE_EN|8); err != nil {
 				return nil, errors.New("Error setting up AK8963")
 			}
 			// Slave 1 can change AK8963 measurement mode
-			if err := icm.i2cWrite(ICMREG_I2C_SLV1_ADDR, AK8963_I2C_ADDR); err != nil {
+			if err := icm.regWrite(ICMREG_I2C_SLV1_ADDR, AK8963_I2C_ADDR); err != nil {
 				return nil, errors.New("Error setting up AK8963")
 			}
-			if err := icm.i2cWrite(ICMREG_I2C_SLV1_REG, AK8963_CNTL1); err != nil {
+			if err := icm.regWrite(ICMREG_I2C_SLV1_REG, AK8963_CNTL1); err != nil {
 				return nil, errors.New("Error setting up AK8963")
 			}
 			// Enable 1-byte reads on slave 1
-			if err := icm.i2cWrite(ICMREG_I2C_SLV1_CTRL, BIT_SLAVE_EN|1); err != nil {
+			if err := icm.regWrite(ICMREG_I2C_SLV1_CTRL, BIT_SLAVE_EN|1); err != nil {
 				return nil, errors.New("Error setting up AK8963")
 			}
 			// Set slave 1 data
-			if err := icm.i2cWrite(ICMREG_I2C_SLV1_DO, AKM_SINGLE_MEASUREMENT); err != nil {
+			if err := icm.regWrite(ICMREG_I2C_SLV1_DO, AKM_SINGLE_MEASUREMENT); err != nil {
 				return nil, errors.New("Error setting up AK8963")
 			}
 			// Triggers slave 0 and 1 actions at each sample
-			if err := icm.i2cWrite(ICMREG_I2C_MST_DELAY_CTRL, 0x03); err != nil {
+			if err := icm.regWrite(ICMREG_I2C_MST_DELAY_CTRL, 0x03); err != nil {
 				return nil, errors.New("Error setting up AK8963")
 			}
 
@@ -164,7 +218,7 @@ func NewICM20948(i2cbus *embd.I2CBus, address byte, sensitivityGyro, sensitivity
 			}
 
 			// Not so sure of this one--I2C Slave 4??!
-			if err := icm.i2cWrite(ICMREG_I2C_SLV4_CTRL, ak8963Rate); err != nil {
+			if err := icm.regWrite(ICMREG_I2C_SLV4_CTRL, ak8963Rate); err != nil {
 				return nil, errors.New("Error setting up AK8963")
 			}
 
@@ -187,18 +241,47 @@ func NewICM20948(i2cbus *embd.I2CBus, address byte, sensitivityGyro, sensitivity
 			return nil, err
 		}
 	*/
-	go icm.readSensors()
+	if err := icm.Start(context.Background()); err != nil {
+		return nil, err
+	}
 
-	// Give the IMU time to fully initialize and then clear out any bad values from the averages.
-	time.Sleep(500 * time.Millisecond) // Make sure it's ready
-	<-icm.CAvg                         // Discard the first readings.
+	// Give the IMU time to fully initialize; readSensors leaves its first readings out of the averages.
+	time.Sleep(settleTime)
 
 	return icm, nil
 }
 
-// readSensors polls the gyro, accelerometer and magnetometer sensors as well as the die temperature.
+// Identity returns the chip name, I2C address and WHO_AM_I value.
+func (icm *ICM20948) Identity() sensors.Identity {
+	return sensors.Identity{Name: "ICM20948", Kind: sensors.KindIMU, Address: icm.Address, ChipID: icm.chipID}
+}
+
+// Start polls the ICM in a goroutine until ctx is done or Stop is called.
+// NewICM20948 already starts it, so this is only needed to restart it after Stop.
+func (icm *ICM20948) Start(ctx context.Context) error {
+	return icm.poller.Start(ctx, icm.readSensors)
+}
+
+// Stop stops the driver from reading the ICM and waits for it to finish.
+func (icm *ICM20948) Stop() error {
+	return icm.poller.Stop()
+}
+
+// Health reports how the ICM polling is going.
+func (icm *ICM20948) Health() sensors.Health {
+	return icm.poller.Health()
+}
+
+// Subscribe returns a channel receiving every new instantaneous reading, buffering up to bufSize of them,
+// and a function to cancel the subscription.
+func (icm *ICM20948) Subscribe(bufSize int) (<-chan *sensors.IMUData, func()) {
+	return icm.feed.Subscribe(bufSize)
+}
+
+// readSensors polls the gyro, accelerometer and magnetometer sensors as well as the die temperature
+// until ctx is done.
 // Communication is via channels.
-func (icm *ICM20948) readSensors() {
+func (icm *ICM20948) readSensors(ctx context.Context) {
 	var (
 		g1, g2, g3, a1, a2, a3, m1, m2, m3, m4, tmp int16   // Current values
 		avg1, avg2, avg3, ava1, ava2, ava3, avtmp   float64 // Accumulators for averages
@@ -212,7 +295,7 @@ func (icm *ICM20948) readSensors() {
 
 	//FIXME: Temporary (testing).
 	//	icm.setRegBank(2)
-	//	icm.i2cWrite(ICMREG_TEMP_CONFIG, 0x04)
+	//	icm.regWrite(ICMREG_TEMP_CONFIG, 0x04)
 	//	icm.setRegBank(0)
 
 	acRegMap := map[*int16]byte{
@@ -230,25 +313,32 @@ func (icm *ICM20948) readSensors() {
 		magSampleRate = icm.sampleRate
 	}
 
-	cC := make(chan *sensors.IMUData)
-	defer close(cC)
-	icm.C = cC
-	cAvg := make(chan *sensors.IMUData)
-	defer close(cAvg)
-	icm.CAvg = cAvg
-	cBuf := make(chan *sensors.IMUData, bufSize)
-	defer close(cBuf)
-	icm.CBuf = cBuf
-	icm.cClose = make(chan bool)
-	defer close(icm.cClose)
-
-	clock := time.NewTicker(time.Duration(int(1125.0/float32(icm.sampleRate)+0.5)) * time.Millisecond)
-	//TODO westphae: use the clock to record actual time instead of a timer
+	cC, cAvg, cBuf := icm.c, icm.cAvg, icm.cBuf
+
+	period := time.Duration(int(1125.0/float32(icm.sampleRate)+0.5)) * time.Millisecond
+	fifoClock := sensors.FIFOClock{Period: time.Duration(1125/icm.sampleRate) * time.Second / 1125} // As set by SMPLRT_DIV
+	if icm.fifo {
+		if period < fifoReadInterval {
+			period = fifoReadInterval
+		}
+		// Drop any samples queued while stopped, they can't be timestamped
+		if err := icm.resetFIFO(); err != nil {
+			icm.poller.Read(time.Now(), err)
+		}
+	}
+	clock := time.NewTicker(period)
 	defer clock.Stop()
+	ready := clock.C // The ticker times the samples, unless the data-ready interrupt does
+	if icm.dataReady != nil {
+		clock.Stop()
+		ready = icm.dataReady.Edges()
+	}
 
 	clockMag := time.NewTicker(time.Duration(int(1125.0/float32(magSampleRate)+0.5)) * time.Millisecond)
+	defer clockMag.Stop()
 	t0 = time.Now()
 	t0m = time.Now()
+	settled := time.After(settleTime)
 
 	makeIMUData := func() *sensors.IMUData {
 		mm1 := float64(m1)*icm.mcal1 - icm.M01
@@ -271,6 +361,8 @@ func (icm *ICM20948) readSensors() {
 			T: t, TM: tm,
 			DT: time.Duration(0), DTM: time.Duration(0),
 		}
+		icm.CompensateTemp(&d)
+		icm.AccelCal.Correct(&d)
 		if gaError != nil {
 			d.N = 0
 		}
@@ -296,6 +388,8 @@ func (icm *ICM20948) readSensors() {
 			d.N = int(n + 0.5)
 			d.T = t
 			d.DT = t.Sub(t0)
+			icm.CompensateTemp(&d)
+			icm.AccelCal.Correct(&d)
 		} else {
 			d.GAError = errors.New("ICM20948 Error: No new accel/gyro values")
 		}
@@ -312,52 +406,93 @@ func (icm *ICM20948) readSensors() {
 		return &d
 	}
 
+	resetAvg := func() {
+		avg1, avg2, avg3 = 0, 0, 0
+		ava1, ava2, ava3 = 0, 0, 0
+		avm1, avm2, avm3 = 0, 0, 0
+		avtmp = 0
+		n, nm = 0, 0
+		t0, t0m = t, tm
+	}
+
+	// publish sends out the current values and adds them to the averages.
+	publish := func() {
+		curdata = makeIMUData()
+		icm.feed.Publish(curdata)
+		// Update accumulated values and increment count of gyro/accel readings
+		avg1 += float64(g1)
+		avg2 += float64(g2)
+		avg3 += float64(g3)
+		ava1 += float64(a1)
+		ava2 += float64(a2)
+		ava3 += float64(a3)
+		avtmp += float64(tmp)
+		avm1 += int32(m1)
+		avm2 += int32(m2)
+		avm3 += int32(m3)
+		n++
+		select {
+		case cBuf <- curdata: // We update the buffer every time we read a new value.
+		default: // If buffer is full, remove oldest value and put in newest.
+			<-cBuf
+			cBuf <- curdata
+		}
+	}
+
 	for {
 		select {
-		case t = <-clock.C: // Read accel/gyro data:
+		case tick, ok := <-ready: // Read accel/gyro data:
+			if !ok {
+				log.Println("ICM20948 Error: data-ready interrupt edges stopped")
+				icm.poller.Read(time.Now(), sensors.ErrEdgesClosed)
+				return
+			}
+			if icm.fifo {
+				frames, err := icm.readFIFO()
+				if err != nil {
+					log.Printf("ICM20948 Warning: %s", err)
+					fifoClock.Reset()
+				}
+				icm.poller.Read(tick, err)
+				for i, ts := range fifoClock.Stamp(time.Now(), len(frames)/fifoFrameSize) {
+					f := frames[i*fifoFrameSize:]
+					a1, a2, a3 = fifoWord(f, 0), fifoWord(f, 2), fifoWord(f, 4)
+					g1, g2, g3, tmp = fifoWord(f, 6), fifoWord(f, 8), fifoWord(f, 10), fifoWord(f, 12)
+					t, gaError = ts, nil
+					publish()
+				}
+				break
+			}
+
+			t = tick
+			var readError error
 			for p, reg := range acRegMap {
-				*p, gaError = icm.i2cRead2(reg)
+				*p, gaError = icm.regRead2(reg)
 				if gaError != nil {
 					log.Println("ICM20948 Warning: error reading gyro/accel")
+					readError = gaError
 				}
 			}
-			curdata = makeIMUData()
-			// Update accumulated values and increment count of gyro/accel readings
-			avg1 += float64(g1)
-			avg2 += float64(g2)
-			avg3 += float64(g3)
-			ava1 += float64(a1)
-			ava2 += float64(a2)
-			ava3 += float64(a3)
-			avtmp += float64(tmp)
-			avm1 += int32(m1)
-			avm2 += int32(m2)
-			avm3 += int32(m3)
-			n++
-			select {
-			case cBuf <- curdata: // We update the buffer every time we read a new value.
-			default: // If buffer is full, remove oldest value and put in newest.
-				<-cBuf
-				cBuf <- curdata
-			}
+			icm.poller.Read(t, readError)
+			publish()
 		case tm = <-clockMag.C: // Read magnetometer data:
 			if icm.enableMag {
 				// Set AK8963 to slave0 for reading
-				if err := icm.i2cWrite(ICMREG_I2C_SLV0_ADDR, AK8963_I2C_ADDR|READ_FLAG); err != nil {
+				if err := icm.regWrite(ICMREG_I2C_SLV0_ADDR, AK8963_I2C_ADDR|READ_FLAG); err != nil {
 					log.Printf("ICM20948 Error: couldn't set AK8963 address for reading: %s", err.Error())
 				}
 				//I2C slave 0 register address from where to begin data transfer
-				if err := icm.i2cWrite(ICMREG_I2C_SLV0_REG, AK8963_HXL); err != nil {
+				if err := icm.regWrite(ICMREG_I2C_SLV0_REG, AK8963_HXL); err != nil {
 					log.Printf("ICM20948 Error: couldn't set AK8963 read register: %s", err.Error())
 				}
 				//Tell AK8963 that we will read 7 bytes
-				if err := icm.i2cWrite(ICMREG_I2C_SLV0_CTRL, 0x87); err != nil {
+				if err := icm.regWrite(ICMREG_I2C_SLV0_CTRL, 0x87); err != nil {
 					log.Printf("ICM20948 Error: couldn't communicate with AK8963: %s", err.Error())
 				}
 
 				// Read the actual data
 				for p, reg := range magRegMap {
-					*p, magError = icm.i2cRead2(reg)
+					*p, magError = icm.regRead2(reg)
 					if magError != nil {
 						log.Println("ICM20948 Warning: error reading magnetometer")
 					}
@@ -384,23 +519,20 @@ func (icm *ICM20948) readSensors() {
 			}
 		case cC <- curdata: // Send the latest values
 		case cAvg <- makeAvgIMUData(): // Send the averages
-			avg1, avg2, avg3 = 0, 0, 0
-			ava1, ava2, ava3 = 0, 0, 0
-			avm1, avm2, avm3 = 0, 0, 0
-			avtmp = 0
-			n, nm = 0, 0
-			t0, t0m = t, tm
-		case <-icm.cClose: // Stop the goroutine, ease up on the CPU
-			break
+			resetAvg()
+		case <-settled: // Clear out any bad values from the averages
+			resetAvg()
+			settled = nil
+		case <-ctx.Done(): // Stop the goroutine, ease up on the CPU
+			return
 		}
 	}
 }
 
-// CloseMPU stops the driver from reading the MPU.
-//TODO westphae: need a way to start it going again!
+// CloseMPU stops the driver from reading the MPU.  Start starts it going again.
 func (icm *ICM20948) CloseMPU() {
 	// Nothing to do bitwise for the 9250?
-	icm.cClose <- true
+	icm.Stop()
 }
 
 // SetGyroSampleRate changes the sampling rate of the gyro on the MPU.
@@ -412,7 +544,7 @@ func (icm *ICM20948) SetGyroSampleRate(rate byte) (err error) {
 
 	defer icm.setRegBank(0)
 
-	errWrite := icm.i2cWrite(ICMREG_GYRO_SMPLRT_DIV, byte(rate)) // Set sample rate to chosen
+	errWrite := icm.regWrite(ICMREG_GYRO_SMPLRT_DIV, byte(rate)) // Set sample rate to chosen
 	if errWrite != nil {
 		err = fmt.Errorf("ICM20948 Error: Couldn't set sample rate: %s", errWrite.Error())
 	}
@@ -428,7 +560,7 @@ func (icm *ICM20948) SetAccelSampleRate(rate byte) (err error) {
 
 	defer icm.setRegBank(0)
 
-	errWrite := icm.i2cWrite(ICMREG_ACCEL_SMPLRT_DIV_2, byte(rate)) // Set sample rate to chosen
+	errWrite := icm.regWrite(ICMREG_ACCEL_SMPLRT_DIV_2, byte(rate)) // Set sample rate to chosen
 	if errWrite != nil {
 		err = fmt.Errorf("ICM20948 Error: Couldn't set sample rate: %s", errWrite.Error())
 	}
@@ -446,7 +578,7 @@ func (icm *ICM20948) SetGyroLPF(rate byte) (err error) {
 
 	defer icm.setRegBank(0)
 
-	cfg, err := icm.i2cRead(ICMREG_GYRO_CONFIG)
+	cfg, err := icm.regRead(ICMREG_GYRO_CONFIG)
 	if err != nil {
 		return errors.New("ICM20948 Error: SetGyroLPF error reading chip")
 	}
@@ -471,7 +603,7 @@ func (icm *ICM20948) SetGyroLPF(rate byte) (err error) {
 	cfg |= 0x01
 	cfg |= r
 
-	errWrite := icm.i2cWrite(ICMREG_GYRO_CONFIG, cfg)
+	errWrite := icm.regWrite(ICMREG_GYRO_CONFIG, cfg)
 	if errWrite != nil {
 		err = fmt.Errorf("ICM20948 Error: couldn't set Gyro LPF: %s", errWrite.Error())
 	}
@@ -489,7 +621,7 @@ func (icm *ICM20948) SetAccelLPF(rate byte) (err error) {
 
 	defer icm.setRegBank(0)
 
-	cfg, err := icm.i2cRead(ICMREG_ACCEL_CONFIG)
+	cfg, err := icm.regRead(ICMREG_ACCEL_CONFIG)
 	if err != nil {
 		return errors.New("ICM20948 Error: SetGyroLPF error reading chip")
 	}
@@ -512,7 +644,7 @@ func (icm *ICM20948) SetAccelLPF(rate byte) (err error) {
 	cfg |= 0x01
 	cfg |= r
 
-	errWrite := icm.i2cWrite(ICMREG_ACCEL_CONFIG, cfg)
+	errWrite := icm.regWrite(ICMREG_ACCEL_CONFIG, cfg)
 	if errWrite != nil {
 		err = fmt.Errorf("ICM20948 Error: couldn't set Accel LPF: %s", errWrite.Error())
 	}
@@ -548,6 +680,75 @@ func (icm *ICM20948) MagEnabled() bool {
 	return icm.enableMag
 }
 
+/*
+SetFIFO switches between polling the gyro, accelerometer and temperature registers, the default, and having the
+ICM queue them in its FIFO at the sample rate, to be read in bursts.  FIFO samples are timestamped from the sample
+rate rather than from when they are read, so they don't suffer from scheduling jitter, and none are missed at high
+sample rates.  The ICM must be stopped.
+*/
+func (icm *ICM20948) SetFIFO(enable bool) error {
+	if icm.Health().Status != sensors.StatusStopped {
+		return sensors.ErrRunning
+	}
+
+	ctrl, err := icm.regRead(ICMREG_USER_CTRL_B0)
+	if err != nil {
+		return fmt.Errorf("ICM20948 Error: couldn't configure FIFO: %w", err)
+	}
+	var fifoEn byte
+	ctrl &^= BIT_FIFO_EN
+	if enable {
+		fifoEn = BITS_FIFO_ACCEL_GYRO_TEMP
+		ctrl |= BIT_FIFO_EN
+	}
+	// Stream mode: when full, the FIFO drops the oldest samples and flags the overflow
+	if err := icm.regWrite(ICMREG_FIFO_MODE, 0x00); err != nil {
+		return fmt.Errorf("ICM20948 Error: couldn't configure FIFO: %w", err)
+	}
+	if err := icm.regWrite(ICMREG_FIFO_EN_2, fifoEn); err != nil {
+		return fmt.Errorf("ICM20948 Error: couldn't configure FIFO: %w", err)
+	}
+	if err := icm.resetFIFO(); err != nil {
+		return fmt.Errorf("ICM20948 Error: couldn't configure FIFO: %w", err)
+	}
+	if err := icm.regWrite(ICMREG_USER_CTRL_B0, ctrl); err != nil {
+		return fmt.Errorf("ICM20948 Error: couldn't configure FIFO: %w", err)
+	}
+
+	icm.fifo = enable
+	return nil
+}
+
+// FIFOEnabled returns whether the gyro and accelerometer are being read from the FIFO.
+func (icm *ICM20948) FIFOEnabled() bool {
+	return icm.fifo
+}
+
+/*
+SetDataReadyInterrupt paces the reading of the gyro and accelerometer by the ICM's data-ready interrupt instead
+of a ticker, so that each sample is read as soon as it is ready and timestamped with the time of the interrupt
+edge.  edges watches the GPIO wired to the INT pin, which the ICM pulses high for 50µs after each sample, e.g. a
+gpiodev.Line; nil goes back to the ticker.  In FIFO mode each edge triggers a burst read instead.
+The ICM must be stopped.
+*/
+func (icm *ICM20948) SetDataReadyInterrupt(edges sensors.EdgeSource) error {
+	if icm.Health().Status != sensors.StatusStopped {
+		return sensors.ErrRunning
+	}
+
+	var intEnable byte
+	if edges != nil {
+		intEnable = BIT_RAW_DATA_0_RDY_EN
+	}
+	// INT_PIN_CFG is left at its default of an active high, push-pull, 50µs pulse
+	if err := icm.regWrite(ICMREG_INT_ENABLE_1, intEnable); err != nil {
+		return fmt.Errorf("ICM20948 Error: couldn't configure data-ready interrupt: %w", err)
+	}
+
+	icm.dataReady = edges
+	return nil
+}
+
 // SetGyroSensitivity sets the gyro sensitivity of the ICM20948; it must be one of the following values:
 // 250, 500, 1000, 2000 (all in deg/s).
 func (icm *ICM20948) SetGyroSensitivity(sensitivityGyro int) (err error) {
@@ -577,7 +778,7 @@ func (icm *ICM20948) SetGyroSensitivity(sensitivityGyro int) (err error) {
 		err = fmt.Errorf("ICM20948 Error: %d is not a valid gyro sensitivity", sensitivityGyro)
 	}
 
-	if errWrite := icm.i2cWrite(ICMREG_GYRO_CONFIG, sensGyro); errWrite != nil {
+	if errWrite := icm.regWrite(ICMREG_GYRO_CONFIG, sensGyro); errWrite != nil {
 		err = errors.New("ICM20948 Error: couldn't set gyro sensitivity")
 	}
 
@@ -585,7 +786,7 @@ func (icm *ICM20948) SetGyroSensitivity(sensitivityGyro int) (err error) {
 }
 
 func (icm *ICM20948) setRegBank(bank byte) error {
-	return icm.i2cWrite(ICMREG_BANK_SEL, bank<<4)
+	return icm.regWrite(ICMREG_BANK_SEL, bank<<4)
 }
 
 // SetAccelSensitivity sets the accelerometer sensitivity of the ICM20948; it must be one of the following values:
@@ -617,7 +818,7 @@ func (icm *ICM20948) SetAccelSensitivity(sensitivityAccel int) error {
 		return fmt.Errorf("ICM20948 Error: %d is not a valid accel sensitivity", sensitivityAccel)
 	}
 
-	if errWrite := icm.i2cWrite(ICMREG_ACCEL_CONFIG, sensAccel); errWrite != nil {
+	if errWrite := icm.regWrite(ICMREG_ACCEL_CONFIG, sensAccel); errWrite != nil {
 		return errors.New("ICM20948 Error: couldn't set accel sensitivity")
 	}
 
@@ -632,15 +833,15 @@ func (icm *ICM20948) ReadAccelBias(sensitivityAccel int) error {
 	}
 	defer icm.setRegBank(0)
 
-	a0x, err := icm.i2cRead2(ICMREG_XA_OFFSET_H)
+	a0x, err := icm.regRead2(ICMREG_XA_OFFSET_H)
 	if err != nil {
 		return errors.New("ICM20948 Error: ReadAccelBias error reading chip")
 	}
-	a0y, err := icm.i2cRead2(ICMREG_YA_OFFSET_H)
+	a0y, err := icm.regRead2(ICMREG_YA_OFFSET_H)
 	if err != nil {
 		return errors.New("ICM20948 Error: ReadAccelBias error reading chip")
 	}
-	a0z, err := icm.i2cRead2(ICMREG_ZA_OFFSET_H)
+	a0z, err := icm.regRead2(ICMREG_ZA_OFFSET_H)
 	if err != nil {
 		return errors.New("ICM20948 Error: ReadAccelBias error reading chip")
 	}
@@ -677,15 +878,15 @@ func (icm *ICM20948) ReadGyroBias(sensitivityGyro int) error {
 	}
 	defer icm.setRegBank(0)
 
-	g0x, err := icm.i2cRead2(ICMREG_XG_OFFS_USRH)
+	g0x, err := icm.regRead2(ICMREG_XG_OFFS_USRH)
 	if err != nil {
 		return errors.New("ICM20948 Error: ReadGyroBias error reading chip")
 	}
-	g0y, err := icm.i2cRead2(ICMREG_YG_OFFS_USRH)
+	g0y, err := icm.regRead2(ICMREG_YG_OFFS_USRH)
 	if err != nil {
 		return errors.New("ICM20948 Error: ReadGyroBias error reading chip")
 	}
-	g0z, err := icm.i2cRead2(ICMREG_ZG_OFFS_USRH)
+	g0z, err := icm.regRead2(ICMREG_ZG_OFFS_USRH)
 	if err != nil {
 		return errors.New("ICM20948 Error: ReadGyroBias error reading chip")
 	}
@@ -720,48 +921,48 @@ func (icm *ICM20948) ReadMagCalibration() error {
 	// Enable bypass mode
 	var tmp uint8
 	var err error
-	tmp, err = icm.i2cRead(ICMREG_USER_CTRL)
+	tmp, err = icm.regRead(ICMREG_USER_CTRL)
 	if err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
-	if err = icm.i2cWrite(ICMREG_USER_CTRL, tmp & ^BIT_AUX_IF_EN); err != nil {
+	if err = icm.regWrite(ICMREG_USER_CTRL, tmp & ^BIT_AUX_IF_EN); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	time.Sleep(3 * time.Millisecond)
-	if err = icm.i2cWrite(ICMREG_INT_PIN_CFG, BIT_BYPASS_EN); err != nil {
+	if err = icm.regWrite(ICMREG_INT_PIN_CFG, BIT_BYPASS_EN); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 
 	// Prepare for getting sensitivity data from AK8963
 	//Set the I2C slave address of AK8963
-	if err = icm.i2cWrite(ICMREG_I2C_SLV0_ADDR, AK8963_I2C_ADDR); err != nil {
+	if err = icm.regWrite(ICMREG_I2C_SLV0_ADDR, AK8963_I2C_ADDR); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	// Power down the AK8963
-	if err = icm.i2cWrite(ICMREG_I2C_SLV0_CTRL, AK8963_CNTL1); err != nil {
+	if err = icm.regWrite(ICMREG_I2C_SLV0_CTRL, AK8963_CNTL1); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	// Power down the AK8963
-	if err = icm.i2cWrite(ICMREG_I2C_SLV0_DO, AKM_POWER_DOWN); err != nil {
+	if err = icm.regWrite(ICMREG_I2C_SLV0_DO, AKM_POWER_DOWN); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	time.Sleep(time.Millisecond)
 	// Fuse AK8963 ROM access
-	if icm.i2cWrite(ICMREG_I2C_SLV0_DO, AK8963_I2CDIS); err != nil {
+	if icm.regWrite(ICMREG_I2C_SLV0_DO, AK8963_I2CDIS); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	time.Sleep(time.Millisecond)
 
 	// Get sensitivity data from AK8963 fuse ROM
-	mcal1, err := icm.i2cRead(AK8963_ASAX)
+	mcal1, err := icm.regRead(AK8963_ASAX)
 	if err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
-	mcal2, err := icm.i2cRead(AK8963_ASAY)
+	mcal2, err := icm.regRead(AK8963_ASAY)
 	if err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
-	mcal3, err := icm.i2cRead(AK8963_ASAZ)
+	mcal3, err := icm.regRead(AK8963_ASAZ)
 	if err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
@@ -772,21 +973,21 @@ func (icm *ICM20948) ReadMagCalibration() error {
 
 	// Clean up from getting sensitivity data from AK8963
 	// Fuse AK8963 ROM access
-	if err = icm.i2cWrite(ICMREG_I2C_SLV0_DO, AK8963_I2CDIS); err != nil {
+	if err = icm.regWrite(ICMREG_I2C_SLV0_DO, AK8963_I2CDIS); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	time.Sleep(time.Millisecond)
 
 	// Disable bypass mode now that we're done getting sensitivity data
-	tmp, err = icm.i2cRead(ICMREG_USER_CTRL)
+	tmp, err = icm.regRead(ICMREG_USER_CTRL)
 	if err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
-	if err = icm.i2cWrite(ICMREG_USER_CTRL, tmp|BIT_AUX_IF_EN); err != nil {
+	if err = icm.regWrite(ICMREG_USER_CTRL, tmp|BIT_AUX_IF_EN); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	time.Sleep(3 * time.Millisecond)
-	if err = icm.i2cWrite(ICMREG_INT_PIN_CFG, 0x00); err != nil {
+	if err = icm.regWrite(ICMREG_INT_PIN_CFG, 0x00); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	time.Sleep(3 * time.Millisecond)
@@ -794,9 +995,9 @@ func (icm *ICM20948) ReadMagCalibration() error {
 	return nil
 }
 
-func (icm *ICM20948) i2cWrite(register, value byte) (err error) {
+func (icm *ICM20948) regWrite(register, value byte) (err error) {
 
-	if errWrite := icm.i2cbus.WriteByteToReg(icm.Address, register, value); errWrite != nil {
+	if errWrite := icm.regs.WriteByteToReg(register, value); errWrite != nil {
 		err = fmt.Errorf("ICM20948 Error writing %X to %X: %s\n",
 			value, register, errWrite.Error())
 	} else {
@@ -805,25 +1006,73 @@ func (icm *ICM20948) i2cWrite(register, value byte) (err error) {
 	return
 }
 
-func (icm *ICM20948) i2cRead(register byte) (value uint8, err error) {
-	value, errWrite := icm.i2cbus.ReadByteFromReg(icm.Address, register)
+func (icm *ICM20948) regRead(register byte) (value uint8, err error) {
+	value, errWrite := icm.regs.ReadByteFromReg(register)
 	if errWrite != nil {
-		err = fmt.Errorf("i2cRead error: %s", errWrite.Error())
+		err = fmt.Errorf("regRead error: %s", errWrite.Error())
 	}
 	return
 }
 
-func (icm *ICM20948) i2cRead2(register byte) (value int16, err error) {
+func (icm *ICM20948) regRead2(register byte) (value int16, err error) {
 
-	v, errWrite := icm.i2cbus.ReadWordFromReg(icm.Address, register)
+	v, errWrite := icm.regs.ReadWordFromReg(register)
 	if errWrite != nil {
-		err = fmt.Errorf("ICM20948 Error reading %x: %s\n", register, err.Error())
+		err = fmt.Errorf("ICM20948 Error reading %x: %s\n", register, errWrite.Error())
 	} else {
 		value = int16(v)
 	}
 	return
 }
 
+// readFIFO reads all the complete samples queued in the FIFO.
+// If it overflowed, the FIFO is reset and sensors.ErrFIFOOverflow returned, as samples were lost
+// and what is left no longer starts on a sample boundary.
+// The FIFO is reset after a failed burst read too, which may have taken part of a sample out of it,
+// and the burst isn't retried, which would take out more.
+func (icm *ICM20948) readFIFO() ([]byte, error) {
+	status, err := icm.regRead(ICMREG_INT_STATUS_2)
+	if err != nil {
+		return nil, err
+	}
+	if status&BITS_FIFO_OVERFLOW_INT != 0 {
+		if err := icm.resetFIFO(); err != nil {
+			return nil, err
+		}
+		return nil, sensors.ErrFIFOOverflow
+	}
+
+	count, err := icm.regRead2(ICMREG_FIFO_COUNTH_B0)
+	if err != nil {
+		return nil, err
+	}
+	n := int(count&0x1FFF) / fifoFrameSize * fifoFrameSize
+	if n == 0 {
+		return nil, nil
+	}
+	frames := make([]byte, n)
+	if err := icm.regs.ReadFromRegOnce(ICMREG_FIFO_R_W_B0, frames); err != nil {
+		if errReset := icm.resetFIFO(); errReset != nil {
+			log.Printf("ICM20948 Warning: couldn't reset FIFO after failed read: %s", errReset)
+		}
+		return nil, fmt.Errorf("ICM20948 Error reading FIFO: %w", err)
+	}
+	return frames, nil
+}
+
+// resetFIFO empties the FIFO.  Unlike on the MPU9250, the reset has to be released again.
+func (icm *ICM20948) resetFIFO() error {
+	if err := icm.regWrite(ICMREG_FIFO_RST, BITS_FIFO_RST); err != nil {
+		return err
+	}
+	return icm.regWrite(ICMREG_FIFO_RST, 0x00)
+}
+
+// fifoWord returns the big-endian word at b[i:i+2].
+func fifoWord(b []byte, i int) int16 {
+	return int16(uint16(b[i])<<8 | uint16(b[i+1]))
+}
+
 func (icm *ICM20948) memWrite(addr uint16, data *[]byte) error {
 	var err error
 	var tmp = make([]byte, 2)
@@ -836,12 +1085,12 @@ func (icm *ICM20948) memWrite(addr uint16, data *[]byte) error {
 		return errors.New("Bad address: writing outside of memory bank boundaries")
 	}
 
-	err = icm.i2cbus.WriteToReg(icm.Address, ICMREG_BANK_SEL, tmp)
+	err = icm.regs.WriteToReg(ICMREG_BANK_SEL, tmp)
 	if err != nil {
 		return fmt.Errorf("ICM20948 Error selecting memory bank: %s\n", err.Error())
 	}
 
-	err = icm.i2cbus.WriteToReg(icm.Address, ICMREG_MEM_R_W, *data)
+	err = icm.regs.WriteToReg(ICMREG_MEM_R_W, *data)
 	if err != nil {
 		return fmt.Errorf("ICM20948 Error writing to the memory bank: %s\n", err.Error())
 	}
@@ -0,0 +1,218 @@
+package icm20948
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/westphae/goflying/i2ctest"
+	"github.com/westphae/goflying/sensors"
+)
+
+// tempCalStore points sensors.DefaultCalStore at a file in a temporary directory for the test,
+// so that the driver doesn't load the calibration data of the machine running it.
+func tempCalStore(t *testing.T) *sensors.CalStore {
+	s := sensors.DefaultCalStore
+	t.Cleanup(func() { sensors.DefaultCalStore = s })
+	sensors.DefaultCalStore = sensors.NewCalStore(filepath.Join(t.TempDir(), "imu_cal.json"))
+	return sensors.DefaultCalStore
+}
+
+func TestNewICM20948(t *testing.T) {
+	tempCalStore(t)
+	b := i2ctest.NewBus()
+	chip := i2ctest.NewICM20948()
+	chip.SetAccel(0, 0, 8192)
+	chip.SetGyro(131, -262, 0)
+	chip.SetTemp(3339)
+	// The hardware offsets share register addresses with the config registers on other banks
+	chip.Bank(1).SetWord(ICMREG_XA_OFFSET_H, 10)
+	chip.Bank(2).SetWord(ICMREG_XG_OFFS_USRH, 5)
+	b.Attach(MPU_ADDRESS1, chip)
+
+	icm, err := NewICM20948(b, MPU_ADDRESS1, 250, 4, 50, false, true)
+	if err != nil {
+		t.Fatalf("NewICM20948() error = %v", err)
+	}
+	defer icm.Stop()
+
+	if n := chip.SelectedBank(); n != 0 {
+		t.Errorf("bank %d selected after init, want 0", n)
+	}
+	cfg := chip.Bank(2)
+	if v := cfg.Get(ICMREG_GYRO_CONFIG, 1)[0]; v&0x06 != BITS_FS_250DPS || v&0x01 == 0 {
+		t.Errorf("GYRO_CONFIG = %X", v)
+	}
+	if v := cfg.Get(ICMREG_ACCEL_CONFIG, 1)[0]; v&0x06 != BITS_FS_4G || v&0x01 == 0 {
+		t.Errorf("ACCEL_CONFIG = %X", v)
+	}
+	if g, a := cfg.Get(ICMREG_GYRO_SMPLRT_DIV, 1)[0], cfg.Get(ICMREG_ACCEL_SMPLRT_DIV_2, 1)[0]; g != 21 || a != 21 {
+		t.Errorf("GYRO_SMPLRT_DIV, ACCEL_SMPLRT_DIV_2 = %d, %d, want 21 for 50Hz", g, a)
+	}
+	if icm.A01 != 20 || icm.G01 != 20 {
+		t.Errorf("hardware offsets A01, G01 = %f, %f, want 20, 20", icm.A01, icm.G01)
+	}
+	if id := icm.Identity(); id.ChipID != ICM20948_ID || id.Kind != sensors.KindIMU {
+		t.Errorf("Identity() = %s", id)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	d := <-icm.CAvg
+	if d.GAError != nil || d.N < 1 {
+		t.Fatalf("average of %d readings, error %v", d.N, d.GAError)
+	}
+	want := [...]float64{(131 - 20) * 250.0 / 32767, -262 * 250.0 / 32767, 0, 8192 * 4.0 / 32767}
+	if got := [...]float64{d.G1, d.G2, d.G3, d.A3}; math.Abs(got[0]-want[0]) > 1e-9 || math.Abs(got[1]-want[1]) > 1e-9 ||
+		got[2] != 0 || math.Abs(got[3]-want[3]) > 1e-9 {
+		t.Errorf("G1, G2, G3, A3 = %v, want %v", got, want)
+	}
+	if math.Abs(d.Temp-31) > 0.01 {
+		t.Errorf("Temp = %f, want 31", d.Temp)
+	}
+}
+
+func TestICM20948FIFO(t *testing.T) {
+	tempCalStore(t)
+	b := i2ctest.NewBus()
+	chip := i2ctest.NewICM20948()
+	b.Attach(MPU_ADDRESS1, chip)
+
+	icm, err := NewICM20948(b, MPU_ADDRESS1, 250, 4, 50, false, false)
+	if err != nil {
+		t.Fatalf("NewICM20948() error = %v", err)
+	}
+	if err := icm.SetFIFO(true); err != sensors.ErrRunning {
+		t.Errorf("SetFIFO() while running error = %v, want ErrRunning", err)
+	}
+	icm.Stop()
+	if err := icm.SetFIFO(true); err != nil {
+		t.Fatalf("SetFIFO() error = %v", err)
+	}
+	if v := chip.Bank(0).Get(ICMREG_FIFO_EN_2, 1)[0]; v != BITS_FIFO_ACCEL_GYRO_TEMP {
+		t.Errorf("FIFO_EN_2 = %X", v)
+	}
+	if v := chip.Bank(0).Get(ICMREG_FIFO_RST, 1)[0]; v != 0 {
+		t.Errorf("FIFO_RST = %X, reset not released", v)
+	}
+
+	c, cancel := icm.Subscribe(50)
+	defer cancel()
+	reads := icm.Health().Reads
+	if err := icm.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer icm.Stop()
+	for icm.Health().Reads == reads { // Wait for the FIFO to be reset
+		time.Sleep(time.Millisecond)
+	}
+
+	chip.SetAccel(7, 0, 8192)
+	chip.SetGyro(131, -262, 0)
+	chip.SetTemp(3339)
+	chip.PushFIFO(5)
+	period := 22 * time.Second / 1125 // From GYRO_SMPLRT_DIV of 21
+	var prev time.Time
+	for i := 1; i <= 5; i++ {
+		select {
+		case d := <-c:
+			if a1 := d.A1 / icm.scaleAccel; math.Abs(a1-7) > 1e-6 || math.Abs(d.A3-1) > 1e-3 || math.Abs(d.G1-1) > 1e-3 ||
+				math.Abs(d.Temp-31) > 0.01 {
+				t.Errorf("sample %d: raw A1 = %f, A3 = %f, G1 = %f, Temp = %f", i, a1, d.A3, d.G1, d.Temp)
+			}
+			if i > 1 && d.T.Sub(prev) != period {
+				t.Errorf("sample %d taken %v after the previous, want %v", i, d.T.Sub(prev), period)
+			}
+			prev = d.T
+		case <-time.After(time.Second):
+			t.Fatalf("only got %d samples from the FIFO", i-1)
+		}
+	}
+
+	// A second of samples overflows the FIFO
+	chip.PushFIFO(50)
+	time.Sleep(100 * time.Millisecond)
+	if h := icm.Health(); !errors.Is(h.LastError, sensors.ErrFIFOOverflow) {
+		t.Errorf("Health() after overflow = %+v", h)
+	}
+	select {
+	case d := <-c:
+		t.Errorf("got a sample %+v from an overflowed FIFO", d)
+	default:
+	}
+
+	// A failed burst read, which took part of a sample, resets the FIFO so later samples stay aligned
+	errRead := errors.New("read failed")
+	chip.Bank(0).Fail(ICMREG_FIFO_R_W_B0, errRead)
+	chip.PushFIFO(5)
+	for deadline := time.Now().Add(time.Second); !errors.Is(icm.Health().LastError, errRead); {
+		if time.Now().After(deadline) {
+			t.Fatalf("Health() after failed FIFO read = %+v", icm.Health())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	chip.Bank(0).Fail(ICMREG_FIFO_R_W_B0, nil)
+	chip.SetAccel(9, 0, 8192)
+	chip.PushFIFO(5)
+	for i := 1; i <= 5; i++ {
+		select {
+		case d := <-c:
+			if a1 := d.A1 / icm.scaleAccel; math.Abs(a1-9) > 1e-6 || math.Abs(d.A3-1) > 1e-3 || math.Abs(d.G1-1) > 1e-3 {
+				t.Errorf("sample %d after failed read: raw A1 = %f, A3 = %f, G1 = %f", i, a1, d.A3, d.G1)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("only got %d samples from the FIFO after a failed read", i-1)
+		}
+	}
+}
+
+func TestICM20948DataReadyInterrupt(t *testing.T) {
+	tempCalStore(t)
+	b := i2ctest.NewBus()
+	chip := i2ctest.NewICM20948()
+	b.Attach(MPU_ADDRESS1, chip)
+
+	icm, err := NewICM20948(b, MPU_ADDRESS1, 250, 4, 50, false, false)
+	if err != nil {
+		t.Fatalf("NewICM20948() error = %v", err)
+	}
+	icm.Stop()
+	edges := i2ctest.NewEdges()
+	if err := icm.SetDataReadyInterrupt(edges); err != nil {
+		t.Fatalf("SetDataReadyInterrupt() error = %v", err)
+	}
+	if v := chip.Bank(0).Get(ICMREG_INT_ENABLE_1, 1)[0]; v != BIT_RAW_DATA_0_RDY_EN {
+		t.Errorf("INT_ENABLE_1 = %X", v)
+	}
+
+	c, cancel := icm.Subscribe(10)
+	defer cancel()
+	if err := icm.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer icm.Stop()
+
+	chip.SetAccel(7, 0, 0)
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	edges.Fire(ts)
+	select {
+	case d := <-c:
+		if a1 := d.A1 / icm.scaleAccel; !d.T.Equal(ts) || math.Abs(a1-7) > 1e-6 {
+			t.Errorf("T = %v, raw A1 = %f, want %v, 7", d.T, a1, ts)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no sample after the edge")
+	}
+
+	edges.Close()
+	for start := time.Now(); icm.Health().Status != sensors.StatusStopped; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("still polling after the edges stopped")
+		}
+	}
+	if h := icm.Health(); !errors.Is(h.LastError, sensors.ErrEdgesClosed) {
+		t.Errorf("Health() after the edges stopped = %+v", h)
+	}
+}
@@ -4,16 +4,21 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/kidoman/embd"
+	"github.com/westphae/goflying/i2cdev"
 	"github.com/westphae/goflying/sensors/icm20948"
 )
 
 func main() {
-	i2cbus := embd.NewI2CBus(1)
+	bus, err := i2cdev.Open(1)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bus.Close()
 
 	var icms []*icm20948.ICM20948
 	for i, address := range []byte{icm20948.MPU_ADDRESS1, icm20948.MPU_ADDRESS2} {
-		icm, err := icm20948.NewICM20948(&i2cbus, address, 250, 2, 1000, true, false)
+		icm, err := icm20948.NewICM20948(bus, address, 250, 2, 1000, true, false)
 		if err != nil {
 			fmt.Printf("no ICM20948 at address %d: %s\n", i, err)
 			continue
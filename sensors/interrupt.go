@@ -0,0 +1,18 @@
+package sensors
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrEdgesClosed is reported when an EdgeSource closes its channel, so the chip can no longer be paced by it.
+var ErrEdgesClosed = errors.New("sensors: interrupt edge source closed")
+
+/*
+EdgeSource delivers the times of the edges of a chip's interrupt pin, such as a gpiodev.Line watching the
+GPIO it is wired to.  The times timestamp the samples, so they should be taken as close to the edge as
+possible, ideally by the kernel.  The channel is closed if the source fails or is closed.
+*/
+type EdgeSource interface {
+	Edges() <-chan time.Time
+}
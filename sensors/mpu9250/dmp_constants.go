@@ -3,6 +3,8 @@ package mpu9250
 const (
 	MPU_ADDRESS1              = 0x68
 	MPU_ADDRESS2              = 0x69
+	MPU9250_ID                = 0x71 // Value of MPUREG_WHOAMI
+	MPU9255_ID                = 0x73 // Value of MPUREG_WHOAMI on the MPU9255
 	MPUREG_XG_OFFS_TC         = 0x00
 	MPUREG_YG_OFFS_TC         = 0x01
 	MPUREG_ZG_OFFS_TC         = 0x02
@@ -55,6 +57,7 @@ const (
 	MPUREG_I2C_MST_STATUS     = 0x36
 	MPUREG_INT_PIN_CFG        = 0x37
 	MPUREG_INT_ENABLE         = 0x38
+	MPUREG_INT_STATUS         = 0x3A
 	MPUREG_ACCEL_XOUT_H       = 0x3B
 	MPUREG_ACCEL_XOUT_L       = 0x3C
 	MPUREG_ACCEL_YOUT_H       = 0x3D
@@ -172,6 +175,10 @@ const (
 	BIT_INT_ANYRD_2CLEAR       = 0x10
 	BIT_RAW_RDY_EN             = 0x01
 	BIT_I2C_IF_DIS             = 0x10
+	BIT_FIFO_EN                = 0x40 // USER_CTRL
+	BIT_FIFO_RST               = 0x04 // USER_CTRL
+	BITS_FIFO_ACCEL_GYRO_TEMP  = 0xF8 // FIFO_EN: TEMP, XG, YG, ZG and ACCEL
+	BIT_FIFO_OFLOW_INT         = 0x10 // INT_STATUS
 
 	// Misc
 	READ_FLAG                    = 0x80
@@ -4,21 +4,22 @@ package mpu9250
 // Also referenced https://github.com/brianc118/MPU9250/blob/master/MPU9250.cpp
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"math"
 	"time"
 
-	"github.com/kidoman/embd"
-	_ "github.com/kidoman/embd/host/all" // Empty import needed to initialize embd library.
-	_ "github.com/kidoman/embd/host/rpi" // Empty import needed to initialize embd library.
 	"github.com/westphae/goflying/sensors"
 )
 
 const (
-	bufSize         = 250 // Size of buffer storing instantaneous sensor values
-	scaleMag        = 9830.0 / 65536
+	bufSize          = 250                    // Size of buffer storing instantaneous sensor values
+	settleTime       = 500 * time.Millisecond // Time after starting before readings count toward the averages
+	scaleMag         = 9830.0 / 65536
+	fifoFrameSize    = 14                    // Bytes per FIFO sample: accel, temp and gyro
+	fifoReadInterval = 10 * time.Millisecond // Shortest time between FIFO bursts
 )
 
 /*
@@ -29,48 +30,103 @@ type MPU9250 struct {
 	sensors.IMUSensor
 	sensors.IMUCalData
 	Address               byte
-	i2cbus                embd.I2CBus
+	regs                  sensors.Registers
 	scaleGyro, scaleAccel float64 // Max sensor reading for value 2**15-1
 	sampleRate            int
 	enableMag             bool
-	mcal1, mcal2, mcal3   float64         // Hardware magnetometer calibration values, uT
-	cClose                chan bool       // Turn off MPU polling
+	fifo                  bool                  // Read gyro/accel samples in bursts from the FIFO
+	dataReady             sensors.EdgeSource    // Data-ready interrupt edges pacing the reads, if any
+	mcal1, mcal2, mcal3   float64               // Hardware magnetometer calibration values, uT
+	chipID                byte                  // Value of the WHO_AM_I register
+	poller                sensors.Poller        // Runs readSensors and tracks its health
+	c, cAvg, cBuf         chan *sensors.IMUData // Sending ends of C, CAvg and CBuf, which outlive restarts
+	feed                  sensors.Feed[*sensors.IMUData]
+}
+
+var _ sensors.IMU = (*MPU9250)(nil)
+
+func init() {
+	sensors.RegisterDriver("MPU9250", sensors.Signature{
+		Kind:      sensors.KindIMU,
+		Addresses: []byte{MPU_ADDRESS1, MPU_ADDRESS2},
+		Register:  MPUREG_WHOAMI,
+		IDs:       []byte{MPU9250_ID, MPU9255_ID},
+		// The ICM20948's WHO_AM_I register is the MPU9250's gyro self-test register, so try this first
+		Priority: 1,
+	}, func(d sensors.Descriptor) (sensors.Device, error) {
+		// ±250°/s, ±4G, 50Hz with magnetometer, as used by Stratux
+		mpu, err := NewMPU9250(d.Bus, d.Address, 250, 4, 50, true, false)
+		if err != nil {
+			return nil, err
+		}
+		return mpu, nil
+	})
 }
 
 /*
 NewMPU9250 creates a new MPU9250 object according to the supplied parameters.  If there is no MPU9250 available or there
 is an error creating the object, an error is returned.
 */
-func NewMPU9250(i2cbus *embd.I2CBus, address byte, sensitivityGyro, sensitivityAccel, sampleRate int, enableMag bool, applyHWOffsets bool) (*MPU9250, error) {
+func NewMPU9250(i2cbus sensors.I2CBus, address byte, sensitivityGyro, sensitivityAccel, sampleRate int, enableMag bool, applyHWOffsets bool) (*MPU9250, error) {
+	return newMPU9250(sensors.NewI2CRegisters(i2cbus, address), address, false,
+		sensitivityGyro, sensitivityAccel, sampleRate, enableMag, applyHWOffsets)
+}
+
+/*
+NewMPU9250SPI creates a new MPU9250 object on an SPI bus, which is fast enough to sample at 1kHz.
+The parameters are otherwise those of NewMPU9250.
+*/
+func NewMPU9250SPI(bus sensors.SPIBus, sensitivityGyro, sensitivityAccel, sampleRate int, enableMag bool, applyHWOffsets bool) (*MPU9250, error) {
+	return newMPU9250(sensors.NewInvenSenseSPIRegisters(bus), 0, true,
+		sensitivityGyro, sensitivityAccel, sampleRate, enableMag, applyHWOffsets)
+}
+
+func newMPU9250(regs sensors.Registers, address byte, spi bool, sensitivityGyro, sensitivityAccel, sampleRate int, enableMag bool, applyHWOffsets bool) (*MPU9250, error) {
 	var mpu = new(MPU9250)
-	if err := mpu.IMUCalData.Load(); err != nil {
-		mpu.IMUCalData.Reset()
-	}
+	mpu.c, mpu.cAvg, mpu.cBuf = make(chan *sensors.IMUData), make(chan *sensors.IMUData), make(chan *sensors.IMUData, bufSize)
+	mpu.C, mpu.CAvg, mpu.CBuf = mpu.c, mpu.cAvg, mpu.cBuf
 
 	mpu.sampleRate = sampleRate
 	mpu.enableMag = enableMag
 
-	mpu.i2cbus = *i2cbus
+	mpu.regs = regs
 	mpu.Address = address
 
+	cal, err := sensors.DefaultCalStore.Load(mpu.Identity().CalKey())
+	if err != nil {
+		cal.Reset()
+	}
+	mpu.IMUCalData = cal
+
+	if v, err := mpu.regRead(MPUREG_WHOAMI); err == nil {
+		mpu.chipID = v
+	}
+
 	// Initialization of MPU
 	// Reset device.
-	if err := mpu.i2cWrite(MPUREG_PWR_MGMT_1, BIT_H_RESET); err != nil {
+	if err := mpu.regWrite(MPUREG_PWR_MGMT_1, BIT_H_RESET); err != nil {
 		return nil, errors.New("error resetting MPU9250")
 	}
 
 	// Note: the following is in inv_mpu.c, but doesn't appear to be necessary from the MPU-9250 register map.
 	// Wake up chip.
 	time.Sleep(100 * time.Millisecond)
-	if err := mpu.i2cWrite(MPUREG_PWR_MGMT_1, 0x00); err != nil {
+	if err := mpu.regWrite(MPUREG_PWR_MGMT_1, 0x00); err != nil {
 		return nil, errors.New("error waking MPU9250")
 	}
 
+	// Keep the chip in SPI mode.
+	if spi {
+		if err := mpu.regWrite(MPUREG_USER_CTRL, BIT_I2C_IF_DIS); err != nil {
+			return nil, errors.New("error disabling MPU9250 I2C interface")
+		}
+	}
+
 	// Note: inv_mpu.c sets some registers here to allocate 1kB to the FIFO buffer and 3kB to the DMP.
-	// It doesn't seem to be supported in the 1.6 version of the register map and we're not using FIFO anyway,
+	// It doesn't seem to be supported in the 1.6 version of the register map and SetFIFO doesn't use the DMP,
 	// so we skip this.
 	// Don't let FIFO overwrite DMP data
-	if err := mpu.i2cWrite(MPUREG_ACCEL_CONFIG_2, BIT_FIFO_SIZE_1024|0x8); err != nil {
+	if err := mpu.regWrite(MPUREG_ACCEL_CONFIG_2, BIT_FIFO_SIZE_1024|0x8); err != nil {
 		return nil, errors.New("error setting up MPU9250")
 	}
 
@@ -99,13 +155,13 @@ func NewMPU9250(i2cbus *embd.I2CBus, address byte, sensitivityGyro, sensitivityA
 		return nil, err
 	}
 
-	// Turn off FIFO buffer
-	if err := mpu.i2cWrite(MPUREG_FIFO_EN, 0x00); err != nil {
+	// Turn off FIFO buffer until SetFIFO
+	if err := mpu.regWrite(MPUREG_FIFO_EN, 0x00); err != nil {
 		return nil, errors.New("MPU9250 Error: couldn't disable FIFO")
 	}
 
-	// Turn off interrupts
-	if err := mpu.i2cWrite(MPUREG_INT_ENABLE, 0x00); err != nil {
+	// Turn off interrupts until SetDataReadyInterrupt
+	if err := mpu.regWrite(MPUREG_INT_ENABLE, 0x00); err != nil {
 		return nil, errors.New("MPU9250 Error: couldn't disable interrupts")
 	}
 
@@ -116,38 +172,38 @@ func NewMPU9250(i2cbus *embd.I2CBus, address byte, sensitivityGyro, sensitivityA
 		}
 
 		// Set up AK8963 master mode, master clock and ES bit
-		if err := mpu.i2cWrite(MPUREG_I2C_MST_CTRL, 0x40); err != nil {
+		if err := mpu.regWrite(MPUREG_I2C_MST_CTRL, 0x40); err != nil {
 			return nil, errors.New("error setting up AK8963")
 		}
 		// Slave 0 reads from AK8963
-		if err := mpu.i2cWrite(MPUREG_I2C_SLV0_ADDR, BIT_I2C_READ|AK8963_I2C_ADDR); err != nil {
+		if err := mpu.regWrite(MPUREG_I2C_SLV0_ADDR, BIT_I2C_READ|AK8963_I2C_ADDR); err != nil {
 			return nil, errors.New("error setting up AK8963")
 		}
 		// Compass reads start at this register
-		if err := mpu.i2cWrite(MPUREG_I2C_SLV0_REG, AK8963_ST1); err != nil {
+		if err := mpu.regWrite(MPUREG_I2C_SLV0_REG, AK8963_ST1); err != nil {
 			return nil, errors.New("error setting up AK8963")
 		}
 		// Enable 8-byte reads on slave 0
-		if err := mpu.i2cWrite(MPUREG_I2C_SLV0_CTRL, BIT_SLAVE_EN|8); err != nil {
+		if err := mpu.regWrite(MPUREG_I2C_SLV0_CTRL, BIT_SLAVE_EN|8); err != nil {
 			return nil, errors.New("error setting up AK8963")
 		}
 		// Slave 1 can change AK8963 measurement mode
-		if err := mpu.i2cWrite(MPUREG_I2C_SLV1_ADDR, AK8963_I2C_ADDR); err != nil {
+		if err := mpu.regWrite(MPUREG_I2C_SLV1_ADDR, AK8963_I2C_ADDR); err != nil {
 			return nil, errors.New("error setting up AK8963")
 		}
-		if err := mpu.i2cWrite(MPUREG_I2C_SLV1_REG, AK8963_CNTL1); err != nil {
+		if err := mpu.regWrite(MPUREG_I2C_SLV1_REG, AK8963_CNTL1); err != nil {
 			return nil, errors.New("error setting up AK8963")
 		}
 		// Enable 1-byte reads on slave 1
-		if err := mpu.i2cWrite(MPUREG_I2C_SLV1_CTRL, BIT_SLAVE_EN|1); err != nil {
+		if err := mpu.regWrite(MPUREG_I2C_SLV1_CTRL, BIT_SLAVE_EN|1); err != nil {
 			return nil, errors.New("error setting up AK8963")
 		}
 		// Set slave 1 data
-		if err := mpu.i2cWrite(MPUREG_I2C_SLV1_DO, AKM_SINGLE_MEASUREMENT); err != nil {
+		if err := mpu.regWrite(MPUREG_I2C_SLV1_DO, AKM_SINGLE_MEASUREMENT); err != nil {
 			return nil, errors.New("error setting up AK8963")
 		}
 		// Triggers slave 0 and 1 actions at each sample
-		if err := mpu.i2cWrite(MPUREG_I2C_MST_DELAY_CTRL, 0x03); err != nil {
+		if err := mpu.regWrite(MPUREG_I2C_MST_DELAY_CTRL, 0x03); err != nil {
 			return nil, errors.New("error setting up AK8963")
 		}
 
@@ -160,7 +216,7 @@ func NewMPU9250(i2cbus *embd.I2CBus, address byte, sensitivityGyro, sensitivityA
 		}
 
 		// Not so sure of this one--I2C Slave 4??!
-		if err := mpu.i2cWrite(MPUREG_I2C_SLV4_CTRL, ak8963Rate); err != nil {
+		if err := mpu.regWrite(MPUREG_I2C_SLV4_CTRL, ak8963Rate); err != nil {
 			return nil, errors.New("error setting up AK8963")
 		}
 
@@ -168,16 +224,16 @@ func NewMPU9250(i2cbus *embd.I2CBus, address byte, sensitivityGyro, sensitivityA
 	}
 
 	// Set clock source to PLL
-	if err := mpu.i2cWrite(MPUREG_PWR_MGMT_1, INV_CLK_PLL); err != nil {
+	if err := mpu.regWrite(MPUREG_PWR_MGMT_1, INV_CLK_PLL); err != nil {
 		return nil, errors.New("error setting up MPU9250")
 	}
 	// Turn off all sensors -- Not sure if necessary, but it's in the InvenSense DMP driver
-	if err := mpu.i2cWrite(MPUREG_PWR_MGMT_2, 0x63); err != nil {
+	if err := mpu.regWrite(MPUREG_PWR_MGMT_2, 0x63); err != nil {
 		return nil, errors.New("error setting up MPU9250")
 	}
 	time.Sleep(100 * time.Millisecond)
 	// Turn on all gyro, all accel
-	if err := mpu.i2cWrite(MPUREG_PWR_MGMT_2, 0x00); err != nil {
+	if err := mpu.regWrite(MPUREG_PWR_MGMT_2, 0x00); err != nil {
 		return nil, errors.New("error setting up MPU9250")
 	}
 
@@ -195,18 +251,47 @@ func NewMPU9250(i2cbus *embd.I2CBus, address byte, sensitivityGyro, sensitivityA
 		return nil, err
 	}
 
-	go mpu.readSensors()
+	if err := mpu.Start(context.Background()); err != nil {
+		return nil, err
+	}
 
-	// Give the IMU time to fully initialize and then clear out any bad values from the averages.
-	time.Sleep(500 * time.Millisecond) // Make sure it's ready
-	<-mpu.CAvg                         // Discard the first readings.
+	// Give the IMU time to fully initialize; readSensors leaves its first readings out of the averages.
+	time.Sleep(settleTime)
 
 	return mpu, nil
 }
 
-// readSensors polls the gyro, accelerometer and magnetometer sensors as well as the die temperature.
+// Identity returns the chip name, I2C address and WHO_AM_I value.
+func (mpu *MPU9250) Identity() sensors.Identity {
+	return sensors.Identity{Name: "MPU9250", Kind: sensors.KindIMU, Address: mpu.Address, ChipID: mpu.chipID}
+}
+
+// Start polls the MPU in a goroutine until ctx is done or Stop is called.
+// NewMPU9250 already starts it, so this is only needed to restart it after Stop.
+func (mpu *MPU9250) Start(ctx context.Context) error {
+	return mpu.poller.Start(ctx, mpu.readSensors)
+}
+
+// Stop stops the driver from reading the MPU and waits for it to finish.
+func (mpu *MPU9250) Stop() error {
+	return mpu.poller.Stop()
+}
+
+// Health reports how the MPU polling is going.
+func (mpu *MPU9250) Health() sensors.Health {
+	return mpu.poller.Health()
+}
+
+// Subscribe returns a channel receiving every new instantaneous reading, buffering up to bufSize of them,
+// and a function to cancel the subscription.
+func (mpu *MPU9250) Subscribe(bufSize int) (<-chan *sensors.IMUData, func()) {
+	return mpu.feed.Subscribe(bufSize)
+}
+
+// readSensors polls the gyro, accelerometer and magnetometer sensors as well as the die temperature
+// until ctx is done.
 // Communication is via channels.
-func (mpu *MPU9250) readSensors() {
+func (mpu *MPU9250) readSensors(ctx context.Context) {
 	var (
 		g1, g2, g3, a1, a2, a3, m1, m2, m3, m4, tmp int16   // Current values
 		avg1, avg2, avg3, ava1, ava2, ava3, avtmp   float64 // Accumulators for averages
@@ -233,25 +318,32 @@ func (mpu *MPU9250) readSensors() {
 		magSampleRate = mpu.sampleRate
 	}
 
-	cC := make(chan *sensors.IMUData)
-	defer close(cC)
-	mpu.C = cC
-	cAvg := make(chan *sensors.IMUData)
-	defer close(cAvg)
-	mpu.CAvg = cAvg
-	cBuf := make(chan *sensors.IMUData, bufSize)
-	defer close(cBuf)
-	mpu.CBuf = cBuf
-	mpu.cClose = make(chan bool)
-	defer close(mpu.cClose)
-
-	clock := time.NewTicker(time.Duration(int(1000.0/float32(mpu.sampleRate)+0.5)) * time.Millisecond)
-	//TODO westphae: use the clock to record actual time instead of a timer
+	cC, cAvg, cBuf := mpu.c, mpu.cAvg, mpu.cBuf
+
+	period := time.Duration(int(1000.0/float32(mpu.sampleRate)+0.5)) * time.Millisecond
+	fifoClock := sensors.FIFOClock{Period: time.Duration(1000/mpu.sampleRate) * time.Millisecond} // As set by SMPLRT_DIV
+	if mpu.fifo {
+		if period < fifoReadInterval {
+			period = fifoReadInterval
+		}
+		// Drop any samples queued while stopped, they can't be timestamped
+		if err := mpu.resetFIFO(); err != nil {
+			mpu.poller.Read(time.Now(), err)
+		}
+	}
+	clock := time.NewTicker(period)
 	defer clock.Stop()
+	ready := clock.C // The ticker times the samples, unless the data-ready interrupt does
+	if mpu.dataReady != nil {
+		clock.Stop()
+		ready = mpu.dataReady.Edges()
+	}
 
 	clockMag := time.NewTicker(time.Duration(int(1000.0/float32(magSampleRate)+0.5)) * time.Millisecond)
+	defer clockMag.Stop()
 	t0 = time.Now()
 	t0m = time.Now()
+	settled := time.After(settleTime)
 
 	makeIMUData := func() *sensors.IMUData {
 		mm1 := float64(m1)*mpu.mcal1 - mpu.M01
@@ -273,6 +365,8 @@ func (mpu *MPU9250) readSensors() {
 			T: t, TM: tm,
 			DT: time.Duration(0), DTM: time.Duration(0),
 		}
+		mpu.CompensateTemp(&d)
+		mpu.AccelCal.Correct(&d)
 		if gaError != nil {
 			d.N = 0
 		}
@@ -298,6 +392,8 @@ func (mpu *MPU9250) readSensors() {
 			d.N = int(n + 0.5)
 			d.T = t
 			d.DT = t.Sub(t0)
+			mpu.CompensateTemp(&d)
+			mpu.AccelCal.Correct(&d)
 		} else {
 			d.GAError = errors.New("mpu9250 error: No new accel/gyro values")
 		}
@@ -314,52 +410,93 @@ func (mpu *MPU9250) readSensors() {
 		return &d
 	}
 
+	resetAvg := func() {
+		avg1, avg2, avg3 = 0, 0, 0
+		ava1, ava2, ava3 = 0, 0, 0
+		avm1, avm2, avm3 = 0, 0, 0
+		avtmp = 0
+		n, nm = 0, 0
+		t0, t0m = t, tm
+	}
+
+	// publish sends out the current values and adds them to the averages.
+	publish := func() {
+		curdata = makeIMUData()
+		mpu.feed.Publish(curdata)
+		// Update accumulated values and increment count of gyro/accel readings
+		avg1 += float64(g1)
+		avg2 += float64(g2)
+		avg3 += float64(g3)
+		ava1 += float64(a1)
+		ava2 += float64(a2)
+		ava3 += float64(a3)
+		avtmp += float64(tmp)
+		avm1 += int32(m1)
+		avm2 += int32(m2)
+		avm3 += int32(m3)
+		n++
+		select {
+		case cBuf <- curdata: // We update the buffer every time we read a new value.
+		default: // If buffer is full, remove oldest value and put in newest.
+			<-cBuf
+			cBuf <- curdata
+		}
+	}
+
 	for {
 		select {
-		case t = <-clock.C: // Read accel/gyro data:
+		case tick, ok := <-ready: // Read accel/gyro data:
+			if !ok {
+				log.Println("mpu9250 error: data-ready interrupt edges stopped")
+				mpu.poller.Read(time.Now(), sensors.ErrEdgesClosed)
+				return
+			}
+			if mpu.fifo {
+				frames, err := mpu.readFIFO()
+				if err != nil {
+					log.Printf("mpu9250 warning: %s", err)
+					fifoClock.Reset()
+				}
+				mpu.poller.Read(tick, err)
+				for i, ts := range fifoClock.Stamp(time.Now(), len(frames)/fifoFrameSize) {
+					f := frames[i*fifoFrameSize:]
+					a1, a2, a3, tmp = fifoWord(f, 0), fifoWord(f, 2), fifoWord(f, 4), fifoWord(f, 6)
+					g1, g2, g3 = fifoWord(f, 8), fifoWord(f, 10), fifoWord(f, 12)
+					t, gaError = ts, nil
+					publish()
+				}
+				break
+			}
+
+			t = tick
+			var readError error
 			for p, reg := range acRegMap {
-				*p, gaError = mpu.i2cRead2(reg)
+				*p, gaError = mpu.regRead2(reg)
 				if gaError != nil {
 					log.Println("mpu9250 warning: error reading gyro/accel")
+					readError = gaError
 				}
 			}
-			curdata = makeIMUData()
-			// Update accumulated values and increment count of gyro/accel readings
-			avg1 += float64(g1)
-			avg2 += float64(g2)
-			avg3 += float64(g3)
-			ava1 += float64(a1)
-			ava2 += float64(a2)
-			ava3 += float64(a3)
-			avtmp += float64(tmp)
-			avm1 += int32(m1)
-			avm2 += int32(m2)
-			avm3 += int32(m3)
-			n++
-			select {
-			case cBuf <- curdata: // We update the buffer every time we read a new value.
-			default: // If buffer is full, remove oldest value and put in newest.
-				<-cBuf
-				cBuf <- curdata
-			}
+			mpu.poller.Read(t, readError)
+			publish()
 		case tm = <-clockMag.C: // Read magnetometer data:
 			if mpu.enableMag {
 				// Set AK8963 to slave0 for reading
-				if err := mpu.i2cWrite(MPUREG_I2C_SLV0_ADDR, AK8963_I2C_ADDR|READ_FLAG); err != nil {
+				if err := mpu.regWrite(MPUREG_I2C_SLV0_ADDR, AK8963_I2C_ADDR|READ_FLAG); err != nil {
 					log.Printf("mpu9250 error: couldn't set AK8963 address for reading: %s", err.Error())
 				}
 				//I2C slave 0 register address from where to begin data transfer
-				if err := mpu.i2cWrite(MPUREG_I2C_SLV0_REG, AK8963_HXL); err != nil {
+				if err := mpu.regWrite(MPUREG_I2C_SLV0_REG, AK8963_HXL); err != nil {
 					log.Printf("mpu9250 error: couldn't set AK8963 read register: %s", err.Error())
 				}
 				//Tell AK8963 that we will read 7 bytes
-				if err := mpu.i2cWrite(MPUREG_I2C_SLV0_CTRL, 0x87); err != nil {
+				if err := mpu.regWrite(MPUREG_I2C_SLV0_CTRL, 0x87); err != nil {
 					log.Printf("mpu9250 error: couldn't communicate with AK8963: %s", err.Error())
 				}
 
 				// Read the actual data
 				for p, reg := range magRegMap {
-					*p, magError = mpu.i2cRead2(reg)
+					*p, magError = mpu.regRead2(reg)
 					if magError != nil {
 						log.Println("mpu9250 warning: error reading magnetometer")
 					}
@@ -386,28 +523,25 @@ func (mpu *MPU9250) readSensors() {
 			}
 		case cC <- curdata: // Send the latest values
 		case cAvg <- makeAvgIMUData(): // Send the averages
-			avg1, avg2, avg3 = 0, 0, 0
-			ava1, ava2, ava3 = 0, 0, 0
-			avm1, avm2, avm3 = 0, 0, 0
-			avtmp = 0
-			n, nm = 0, 0
-			t0, t0m = t, tm
-		case <-mpu.cClose: // Stop the goroutine, ease up on the CPU
-			break
+			resetAvg()
+		case <-settled: // Clear out any bad values from the averages
+			resetAvg()
+			settled = nil
+		case <-ctx.Done(): // Stop the goroutine, ease up on the CPU
+			return
 		}
 	}
 }
 
-// CloseMPU stops the driver from reading the MPU.
-//TODO westphae: need a way to start it going again!
+// CloseMPU stops the driver from reading the MPU.  Start starts it going again.
 func (mpu *MPU9250) CloseMPU() {
 	// Nothing to do bitwise for the 9250?
-	mpu.cClose <- true
+	mpu.Stop()
 }
 
 // SetSampleRate changes the sampling rate of the MPU.
 func (mpu *MPU9250) SetSampleRate(rate byte) (err error) {
-	errWrite := mpu.i2cWrite(MPUREG_SMPLRT_DIV, rate) // Set sample rate to chosen
+	errWrite := mpu.regWrite(MPUREG_SMPLRT_DIV, rate) // Set sample rate to chosen
 	if errWrite != nil {
 		err = fmt.Errorf("mpu9250 error: couldn't set sample rate: %s", errWrite.Error())
 	}
@@ -432,7 +566,7 @@ func (mpu *MPU9250) SetGyroLPF(rate byte) (err error) {
 		r = BITS_DLPF_CFG_5HZ
 	}
 
-	errWrite := mpu.i2cWrite(MPUREG_CONFIG, r)
+	errWrite := mpu.regWrite(MPUREG_CONFIG, r)
 	if errWrite != nil {
 		err = fmt.Errorf("MPU9250 Error: couldn't set Gyro LPF: %s", errWrite.Error())
 	}
@@ -457,7 +591,7 @@ func (mpu *MPU9250) SetAccelLPF(rate byte) (err error) {
 		r = BITS_DLPF_CFG_5HZ
 	}
 
-	errWrite := mpu.i2cWrite(MPUREG_ACCEL_CONFIG_2, r)
+	errWrite := mpu.regWrite(MPUREG_ACCEL_CONFIG_2, r)
 	if errWrite != nil {
 		err = fmt.Errorf("MPU9250 Error: couldn't set Accel LPF: %s", errWrite.Error())
 	}
@@ -493,6 +627,68 @@ func (mpu *MPU9250) MagEnabled() bool {
 	return mpu.enableMag
 }
 
+/*
+SetFIFO switches between polling the gyro, accelerometer and temperature registers, the default, and having the
+MPU queue them in its FIFO at the sample rate, to be read in bursts.  FIFO samples are timestamped from the sample
+rate rather than from when they are read, so they don't suffer from scheduling jitter, and none are missed at high
+sample rates.  The magnetometer is still polled.  The MPU must be stopped.
+*/
+func (mpu *MPU9250) SetFIFO(enable bool) error {
+	if mpu.Health().Status != sensors.StatusStopped {
+		return sensors.ErrRunning
+	}
+
+	ctrl, err := mpu.regRead(MPUREG_USER_CTRL)
+	if err != nil {
+		return fmt.Errorf("mpu9250 error: couldn't configure FIFO: %w", err)
+	}
+	var fifoEn byte
+	ctrl &^= BIT_FIFO_EN
+	if enable {
+		fifoEn = BITS_FIFO_ACCEL_GYRO_TEMP
+		ctrl |= BIT_FIFO_EN | BIT_FIFO_RST
+	}
+	if err := mpu.regWrite(MPUREG_FIFO_EN, fifoEn); err != nil {
+		return fmt.Errorf("mpu9250 error: couldn't configure FIFO: %w", err)
+	}
+	if err := mpu.regWrite(MPUREG_USER_CTRL, ctrl); err != nil {
+		return fmt.Errorf("mpu9250 error: couldn't configure FIFO: %w", err)
+	}
+
+	mpu.fifo = enable
+	return nil
+}
+
+// FIFOEnabled returns whether the gyro and accelerometer are being read from the FIFO.
+func (mpu *MPU9250) FIFOEnabled() bool {
+	return mpu.fifo
+}
+
+/*
+SetDataReadyInterrupt paces the reading of the gyro and accelerometer by the MPU's data-ready interrupt instead
+of a ticker, so that each sample is read as soon as it is ready and timestamped with the time of the interrupt
+edge.  edges watches the GPIO wired to the INT pin, which the MPU pulses high for 50µs after each sample, e.g. a
+gpiodev.Line; nil goes back to the ticker.  In FIFO mode each edge triggers a burst read instead.
+The MPU must be stopped.
+*/
+func (mpu *MPU9250) SetDataReadyInterrupt(edges sensors.EdgeSource) error {
+	if mpu.Health().Status != sensors.StatusStopped {
+		return sensors.ErrRunning
+	}
+
+	var intEnable byte
+	if edges != nil {
+		intEnable = BIT_RAW_RDY_EN
+	}
+	// INT_PIN_CFG is left at its default of an active high, push-pull, 50µs pulse
+	if err := mpu.regWrite(MPUREG_INT_ENABLE, intEnable); err != nil {
+		return fmt.Errorf("mpu9250 error: couldn't configure data-ready interrupt: %w", err)
+	}
+
+	mpu.dataReady = edges
+	return nil
+}
+
 // SetGyroSensitivity sets the gyro sensitivity of the MPU9250; it must be one of the following values:
 // 250, 500, 1000, 2000 (all in deg/s).
 func (mpu *MPU9250) SetGyroSensitivity(sensitivityGyro int) (err error) {
@@ -515,7 +711,7 @@ func (mpu *MPU9250) SetGyroSensitivity(sensitivityGyro int) (err error) {
 		err = fmt.Errorf("MPU9250 Error: %d is not a valid gyro sensitivity", sensitivityGyro)
 	}
 
-	if errWrite := mpu.i2cWrite(MPUREG_GYRO_CONFIG, sensGyro); errWrite != nil {
+	if errWrite := mpu.regWrite(MPUREG_GYRO_CONFIG, sensGyro); errWrite != nil {
 		err = errors.New("MPU9250 Error: couldn't set gyro sensitivity")
 	}
 
@@ -544,7 +740,7 @@ func (mpu *MPU9250) SetAccelSensitivity(sensitivityAccel int) (err error) {
 		err = fmt.Errorf("MPU9250 Error: %d is not a valid accel sensitivity", sensitivityAccel)
 	}
 
-	if errWrite := mpu.i2cWrite(MPUREG_ACCEL_CONFIG, sensAccel); errWrite != nil {
+	if errWrite := mpu.regWrite(MPUREG_ACCEL_CONFIG, sensAccel); errWrite != nil {
 		err = errors.New("MPU9250 Error: couldn't set accel sensitivity")
 	}
 
@@ -554,15 +750,15 @@ func (mpu *MPU9250) SetAccelSensitivity(sensitivityAccel int) (err error) {
 // ReadAccelBias reads the bias accelerometer value stored on the chip.
 // These values are set at the factory.
 func (mpu *MPU9250) ReadAccelBias(sensitivityAccel int) error {
-	a0x, err := mpu.i2cRead2(MPUREG_XA_OFFSET_H)
+	a0x, err := mpu.regRead2(MPUREG_XA_OFFSET_H)
 	if err != nil {
 		return errors.New("MPU9250 Error: ReadAccelBias error reading chip")
 	}
-	a0y, err := mpu.i2cRead2(MPUREG_YA_OFFSET_H)
+	a0y, err := mpu.regRead2(MPUREG_YA_OFFSET_H)
 	if err != nil {
 		return errors.New("MPU9250 Error: ReadAccelBias error reading chip")
 	}
-	a0z, err := mpu.i2cRead2(MPUREG_ZA_OFFSET_H)
+	a0z, err := mpu.regRead2(MPUREG_ZA_OFFSET_H)
 	if err != nil {
 		return errors.New("MPU9250 Error: ReadAccelBias error reading chip")
 	}
@@ -594,15 +790,15 @@ func (mpu *MPU9250) ReadAccelBias(sensitivityAccel int) error {
 // ReadGyroBias reads the bias gyro value stored on the chip.
 // These values are set at the factory.
 func (mpu *MPU9250) ReadGyroBias(sensitivityGyro int) error {
-	g0x, err := mpu.i2cRead2(MPUREG_XG_OFFS_USRH)
+	g0x, err := mpu.regRead2(MPUREG_XG_OFFS_USRH)
 	if err != nil {
 		return errors.New("MPU9250 Error: ReadGyroBias error reading chip")
 	}
-	g0y, err := mpu.i2cRead2(MPUREG_YG_OFFS_USRH)
+	g0y, err := mpu.regRead2(MPUREG_YG_OFFS_USRH)
 	if err != nil {
 		return errors.New("MPU9250 Error: ReadGyroBias error reading chip")
 	}
-	g0z, err := mpu.i2cRead2(MPUREG_ZG_OFFS_USRH)
+	g0z, err := mpu.regRead2(MPUREG_ZG_OFFS_USRH)
 	if err != nil {
 		return errors.New("MPU9250 Error: ReadGyroBias error reading chip")
 	}
@@ -637,48 +833,48 @@ func (mpu *MPU9250) ReadMagCalibration() error {
 	// Enable bypass mode
 	var tmp uint8
 	var err error
-	tmp, err = mpu.i2cRead(MPUREG_USER_CTRL)
+	tmp, err = mpu.regRead(MPUREG_USER_CTRL)
 	if err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
-	if err = mpu.i2cWrite(MPUREG_USER_CTRL, tmp & ^BIT_AUX_IF_EN); err != nil {
+	if err = mpu.regWrite(MPUREG_USER_CTRL, tmp & ^BIT_AUX_IF_EN); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	time.Sleep(3 * time.Millisecond)
-	if err = mpu.i2cWrite(MPUREG_INT_PIN_CFG, BIT_BYPASS_EN); err != nil {
+	if err = mpu.regWrite(MPUREG_INT_PIN_CFG, BIT_BYPASS_EN); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 
 	// Prepare for getting sensitivity data from AK8963
 	//Set the I2C slave address of AK8963
-	if err = mpu.i2cWrite(MPUREG_I2C_SLV0_ADDR, AK8963_I2C_ADDR); err != nil {
+	if err = mpu.regWrite(MPUREG_I2C_SLV0_ADDR, AK8963_I2C_ADDR); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	// Power down the AK8963
-	if err = mpu.i2cWrite(MPUREG_I2C_SLV0_CTRL, AK8963_CNTL1); err != nil {
+	if err = mpu.regWrite(MPUREG_I2C_SLV0_CTRL, AK8963_CNTL1); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	// Power down the AK8963
-	if err = mpu.i2cWrite(MPUREG_I2C_SLV0_DO, AKM_POWER_DOWN); err != nil {
+	if err = mpu.regWrite(MPUREG_I2C_SLV0_DO, AKM_POWER_DOWN); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	time.Sleep(time.Millisecond)
 	// Fuse AK8963 ROM access
-	if err = mpu.i2cWrite(MPUREG_I2C_SLV0_DO, AK8963_I2CDIS); err != nil {
+	if err = mpu.regWrite(MPUREG_I2C_SLV0_DO, AK8963_I2CDIS); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	time.Sleep(time.Millisecond)
 
 	// Get sensitivity data from AK8963 fuse ROM
-	mcal1, err := mpu.i2cRead(AK8963_ASAX)
+	mcal1, err := mpu.regRead(AK8963_ASAX)
 	if err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
-	mcal2, err := mpu.i2cRead(AK8963_ASAY)
+	mcal2, err := mpu.regRead(AK8963_ASAY)
 	if err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
-	mcal3, err := mpu.i2cRead(AK8963_ASAZ)
+	mcal3, err := mpu.regRead(AK8963_ASAZ)
 	if err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
@@ -689,21 +885,21 @@ func (mpu *MPU9250) ReadMagCalibration() error {
 
 	// Clean up from getting sensitivity data from AK8963
 	// Fuse AK8963 ROM access
-	if err = mpu.i2cWrite(MPUREG_I2C_SLV0_DO, AK8963_I2CDIS); err != nil {
+	if err = mpu.regWrite(MPUREG_I2C_SLV0_DO, AK8963_I2CDIS); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	time.Sleep(time.Millisecond)
 
 	// Disable bypass mode now that we're done getting sensitivity data
-	tmp, err = mpu.i2cRead(MPUREG_USER_CTRL)
+	tmp, err = mpu.regRead(MPUREG_USER_CTRL)
 	if err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
-	if err = mpu.i2cWrite(MPUREG_USER_CTRL, tmp|BIT_AUX_IF_EN); err != nil {
+	if err = mpu.regWrite(MPUREG_USER_CTRL, tmp|BIT_AUX_IF_EN); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	time.Sleep(3 * time.Millisecond)
-	if err = mpu.i2cWrite(MPUREG_INT_PIN_CFG, 0x00); err != nil {
+	if err = mpu.regWrite(MPUREG_INT_PIN_CFG, 0x00); err != nil {
 		return errors.New("ReadMagCalibration error reading chip")
 	}
 	time.Sleep(3 * time.Millisecond)
@@ -711,9 +907,9 @@ func (mpu *MPU9250) ReadMagCalibration() error {
 	return nil
 }
 
-func (mpu *MPU9250) i2cWrite(register, value byte) (err error) {
+func (mpu *MPU9250) regWrite(register, value byte) (err error) {
 
-	if errWrite := mpu.i2cbus.WriteByteToReg(mpu.Address, register, value); errWrite != nil {
+	if errWrite := mpu.regs.WriteByteToReg(register, value); errWrite != nil {
 		err = fmt.Errorf("mpu9250 error writing %X to %X: %s\n",
 			value, register, errWrite.Error())
 	} else {
@@ -722,17 +918,17 @@ func (mpu *MPU9250) i2cWrite(register, value byte) (err error) {
 	return
 }
 
-func (mpu *MPU9250) i2cRead(register byte) (value uint8, err error) {
-	value, errWrite := mpu.i2cbus.ReadByteFromReg(mpu.Address, register)
+func (mpu *MPU9250) regRead(register byte) (value uint8, err error) {
+	value, errWrite := mpu.regs.ReadByteFromReg(register)
 	if errWrite != nil {
-		err = fmt.Errorf("i2cRead error: %s", errWrite.Error())
+		err = fmt.Errorf("regRead error: %s", errWrite.Error())
 	}
 	return
 }
 
-func (mpu *MPU9250) i2cRead2(register byte) (value int16, err error) {
+func (mpu *MPU9250) regRead2(register byte) (value int16, err error) {
 
-	v, errWrite := mpu.i2cbus.ReadWordFromReg(mpu.Address, register)
+	v, errWrite := mpu.regs.ReadWordFromReg(register)
 	if errWrite != nil {
 		err = fmt.Errorf("mpu9250 error reading %x: %s\n", register, errWrite.Error())
 	} else {
@@ -741,6 +937,55 @@ func (mpu *MPU9250) i2cRead2(register byte) (value int16, err error) {
 	return
 }
 
+// readFIFO reads all the complete samples queued in the FIFO.
+// If it overflowed, the FIFO is reset and sensors.ErrFIFOOverflow returned, as samples were lost
+// and what is left no longer starts on a sample boundary.
+// The FIFO is reset after a failed burst read too, which may have taken part of a sample out of it,
+// and the burst isn't retried, which would take out more.
+func (mpu *MPU9250) readFIFO() ([]byte, error) {
+	status, err := mpu.regRead(MPUREG_INT_STATUS)
+	if err != nil {
+		return nil, err
+	}
+	if status&BIT_FIFO_OFLOW_INT != 0 {
+		if err := mpu.resetFIFO(); err != nil {
+			return nil, err
+		}
+		return nil, sensors.ErrFIFOOverflow
+	}
+
+	count, err := mpu.regRead2(MPUREG_FIFO_COUNTH)
+	if err != nil {
+		return nil, err
+	}
+	n := int(count&0x1FFF) / fifoFrameSize * fifoFrameSize
+	if n == 0 {
+		return nil, nil
+	}
+	frames := make([]byte, n)
+	if err := mpu.regs.ReadFromRegOnce(MPUREG_FIFO_R_W, frames); err != nil {
+		if errReset := mpu.resetFIFO(); errReset != nil {
+			log.Printf("mpu9250 warning: couldn't reset FIFO after failed read: %s", errReset)
+		}
+		return nil, fmt.Errorf("mpu9250 error reading FIFO: %w", err)
+	}
+	return frames, nil
+}
+
+// resetFIFO empties the FIFO.
+func (mpu *MPU9250) resetFIFO() error {
+	ctrl, err := mpu.regRead(MPUREG_USER_CTRL)
+	if err != nil {
+		return err
+	}
+	return mpu.regWrite(MPUREG_USER_CTRL, ctrl|BIT_FIFO_RST)
+}
+
+// fifoWord returns the big-endian word at b[i:i+2].
+func fifoWord(b []byte, i int) int16 {
+	return int16(uint16(b[i])<<8 | uint16(b[i+1]))
+}
+
 func (mpu *MPU9250) memWrite(addr uint16, data *[]byte) error {
 	var err error
 	var tmp = make([]byte, 2)
@@ -753,12 +998,12 @@ func (mpu *MPU9250) memWrite(addr uint16, data *[]byte) error {
 		return errors.New("bad address: writing outside of memory bank boundaries")
 	}
 
-	err = mpu.i2cbus.WriteToReg(mpu.Address, MPUREG_BANK_SEL, tmp)
+	err = mpu.regs.WriteToReg(MPUREG_BANK_SEL, tmp)
 	if err != nil {
 		return fmt.Errorf("mpu9250 error selecting memory bank: %s\n", err.Error())
 	}
 
-	err = mpu.i2cbus.WriteToReg(mpu.Address, MPUREG_MEM_R_W, *data)
+	err = mpu.regs.WriteToReg(MPUREG_MEM_R_W, *data)
 	if err != nil {
 		return fmt.Errorf("mpu9250 error writing to the memory bank: %s\n", err.Error())
 	}
@@ -0,0 +1,332 @@
+package mpu9250
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/westphae/goflying/i2ctest"
+	"github.com/westphae/goflying/sensors"
+)
+
+// tempCalStore points sensors.DefaultCalStore at a file in a temporary directory for the test,
+// so that the driver doesn't load the calibration data of the machine running it.
+func tempCalStore(t *testing.T) *sensors.CalStore {
+	s := sensors.DefaultCalStore
+	t.Cleanup(func() { sensors.DefaultCalStore = s })
+	sensors.DefaultCalStore = sensors.NewCalStore(filepath.Join(t.TempDir(), "imu_cal.json"))
+	return sensors.DefaultCalStore
+}
+
+func TestNewMPU9250(t *testing.T) {
+	tempCalStore(t)
+	b := i2ctest.NewBus()
+	chip := i2ctest.NewMPU9250()
+	chip.SetAccel(0, 0, 8192)
+	chip.SetGyro(131, -262, 0)
+	chip.SetTemp(340)
+	chip.SetWord(MPUREG_XA_OFFSET_H, 10)
+	chip.SetWord(MPUREG_XG_OFFS_USRH, 5)
+	// Accel 1 alternates between two values, to check the averaging
+	var frames [][]byte
+	for i := 0; i < 1000; i++ {
+		frames = append(frames, []byte{0, 100}, []byte{0x01, 0x2C})
+	}
+	chip.Script(MPUREG_ACCEL_XOUT_H, frames...)
+	b.Attach(MPU_ADDRESS1, chip)
+
+	mpu, err := NewMPU9250(b, MPU_ADDRESS1, 250, 4, 50, false, true)
+	if err != nil {
+		t.Fatalf("NewMPU9250() error = %v", err)
+	}
+	defer mpu.Stop()
+
+	if v := chip.Get(MPUREG_GYRO_CONFIG, 2); !bytes.Equal(v, []byte{BITS_FS_250DPS, BITS_FS_4G}) {
+		t.Errorf("GYRO_CONFIG, ACCEL_CONFIG = % X", v)
+	}
+	if v := chip.Get(MPUREG_SMPLRT_DIV, 1)[0]; v != 19 {
+		t.Errorf("SMPLRT_DIV = %d, want 19 for 50Hz", v)
+	}
+	if v := chip.DMPMemory(CFG_MOTION_BIAS, 9); !bytes.Equal(v, []byte{0xb8, 0xaa, 0xaa, 0xaa, 0xb0, 0x88, 0xc3, 0xc5, 0xc7}) {
+		t.Errorf("gyro bias compensation not disabled in DMP memory: % X", v)
+	}
+	if mpu.A01 != 20 || mpu.G01 != 20 {
+		t.Errorf("hardware offsets A01, G01 = %f, %f, want 20, 20", mpu.A01, mpu.G01)
+	}
+	if id := mpu.Identity(); id.ChipID != 0x71 || id.Kind != sensors.KindIMU {
+		t.Errorf("Identity() = %s", id)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	d := <-mpu.CAvg
+	if d.GAError != nil || d.N < 2 {
+		t.Fatalf("average of %d readings, error %v", d.N, d.GAError)
+	}
+	// The average of N alternating values 100 and 300 is within 100/N of 200
+	if a1 := d.A1/mpu.scaleAccel + mpu.A01; math.Abs(a1-200) > 100/float64(d.N)+1e-6 {
+		t.Errorf("raw A1 average over %d readings = %f, want 200", d.N, a1)
+	}
+	want := [...]float64{(131 - 20) * 250.0 / 32767, -262 * 250.0 / 32767, 0, 8192 * 4.0 / 32767}
+	if got := [...]float64{d.G1, d.G2, d.G3, d.A3}; math.Abs(got[0]-want[0]) > 1e-9 || math.Abs(got[1]-want[1]) > 1e-9 ||
+		got[2] != 0 || math.Abs(got[3]-want[3]) > 1e-9 {
+		t.Errorf("G1, G2, G3, A3 = %v, want %v", got, want)
+	}
+	if math.Abs(d.Temp-37.53) > 1e-9 {
+		t.Errorf("Temp = %f, want 37.53", d.Temp)
+	}
+
+	if err := mpu.Stop(); err != nil {
+		t.Errorf("Stop() error = %v", err)
+	}
+	if h := mpu.Health(); h.Status != sensors.StatusStopped || h.Reads < uint64(d.N) {
+		t.Errorf("Health() after Stop() = %+v", h)
+	}
+
+	// The channels survive a restart
+	cAvg := mpu.CAvg
+	if err := mpu.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	time.Sleep(settleTime + 200*time.Millisecond)
+	if d := <-cAvg; d.GAError != nil || d.N < 2 {
+		t.Errorf("average of %d readings after restart, error %v", d.N, d.GAError)
+	}
+}
+
+func TestNewMPU9250SPI(t *testing.T) {
+	tempCalStore(t)
+	chip := i2ctest.NewMPU9250()
+	chip.SetAccel(0, 0, 8192)
+	spi := i2ctest.NewSPI(chip, false)
+
+	mpu, err := NewMPU9250SPI(spi, 250, 4, 1000, false, false)
+	if err != nil {
+		t.Fatalf("NewMPU9250SPI() error = %v", err)
+	}
+	defer mpu.Stop()
+
+	if v := chip.Get(MPUREG_USER_CTRL, 1)[0]; v&BIT_I2C_IF_DIS == 0 {
+		t.Errorf("USER_CTRL = %X, I2C interface not disabled", v)
+	}
+	if v := chip.Get(MPUREG_SMPLRT_DIV, 1)[0]; v != 0 {
+		t.Errorf("SMPLRT_DIV = %d, want 0 for 1kHz", v)
+	}
+	if id := mpu.Identity(); id.ChipID != 0x71 {
+		t.Errorf("Identity() = %s", id)
+	}
+	for _, f := range spi.Frames() {
+		if f[0]&0x80 != 0 && f[0]&^0x80 == MPUREG_ACCEL_ZOUT_H {
+			return
+		}
+	}
+	t.Errorf("accelerometer never read over SPI")
+}
+
+func TestMPU9250FIFO(t *testing.T) {
+	tempCalStore(t)
+	b := i2ctest.NewBus()
+	chip := i2ctest.NewMPU9250()
+	b.Attach(MPU_ADDRESS1, chip)
+
+	mpu, err := NewMPU9250(b, MPU_ADDRESS1, 250, 4, 50, false, false)
+	if err != nil {
+		t.Fatalf("NewMPU9250() error = %v", err)
+	}
+	if err := mpu.SetFIFO(true); err != sensors.ErrRunning {
+		t.Errorf("SetFIFO() while running error = %v, want ErrRunning", err)
+	}
+	mpu.Stop()
+	if err := mpu.SetFIFO(true); err != nil {
+		t.Fatalf("SetFIFO() error = %v", err)
+	}
+	if v := chip.Get(MPUREG_FIFO_EN, 1)[0]; v != BITS_FIFO_ACCEL_GYRO_TEMP {
+		t.Errorf("FIFO_EN = %X", v)
+	}
+
+	c, cancel := mpu.Subscribe(50)
+	defer cancel()
+	reads := mpu.Health().Reads
+	if err := mpu.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer mpu.Stop()
+	for mpu.Health().Reads == reads { // Wait for the FIFO to be reset
+		time.Sleep(time.Millisecond)
+	}
+
+	chip.SetAccel(7, 0, 8192)
+	chip.SetGyro(131, -262, 0)
+	chip.SetTemp(340)
+	chip.PushFIFO(5)
+	var prev time.Time
+	for i := 1; i <= 5; i++ {
+		select {
+		case d := <-c:
+			if a1 := d.A1 / mpu.scaleAccel; math.Abs(a1-7) > 1e-6 || math.Abs(d.A3-1) > 1e-3 || math.Abs(d.G1-1) > 1e-3 ||
+				math.Abs(d.Temp-37.53) > 1e-9 {
+				t.Errorf("sample %d: raw A1 = %f, A3 = %f, G1 = %f, Temp = %f", i, a1, d.A3, d.G1, d.Temp)
+			}
+			if i > 1 && d.T.Sub(prev) != 20*time.Millisecond {
+				t.Errorf("sample %d taken %v after the previous, want 20ms", i, d.T.Sub(prev))
+			}
+			prev = d.T
+		case <-time.After(time.Second):
+			t.Fatalf("only got %d samples from the FIFO", i-1)
+		}
+	}
+
+	// A second of samples overflows the FIFO
+	chip.PushFIFO(50)
+	time.Sleep(100 * time.Millisecond)
+	if h := mpu.Health(); !errors.Is(h.LastError, sensors.ErrFIFOOverflow) {
+		t.Errorf("Health() after overflow = %+v", h)
+	}
+	select {
+	case d := <-c:
+		t.Errorf("got a sample %+v from an overflowed FIFO", d)
+	default:
+	}
+
+	// A failed burst read, which took part of a sample, resets the FIFO so later samples stay aligned
+	errRead := errors.New("read failed")
+	chip.Fail(MPUREG_FIFO_R_W, errRead)
+	chip.PushFIFO(5)
+	for deadline := time.Now().Add(time.Second); !errors.Is(mpu.Health().LastError, errRead); {
+		if time.Now().After(deadline) {
+			t.Fatalf("Health() after failed FIFO read = %+v", mpu.Health())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	chip.Fail(MPUREG_FIFO_R_W, nil)
+	chip.SetAccel(9, 0, 8192)
+	chip.PushFIFO(5)
+	for i := 1; i <= 5; i++ {
+		select {
+		case d := <-c:
+			if a1 := d.A1 / mpu.scaleAccel; math.Abs(a1-9) > 1e-6 || math.Abs(d.A3-1) > 1e-3 || math.Abs(d.G1-1) > 1e-3 {
+				t.Errorf("sample %d after failed read: raw A1 = %f, A3 = %f, G1 = %f", i, a1, d.A3, d.G1)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("only got %d samples from the FIFO after a failed read", i-1)
+		}
+	}
+}
+
+func TestMPU9250DataReadyInterrupt(t *testing.T) {
+	tempCalStore(t)
+	b := i2ctest.NewBus()
+	chip := i2ctest.NewMPU9250()
+	b.Attach(MPU_ADDRESS1, chip)
+
+	mpu, err := NewMPU9250(b, MPU_ADDRESS1, 250, 4, 50, false, false)
+	if err != nil {
+		t.Fatalf("NewMPU9250() error = %v", err)
+	}
+	mpu.Stop()
+	edges := i2ctest.NewEdges()
+	if err := mpu.SetDataReadyInterrupt(edges); err != nil {
+		t.Fatalf("SetDataReadyInterrupt() error = %v", err)
+	}
+	if v := chip.Get(MPUREG_INT_ENABLE, 1)[0]; v != BIT_RAW_RDY_EN {
+		t.Errorf("INT_ENABLE = %X", v)
+	}
+
+	c, cancel := mpu.Subscribe(10)
+	defer cancel()
+	if err := mpu.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer mpu.Stop()
+
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := int16(1); i <= 3; i++ {
+		chip.SetAccel(i, 0, 0)
+		ts := t0.Add(time.Duration(i) * time.Millisecond)
+		edges.Fire(ts)
+		select {
+		case d := <-c:
+			if a1 := d.A1 / mpu.scaleAccel; !d.T.Equal(ts) || math.Abs(a1-float64(i)) > 1e-6 {
+				t.Errorf("sample %d: T = %v, raw A1 = %f, want %v, %d", i, d.T, a1, ts, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no sample after edge %d", i)
+		}
+	}
+	select {
+	case d := <-c:
+		t.Errorf("got a sample %+v without an edge", d)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	edges.Close()
+	for start := time.Now(); mpu.Health().Status != sensors.StatusStopped; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("still polling after the edges stopped")
+		}
+	}
+	if h := mpu.Health(); !errors.Is(h.LastError, sensors.ErrEdgesClosed) {
+		t.Errorf("Health() after the edges stopped = %+v", h)
+	}
+}
+
+func TestMPU9250TempBias(t *testing.T) {
+	tempCalStore(t)
+	b := i2ctest.NewBus()
+	chip := i2ctest.NewMPU9250()
+	chip.SetAccel(0, 0, 8192)
+	chip.SetTemp(340) // 37.53°C
+	b.Attach(MPU_ADDRESS1, chip)
+
+	mpu, err := NewMPU9250(b, MPU_ADDRESS1, 250, 4, 50, false, false)
+	if err != nil {
+		t.Fatalf("NewMPU9250() error = %v", err)
+	}
+	mpu.Stop()
+	mpu.GyroTemp = sensors.TempBias{T0: 30, Coeffs: [3][]float64{{0.5, 0.1}}}
+	mpu.AccelTemp = sensors.TempBias{T0: 30, Coeffs: [3][]float64{nil, nil, {0, 0.01}}}
+
+	c, cancel := mpu.Subscribe(10)
+	defer cancel()
+	if err := mpu.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer mpu.Stop()
+
+	select {
+	case d := <-c:
+		want := [...]float64{-0.5 - 0.1*7.53, 8192*4.0/32767 - 0.01*7.53}
+		if math.Abs(d.G1-want[0]) > 1e-9 || math.Abs(d.A3-want[1]) > 1e-9 {
+			t.Errorf("G1, A3 = %f, %f, want %v", d.G1, d.A3, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no readings")
+	}
+}
+
+func TestMPU9250CalKey(t *testing.T) {
+	cs := tempCalStore(t)
+	b := i2ctest.NewBus()
+	b.Attach(MPU_ADDRESS1, i2ctest.NewMPU9250())
+	b.Attach(MPU_ADDRESS2, i2ctest.NewMPU9250())
+	for i, addr := range []byte{MPU_ADDRESS1, MPU_ADDRESS2} {
+		id := sensors.Identity{Name: "MPU9250", Address: addr}
+		if err := cs.Save(id.CalKey(), sensors.IMUCalData{A01: float64(i + 1), Ms11: 1}); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	for i, addr := range []byte{MPU_ADDRESS1, MPU_ADDRESS2} {
+		mpu, err := NewMPU9250(b, addr, 250, 4, 50, false, false)
+		if err != nil {
+			t.Fatalf("NewMPU9250() error = %v", err)
+		}
+		mpu.Stop()
+		if mpu.A01 != float64(i+1) {
+			t.Errorf("MPU9250 at 0x%02X loaded A01 = %f, want %d", addr, mpu.A01, i+1)
+		}
+	}
+}
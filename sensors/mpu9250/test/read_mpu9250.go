@@ -4,16 +4,21 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/kidoman/embd"
+	"github.com/westphae/goflying/i2cdev"
 	"github.com/westphae/goflying/sensors/mpu9250"
 )
 
 func main() {
-	i2cbus := embd.NewI2CBus(1)
+	bus, err := i2cdev.Open(1)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bus.Close()
 
 	var mpus []*mpu9250.MPU9250
 	for i, address := range []byte{mpu9250.MPU_ADDRESS1, mpu9250.MPU_ADDRESS2} {
-		mpu, err := mpu9250.NewMPU9250(&i2cbus, address, 250, 4, 1000, true, false)
+		mpu, err := mpu9250.NewMPU9250(bus, address, 250, 4, 1000, true, false)
 		if err != nil {
 			fmt.Printf("no MPU9250 at address %d: %s\n", i, err)
 			continue
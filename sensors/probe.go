@@ -0,0 +1,157 @@
+package sensors
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/westphae/goflying"
+)
+
+/*
+Signature describes how Probe recognizes a kind of sensor chip on an I2C bus: by reading Register at
+each of Addresses and finding one of IDs there.
+A driver whose Signature has no Addresses is never probed for.
+*/
+type Signature struct {
+	Kind      Kind
+	Addresses []byte
+	Register  byte   // WHO_AM_I or ChipID register
+	IDs       []byte // Values of Register identifying the chip
+	Priority  int    // Signatures are tried at each address by decreasing Priority, then by name
+}
+
+// ErrNoIMU is returned by OpenFirstIMU when it can't open any IMU.
+var ErrNoIMU = errors.New("sensors: no IMU found")
+
+// Descriptor describes a sensor chip found by Probe.
+type Descriptor struct {
+	Identity
+	Bus I2CBus
+}
+
+// Open constructs and starts the driver for the chip with the driver's default settings.
+// The driver package must have been imported so that it has registered itself with RegisterDriver.
+func (d Descriptor) Open() (Device, error) {
+	driversMu.RLock()
+	drv, ok := drivers[d.Name]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("sensors: no driver registered for %s", d.Name)
+	}
+
+	dev, err := drv.open(d)
+	if err != nil {
+		return nil, fmt.Errorf("sensors: opening %s: %w", d.Identity, err)
+	}
+	return dev, nil
+}
+
+// OpenFunc constructs and starts a driver for the chip described by d.
+type OpenFunc func(d Descriptor) (Device, error)
+
+type driver struct {
+	name string
+	sig  Signature
+	open OpenFunc
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]driver)
+)
+
+// RegisterDriver makes a driver available to Descriptor.Open for chips with the given name,
+// and to Probe for chips matching sig.
+// Driver packages call it from their init functions.
+func RegisterDriver(name string, sig Signature, open OpenFunc) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if _, ok := drivers[name]; ok {
+		panic(fmt.Sprintf("sensors: driver %s registered twice", name))
+	}
+	drivers[name] = driver{name, sig, open}
+}
+
+// probeOrder returns the registered drivers in the order Probe tries them.
+func probeOrder() (ds []driver) {
+	driversMu.RLock()
+	for _, d := range drivers {
+		if len(d.sig.Addresses) > 0 {
+			ds = append(ds, d)
+		}
+	}
+	driversMu.RUnlock()
+
+	sort.Slice(ds, func(i, j int) bool {
+		if ds[i].sig.Priority != ds[j].sig.Priority {
+			return ds[i].sig.Priority > ds[j].sig.Priority
+		}
+		return ds[i].name < ds[j].name
+	})
+	return
+}
+
+// Probe scans bus for the chips of the registered drivers by reading their identifying registers,
+// and returns a Descriptor for each one found, in order of address.
+// An address that doesn't respond or holds an unknown chip is skipped.
+func Probe(bus I2CBus) (found []Descriptor) {
+	seen := make(map[byte]bool)
+	for _, d := range probeOrder() {
+		for _, addr := range d.sig.Addresses {
+			if seen[addr] {
+				continue
+			}
+
+			v, err := bus.ReadByteFromReg(addr, d.sig.Register)
+			if err != nil {
+				continue
+			}
+			for _, id := range d.sig.IDs {
+				if v == id {
+					seen[addr] = true
+					found = append(found, Descriptor{
+						Identity: Identity{Name: d.name, Kind: d.sig.Kind, Address: addr, ChipID: v},
+						Bus:      bus,
+					})
+					goflying.Debugf("sensors: found %s\n", found[len(found)-1].Identity)
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Address < found[j].Address })
+	return
+}
+
+/*
+OpenFirstIMU opens the first IMU Probe finds on bus whose driver keeps its calibration data in an embedded
+IMUCalData, and returns it, started, with its calibration data and Identity.
+The driver packages must have been imported so that they have registered themselves with RegisterDriver.
+*/
+func OpenFirstIMU(bus I2CBus) (IMU, *IMUCalData, Identity, error) {
+	var openErr error
+	for _, d := range Probe(bus) {
+		if d.Kind != KindIMU {
+			continue
+		}
+		dev, err := d.Open()
+		if err != nil {
+			openErr = err
+			continue
+		}
+		if imu, ok := dev.(interface {
+			IMU
+			CalData() *IMUCalData
+		}); ok {
+			return imu, imu.CalData(), d.Identity, nil
+		}
+		dev.Stop()
+	}
+	if openErr != nil {
+		return nil, nil, Identity{}, fmt.Errorf("%w: %v", ErrNoIMU, openErr)
+	}
+	return nil, nil, Identity{}, ErrNoIMU
+}
@@ -0,0 +1,154 @@
+package sensors
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kidoman/embd"
+	"github.com/westphae/goflying"
+)
+
+// registerBus is an embd.I2CBus whose chips only answer register reads.
+type registerBus struct {
+	embd.I2CBus // Nil; the other methods aren't used
+	regs        map[byte]map[byte]byte
+}
+
+var errNoDevice = errors.New("no device")
+
+func (b registerBus) ReadFromReg(addr, reg byte, value []byte) error {
+	regs, ok := b.regs[addr]
+	if !ok {
+		return errNoDevice
+	}
+	for i := range value {
+		value[i] = regs[reg+byte(i)]
+	}
+	return nil
+}
+
+func (b registerBus) ReadByteFromReg(addr, reg byte) (byte, error) {
+	v := make([]byte, 1)
+	err := b.ReadFromReg(addr, reg, v)
+	return v[0], err
+}
+
+// testOpen is the OpenFunc of the drivers registered for TestProbe and TestOpenFirstIMU.
+func testOpen(d Descriptor) (Device, error) {
+	if d.Kind == KindIMU {
+		return &testIMU{testDevice: testDevice{id: d.Identity}}, nil
+	}
+	return &testDevice{id: d.Identity}, nil
+}
+
+func init() {
+	// The signatures of the real drivers, which can't be imported here
+	RegisterDriver("MPU9250", Signature{KindIMU, []byte{0x68, 0x69}, 0x75, []byte{0x71, 0x73}, 1}, testOpen)
+	RegisterDriver("ICM20948", Signature{KindIMU, []byte{0x68, 0x69}, 0x00, []byte{0xEA}, 0}, testOpen)
+	RegisterDriver("BME280", Signature{KindPressure, []byte{0x76, 0x77}, 0xD0, []byte{0x60}, 0}, testOpen)
+	RegisterDriver("BMP280", Signature{KindPressure, []byte{0x76, 0x77}, 0xD0, []byte{0x56, 0x57, 0x58}, 0}, testOpen)
+}
+
+func TestProbe(t *testing.T) {
+	bus := &goflying.I2CBus{I2CBus: registerBus{regs: map[byte]map[byte]byte{
+		0x68: {0x00: 0xEA, 0x75: 0x71}, // MPU9250 with an ICM20948 WHO_AM_I in its self-test register
+		0x69: {0x00: 0xEA, 0x75: 0x00}, // ICM20948
+		0x77: {0xD0: 0x58},             // BMP280
+		0x40: {0x00: 0xEA},             // Not a sensor address
+	}}}
+
+	var got []Identity
+	for _, d := range Probe(bus) {
+		if d.Bus != bus {
+			t.Errorf("%s: wrong bus", d.Identity)
+		}
+		got = append(got, d.Identity)
+	}
+	want := []Identity{
+		{Name: "MPU9250", Kind: KindIMU, Address: 0x68, ChipID: 0x71},
+		{Name: "ICM20948", Kind: KindIMU, Address: 0x69, ChipID: 0xEA},
+		{Name: "BMP280", Kind: KindPressure, Address: 0x77, ChipID: 0x58},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Probe() = %v, want %v", got, want)
+	}
+
+	bus = &goflying.I2CBus{I2CBus: registerBus{regs: map[byte]map[byte]byte{0x76: {0xD0: 0x60}, 0x77: {0xD0: 0x12}}}}
+	want = []Identity{{Name: "BME280", Kind: KindPressure, Address: 0x76, ChipID: 0x60}}
+	if got := Probe(bus); len(got) != 1 || got[0].Identity != want[0] {
+		t.Errorf("Probe() = %v, want %v", got, want)
+	}
+}
+
+// testDevice is a Device that does nothing.
+type testDevice struct {
+	id Identity
+	Poller
+}
+
+func (d *testDevice) Identity() Identity { return d.id }
+func (d *testDevice) Start(ctx context.Context) error {
+	return d.Poller.Start(ctx, func(ctx context.Context) { <-ctx.Done() })
+}
+
+// testIMU is an IMU that does nothing, with calibration data.
+type testIMU struct {
+	testDevice
+	IMUCalData
+}
+
+func (d *testIMU) Subscribe(bufSize int) (<-chan *IMUData, func()) {
+	return make(chan *IMUData), func() {}
+}
+
+func TestOpenFirstIMU(t *testing.T) {
+	bus := &goflying.I2CBus{I2CBus: registerBus{regs: map[byte]map[byte]byte{
+		0x69: {0x00: 0xEA, 0x75: 0x00}, // ICM20948
+		0x77: {0xD0: 0x58},             // BMP280
+	}}}
+	imu, cal, id, err := OpenFirstIMU(bus)
+	if err != nil {
+		t.Fatalf("OpenFirstIMU() error = %v", err)
+	}
+	if id.Name != "ICM20948" || imu.Identity() != id {
+		t.Errorf("OpenFirstIMU() opened %s, %s, want the ICM20948", imu.Identity(), id)
+	}
+	if cal != &imu.(*testIMU).IMUCalData {
+		t.Errorf("OpenFirstIMU() didn't return the IMU's own calibration data")
+	}
+
+	bus = &goflying.I2CBus{I2CBus: registerBus{regs: map[byte]map[byte]byte{0x77: {0xD0: 0x58}}}}
+	if _, _, _, err := OpenFirstIMU(bus); !errors.Is(err, ErrNoIMU) {
+		t.Errorf("OpenFirstIMU() without an IMU error = %v, want %v", err, ErrNoIMU)
+	}
+}
+
+func TestDescriptorOpen(t *testing.T) {
+	RegisterDriver("TEST", Signature{}, func(d Descriptor) (Device, error) {
+		if d.Address != 0x42 {
+			return nil, errNoDevice
+		}
+		return &testDevice{id: d.Identity}, nil
+	})
+
+	d := Descriptor{Identity: Identity{Name: "TEST", Address: 0x42}}
+	dev, err := d.Open()
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if dev.Identity() != d.Identity {
+		t.Errorf("Identity() = %s, want %s", dev.Identity(), d.Identity)
+	}
+
+	d.Address = 0x43
+	if _, err := d.Open(); !errors.Is(err, errNoDevice) {
+		t.Errorf("Open() error = %v, want %v", err, errNoDevice)
+	}
+
+	d.Name = "UNKNOWN"
+	if _, err := d.Open(); err == nil {
+		t.Errorf("Open() of unregistered driver succeeded")
+	}
+}
@@ -0,0 +1,155 @@
+package sensors
+
+import "fmt"
+
+const spiReadBit = 0x80 // Set in the register address byte of an SPI read, clear for a write
+
+/*
+Registers gives a driver access to the registers of one chip, whichever bus it is on.
+Multi-byte reads and writes start at reg and continue through the following registers.
+Words are big-endian.
+ReadFromRegOnce reads like ReadFromReg, but without letting the bus retry a failed read, for registers
+such as a FIFO where a failed read may already have consumed data.
+*/
+type Registers interface {
+	ReadFromReg(reg byte, value []byte) error
+	ReadFromRegOnce(reg byte, value []byte) error
+	ReadByteFromReg(reg byte) (byte, error)
+	ReadWordFromReg(reg byte) (uint16, error)
+	WriteToReg(reg byte, value []byte) error
+	WriteByteToReg(reg, value byte) error
+}
+
+/*
+I2CBus gives the drivers access to the registers of the chips on an I2C bus.
+Multi-byte reads and writes start at reg and continue through the following registers.
+goflying.I2CBus, i2cdev.Bus and embd.I2CBus all satisfy it; embd's buses need the host drivers that
+importing goflying/embdhost registers.
+*/
+type I2CBus interface {
+	ReadFromReg(addr, reg byte, value []byte) error
+	ReadByteFromReg(addr, reg byte) (byte, error)
+	ReadWordFromReg(addr, reg byte) (uint16, error)
+	WriteToReg(addr, reg byte, value []byte) error
+	WriteByteToReg(addr, reg, value byte) error
+}
+
+// onceReader is implemented by I2C buses that retry failed reads, such as goflying.I2CBus,
+// to read without retrying.
+type onceReader interface {
+	ReadFromRegOnce(addr, reg byte, value []byte) error
+}
+
+// I2CRegisters are the registers of the chip at Address on an I2C bus.
+type I2CRegisters struct {
+	Bus     I2CBus
+	Address byte
+}
+
+// NewI2CRegisters returns the registers of the chip at address on bus.
+func NewI2CRegisters(bus I2CBus, address byte) *I2CRegisters {
+	return &I2CRegisters{Bus: bus, Address: address}
+}
+
+func (r *I2CRegisters) ReadFromReg(reg byte, value []byte) error {
+	return r.Bus.ReadFromReg(r.Address, reg, value)
+}
+
+func (r *I2CRegisters) ReadFromRegOnce(reg byte, value []byte) error {
+	if b, ok := r.Bus.(onceReader); ok {
+		return b.ReadFromRegOnce(r.Address, reg, value)
+	}
+	return r.Bus.ReadFromReg(r.Address, reg, value)
+}
+
+func (r *I2CRegisters) ReadByteFromReg(reg byte) (byte, error) {
+	return r.Bus.ReadByteFromReg(r.Address, reg)
+}
+
+func (r *I2CRegisters) ReadWordFromReg(reg byte) (uint16, error) {
+	return r.Bus.ReadWordFromReg(r.Address, reg)
+}
+
+func (r *I2CRegisters) WriteToReg(reg byte, value []byte) error {
+	return r.Bus.WriteToReg(r.Address, reg, value)
+}
+
+func (r *I2CRegisters) WriteByteToReg(reg, value byte) error {
+	return r.Bus.WriteByteToReg(r.Address, reg, value)
+}
+
+// SPIBus performs full-duplex transfers with one chip, selecting it for the duration of each.
+// embd.SPIBus satisfies it.
+type SPIBus interface {
+	// TransferAndReceiveData sends data and replaces it with the bytes received at the same time.
+	TransferAndReceiveData(data []byte) error
+}
+
+/*
+SPIRegisters are the registers of a chip on an SPI bus.
+The first byte of every transfer is the register address, with bit 7 set for a read and clear for a write,
+so only the low 7 bits of reg are sent: the Bosch chips' registers 0x80 to 0xFF are written as 0x00 to 0x7F.
+InvenSense chips take a burst of data after the address of a write, while Bosch chips need an address
+before each byte written.
+*/
+type SPIRegisters struct {
+	Bus          SPIBus
+	PairedWrites bool // Send an address before each byte written, as for the Bosch chips
+}
+
+// NewInvenSenseSPIRegisters returns the registers of an MPU9250 or ICM20948 on bus.
+func NewInvenSenseSPIRegisters(bus SPIBus) *SPIRegisters {
+	return &SPIRegisters{Bus: bus}
+}
+
+// NewBoschSPIRegisters returns the registers of a BME280 or BMP280 on bus.
+func NewBoschSPIRegisters(bus SPIBus) *SPIRegisters {
+	return &SPIRegisters{Bus: bus, PairedWrites: true}
+}
+
+func (r *SPIRegisters) ReadFromReg(reg byte, value []byte) error {
+	data := make([]byte, len(value)+1)
+	data[0] = reg | spiReadBit
+	if err := r.Bus.TransferAndReceiveData(data); err != nil {
+		return fmt.Errorf("spi: reading from 0x%02X: %w", reg, err)
+	}
+	copy(value, data[1:])
+	return nil
+}
+
+// ReadFromRegOnce is ReadFromReg, as SPI transfers are never retried.
+func (r *SPIRegisters) ReadFromRegOnce(reg byte, value []byte) error {
+	return r.ReadFromReg(reg, value)
+}
+
+func (r *SPIRegisters) ReadByteFromReg(reg byte) (byte, error) {
+	v := make([]byte, 1)
+	err := r.ReadFromReg(reg, v)
+	return v[0], err
+}
+
+func (r *SPIRegisters) ReadWordFromReg(reg byte) (uint16, error) {
+	v := make([]byte, 2)
+	err := r.ReadFromReg(reg, v)
+	return uint16(v[0])<<8 | uint16(v[1]), err
+}
+
+func (r *SPIRegisters) WriteToReg(reg byte, value []byte) error {
+	var data []byte
+	if r.PairedWrites {
+		for i, v := range value {
+			data = append(data, (reg+byte(i))&^spiReadBit, v)
+		}
+	} else {
+		data = append([]byte{reg &^ spiReadBit}, value...)
+	}
+
+	if err := r.Bus.TransferAndReceiveData(data); err != nil {
+		return fmt.Errorf("spi: writing to 0x%02X: %w", reg, err)
+	}
+	return nil
+}
+
+func (r *SPIRegisters) WriteByteToReg(reg, value byte) error {
+	return r.WriteToReg(reg, []byte{value})
+}
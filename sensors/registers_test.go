@@ -0,0 +1,56 @@
+package sensors
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/westphae/goflying/i2ctest"
+)
+
+func TestI2CRegisters(t *testing.T) {
+	b := i2ctest.NewBus()
+	chip := i2ctest.NewRegisters()
+	chip.Set(0x3B, 0x12, 0x34, 0x56)
+	b.Attach(0x68, chip)
+	var r Registers = NewI2CRegisters(b, 0x68)
+
+	if w, err := r.ReadWordFromReg(0x3B); err != nil || w != 0x1234 {
+		t.Errorf("ReadWordFromReg() = %04X, %v, want 1234", w, err)
+	}
+	if err := r.WriteToReg(0x19, []byte{1, 2}); err != nil || !bytes.Equal(chip.Get(0x19, 2), []byte{1, 2}) {
+		t.Errorf("WriteToReg() wrote % X, %v", chip.Get(0x19, 2), err)
+	}
+}
+
+func TestSPIRegisters(t *testing.T) {
+	tests := []struct {
+		name        string
+		bosch       bool
+		reg         byte
+		wantWrite   []byte
+		wantReadReg byte
+	}{
+		{"InvenSense", false, 0x19, []byte{0x19, 1, 2}, 0x99},
+		{"Bosch", true, 0xF4, []byte{0x74, 1, 0x75, 2}, 0xF4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chip := i2ctest.NewRegisters()
+			spi := i2ctest.NewSPI(chip, tt.bosch)
+			r := &SPIRegisters{Bus: spi, PairedWrites: tt.bosch}
+
+			if err := r.WriteToReg(tt.reg, []byte{1, 2}); err != nil || !bytes.Equal(chip.Get(tt.reg, 2), []byte{1, 2}) {
+				t.Errorf("WriteToReg() wrote % X, %v", chip.Get(tt.reg, 2), err)
+			}
+			if w, err := r.ReadWordFromReg(tt.reg); err != nil || w != 0x0102 {
+				t.Errorf("ReadWordFromReg() = %04X, %v, want 0102", w, err)
+			}
+
+			f := spi.Frames()
+			if len(f) != 2 || !bytes.Equal(f[0], tt.wantWrite) || f[1][0] != tt.wantReadReg || len(f[1]) != 3 {
+				t.Errorf("SPI transfers = % X, want % X then %X and 2 bytes", f, tt.wantWrite, tt.wantReadReg)
+			}
+		})
+	}
+}
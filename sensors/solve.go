@@ -0,0 +1,66 @@
+package sensors
+
+import "math"
+
+// solveLinear solves the n linear equations of the augmented n×(n+1) matrix a by Gaussian elimination
+// with partial pivoting, overwriting a.  It returns false if the equations are singular.
+func solveLinear(a [][]float64) ([]float64, bool) {
+	n := len(a)
+	var scale float64
+	for _, row := range a {
+		for _, v := range row[:n] {
+			scale = math.Max(scale, math.Abs(v))
+		}
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) <= 1e-12*scale {
+			return nil, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for r := col + 1; r < n; r++ {
+			f := a[r][col] / a[col][col]
+			for j := col; j <= n; j++ {
+				a[r][j] -= f * a[col][j]
+			}
+		}
+	}
+
+	x := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		s := a[i][n]
+		for j := i + 1; j < n; j++ {
+			s -= a[i][j] * x[j]
+		}
+		x[i] = s / a[i][i]
+	}
+	return x, true
+}
+
+// leastSquares returns the x minimizing |A x - b|, where row k of A is rows[k], by the normal equations.
+// It returns false if the columns of A aren't independent.
+func leastSquares(rows [][]float64, b []float64) ([]float64, bool) {
+	if len(rows) == 0 {
+		return nil, false
+	}
+	n := len(rows[0])
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n+1) // Augmented with the right-hand side
+	}
+	for k, row := range rows {
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				a[i][j] += row[i] * row[j]
+			}
+			a[i][n] += row[i] * b[k]
+		}
+	}
+	return solveLinear(a)
+}
@@ -0,0 +1,126 @@
+package sensors
+
+import (
+	"errors"
+	"math"
+)
+
+// MinTempSweep is the smallest range of die temperatures, in °C, that FitTempBias will fit a model to.
+var MinTempSweep = 1.0
+
+// ErrTempSweep is returned when logged readings don't cover enough temperatures to fit a bias model.
+var ErrTempSweep = errors.New("sensors: readings don't cover enough temperatures to fit a bias model")
+
+/*
+TempBias models how the biases of a 3-axis sensor drift with die temperature.
+Each axis has a polynomial in the difference from a reference temperature T0:
+
+	bias(Temp) = Coeffs[i][0] + Coeffs[i][1]*(Temp-T0) + Coeffs[i][2]*(Temp-T0)^2 + ...
+
+The zero value has no bias at any temperature.
+*/
+type TempBias struct {
+	T0     float64      // Reference temperature, °C
+	Coeffs [3][]float64 // Polynomial coefficients of each axis, constant term first
+}
+
+// Bias returns the bias of each axis at die temperature temp, in °C.
+func (b *TempBias) Bias(temp float64) (b1, b2, b3 float64) {
+	x := temp - b.T0
+	return polyval(b.Coeffs[0], x), polyval(b.Coeffs[1], x), polyval(b.Coeffs[2], x)
+}
+
+func polyval(c []float64, x float64) (y float64) {
+	for i := len(c) - 1; i >= 0; i-- {
+		y = y*x + c[i]
+	}
+	return
+}
+
+/*
+FitTempBias fits polynomials of the given degree to readings logged while the IMU sat still through
+a temperature sweep, such as a cold soak warming up, giving the gyro (°/s) and accelerometer (G) bias models.
+The true rotation is zero, so the gyro model holds the whole bias.  The accelerometer readings also hold
+gravity, in an unknown direction, so its model only holds the drift from the reference temperature and has
+no constant term: the fixed biases come from an accelerometer calibration.
+The reference temperature is the mean of the readings.  Readings with a GAError are skipped.
+The drivers apply GyroTemp, AccelTemp and AccelCal to every reading, so the readings must be logged with them
+cleared, as by ClearForTempSweep: a model fitted to corrected readings only holds what the old one missed.
+*/
+func FitTempBias(data []*IMUData, degree int) (gyro, accel TempBias, err error) {
+	var temps []float64
+	var ys [6][]float64
+	tMin, tMax := math.Inf(1), math.Inf(-1)
+	for _, d := range data {
+		if d.GAError != nil || d.N == 0 {
+			continue
+		}
+		temps = append(temps, d.Temp)
+		for i, v := range [6]float64{d.G1, d.G2, d.G3, d.A1, d.A2, d.A3} {
+			ys[i] = append(ys[i], v)
+		}
+		tMin, tMax = math.Min(tMin, d.Temp), math.Max(tMax, d.Temp)
+	}
+	if degree < 0 || len(temps) <= degree || tMax-tMin < MinTempSweep {
+		return gyro, accel, ErrTempSweep
+	}
+
+	var t0 float64
+	for _, t := range temps {
+		t0 += t
+	}
+	t0 /= float64(len(temps))
+	x := make([]float64, len(temps))
+	for i, t := range temps {
+		x[i] = t - t0
+	}
+
+	gyro.T0, accel.T0 = t0, t0
+	for i := 0; i < 3; i++ {
+		if gyro.Coeffs[i], err = polyfit(x, ys[i], degree); err != nil {
+			return
+		}
+		if accel.Coeffs[i], err = polyfit(x, ys[i+3], degree); err != nil {
+			return
+		}
+		accel.Coeffs[i][0] = 0
+	}
+	return
+}
+
+// polyfit returns the least-squares polynomial of the given degree through the points (x, y).
+func polyfit(x, y []float64, degree int) ([]float64, error) {
+	rows := make([][]float64, len(x))
+	for k := range x {
+		rows[k] = make([]float64, degree+1)
+		p := 1.0
+		for j := range rows[k] {
+			rows[k][j] = p
+			p *= x[k]
+		}
+	}
+	c, ok := leastSquares(rows, y)
+	if !ok {
+		return nil, ErrTempSweep
+	}
+	return c, nil
+}
+
+/*
+ClearForTempSweep clears the corrections that FitTempBias needs the readings logged without: GyroTemp,
+AccelTemp and AccelCal.  It returns the calibration as it was, to restore AccelCal from after the sweep.
+As with CalibrateAccel, stop the IMU before changing its calibration data and restart it to log the sweep.
+*/
+func (c *IMUCalData) ClearForTempSweep() (prev IMUCalData) {
+	prev = *c
+	c.GyroTemp, c.AccelTemp, c.AccelCal = TempBias{}, TempBias{}, AccelCal{}
+	return prev
+}
+
+// CompensateTemp removes the gyro and accelerometer bias drift at the die temperature d.Temp from d.
+func (c *IMUCalData) CompensateTemp(d *IMUData) {
+	g1, g2, g3 := c.GyroTemp.Bias(d.Temp)
+	a1, a2, a3 := c.AccelTemp.Bias(d.Temp)
+	d.G1, d.G2, d.G3 = d.G1-g1, d.G2-g2, d.G3-g3
+	d.A1, d.A2, d.A3 = d.A1-a1, d.A2-a2, d.A3-a3
+}
@@ -0,0 +1,82 @@
+package sensors
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestFitTempBias(t *testing.T) {
+	// Gyro X drifts quadratically and accel Z linearly around 25°C, on top of 1G of gravity
+	var data []*IMUData
+	for temp := 5.0; temp <= 45; temp += 0.5 {
+		x := temp - 25
+		data = append(data, &IMUData{
+			G1: 0.2 + 0.01*x + 0.001*x*x, G2: -0.1,
+			A3:   1 + 0.002*x,
+			Temp: temp, N: 1,
+		})
+	}
+	data = append(data, &IMUData{G1: 100, Temp: 25, GAError: errors.New("bad read")})
+
+	gyro, accel, err := FitTempBias(data, 2)
+	if err != nil {
+		t.Fatalf("FitTempBias() error = %v", err)
+	}
+	if math.Abs(gyro.T0-25) > 1e-9 {
+		t.Errorf("T0 = %f, want 25", gyro.T0)
+	}
+	for _, temp := range []float64{5, 20, 45} {
+		x := temp - 25
+		g1, g2, g3 := gyro.Bias(temp)
+		a1, a2, a3 := accel.Bias(temp)
+		got := [...]float64{g1, g2, g3, a1, a2, a3}
+		want := [...]float64{0.2 + 0.01*x + 0.001*x*x, -0.1, 0, 0, 0, 0.002 * x}
+		for i := range got {
+			if math.Abs(got[i]-want[i]) > 1e-9 {
+				t.Errorf("biases at %.0f°C = %v, want %v", temp, got, want)
+				break
+			}
+		}
+	}
+
+	cal := IMUCalData{GyroTemp: gyro, AccelTemp: accel}
+	d := *data[0]
+	cal.CompensateTemp(&d)
+	if math.Abs(d.G1) > 1e-9 || math.Abs(d.A3-1) > 1e-9 {
+		t.Errorf("compensated G1, A3 = %f, %f, want 0, 1", d.G1, d.A3)
+	}
+}
+
+func TestClearForTempSweep(t *testing.T) {
+	cal := IMUCalData{A01: 1, GyroTemp: TempBias{T0: 25, Coeffs: [3][]float64{{0.2}, {0.1}, {0}}}}
+	cal.AccelTemp.Coeffs[2] = []float64{0, 0.002}
+	cal.AccelCal.B[2] = 0.01
+	prev := cal.ClearForTempSweep()
+
+	d := IMUData{G1: 0.2, A3: 1, Temp: 35, N: 1}
+	cal.CompensateTemp(&d)
+	cal.AccelCal.Correct(&d)
+	if d.G1 != 0.2 || d.A3 != 1 {
+		t.Errorf("G1, A3 = %f, %f after clearing, want the raw 0.2, 1", d.G1, d.A3)
+	}
+	if cal.A01 != 1 || prev.GyroTemp.T0 != 25 || prev.AccelCal.B[2] != 0.01 {
+		t.Errorf("ClearForTempSweep() = %+v, leaving %+v", prev, cal)
+	}
+}
+
+func TestFitTempBiasSweep(t *testing.T) {
+	data := []*IMUData{{Temp: 20, N: 1}, {Temp: 20.5, N: 1}, {Temp: 20.2, N: 1}}
+	if _, _, err := FitTempBias(data, 1); err != ErrTempSweep {
+		t.Errorf("FitTempBias() over 0.5°C error = %v, want ErrTempSweep", err)
+	}
+	data = []*IMUData{{Temp: 20, N: 1}, {Temp: 30, N: 1}}
+	if _, _, err := FitTempBias(data, 2); err != ErrTempSweep {
+		t.Errorf("FitTempBias() of degree 2 to 2 readings error = %v, want ErrTempSweep", err)
+	}
+
+	var zero TempBias
+	if b1, b2, b3 := zero.Bias(40); b1 != 0 || b2 != 0 || b3 != 0 {
+		t.Errorf("zero TempBias has biases %f, %f, %f", b1, b2, b3)
+	}
+}
@@ -30,6 +30,23 @@ func parseFloatArrayString(str string, a *[]float64) (err error) {
 	return
 }
 
+// algoNames lists the registered AHRS algorithms and their config keys.
+func algoNames() string {
+	var names []string
+	for _, a := range ahrs.Algorithms() {
+		var keys []string
+		for _, p := range a.Config {
+			keys = append(keys, fmt.Sprintf("%s=%g [%g, %g]", p.Name, p.Default, p.Min, p.Max))
+		}
+		if len(keys) > 0 {
+			names = append(names, fmt.Sprintf("%s (%s)", a.Name, strings.Join(keys, ", ")))
+		} else {
+			names = append(names, a.Name)
+		}
+	}
+	return strings.Join(names, "; ")
+}
+
 func main() {
 	// Handle some shell arguments
 	var (
@@ -84,7 +101,6 @@ func main() {
 		defaultScenario   = "takeoff"
 		scenarioUsage     = "Scenario to use: filename or \"takeoff\" or \"turn\""
 		defaultAlgo       = "simple"
-		algoUsage         = "Algo to use for AHRS: simple (default), heuristic, kalman, kalman1, kalman2"
 		defaultConfig     = ""
 		configUsage       = "json-formatted map for AHRS Config"
 	)
@@ -114,7 +130,7 @@ func main() {
 	flag.BoolVar(&magInop, "m", defaultMagInop, magInopUsage)
 	flag.StringVar(&scenario, "scenario", defaultScenario, scenarioUsage)
 	flag.StringVar(&scenario, "s", defaultScenario, scenarioUsage)
-	flag.StringVar(&algo, "algo", defaultAlgo, algoUsage)
+	flag.StringVar(&algo, "algo", defaultAlgo, "Algo to use for AHRS: "+algoNames())
 	flag.StringVar(&ahrsConfigStr, "config", defaultConfig, configUsage)
 	flag.StringVar(&ahrsConfigStr, "c", defaultConfig, configUsage)
 	flag.Parse()
@@ -137,20 +153,20 @@ func main() {
 	s0 := new(ahrs.State)      // Actual state from simulation, for comparison
 	m := ahrs.NewMeasurement() // Measurement from IMU
 
+	if err := json.Unmarshal([]byte(ahrsConfigStr), &ahrsConfig); ahrsConfigStr != "" && err != nil {
+		log.Fatalf("Bad config: %s\n", err.Error())
+	}
+	log.Printf("ahrs config: %v\n", ahrsConfig)
+
 	fmt.Println("Simulation parameters:")
-	switch strings.ToLower(algo) {
-	/*
-		case "kalman":
-			fmt.Println("Running Kalman AHRS")
-			ioutil.WriteFile("config.json", []byte(ahrs.KalmanJSONConfig), 0644)
-			s = ahrs.InitializeKalman(m)
-	*/
-	case "simple":
-		fallthrough // simple is the default.
-	default:
-		fmt.Println("Running simple AHRS")
-		ioutil.WriteFile("config.json", []byte(ahrs.SimpleJSONConfig), 0644)
-		s = ahrs.NewSimpleAHRS()
+	algorithm, ok := ahrs.LookupAlgorithm(strings.ToLower(algo))
+	if !ok {
+		log.Fatalf("Unknown AHRS algorithm %s, should be one of: %s\n", algo, algoNames())
+	}
+	fmt.Printf("Running %s AHRS: %s\n", algorithm.Name, algorithm.Description)
+	ioutil.WriteFile("config.json", []byte(algorithm.JSONConfig), 0644)
+	if s, err = ahrs.NewAHRS(algorithm.Name, ahrsConfig); err != nil {
+		log.Fatalln(err)
 	}
 
 	if err := parseFloatArrayString(gyroBiasStr, &gyroBias); err != nil {
@@ -188,12 +204,6 @@ func main() {
 
 	uBias := []float64{asiBias, 0, 0}
 
-	if err := json.Unmarshal([]byte(ahrsConfigStr), &ahrsConfig); err != nil {
-		log.Printf("Bad config: %s\n", err.Error())
-	}
-	log.Printf("ahrs config: %v\n", ahrsConfig)
-	s.SetConfig(ahrsConfig)
-
 	// Set up logging
 	logMap := s.GetLogMap()
 	logMapActual := sit.GetLogMap()
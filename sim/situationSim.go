@@ -171,10 +171,12 @@ func (s *SituationSim) Measurement(t float64, m *ahrs.Measurement,
 	if uValid { // ASI doesn't read U2 or U3
 		m.UValid = true
 		m.U1 = x.U1 + uBias[0] + uNoise*rand.NormFloat64()
+		m.TU = t
 	}
 
 	if wValid {
 		m.WValid = true
+		m.TW = t
 		m.W1 = e11*x.U1 + e12*x.U2 + e13*x.U3 + x.V1 + wNoise*rand.NormFloat64()
 		m.W2 = e21*x.U1 + e22*x.U2 + e23*x.U3 + x.V2 + wNoise*rand.NormFloat64()
 		m.W3 = e31*x.U1 + e32*x.U2 + e33*x.U3 + x.V3 + wNoise*rand.NormFloat64()